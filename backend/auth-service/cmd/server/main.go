@@ -2,17 +2,20 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/hosterizer/auth-service/internal/handler"
 	"github.com/hosterizer/auth-service/internal/repository"
 	"github.com/hosterizer/auth-service/internal/service"
+	"github.com/hosterizer/shared/audit"
 	"github.com/hosterizer/shared/database"
 )
 
@@ -21,9 +24,24 @@ func main() {
 
 	// Load configuration from environment
 	dbConfig := loadDBConfig()
-	jwtSecret := getEnv("JWT_SECRET", "your-secret-key-change-in-production")
+	signingKeyFile := getEnv("JWT_SIGNING_KEY_FILE", "")
+	verificationKeyFiles := getEnvAsList("JWT_VERIFICATION_KEY_FILES")
 	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
 	redisPassword := getEnv("REDIS_PASSWORD", "")
+	sessionStore := getEnv("SESSION_STORE", "redis")
+	sessionStoreFailOpen := getEnv("SESSION_STORE_FAIL_OPEN", "false") == "true"
+	webauthnRPID := getEnv("WEBAUTHN_RP_ID", "localhost")
+	webauthnOrigins := getEnvAsList("WEBAUTHN_RP_ORIGINS")
+	if len(webauthnOrigins) == 0 {
+		webauthnOrigins = []string{"http://localhost:3000", "http://localhost:3001"}
+	}
+	appBaseURL := getEnv("APP_BASE_URL", "http://localhost:3001")
+	authBaseURL := getEnv("AUTH_BASE_URL", "http://localhost:8001")
+	trustedProxies, err := handler.ParseTrustedProxies(getEnvAsList("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Failed to parse TRUSTED_PROXIES: %v", err)
+	}
+	auditRetentionDays := getEnvAsInt("AUDIT_RETENTION_DAYS", 90)
 	port := getEnv("PORT", "8001")
 
 	// Initialize database connection
@@ -35,47 +53,188 @@ func main() {
 
 	log.Println("Database connection established")
 
+	// Purge the platform audit log past its retention period. Every replica runs
+	// the job; an advisory lock lets only one of them purge at a time.
+	go audit.RunRetention(context.Background(), db.DB, audit.RetentionConfig{
+		Retention: time.Duration(auditRetentionDays) * 24 * time.Hour,
+	})
+
 	// Initialize repositories
 	userRepo := repository.NewPostgresUserRepository(db.DB)
+	refreshTokenRepo := repository.NewPostgresRefreshTokenRepository(db.DB)
+	customerRepo := repository.NewPostgresCustomerRepository(db.DB)
+	membershipRepo := repository.NewPostgresMembershipRepository(db.DB)
+	recoveryCodeRepo := repository.NewPostgresMFARecoveryCodeRepository(db.DB)
+	webauthnCredentialRepo := repository.NewPostgresWebAuthnCredentialRepository(db.DB)
+	accountTokenRepo := repository.NewPostgresAccountTokenRepository(db.DB)
+	invitationRepo := repository.NewPostgresInvitationRepository(db.DB)
+	ssoIdentityRepo := repository.NewPostgresSSOIdentityRepository(db.DB)
+	apiKeyRepo := repository.NewPostgresAPIKeyRepository(db.DB)
+	authEventRepo := repository.NewPostgresAuthEventRepository(db.DB)
 
 	// Initialize services
-	passwordSvc := service.NewPasswordService()
+	passwordSvc := service.NewPasswordService(service.PasswordConfig{
+		MinLength:    getEnvAsInt("PASSWORD_MIN_LENGTH", service.MinPasswordLength),
+		MinScore:     getEnvAsInt("PASSWORD_MIN_SCORE", service.DefaultPasswordMinScore),
+		BreachCorpus: loadBreachCorpus(),
+		Argon2: service.Argon2Params{
+			Memory:      uint32(getEnvAsInt("PASSWORD_ARGON2_MEMORY", service.DefaultArgon2Memory)),
+			Iterations:  uint32(getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", service.DefaultArgon2Iterations)),
+			Parallelism: uint8(getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", service.DefaultArgon2Parallelism)),
+		},
+	})
+	sessionSvc := service.NewSessionService(service.SessionConfig{
+		Store:          loadSessionStore(sessionStore, db.DB, redisAddr, redisPassword),
+		SessionTimeout: 30 * time.Minute,
+		FailOpen:       sessionStoreFailOpen,
+	})
+	defer sessionSvc.Close()
+
+	// An unavailable session store does not stop the service from starting; requests
+	// that need it fail until it is back, see SessionService
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := sessionSvc.Ping(pingCtx); err != nil {
+		log.Printf("WARNING: %v, starting anyway", err)
+	}
+	cancelPing()
+
+	keySet, err := loadKeySet(signingKeyFile, verificationKeyFiles)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
 	jwtSvc := service.NewJWTService(service.JWTConfig{
-		SecretKey:            jwtSecret,
+		Keys:                 keySet,
 		AccessTokenDuration:  15 * time.Minute,
 		RefreshTokenDuration: 7 * 24 * time.Hour,
+		Denylist:             sessionSvc,
+		Sessions:             sessionSvc,
 	})
-	mfaSvc := service.NewMFAService("Hosterizer")
-	lockoutSvc := service.NewLockoutService(userRepo, service.LockoutConfig{
-		MaxFailedAttempts: 3,
-		LockoutDuration:   15 * time.Minute,
+	authEvents := service.NewRepositoryEventRecorder(authEventRepo)
+	refreshSvc := service.NewRefreshTokenService(refreshTokenRepo, jwtSvc)
+	tenantSvc := service.NewTenantService(membershipRepo)
+	membershipSvc := service.NewMembershipService(membershipRepo, customerRepo, userRepo)
+	mfaSvc := service.NewMFAService(service.MFAConfig{
+		Issuer: "Hosterizer",
+		Steps:  userRepo,
 	})
-	sessionSvc, err := service.NewSessionService(service.SessionConfig{
-		RedisAddr:      redisAddr,
-		RedisPassword:  redisPassword,
-		RedisDB:        0,
-		SessionTimeout: 30 * time.Minute,
+	recoverySvc := service.NewRecoveryCodeService(recoveryCodeRepo)
+	webauthnSvc, err := service.NewWebAuthnService(service.WebAuthnConfig{
+		RPID:          webauthnRPID,
+		RPDisplayName: "Hosterizer",
+		RPOrigins:     webauthnOrigins,
+		Credentials:   webauthnCredentialRepo,
+		Users:         userRepo,
+		Ceremonies:    sessionSvc,
 	})
 	if err != nil {
-		log.Fatalf("Failed to initialize session service: %v", err)
+		log.Fatalf("Failed to initialize WebAuthn service: %v", err)
 	}
-	defer sessionSvc.Close()
+	lockoutSvc := service.NewLockoutService(userRepo, service.LockoutConfig{
+		MaxFailedAttempts: 10,
+		LockoutDuration:   15 * time.Minute,
+		MFAAttempts:       sessionSvc,
+		MaxMFAAttempts:    5,
+		Events:            authEvents,
+	})
+	loginThrottle := service.NewLoginThrottle(service.ThrottleConfig{
+		Failures:           sessionSvc,
+		Window:             15 * time.Minute,
+		EmailFreeFailures:  3,
+		IPFreeFailures:     10,
+		MaxIPFailures:      100,
+		MaxEmailIPFailures: 10,
+	})
 
 	authSvc := service.NewAuthService(service.AuthServiceConfig{
 		UserRepo:    userRepo,
 		PasswordSvc: passwordSvc,
 		JWTSvc:      jwtSvc,
 		MFASvc:      mfaSvc,
+		RecoverySvc: recoverySvc,
+		WebAuthnSvc: webauthnSvc,
 		LockoutSvc:  lockoutSvc,
 		SessionSvc:  sessionSvc,
+		RefreshSvc:  refreshSvc,
+		TenantSvc:   tenantSvc,
+		Throttle:    loginThrottle,
+		Events:      authEvents,
+	})
+	mailer := loadMailer()
+	accountSvc := service.NewAccountService(service.AccountConfig{
+		UserRepo:       userRepo,
+		TokenRepo:      accountTokenRepo,
+		MembershipRepo: membershipRepo,
+		PasswordSvc:    passwordSvc,
+		LockoutSvc:     lockoutSvc,
+		Mailer:         mailer,
+		Sessions:       authSvc,
+		BaseURL:        appBaseURL,
+	})
+	invitationSvc := service.NewInvitationService(service.InvitationConfig{
+		InvitationRepo: invitationRepo,
+		MembershipRepo: membershipRepo,
+		CustomerRepo:   customerRepo,
+		UserRepo:       userRepo,
+		PasswordSvc:    passwordSvc,
+		JWTSvc:         jwtSvc,
+		Mailer:         mailer,
+		BaseURL:        appBaseURL,
+	})
+	ssoSvc := service.NewSSOService(service.SSOConfig{
+		CustomerRepo:   customerRepo,
+		UserRepo:       userRepo,
+		MembershipRepo: membershipRepo,
+		IdentityRepo:   ssoIdentityRepo,
+		Store:          sessionSvc,
+		Logins:         authSvc,
+		BaseURL:        authBaseURL,
+	})
+	apiKeySvc := service.NewAPIKeyService(service.APIKeyConfig{
+		APIKeyRepo:     apiKeyRepo,
+		UserRepo:       userRepo,
+		CustomerRepo:   customerRepo,
+		MembershipRepo: membershipRepo,
+		TenantSvc:      tenantSvc,
+	})
+	authEventSvc := service.NewAuthEventService(service.AuthEventConfig{
+		EventRepo:      authEventRepo,
+		MembershipRepo: membershipRepo,
+	})
+	adminSvc := service.NewAdminService(service.AdminConfig{
+		UserRepo:   userRepo,
+		LockoutSvc: lockoutSvc,
+		AccountSvc: accountSvc,
+		MFA:        authSvc,
+		Sessions:   authSvc,
+		Throttle:   loginThrottle,
+		Events:     authEvents,
 	})
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(authSvc, jwtSvc)
+	membershipHandler := handler.NewMembershipHandler(membershipSvc, jwtSvc)
+	jwksHandler := handler.NewJWKSHandler(jwtSvc)
+	webauthnHandler := handler.NewWebAuthnHandler(webauthnSvc, authSvc, jwtSvc, authEvents)
+	accountHandler := handler.NewAccountHandler(accountSvc, jwtSvc)
+	adminHandler := handler.NewAdminHandler(adminSvc, jwtSvc)
+	invitationHandler := handler.NewInvitationHandler(invitationSvc, jwtSvc)
+	ssoHandler := handler.NewSSOHandler(ssoSvc, authEvents, appBaseURL)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeySvc, jwtSvc)
+	authEventHandler := handler.NewAuthEventHandler(authEventSvc, jwtSvc)
 
 	// Setup HTTP server
 	mux := http.NewServeMux()
 	authHandler.RegisterRoutes(mux)
+	membershipHandler.RegisterRoutes(mux)
+	jwksHandler.RegisterRoutes(mux)
+	webauthnHandler.RegisterRoutes(mux)
+	accountHandler.RegisterRoutes(mux)
+	adminHandler.RegisterRoutes(mux)
+	invitationHandler.RegisterRoutes(mux)
+	ssoHandler.RegisterRoutes(mux)
+	apiKeyHandler.RegisterRoutes(mux)
+	authEventHandler.RegisterRoutes(mux)
 
 	// Add health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -83,9 +242,23 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Add readiness endpoint, which fails while the session store is unavailable
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		if err := sessionSvc.Ping(ctx); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
 	server := &http.Server{
 		Addr:         ":" + port,
-		Handler:      mux,
+		Handler:      audit.RequestID()(handler.WithRequestInfo(mux, trustedProxies)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -132,6 +305,83 @@ func loadDBConfig() database.Config {
 	}
 }
 
+// loadKeySet loads the JWT keys from PEM files. Without a signing key file an
+// ephemeral key is generated, which is only suitable for local development.
+func loadKeySet(signingKeyFile string, verificationKeyFiles []string) (*service.KeySet, error) {
+	if signingKeyFile == "" {
+		log.Println("WARNING: JWT_SIGNING_KEY_FILE not set, generating an ephemeral signing key")
+		return service.GenerateKeySet()
+	}
+	return service.LoadKeySet(signingKeyFile, verificationKeyFiles)
+}
+
+// loadMailer returns an SMTP mailer. Without SMTP_HOST emails are written to the
+// log instead, which is only suitable for local development.
+func loadMailer() service.Mailer {
+	host := getEnv("SMTP_HOST", "")
+	if host == "" {
+		log.Println("WARNING: SMTP_HOST not set, emails will be written to the log")
+		return service.NewLogMailer()
+	}
+	return service.NewSMTPMailer(service.SMTPConfig{
+		Host:     host,
+		Port:     getEnvAsInt("SMTP_PORT", 587),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("SMTP_FROM", "Hosterizer <no-reply@hosterizer.local>"),
+	})
+}
+
+// loadSessionStore returns the session store selected by SESSION_STORE: redis,
+// postgres or memory. The in-memory store is only suitable for local development
+// with a single instance, as it is neither persistent nor shared.
+func loadSessionStore(kind string, db *sql.DB, redisAddr, redisPassword string) service.SessionStore {
+	switch kind {
+	case "redis":
+		return service.NewRedisSessionStore(service.RedisConfig{
+			Addr:     redisAddr,
+			Password: redisPassword,
+		})
+	case "postgres":
+		store := service.NewPostgresSessionStore(db)
+		go purgeSessionStore(store, 10*time.Minute)
+		return store
+	case "memory":
+		log.Println("WARNING: SESSION_STORE is memory, sessions are lost on restart and not shared between instances")
+		return service.NewMemorySessionStore()
+	default:
+		log.Fatalf("Unknown SESSION_STORE %q, expected redis, postgres or memory", kind)
+		return nil
+	}
+}
+
+// purgeSessionStore periodically deletes expired rows of the PostgreSQL session store
+func purgeSessionStore(store *service.PostgresSessionStore, interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if _, err := store.PurgeExpired(ctx); err != nil {
+			log.Printf("Failed to purge session store: %v", err)
+		}
+		cancel()
+	}
+}
+
+// loadBreachCorpus opens the local breached password corpus, a file of SHA-1
+// hashes or a directory of range files
+func loadBreachCorpus() service.BreachCorpus {
+	path := getEnv("PASSWORD_BREACH_CORPUS", "")
+	if path == "" {
+		log.Println("WARNING: PASSWORD_BREACH_CORPUS not set, breached passwords will not be rejected")
+		return nil
+	}
+
+	corpus, err := service.OpenBreachCorpus(path)
+	if err != nil {
+		log.Fatalf("Failed to load breached password corpus: %v", err)
+	}
+	return corpus
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -148,3 +398,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
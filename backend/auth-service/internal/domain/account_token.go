@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+)
+
+// AccountTokenPurpose represents what an emailed account token may be used for
+type AccountTokenPurpose string
+
+const (
+	TokenPurposePasswordReset     AccountTokenPurpose = "password_reset"
+	TokenPurposeEmailVerification AccountTokenPurpose = "email_verification"
+)
+
+// AccountToken represents a single-use token sent to a user by email to reset
+// their password or verify their email address. Only its hash is stored.
+type AccountToken struct {
+	ID        int64
+	UserID    int64
+	Purpose   AccountTokenPurpose
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// IsUsed checks if the token has already been redeemed
+func (t *AccountToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
+
+// IsExpired checks if the token has expired
+func (t *AccountToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"time"
+)
+
+// APIKeyStatus represents where an API key is in its lifecycle
+type APIKeyStatus string
+
+const (
+	APIKeyStatusActive  APIKeyStatus = "active"
+	APIKeyStatusRevoked APIKeyStatus = "revoked"
+	APIKeyStatusExpired APIKeyStatus = "expired"
+)
+
+// APIKey represents a long-lived, scoped credential for automation. A personal
+// access token acts as the user it belongs to; a service key has no user and acts
+// on behalf of its customer. Only a hash of the key is stored.
+type APIKey struct {
+	ID         int64
+	UUID       string
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	UserID     *int64
+	CustomerID *int64
+	CreatedBy  *int64
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// IsService checks if the key is a service key of a customer rather than a personal access token
+func (k *APIKey) IsService() bool {
+	return k.UserID == nil
+}
+
+// IsExpired checks if the key has expired
+func (k *APIKey) IsExpired() bool {
+	return time.Now().After(k.ExpiresAt)
+}
+
+// IsActive checks if the key can still be used
+func (k *APIKey) IsActive() bool {
+	return k.Status() == APIKeyStatusActive
+}
+
+// Status returns the lifecycle status of the key
+func (k *APIKey) Status() APIKeyStatus {
+	switch {
+	case k.RevokedAt != nil:
+		return APIKeyStatusRevoked
+	case k.IsExpired():
+		return APIKeyStatusExpired
+	}
+	return APIKeyStatusActive
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"time"
+)
+
+// AuthEventOutcome tells whether an authentication attempt succeeded
+type AuthEventOutcome string
+
+const (
+	AuthEventSuccess AuthEventOutcome = "success"
+	AuthEventFailure AuthEventOutcome = "failure"
+)
+
+// AuthEvent is an entry of the authentication audit log. Entries are never
+// changed or deleted, and outlive the users they refer to.
+type AuthEvent struct {
+	ID      int64
+	Type    string
+	Outcome AuthEventOutcome
+
+	// UserID is the user the event is about; nil when no user matched
+	UserID *int64
+
+	// ActorID is the user who caused the event, if not the user themselves
+	ActorID *int64
+
+	// CustomerID is the tenant the event happened in; nil before a tenant is known
+	CustomerID *int64
+
+	Email      string
+	IPAddress  string
+	UserAgent  string
+	Reason     string
+	OccurredAt time.Time
+}
+
+// AuthEventFilter narrows down a list of auth events. Nil and empty fields match
+// every event.
+type AuthEventFilter struct {
+	UserID *int64
+
+	// CustomerID limits the events to those in the customer's tenant, plus the
+	// events of its members that happened outside any tenant, such as failed logins
+	CustomerID *int64
+
+	Types []string
+	Since *time.Time
+	Until *time.Time
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"time"
+)
+
+// InvitationStatus represents where an invitation is in its lifecycle
+type InvitationStatus string
+
+const (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+	InvitationStatusRevoked  InvitationStatus = "revoked"
+	InvitationStatusExpired  InvitationStatus = "expired"
+)
+
+// Invitation represents an invitation for a new user to join a customer tenant.
+// The invitee receives a signed link carrying the invitation UUID.
+type Invitation struct {
+	ID             int64
+	UUID           string
+	CustomerID     int64
+	Email          string
+	Role           MembershipRole
+	InvitedBy      *int64
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	AcceptedUserID *int64
+	RevokedAt      *time.Time
+	CreatedAt      time.Time
+}
+
+// IsExpired checks if the invitation has expired
+func (i *Invitation) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
+
+// IsPending checks if the invitation can still be accepted
+func (i *Invitation) IsPending() bool {
+	return i.Status() == InvitationStatusPending
+}
+
+// Status returns the lifecycle status of the invitation
+func (i *Invitation) Status() InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case i.IsExpired():
+		return InvitationStatusExpired
+	}
+	return InvitationStatusPending
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"time"
+)
+
+// MembershipRole represents a user's role within a customer tenant
+type MembershipRole string
+
+const (
+	MembershipRoleOwner     MembershipRole = "owner"
+	MembershipRoleDeveloper MembershipRole = "developer"
+	MembershipRoleBilling   MembershipRole = "billing"
+	MembershipRoleReadOnly  MembershipRole = "read_only"
+)
+
+// IsValid checks if the membership role is one of the known roles
+func (r MembershipRole) IsValid() bool {
+	switch r {
+	case MembershipRoleOwner, MembershipRoleDeveloper, MembershipRoleBilling, MembershipRoleReadOnly:
+		return true
+	}
+	return false
+}
+
+// CustomerMembership links a user to a customer tenant with a per-tenant role
+type CustomerMembership struct {
+	ID         int64
+	CustomerID int64
+	UserID     int64
+	Role       MembershipRole
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	// Customer is populated when memberships are listed for a user
+	Customer *Customer
+
+	// User is populated when memberships are listed for a customer
+	User *User
+}
+
+// IsOwner checks if the membership grants owner rights on the customer
+func (m *CustomerMembership) IsOwner() bool {
+	return m.Role == MembershipRoleOwner
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"time"
+)
+
+// MFARecoveryCode represents a single-use MFA recovery code. Only its hash is stored.
+type MFARecoveryCode struct {
+	ID        int64
+	UserID    int64
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// IsUsed checks if the recovery code has already been redeemed
+func (c *MFARecoveryCode) IsUsed() bool {
+	return c.UsedAt != nil
+}
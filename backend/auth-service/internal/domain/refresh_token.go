@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+)
+
+// RefreshToken represents an issued refresh token tracked for rotation
+type RefreshToken struct {
+	ID        int64
+	JTI       string
+	FamilyID  string
+	UserID    int64
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// IsUsed checks if the refresh token has already been exchanged
+func (t *RefreshToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
+
+// IsRevoked checks if the refresh token has been revoked
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
@@ -15,6 +15,57 @@ var (
 
 	// ErrInvalidCredentials is returned when login credentials are invalid
 	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrRefreshTokenNotFound is returned when a refresh token is not found
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+	// ErrRefreshTokenUsed is returned when a refresh token has already been exchanged
+	ErrRefreshTokenUsed = errors.New("refresh token already used")
+
+	// ErrRefreshTokenRevoked is returned when a refresh token has been revoked
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+
+	// ErrCustomerNotFound is returned when a customer is not found
+	ErrCustomerNotFound = errors.New("customer not found")
+
+	// ErrMembershipNotFound is returned when a customer membership is not found
+	ErrMembershipNotFound = errors.New("membership not found")
+
+	// ErrMembershipAlreadyExists is returned when a user already belongs to a customer
+	ErrMembershipAlreadyExists = errors.New("membership already exists")
+
+	// ErrLastOwner is returned when a change would leave a customer without an owner
+	ErrLastOwner = errors.New("customer must keep at least one owner")
+
+	// ErrMFACodeReplayed is returned when a TOTP time step has already been used
+	ErrMFACodeReplayed = errors.New("MFA code already used")
+
+	// ErrRecoveryCodeNotFound is returned when no unused recovery code matches
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+
+	// ErrWebAuthnCredentialNotFound is returned when a WebAuthn credential is not found
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+
+	// ErrWebAuthnCredentialAlreadyExists is returned when a credential ID is already registered
+	ErrWebAuthnCredentialAlreadyExists = errors.New("webauthn credential already exists")
+
+	// ErrAccountTokenNotFound is returned when no unused, unexpired account token matches
+	ErrAccountTokenNotFound = errors.New("account token not found")
+
+	// ErrInvitationNotFound is returned when an invitation is not found
+	ErrInvitationNotFound = errors.New("invitation not found")
+
+	// ErrInvitationAlreadyExists is returned when an address already has an open invitation to a customer
+	ErrInvitationAlreadyExists = errors.New("invitation already exists")
+
+	// ErrSSOIdentityNotFound is returned when no user is linked to an identity provider subject
+	ErrSSOIdentityNotFound = errors.New("sso identity not found")
+
+	// ErrSSOIdentityAlreadyExists is returned when an identity provider subject is already linked to a user
+	ErrSSOIdentityAlreadyExists = errors.New("sso identity already exists")
+
+	// ErrAPIKeyNotFound is returned when an API key is not found
+	ErrAPIKeyNotFound = errors.New("api key not found")
 )
 
 // UserRepository defines the interface for user data access
@@ -37,12 +88,220 @@ type UserRepository interface {
 	// Delete deletes a user by ID
 	Delete(ctx context.Context, id int64) error
 
+	// List returns up to limit users matching the filter with an ID greater than
+	// afterID, ordered by ID
+	List(ctx context.Context, filter UserFilter, afterID int64, limit int) ([]*User, error)
+
+	// Count returns the number of users matching the filter
+	Count(ctx context.Context, filter UserFilter) (int, error)
+
 	// UpdateFailedAttempts updates the failed login attempts and lock status
 	UpdateFailedAttempts(ctx context.Context, id int64, attempts int, lockedUntil *time.Time) error
 
+	// IncrementFailedAttempts atomically counts a failed login attempt. Reaching
+	// maxAttempts locks the account for lockoutDuration unless it is locked already.
+	// The count starts over once a lock has expired.
+	IncrementFailedAttempts(ctx context.Context, id int64, maxAttempts int, lockoutDuration time.Duration) (*FailedAttempt, error)
+
+	// LockAccount locks a user for lockoutDuration from now without touching the
+	// failed attempt count, and returns the end of the lock. A lock that ends
+	// later is kept.
+	LockAccount(ctx context.Context, id int64, lockoutDuration time.Duration) (*time.Time, error)
+
 	// UpdateLastLogin updates the last login timestamp
 	UpdateLastLogin(ctx context.Context, id int64) error
 
 	// UpdateMFASecret updates the MFA secret for a user
 	UpdateMFASecret(ctx context.Context, id int64, secret string, enabled bool) error
+
+	// UpdateMFALastUsedStep records the last accepted TOTP time step. It fails with
+	// ErrMFACodeReplayed unless step is newer than the recorded one.
+	UpdateMFALastUsedStep(ctx context.Context, id int64, step int64) error
+
+	// UpdatePassword replaces the password hash of a user and atomically moves the
+	// old hash to the password history, keeping only the newest historySize entries
+	UpdatePassword(ctx context.Context, id int64, passwordHash string, historySize int) error
+
+	// UpdatePasswordHash replaces a password hash with a new hash of the same
+	// password, e.g. with a stronger algorithm. Nothing else is changed, and nothing
+	// at all if the password was changed since oldHash was read.
+	UpdatePasswordHash(ctx context.Context, id int64, oldHash, newHash string) error
+
+	// ListPasswordHistory returns up to limit hashes of replaced passwords, newest first
+	ListPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error)
+
+	// MarkEmailVerified records that a user confirmed their email address.
+	// An existing verification timestamp is kept.
+	MarkEmailVerified(ctx context.Context, id int64) error
+}
+
+// RefreshTokenRepository defines the interface for refresh token data access
+type RefreshTokenRepository interface {
+	// Create records a newly issued refresh token
+	Create(ctx context.Context, token *RefreshToken) error
+
+	// Consume atomically marks an unused, unrevoked token as used and returns it.
+	// If the token was already used it returns the token together with ErrRefreshTokenUsed.
+	Consume(ctx context.Context, jti string) (*RefreshToken, error)
+
+	// RevokeFamily revokes every token in a token family
+	RevokeFamily(ctx context.Context, familyID string) error
+
+	// RevokeAllForUser revokes every token issued to a user
+	RevokeAllForUser(ctx context.Context, userID int64) error
+
+	// RevokeOtherFamilies revokes every token issued to a user outside the given family
+	RevokeOtherFamilies(ctx context.Context, userID int64, familyID string) error
+}
+
+// CustomerRepository defines the interface for customer data access
+type CustomerRepository interface {
+	// GetByID retrieves a customer by ID
+	GetByID(ctx context.Context, id int64) (*Customer, error)
+
+	// GetByUUID retrieves a customer by UUID
+	GetByUUID(ctx context.Context, uuid string) (*Customer, error)
+}
+
+// MembershipRepository defines the interface for customer membership data access
+type MembershipRepository interface {
+	// Create adds a user to a customer
+	Create(ctx context.Context, membership *CustomerMembership) error
+
+	// Get retrieves the membership of a user in a customer
+	Get(ctx context.Context, customerID, userID int64) (*CustomerMembership, error)
+
+	// ListByUser returns every membership of a user with its customer, oldest first
+	ListByUser(ctx context.Context, userID int64) ([]*CustomerMembership, error)
+
+	// ListByCustomer returns every membership of a customer with its user, oldest first
+	ListByCustomer(ctx context.Context, customerID int64) ([]*CustomerMembership, error)
+
+	// UpdateRole changes the role of a user in a customer. It returns ErrLastOwner
+	// instead of demoting the customer's only owner.
+	UpdateRole(ctx context.Context, customerID, userID int64, role MembershipRole) error
+
+	// Delete removes a user from a customer. It returns ErrLastOwner instead of
+	// removing the customer's only owner.
+	Delete(ctx context.Context, customerID, userID int64) error
+}
+
+// MFARecoveryCodeRepository defines the interface for MFA recovery code data access
+type MFARecoveryCodeRepository interface {
+	// ReplaceForUser atomically replaces all recovery codes of a user with the given hashes
+	ReplaceForUser(ctx context.Context, userID int64, codeHashes []string) error
+
+	// Consume atomically marks an unused recovery code as used.
+	// It returns ErrRecoveryCodeNotFound if no unused code has the given hash.
+	Consume(ctx context.Context, userID int64, codeHash string) error
+
+	// CountUnused returns the number of recovery codes a user has left
+	CountUnused(ctx context.Context, userID int64) (int, error)
+
+	// DeleteForUser deletes all recovery codes of a user
+	DeleteForUser(ctx context.Context, userID int64) error
+}
+
+// WebAuthnCredentialRepository defines the interface for WebAuthn credential data access
+type WebAuthnCredentialRepository interface {
+	// Create registers a new credential
+	Create(ctx context.Context, credential *WebAuthnCredential) error
+
+	// ListByUser retrieves all credentials of a user
+	ListByUser(ctx context.Context, userID int64) ([]*WebAuthnCredential, error)
+
+	// UpdateAfterLogin stores the signature counter and backup state reported by a
+	// successful assertion and sets the last used timestamp
+	UpdateAfterLogin(ctx context.Context, id int64, signCount uint32, backupState bool) error
+
+	// Delete deletes a credential of a user
+	Delete(ctx context.Context, userID int64, id int64) error
+}
+
+// AccountTokenRepository defines the interface for password reset and email verification token data access
+type AccountTokenRepository interface {
+	// Create records a newly issued token
+	Create(ctx context.Context, token *AccountToken) error
+
+	// Find retrieves an unused, unexpired token without redeeming it.
+	// It returns ErrAccountTokenNotFound if no such token has the given hash and purpose.
+	Find(ctx context.Context, purpose AccountTokenPurpose, tokenHash string) (*AccountToken, error)
+
+	// Consume atomically marks an unused, unexpired token as used and returns it.
+	// It returns ErrAccountTokenNotFound if no such token has the given hash and purpose.
+	Consume(ctx context.Context, purpose AccountTokenPurpose, tokenHash string) (*AccountToken, error)
+
+	// DeleteForUser deletes every token of a user issued for the given purpose
+	DeleteForUser(ctx context.Context, userID int64, purpose AccountTokenPurpose) error
+}
+
+// InvitationRepository defines the interface for customer invitation data access
+type InvitationRepository interface {
+	// Create records a new invitation. It returns ErrInvitationAlreadyExists if the
+	// address already has an unaccepted, unrevoked invitation to the customer.
+	Create(ctx context.Context, invitation *Invitation) error
+
+	// GetByUUID retrieves an invitation by UUID
+	GetByUUID(ctx context.Context, uuid string) (*Invitation, error)
+
+	// ListByCustomer returns every invitation of a customer, newest first
+	ListByCustomer(ctx context.Context, customerID int64) ([]*Invitation, error)
+
+	// Revoke revokes a pending invitation of a customer.
+	// It returns ErrInvitationNotFound if no such pending invitation exists.
+	Revoke(ctx context.Context, customerID, id int64) error
+
+	// Accept atomically marks a pending, unexpired invitation as accepted by a user.
+	// It returns ErrInvitationNotFound if no such invitation has the given UUID.
+	Accept(ctx context.Context, uuid string, userID int64) error
+}
+
+// SSOIdentityRepository defines the interface for single sign-on identity data access
+type SSOIdentityRepository interface {
+	// Create links an identity provider subject to a user
+	Create(ctx context.Context, identity *SSOIdentity) error
+
+	// Get retrieves the identity of a subject at a customer's identity provider
+	Get(ctx context.Context, customerID int64, subject string) (*SSOIdentity, error)
+
+	// UpdateLastLogin updates the last login timestamp of an identity
+	UpdateLastLogin(ctx context.Context, id int64) error
+}
+
+// APIKeyRepository defines the interface for API key data access
+type APIKeyRepository interface {
+	// Create stores a new API key
+	Create(ctx context.Context, key *APIKey) error
+
+	// GetByHash retrieves an API key by the hash of the key
+	GetByHash(ctx context.Context, keyHash string) (*APIKey, error)
+
+	// GetByID retrieves an API key by ID
+	GetByID(ctx context.Context, id int64) (*APIKey, error)
+
+	// ListByUser returns the personal access tokens of a user, newest first
+	ListByUser(ctx context.Context, userID int64) ([]*APIKey, error)
+
+	// ListByCustomer returns the keys scoped to a customer, newest first: its
+	// service keys and the personal access tokens of its members
+	ListByCustomer(ctx context.Context, customerID int64) ([]*APIKey, error)
+
+	// Revoke revokes an API key.
+	// It returns ErrAPIKeyNotFound if no unrevoked key has the given ID.
+	Revoke(ctx context.Context, id int64) error
+
+	// UpdateLastUsed records that a key was used. Updates within a minute of the
+	// last one are skipped, so busy keys do not cause a write per request.
+	UpdateLastUsed(ctx context.Context, id int64) error
+}
+
+// AuthEventRepository defines the interface for the authentication audit log,
+// which can only be appended to
+type AuthEventRepository interface {
+	// Create appends an event to the log
+	Create(ctx context.Context, event *AuthEvent) error
+
+	// List returns up to limit events matching the filter with an ID less than
+	// beforeID, newest first. A beforeID of zero starts at the newest event.
+	List(ctx context.Context, filter AuthEventFilter, beforeID int64, limit int) ([]*AuthEvent, error)
 }
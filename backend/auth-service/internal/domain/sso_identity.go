@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"time"
+)
+
+// SSOIdentity links a subject at a customer's identity provider to a user
+type SSOIdentity struct {
+	ID          int64
+	CustomerID  int64
+	Subject     string
+	UserID      int64
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
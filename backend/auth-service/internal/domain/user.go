@@ -17,6 +17,7 @@ type User struct {
 	ID                  int64
 	UUID                string
 	Email               string
+	EmailVerifiedAt     *time.Time
 	PasswordHash        string
 	FirstName           string
 	LastName            string
@@ -30,6 +31,13 @@ type User struct {
 	UpdatedAt           time.Time
 }
 
+// UserFilter narrows down a list of users. Nil fields match every user.
+type UserFilter struct {
+	Role       *UserRole
+	Locked     *bool
+	MFAEnabled *bool
+}
+
 // IsLocked checks if the user account is currently locked
 func (u *User) IsLocked() bool {
 	if u.LockedUntil == nil {
@@ -38,11 +46,26 @@ func (u *User) IsLocked() bool {
 	return time.Now().Before(*u.LockedUntil)
 }
 
+// HasPassword checks if the user has a password. Invited users and users whose
+// password was reset by an administrator have none until they choose one.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
 // CanLogin checks if the user can attempt to login
 func (u *User) CanLogin() bool {
 	return !u.IsLocked()
 }
 
+// FailedAttempt is the state of an account after a failed login attempt was counted
+type FailedAttempt struct {
+	Attempts    int
+	LockedUntil *time.Time
+
+	// Locked reports whether this attempt locked the account
+	Locked bool
+}
+
 // IncrementFailedAttempts increments the failed login attempts counter
 func (u *User) IncrementFailedAttempts() {
 	u.FailedLoginAttempts++
@@ -60,6 +83,11 @@ func (u *User) LockAccount(duration time.Duration) {
 	u.LockedUntil = &lockUntil
 }
 
+// IsEmailVerified checks if the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 // UpdateLastLogin updates the last login timestamp
 func (u *User) UpdateLastLogin() {
 	now := time.Now()
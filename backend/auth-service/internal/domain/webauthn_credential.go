@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+)
+
+// WebAuthnCredential represents a WebAuthn credential (passkey or security key) registered by a user
+type WebAuthnCredential struct {
+	ID              int64
+	UserID          int64
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+	Name            string
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
+}
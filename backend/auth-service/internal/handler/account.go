@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// AccountHandler handles signup, email verification and password HTTP requests
+type AccountHandler struct {
+	accountSvc *service.AccountService
+	jwtSvc     *service.JWTService
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(accountSvc *service.AccountService, jwtSvc *service.JWTService) *AccountHandler {
+	return &AccountHandler{
+		accountSvc: accountSvc,
+		jwtSvc:     jwtSvc,
+	}
+}
+
+// RegisterRequest represents a signup request
+type RegisterRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// EmailRequest represents a request that only carries an email address
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// TokenRequest represents a request that redeems an emailed token
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// ResetPasswordRequest represents a request to set a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePasswordRequest represents a request to change the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePasswordResponse represents a change password response. The access token
+// replaces the presented one, which is revoked together with the other logins.
+type ChangePasswordResponse struct {
+	Message     string `json:"message"`
+	AccessToken string `json:"access_token"`
+}
+
+// Register handles signup requests
+func (h *AccountHandler) Register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		sendError(w, http.StatusBadRequest, "email and password are required")
+		return
+	}
+
+	user, err := h.accountSvc.Register(r.Context(), service.RegisterRequest{
+		Email:     req.Email,
+		Password:  req.Password,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail), isPasswordError(err):
+			sendError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrUserAlreadyExists):
+			sendError(w, http.StatusConflict, err.Error())
+		default:
+			sendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, UserInfo{
+		ID:            user.ID,
+		UUID:          user.UUID,
+		Email:         user.Email,
+		EmailVerified: user.IsEmailVerified(),
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Role:          string(user.Role),
+		MFAEnabled:    user.MFAEnabled,
+	})
+}
+
+// VerifyEmail handles requests to confirm an email address with an emailed token
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.accountSvc.VerifyEmail(r.Context(), req.Token); err != nil {
+		sendAccountTokenError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "email verified successfully",
+	})
+}
+
+// ResendVerification handles requests to send a new email verification link
+func (h *AccountHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Email == "" {
+		sendError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	if err := h.accountSvc.ResendVerificationEmail(r.Context(), req.Email); err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The same response is sent whether or not the account exists
+	sendJSON(w, http.StatusAccepted, map[string]string{
+		"message": "if the address belongs to an unverified account, a verification email has been sent",
+	})
+}
+
+// ForgotPassword handles requests to email a password reset link
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Email == "" {
+		sendError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	if err := h.accountSvc.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The same response is sent whether or not the account exists
+	sendJSON(w, http.StatusAccepted, map[string]string{
+		"message": "if the address belongs to an account, a password reset email has been sent",
+	})
+}
+
+// ResetPassword handles requests to set a new password with an emailed token
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.accountSvc.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		if isPasswordError(err) {
+			sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sendAccountTokenError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "password reset successfully",
+	})
+}
+
+// ChangePassword handles requests to change the authenticated user's password
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		sendError(w, http.StatusBadRequest, "current_password and new_password are required")
+		return
+	}
+
+	accessToken, err := h.accountSvc.ChangePassword(r.Context(), claims, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		switch {
+		case isPasswordError(err):
+			sendError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, domain.ErrInvalidCredentials),
+			errors.Is(err, service.ErrAccountLocked),
+			isTenantError(err):
+			sendError(w, http.StatusForbidden, err.Error())
+		default:
+			sendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	sendJSON(w, http.StatusOK, ChangePasswordResponse{
+		Message:     "password changed successfully",
+		AccessToken: accessToken,
+	})
+}
+
+func sendAccountTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrInvalidAccountToken) {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sendError(w, http.StatusInternalServerError, err.Error())
+}
+
+// RegisterRoutes registers all account routes
+func (h *AccountHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/register", h.Register)
+	mux.HandleFunc("/api/v1/auth/verify-email", h.VerifyEmail)
+	mux.HandleFunc("/api/v1/auth/verify-email/resend", h.ResendVerification)
+	mux.HandleFunc("/api/v1/auth/forgot-password", h.ForgotPassword)
+	mux.HandleFunc("/api/v1/auth/reset-password", h.ResetPassword)
+	mux.HandleFunc("/api/v1/auth/password", h.ChangePassword)
+}
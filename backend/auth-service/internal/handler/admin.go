@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// AdminHandler handles platform administration HTTP requests
+type AdminHandler struct {
+	adminSvc *service.AdminService
+	jwtSvc   *service.JWTService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(adminSvc *service.AdminService, jwtSvc *service.JWTService) *AdminHandler {
+	return &AdminHandler{
+		adminSvc: adminSvc,
+		jwtSvc:   jwtSvc,
+	}
+}
+
+// AdminUserInfo represents a user in administration responses
+type AdminUserInfo struct {
+	ID                  int64      `json:"id"`
+	UUID                string     `json:"uuid"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"email_verified"`
+	FirstName           string     `json:"first_name"`
+	LastName            string     `json:"last_name"`
+	Role                string     `json:"role"`
+	MFAEnabled          bool       `json:"mfa_enabled"`
+	HasPassword         bool       `json:"has_password"`
+	Locked              bool       `json:"locked"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	FailedLoginAttempts int        `json:"failed_login_attempts"`
+	LastLoginAt         *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// UserListResponse represents a page of users
+type UserListResponse struct {
+	Users      []AdminUserInfo `json:"users"`
+	Total      int             `json:"total"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// InviteUserRequest represents a request to create a user by invite
+type InviteUserRequest struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+}
+
+// Users handles listing, inviting and deleting users
+func (h *AdminHandler) Users(w http.ResponseWriter, r *http.Request) {
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listUsers(w, r, claims)
+	case http.MethodPost:
+		h.inviteUser(w, r, claims)
+	case http.MethodDelete:
+		h.deleteUser(w, r, claims)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *AdminHandler) listUsers(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	query := r.URL.Query()
+
+	var filter domain.UserFilter
+	if value := query.Get("role"); value != "" {
+		role := domain.UserRole(value)
+		if role != domain.RoleAdministrator && role != domain.RoleCustomer {
+			sendError(w, http.StatusBadRequest, service.ErrInvalidUserRole.Error())
+			return
+		}
+		filter.Role = &role
+	}
+
+	var ok bool
+	if filter.Locked, ok = parseBoolParam(w, r, "locked"); !ok {
+		return
+	}
+	if filter.MFAEnabled, ok = parseBoolParam(w, r, "mfa_enabled"); !ok {
+		return
+	}
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			sendError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+	}
+
+	page, err := h.adminSvc.ListUsers(r.Context(), claims, filter, query.Get("cursor"), limit)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	users := make([]AdminUserInfo, 0, len(page.Users))
+	for _, user := range page.Users {
+		users = append(users, newAdminUserInfo(user))
+	}
+
+	sendJSON(w, http.StatusOK, UserListResponse{
+		Users:      users,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	})
+}
+
+func (h *AdminHandler) inviteUser(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	var req InviteUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Email == "" || req.Role == "" {
+		sendError(w, http.StatusBadRequest, "email and role are required")
+		return
+	}
+
+	user, err := h.adminSvc.InviteUser(r.Context(), claims, service.InviteRequest{
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      domain.UserRole(req.Role),
+	})
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, newAdminUserInfo(user))
+}
+
+func (h *AdminHandler) deleteUser(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.adminSvc.DeleteUser(r.Context(), claims, userID); err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockAccount handles administrator requests to unlock a locked account
+func (h *AdminHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.adminSvc.UnlockAccount, "account unlocked")
+}
+
+// ResetPassword handles administrator requests to force a password reset
+func (h *AdminHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.adminSvc.ForcePasswordReset, "password reset email sent")
+}
+
+// ResetMFA handles administrator requests to remove a user's second factors
+func (h *AdminHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.adminSvc.ResetMFA, "multi-factor authentication reset")
+}
+
+// userAction runs an administrative action on the user given by the user_id parameter
+func (h *AdminHandler) userAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, actor *service.TokenClaims, userID int64) error, message string) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	userID, ok := parseUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := action(r.Context(), claims, userID); err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": message,
+	})
+}
+
+func parseUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "user_id is required")
+		return 0, false
+	}
+	return userID, true
+}
+
+// parseBoolParam parses an optional boolean query parameter
+func parseBoolParam(w http.ResponseWriter, r *http.Request, name string) (*bool, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, true
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, name+" must be true or false")
+		return nil, false
+	}
+	return &b, true
+}
+
+func newAdminUserInfo(user *domain.User) AdminUserInfo {
+	info := AdminUserInfo{
+		ID:                  user.ID,
+		UUID:                user.UUID,
+		Email:               user.Email,
+		EmailVerified:       user.IsEmailVerified(),
+		FirstName:           user.FirstName,
+		LastName:            user.LastName,
+		Role:                string(user.Role),
+		MFAEnabled:          user.MFAEnabled,
+		HasPassword:         user.HasPassword(),
+		Locked:              user.IsLocked(),
+		FailedLoginAttempts: user.FailedLoginAttempts,
+		LastLoginAt:         user.LastLoginAt,
+		CreatedAt:           user.CreatedAt,
+	}
+	if info.Locked {
+		info.LockedUntil = user.LockedUntil
+	}
+	return info
+}
+
+func sendAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrUserNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrUserAlreadyExists):
+		sendError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidCursor),
+		errors.Is(err, service.ErrInvalidEmail),
+		errors.Is(err, service.ErrInvalidUserRole),
+		errors.Is(err, service.ErrCannotDeleteSelf):
+		sendError(w, http.StatusBadRequest, err.Error())
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RegisterRoutes registers all admin routes
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/admin/users", h.Users)
+	mux.HandleFunc("/api/v1/admin/users/unlock", h.UnlockAccount)
+	mux.HandleFunc("/api/v1/admin/users/reset-password", h.ResetPassword)
+	mux.HandleFunc("/api/v1/admin/users/reset-mfa", h.ResetMFA)
+}
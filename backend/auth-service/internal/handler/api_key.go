@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// APIKeyHandler handles API key HTTP requests. Keys are managed with access
+// tokens only; a key cannot be used to create or revoke keys.
+type APIKeyHandler struct {
+	apiKeySvc *service.APIKeyService
+	jwtSvc    *service.JWTService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeySvc *service.APIKeyService, jwtSvc *service.JWTService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeySvc: apiKeySvc,
+		jwtSvc:    jwtSvc,
+	}
+}
+
+// APIKeyInfo represents an API key in responses. The key itself is only part of
+// the response that creates it.
+type APIKeyInfo struct {
+	ID         int64      `json:"id"`
+	UUID       string     `json:"uuid"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	KeyPrefix  string     `json:"key_prefix"`
+	Service    bool       `json:"service"`
+	UserID     *int64     `json:"user_id,omitempty"`
+	CustomerID *int64     `json:"customer_id,omitempty"`
+	CreatedBy  *int64     `json:"created_by,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+	CustomerID    *int64   `json:"customer_id,omitempty"`
+	Service       bool     `json:"service,omitempty"`
+}
+
+// IntrospectAPIKeyRequest represents a request to resolve an API key
+type IntrospectAPIKeyRequest struct {
+	Key string `json:"key"`
+}
+
+// APIKeys handles listing, creating and revoking API keys
+func (h *APIKeyHandler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listAPIKeys(w, r, claims)
+	case http.MethodPost:
+		h.createAPIKey(w, r, claims)
+	case http.MethodDelete:
+		h.revokeAPIKey(w, r, claims)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// listAPIKeys lists the keys of the customer given by customer_id, or else the
+// personal access tokens of the user given by user_id, the caller by default
+func (h *APIKeyHandler) listAPIKeys(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	query := r.URL.Query()
+
+	var keys []*domain.APIKey
+	var err error
+	switch {
+	case query.Get("customer_id") != "":
+		customerID, parseErr := strconv.ParseInt(query.Get("customer_id"), 10, 64)
+		if parseErr != nil {
+			sendError(w, http.StatusBadRequest, "invalid customer_id")
+			return
+		}
+		keys, err = h.apiKeySvc.ListForCustomer(r.Context(), claims, customerID)
+	case query.Get("user_id") != "":
+		userID, parseErr := strconv.ParseInt(query.Get("user_id"), 10, 64)
+		if parseErr != nil {
+			sendError(w, http.StatusBadRequest, "invalid user_id")
+			return
+		}
+		keys, err = h.apiKeySvc.ListForUser(r.Context(), claims, userID)
+	default:
+		keys, err = h.apiKeySvc.ListForUser(r.Context(), claims, claims.UserID)
+	}
+	if err != nil {
+		sendAPIKeyError(w, err)
+		return
+	}
+
+	infos := make([]APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, newAPIKeyInfo(key))
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": infos,
+	})
+}
+
+func (h *APIKeyHandler) createAPIKey(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Name == "" || len(req.Scopes) == 0 {
+		sendError(w, http.StatusBadRequest, "name and scopes are required")
+		return
+	}
+
+	apiKey, key, err := h.apiKeySvc.Create(r.Context(), claims, service.CreateAPIKeyRequest{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		ExpiresIn:  time.Duration(req.ExpiresInDays) * 24 * time.Hour,
+		CustomerID: req.CustomerID,
+		Service:    req.Service,
+	})
+	if err != nil {
+		sendAPIKeyError(w, err)
+		return
+	}
+
+	info := newAPIKeyInfo(apiKey)
+	info.Key = key
+	sendJSON(w, http.StatusCreated, info)
+}
+
+func (h *APIKeyHandler) revokeAPIKey(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	keyID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	if err := h.apiKeySvc.Revoke(r.Context(), claims, keyID); err != nil {
+		sendAPIKeyError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "api key revoked successfully",
+	})
+}
+
+// Introspect resolves an API key to the claims of the principal it acts as. Other
+// services call it to accept API keys as bearer credentials; holding the key is
+// the only authentication it needs.
+func (h *APIKeyHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req IntrospectAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// The caller is unauthenticated, so it learns nothing beyond whether the key
+	// is accepted
+	claims, err := h.apiKeySvc.Authenticate(r.Context(), req.Key)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKey) || isTenantError(err) {
+			sendError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		log.Printf("API key introspection failed: %v", err)
+		sendError(w, http.StatusInternalServerError, "failed to introspect api key")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, claims)
+}
+
+func newAPIKeyInfo(key *domain.APIKey) APIKeyInfo {
+	return APIKeyInfo{
+		ID:         key.ID,
+		UUID:       key.UUID,
+		Name:       key.Name,
+		KeyPrefix:  key.KeyPrefix,
+		Service:    key.IsService(),
+		UserID:     key.UserID,
+		CustomerID: key.CustomerID,
+		CreatedBy:  key.CreatedBy,
+		Scopes:     key.Scopes,
+		Status:     string(key.Status()),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func sendAPIKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrCustomerNotFound),
+		errors.Is(err, domain.ErrAPIKeyNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidAPIKeyName),
+		errors.Is(err, service.ErrInvalidScope),
+		errors.Is(err, service.ErrInvalidAPIKeyDuration),
+		errors.Is(err, service.ErrCustomerRequired),
+		errors.Is(err, service.ErrNoActiveCustomer):
+		sendError(w, http.StatusBadRequest, err.Error())
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RegisterRoutes registers all API key routes
+func (h *APIKeyHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/api-keys", h.APIKeys)
+	mux.HandleFunc("/api/v1/auth/api-keys/introspect", h.Introspect)
+}
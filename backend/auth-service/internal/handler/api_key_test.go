@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+	"github.com/hosterizer/shared/auth"
+)
+
+// memoryAPIKeys looks keys up by hash, or fails every lookup with err
+type memoryAPIKeys struct {
+	domain.APIKeyRepository
+	keys map[string]*domain.APIKey
+	err  error
+}
+
+func (r *memoryAPIKeys) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if key, ok := r.keys[hash]; ok {
+		return key, nil
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeys) UpdateLastUsed(ctx context.Context, id int64) error {
+	return nil
+}
+
+type memoryCustomers struct {
+	domain.CustomerRepository
+	customers map[int64]*domain.Customer
+}
+
+func (r *memoryCustomers) GetByID(ctx context.Context, id int64) (*domain.Customer, error) {
+	if customer, ok := r.customers[id]; ok {
+		return customer, nil
+	}
+	return nil, domain.ErrCustomerNotFound
+}
+
+func introspect(h *APIKeyHandler, key string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(IntrospectAPIKeyRequest{Key: key})
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/api-keys/introspect", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	h.Introspect(w, r)
+	return w
+}
+
+func TestIntrospectAPIKey(t *testing.T) {
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	serviceKey := func(customerID int64) *domain.APIKey {
+		return &domain.APIKey{
+			ID:         customerID,
+			UUID:       fmt.Sprintf("key-%d", customerID),
+			CustomerID: &customerID,
+			Scopes:     []string{auth.ScopeSitesRead},
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}
+	}
+
+	keys := &memoryAPIKeys{keys: map[string]*domain.APIKey{
+		hash("hzk_active"):    serviceKey(1),
+		hash("hzk_suspended"): serviceKey(2),
+	}}
+	customers := &memoryCustomers{customers: map[int64]*domain.Customer{
+		1: {ID: 1, Status: domain.CustomerStatusActive},
+		2: {ID: 2, Status: domain.CustomerStatusSuspended},
+	}}
+	h := NewAPIKeyHandler(service.NewAPIKeyService(service.APIKeyConfig{
+		APIKeyRepo:   keys,
+		CustomerRepo: customers,
+	}), nil)
+
+	w := introspect(h, "hzk_active")
+	if w.Code != http.StatusOK {
+		t.Fatalf("active key: status %d: %s", w.Code, w.Body.String())
+	}
+	var claims auth.Claims
+	if err := json.NewDecoder(w.Body).Decode(&claims); err != nil {
+		t.Fatal(err)
+	}
+	if !claims.IsAPIKey() || claims.CustomerID == nil || *claims.CustomerID != 1 || !claims.HasScope(auth.ScopeSitesRead) {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// Rejected keys all get the same answer, whatever the reason
+	for _, key := range []string{"hzk_unknown", "hzk_suspended", "not-a-key"} {
+		w := introspect(h, key)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: status %d, want 401", key, w.Code)
+		}
+		var resp ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Message != "invalid api key" {
+			t.Fatalf("%s: message %q, want the generic one", key, resp.Message)
+		}
+	}
+
+	// Internal failures are not spelled out to the unauthenticated caller
+	keys.err = errors.New("pq: connection to 10.0.3.7 refused")
+	w = introspect(h, "hzk_active")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "10.0.3.7") {
+		t.Fatalf("repository failure: status %d body %s", w.Code, w.Body.String())
+	}
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/hosterizer/auth-service/internal/service"
 )
@@ -22,17 +24,13 @@ func NewAuthHandler(authSvc *service.AuthService, jwtSvc *service.JWTService) *A
 	}
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-}
-
 // LoginRequest represents a login request
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	MFACode  string `json:"mfa_code,omitempty"`
+	Email        string          `json:"email"`
+	Password     string          `json:"password"`
+	MFACode      string          `json:"mfa_code,omitempty"`
+	RecoveryCode string          `json:"recovery_code,omitempty"`
+	WebAuthn     json.RawMessage `json:"webauthn,omitempty"`
 }
 
 // LoginResponse represents a login response
@@ -40,47 +38,65 @@ type LoginResponse struct {
 	AccessToken  string    `json:"access_token,omitempty"`
 	RefreshToken string    `json:"refresh_token,omitempty"`
 	RequiresMFA  bool      `json:"requires_mfa"`
+	MFAToken     string    `json:"mfa_token,omitempty"`
 	User         *UserInfo `json:"user,omitempty"`
 }
 
 // UserInfo represents user information in responses
 type UserInfo struct {
-	ID         int64  `json:"id"`
-	UUID       string `json:"uuid"`
-	Email      string `json:"email"`
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	Role       string `json:"role"`
-	MFAEnabled bool   `json:"mfa_enabled"`
+	ID            int64  `json:"id"`
+	UUID          string `json:"uuid"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Role          string `json:"role"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
 }
 
 // Login handles login requests
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		sendError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	// Validate input
-	if req.Email == "" || req.Password == "" {
-		h.sendError(w, http.StatusBadRequest, "email and password are required")
+	// Validate input; a passkey alone is enough for passwordless login
+	passwordless := req.Email == "" && req.Password == "" && len(req.WebAuthn) > 0
+	if !passwordless && (req.Email == "" || req.Password == "") {
+		sendError(w, http.StatusBadRequest, "email and password are required")
 		return
 	}
 
 	// Perform login
 	resp, err := h.authSvc.Login(r.Context(), service.LoginRequest{
-		Email:    req.Email,
-		Password: req.Password,
-		MFACode:  req.MFACode,
+		Email:        req.Email,
+		Password:     req.Password,
+		MFACode:      req.MFACode,
+		RecoveryCode: req.RecoveryCode,
+		WebAuthn:     req.WebAuthn,
 	})
 	if err != nil {
-		h.sendError(w, http.StatusUnauthorized, err.Error())
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			sendThrottled(w, throttled)
+			return
+		}
+		if isUnavailable(err) {
+			sendUnavailable(w, err)
+			return
+		}
+		if isTenantError(err) || errors.Is(err, service.ErrSSORequired) {
+			sendError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		sendError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
@@ -89,38 +105,263 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		RequiresMFA: resp.RequiresMFA,
 	}
 
-	if !resp.RequiresMFA {
+	if resp.RequiresMFA {
+		loginResp.MFAToken = resp.MFAToken
+	} else {
 		loginResp.AccessToken = resp.AccessToken
 		loginResp.RefreshToken = resp.RefreshToken
 		loginResp.User = &UserInfo{
-			ID:         resp.User.ID,
-			UUID:       resp.User.UUID,
-			Email:      resp.User.Email,
-			FirstName:  resp.User.FirstName,
-			LastName:   resp.User.LastName,
-			Role:       string(resp.User.Role),
-			MFAEnabled: resp.User.MFAEnabled,
+			ID:            resp.User.ID,
+			UUID:          resp.User.UUID,
+			Email:         resp.User.Email,
+			FirstName:     resp.User.FirstName,
+			LastName:      resp.User.LastName,
+			Role:          string(resp.User.Role),
+			MFAEnabled:    resp.User.MFAEnabled,
+			EmailVerified: resp.User.IsEmailVerified(),
 		}
 	}
 
-	h.sendJSON(w, http.StatusOK, loginResp)
+	sendJSON(w, http.StatusOK, loginResp)
 }
 
-// Logout handles logout requests
+// MFAChallengeRequest represents the second step of a login with MFA
+type MFAChallengeRequest struct {
+	MFAToken     string          `json:"mfa_token"`
+	MFACode      string          `json:"mfa_code,omitempty"`
+	RecoveryCode string          `json:"recovery_code,omitempty"`
+	WebAuthn     json.RawMessage `json:"webauthn,omitempty"`
+}
+
+// MFAChallenge handles requests exchanging an MFA token and a code for tokens
+func (h *AuthHandler) MFAChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req MFAChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.MFAToken == "" || (req.MFACode == "" && req.RecoveryCode == "" && len(req.WebAuthn) == 0) {
+		sendError(w, http.StatusBadRequest, "mfa_token and one of mfa_code, recovery_code or webauthn are required")
+		return
+	}
+
+	resp, err := h.authSvc.CompleteMFAChallenge(r.Context(), service.MFAChallengeRequest{
+		MFAToken:     req.MFAToken,
+		MFACode:      req.MFACode,
+		RecoveryCode: req.RecoveryCode,
+		WebAuthn:     req.WebAuthn,
+	})
+	if err != nil {
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			sendThrottled(w, throttled)
+			return
+		}
+		if isUnavailable(err) {
+			sendUnavailable(w, err)
+			return
+		}
+		if isTenantError(err) {
+			sendError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	sendJSON(w, http.StatusOK, LoginResponse{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		User: &UserInfo{
+			ID:            resp.User.ID,
+			UUID:          resp.User.UUID,
+			Email:         resp.User.Email,
+			FirstName:     resp.User.FirstName,
+			LastName:      resp.User.LastName,
+			Role:          string(resp.User.Role),
+			MFAEnabled:    resp.User.MFAEnabled,
+			EmailVerified: resp.User.IsEmailVerified(),
+		},
+	})
+}
+
+// LogoutRequest represents a logout request
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Logout handles logout requests. It revokes the presented access token, its
+// refresh token family and session, and an optional refresh token from the body.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	// The body is optional
+	var req LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	// In a stateless JWT system, logout is handled client-side by removing the token
-	// If using sessions, we would invalidate the session here
+	if err := h.authSvc.Logout(r.Context(), claims, req.RefreshToken); err != nil {
+		sendSessionError(w, err)
+		return
+	}
 
-	h.sendJSON(w, http.StatusOK, map[string]string{
+	sendJSON(w, http.StatusOK, map[string]string{
 		"message": "logged out successfully",
 	})
 }
 
+// LogoutAll handles requests to log out of every session of the current user
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	if err := h.authSvc.LogoutAll(r.Context(), claims); err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "logged out of all sessions successfully",
+	})
+}
+
+// SessionInfo represents an active login session in responses
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Current    bool      `json:"current"`
+	Device     string    `json:"device,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CustomerID *int64    `json:"customer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// Sessions handles listing and revoking the active sessions of a user. Users see
+// their own sessions; administrators may pass user_id to see anyone's.
+func (h *AuthHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listSessions(w, r, claims)
+	case http.MethodDelete:
+		h.revokeSession(w, r, claims)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// CurrentSession checks the login session of the presented access token and slides
+// its idle timeout, like every request to auth-service does. Other services call
+// it so their requests keep the session alive and stop working once it has ended.
+func (h *AuthHandler) CurrentSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if _, err := authenticate(r, h.jwtSvc); err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) listSessions(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	userID := claims.UserID
+	if r.URL.Query().Get("user_id") != "" {
+		var ok bool
+		if userID, ok = parseUserID(w, r); !ok {
+			return
+		}
+	}
+
+	sessions, err := h.authSvc.ListSessions(r.Context(), claims, userID)
+	if err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{
+			ID:         session.ID,
+			Current:    session.ID == claims.FamilyID,
+			Device:     session.Device,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CustomerID: session.CustomerID,
+			CreatedAt:  session.CreatedAt,
+			LastAccess: session.LastAccess,
+		})
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": infos,
+	})
+}
+
+func (h *AuthHandler) revokeSession(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	sessionID := r.URL.Query().Get("id")
+	if sessionID == "" {
+		sendError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	if err := h.authSvc.RevokeSession(r.Context(), claims, sessionID); err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "session revoked successfully",
+	})
+}
+
+func sendSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrSessionNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case isUnavailable(err):
+		sendUnavailable(w, err)
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 // RefreshRequest represents a refresh token request
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
@@ -129,39 +370,115 @@ type RefreshRequest struct {
 // Refresh handles token refresh requests
 func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var req RefreshRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		sendError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if req.RefreshToken == "" {
-		h.sendError(w, http.StatusBadRequest, "refresh token is required")
+		sendError(w, http.StatusBadRequest, "refresh token is required")
 		return
 	}
 
 	// Refresh tokens
 	resp, err := h.authSvc.RefreshTokens(r.Context(), req.RefreshToken)
 	if err != nil {
-		h.sendError(w, http.StatusUnauthorized, err.Error())
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			sendErrorCode(w, http.StatusUnauthorized, ErrCodeRefreshTokenReused, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrSessionExpired) {
+			sendErrorCode(w, http.StatusUnauthorized, ErrCodeSessionExpired, err.Error())
+			return
+		}
+		if isUnavailable(err) {
+			sendUnavailable(w, err)
+			return
+		}
+		if isTenantError(err) {
+			sendError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		sendError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	h.sendJSON(w, http.StatusOK, LoginResponse{
+	sendJSON(w, http.StatusOK, LoginResponse{
 		AccessToken:  resp.AccessToken,
 		RefreshToken: resp.RefreshToken,
 		User: &UserInfo{
-			ID:         resp.User.ID,
-			UUID:       resp.User.UUID,
-			Email:      resp.User.Email,
-			FirstName:  resp.User.FirstName,
-			LastName:   resp.User.LastName,
-			Role:       string(resp.User.Role),
-			MFAEnabled: resp.User.MFAEnabled,
+			ID:            resp.User.ID,
+			UUID:          resp.User.UUID,
+			Email:         resp.User.Email,
+			FirstName:     resp.User.FirstName,
+			LastName:      resp.User.LastName,
+			Role:          string(resp.User.Role),
+			MFAEnabled:    resp.User.MFAEnabled,
+			EmailVerified: resp.User.IsEmailVerified(),
+		},
+	})
+}
+
+// SwitchTenantRequest represents a tenant switch request
+type SwitchTenantRequest struct {
+	CustomerID   int64  `json:"customer_id"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// SwitchTenant handles requests to scope the current login to another customer
+func (h *AuthHandler) SwitchTenant(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	var req SwitchTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CustomerID == 0 {
+		sendError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	resp, err := h.authSvc.SwitchTenant(r.Context(), claims, req.CustomerID, req.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			sendErrorCode(w, http.StatusUnauthorized, ErrCodeRefreshTokenReused, err.Error())
+		case errors.Is(err, service.ErrInvalidToken):
+			sendError(w, http.StatusUnauthorized, err.Error())
+		default:
+			sendError(w, http.StatusForbidden, err.Error())
+		}
+		return
+	}
+
+	sendJSON(w, http.StatusOK, LoginResponse{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		User: &UserInfo{
+			ID:            resp.User.ID,
+			UUID:          resp.User.UUID,
+			Email:         resp.User.Email,
+			FirstName:     resp.User.FirstName,
+			LastName:      resp.User.LastName,
+			Role:          string(resp.User.Role),
+			MFAEnabled:    resp.User.MFAEnabled,
+			EmailVerified: resp.User.IsEmailVerified(),
 		},
 	})
 }
@@ -175,25 +492,25 @@ type MFASetupResponse struct {
 // SetupMFA handles MFA setup requests
 func (h *AuthHandler) SetupMFA(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	// Extract user ID from token
 	userID, err := h.getUserIDFromToken(r)
 	if err != nil {
-		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		sendAuthError(w, err)
 		return
 	}
 
 	// Setup MFA
 	result, err := h.authSvc.SetupMFA(r.Context(), userID)
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, err.Error())
+		sendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	h.sendJSON(w, http.StatusOK, MFASetupResponse{
+	sendJSON(w, http.StatusOK, MFASetupResponse{
 		Secret:    result.Secret,
 		QRCodeURL: result.QRCodeURL,
 	})
@@ -207,88 +524,138 @@ type VerifyMFARequest struct {
 // VerifyMFA handles MFA verification requests
 func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	// Extract user ID from token
 	userID, err := h.getUserIDFromToken(r)
 	if err != nil {
-		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		sendAuthError(w, err)
 		return
 	}
 
 	var req VerifyMFARequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		sendError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if req.Code == "" {
-		h.sendError(w, http.StatusBadRequest, "code is required")
+		sendError(w, http.StatusBadRequest, "code is required")
 		return
 	}
 
 	// Verify and enable MFA
-	if err := h.authSvc.VerifyAndEnableMFA(r.Context(), userID, req.Code); err != nil {
-		h.sendError(w, http.StatusBadRequest, err.Error())
+	recoveryCodes, err := h.authSvc.VerifyAndEnableMFA(r.Context(), userID, req.Code)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	h.sendJSON(w, http.StatusOK, map[string]string{
-		"message": "MFA enabled successfully",
+	sendJSON(w, http.StatusOK, VerifyMFAResponse{
+		Message:       "MFA enabled successfully",
+		RecoveryCodes: recoveryCodes,
 	})
 }
 
+// VerifyMFAResponse represents MFA verification response. The recovery codes
+// are only ever returned here and when they are regenerated.
+type VerifyMFAResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RecoveryCodesResponse represents the recovery code status of the current user
+type RecoveryCodesResponse struct {
+	Remaining     int      `json:"remaining"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// RecoveryCodes handles recovery code requests. GET returns how many unused codes
+// are left; POST regenerates the set and requires a current TOTP code.
+func (h *AuthHandler) RecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromToken(r)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		remaining, err := h.authSvc.RemainingRecoveryCodes(r.Context(), userID)
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		sendJSON(w, http.StatusOK, RecoveryCodesResponse{
+			Remaining: remaining,
+		})
+	case http.MethodPost:
+		var req VerifyMFARequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if req.Code == "" {
+			sendError(w, http.StatusBadRequest, "code is required")
+			return
+		}
+
+		recoveryCodes, err := h.authSvc.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		sendJSON(w, http.StatusOK, RecoveryCodesResponse{
+			Remaining:     len(recoveryCodes),
+			RecoveryCodes: recoveryCodes,
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
 // GetMe handles current user info requests
 func (h *AuthHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	// Extract user ID from token
 	userID, err := h.getUserIDFromToken(r)
 	if err != nil {
-		h.sendError(w, http.StatusUnauthorized, "unauthorized")
+		sendAuthError(w, err)
 		return
 	}
 
 	// Get user
 	user, err := h.authSvc.GetCurrentUser(r.Context(), userID)
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, err.Error())
+		sendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	h.sendJSON(w, http.StatusOK, UserInfo{
-		ID:         user.ID,
-		UUID:       user.UUID,
-		Email:      user.Email,
-		FirstName:  user.FirstName,
-		LastName:   user.LastName,
-		Role:       string(user.Role),
-		MFAEnabled: user.MFAEnabled,
+	sendJSON(w, http.StatusOK, UserInfo{
+		ID:            user.ID,
+		UUID:          user.UUID,
+		Email:         user.Email,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Role:          string(user.Role),
+		MFAEnabled:    user.MFAEnabled,
+		EmailVerified: user.IsEmailVerified(),
 	})
 }
 
 // Helper methods
 
 func (h *AuthHandler) getUserIDFromToken(r *http.Request) (int64, error) {
-	// Extract token from Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return 0, http.ErrNoCookie
-	}
-
-	// Remove "Bearer " prefix
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		return 0, http.ErrNoCookie
-	}
-
-	// Validate token
-	claims, err := h.jwtSvc.ValidateAccessToken(tokenString)
+	claims, err := authenticate(r, h.jwtSvc)
 	if err != nil {
 		return 0, err
 	}
@@ -296,25 +663,18 @@ func (h *AuthHandler) getUserIDFromToken(r *http.Request) (int64, error) {
 	return claims.UserID, nil
 }
 
-func (h *AuthHandler) sendJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
-}
-
-func (h *AuthHandler) sendError(w http.ResponseWriter, status int, message string) {
-	h.sendJSON(w, status, ErrorResponse{
-		Error:   http.StatusText(status),
-		Message: message,
-	})
-}
-
 // RegisterRoutes registers all auth routes
 func (h *AuthHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/auth/login", h.Login)
 	mux.HandleFunc("/api/v1/auth/logout", h.Logout)
+	mux.HandleFunc("/api/v1/auth/logout-all", h.LogoutAll)
+	mux.HandleFunc("/api/v1/auth/sessions", h.Sessions)
+	mux.HandleFunc("/api/v1/auth/sessions/current", h.CurrentSession)
 	mux.HandleFunc("/api/v1/auth/refresh", h.Refresh)
+	mux.HandleFunc("/api/v1/auth/switch-tenant", h.SwitchTenant)
 	mux.HandleFunc("/api/v1/auth/mfa/setup", h.SetupMFA)
 	mux.HandleFunc("/api/v1/auth/mfa/verify", h.VerifyMFA)
+	mux.HandleFunc("/api/v1/auth/mfa/challenge", h.MFAChallenge)
+	mux.HandleFunc("/api/v1/auth/mfa/recovery-codes", h.RecoveryCodes)
 	mux.HandleFunc("/api/v1/auth/me", h.GetMe)
 }
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// AuthEventHandler handles queries of the authentication audit log
+type AuthEventHandler struct {
+	eventSvc *service.AuthEventService
+	jwtSvc   *service.JWTService
+}
+
+// NewAuthEventHandler creates a new auth event handler
+func NewAuthEventHandler(eventSvc *service.AuthEventService, jwtSvc *service.JWTService) *AuthEventHandler {
+	return &AuthEventHandler{
+		eventSvc: eventSvc,
+		jwtSvc:   jwtSvc,
+	}
+}
+
+// AuthEventInfo represents an auth event in responses
+type AuthEventInfo struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	Outcome    string    `json:"outcome"`
+	UserID     *int64    `json:"user_id,omitempty"`
+	ActorID    *int64    `json:"actor_id,omitempty"`
+	CustomerID *int64    `json:"customer_id,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// AuthEventListResponse represents a page of auth events
+type AuthEventListResponse struct {
+	Events     []AuthEventInfo `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// AdminEvents handles administrator queries of the auth events of every user
+func (h *AuthEventHandler) AdminEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	filter, limit, ok := parseAuthEventQuery(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.eventSvc.List(r.Context(), claims, filter, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		sendAuthEventError(w, err)
+		return
+	}
+
+	sendAuthEventPage(w, page)
+}
+
+// CustomerEvents handles owner queries of the auth events of the customer given by customer_id
+func (h *AuthEventHandler) CustomerEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	customerID, err := strconv.ParseInt(r.URL.Query().Get("customer_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	filter, limit, ok := parseAuthEventQuery(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.eventSvc.ListForCustomer(r.Context(), claims, customerID, filter, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		sendAuthEventError(w, err)
+		return
+	}
+
+	sendAuthEventPage(w, page)
+}
+
+// parseAuthEventQuery reads the user_id, type, since, until and limit parameters.
+// Several event types may be given separated by commas. On failure it sends the
+// error response and returns false.
+func parseAuthEventQuery(w http.ResponseWriter, r *http.Request) (domain.AuthEventFilter, int, bool) {
+	query := r.URL.Query()
+
+	var filter domain.AuthEventFilter
+	if value := query.Get("user_id"); value != "" {
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "invalid user_id")
+			return filter, 0, false
+		}
+		filter.UserID = &userID
+	}
+
+	if value := query.Get("type"); value != "" {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				filter.Types = append(filter.Types, eventType)
+			}
+		}
+	}
+
+	var ok bool
+	if filter.Since, ok = parseTimeParam(w, r, "since"); !ok {
+		return filter, 0, false
+	}
+	if filter.Until, ok = parseTimeParam(w, r, "until"); !ok {
+		return filter, 0, false
+	}
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			sendError(w, http.StatusBadRequest, "limit must be a positive number")
+			return filter, 0, false
+		}
+	}
+
+	return filter, limit, true
+}
+
+// parseTimeParam reads an optional RFC 3339 timestamp parameter. On failure it sends
+// the error response and returns false.
+func parseTimeParam(w http.ResponseWriter, r *http.Request, name string) (*time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, true
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, name+" must be an RFC 3339 timestamp")
+		return nil, false
+	}
+	return &t, true
+}
+
+func sendAuthEventPage(w http.ResponseWriter, page *service.AuthEventPage) {
+	events := make([]AuthEventInfo, 0, len(page.Events))
+	for _, event := range page.Events {
+		events = append(events, AuthEventInfo{
+			ID:         event.ID,
+			Type:       event.Type,
+			Outcome:    string(event.Outcome),
+			UserID:     event.UserID,
+			ActorID:    event.ActorID,
+			CustomerID: event.CustomerID,
+			Email:      event.Email,
+			IPAddress:  event.IPAddress,
+			UserAgent:  event.UserAgent,
+			Reason:     event.Reason,
+			OccurredAt: event.OccurredAt,
+		})
+	}
+
+	sendJSON(w, http.StatusOK, AuthEventListResponse{
+		Events:     events,
+		NextCursor: page.NextCursor,
+	})
+}
+
+func sendAuthEventError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrInvalidCursor):
+		sendError(w, http.StatusBadRequest, err.Error())
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// recordEvent records an audit event for an action taken by a handler. The action
+// has already happened, so a failure to record it is only logged.
+func recordEvent(r *http.Request, events service.EventRecorder, event *service.AuditEvent) {
+	if err := events.Record(r.Context(), event); err != nil {
+		log.Printf("failed to record %s event for user %d: %v", event.Type, event.UserID, err)
+	}
+}
+
+// RegisterRoutes registers all auth event routes
+func (h *AuthEventHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/admin/auth-events", h.AdminEvents)
+	mux.HandleFunc("/api/v1/auth/events", h.CustomerEvents)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// memoryUsers looks users up by ID
+type memoryUsers struct {
+	domain.UserRepository
+	users map[int64]*domain.User
+}
+
+func (r *memoryUsers) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func TestMFAChallengeThrottled(t *testing.T) {
+	ctx := context.Background()
+	keys, err := service.GenerateKeySet()
+	if err != nil {
+		t.Fatalf("GenerateKeySet: %v", err)
+	}
+	jwtSvc := service.NewJWTService(service.JWTConfig{Keys: keys})
+	throttle := service.NewLoginThrottle(service.ThrottleConfig{
+		Failures:          service.NewSessionService(service.SessionConfig{}),
+		EmailFreeFailures: 1,
+		BaseDelay:         time.Minute,
+	})
+	jane := &domain.User{ID: 1, Email: "jane@example.com", Role: domain.RoleAdministrator, MFAEnabled: true}
+	h := NewAuthHandler(service.NewAuthService(service.AuthServiceConfig{
+		UserRepo: &memoryUsers{users: map[int64]*domain.User{jane.ID: jane}},
+		JWTSvc:   jwtSvc,
+		Throttle: throttle,
+	}), jwtSvc)
+
+	// Earlier wrong guesses for jane's address
+	for i := 0; i < 2; i++ {
+		if _, err := throttle.Begin(ctx, jane.Email, ""); err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+	}
+
+	mfaToken, err := jwtSvc.GenerateMFAToken(jane)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken: %v", err)
+	}
+	body, _ := json.Marshal(MFAChallengeRequest{MFAToken: mfaToken, MFACode: "123456"})
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/challenge", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	h.MFAChallenge(w, r)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429: %s", w.Code, w.Body)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Fatalf("Retry-After = %q, want 60", retryAfter)
+	}
+}
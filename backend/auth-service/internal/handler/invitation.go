@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// InvitationHandler handles customer invitation HTTP requests
+type InvitationHandler struct {
+	invitationSvc *service.InvitationService
+	jwtSvc        *service.JWTService
+}
+
+// NewInvitationHandler creates a new invitation handler
+func NewInvitationHandler(invitationSvc *service.InvitationService, jwtSvc *service.JWTService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationSvc: invitationSvc,
+		jwtSvc:        jwtSvc,
+	}
+}
+
+// InvitationInfo represents an invitation in responses
+type InvitationInfo struct {
+	ID         int64      `json:"id"`
+	UUID       string     `json:"uuid"`
+	CustomerID int64      `json:"customer_id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Status     string     `json:"status"`
+	InvitedBy  *int64     `json:"invited_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// InvitationRequest represents a request to invite a new user to a customer
+type InvitationRequest struct {
+	CustomerID int64  `json:"customer_id"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+}
+
+// AcceptInvitationRequest represents a request to create an account from an invitation
+type AcceptInvitationRequest struct {
+	Token     string `json:"token"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// Invitations handles listing, sending and revoking invitations to a customer
+func (h *InvitationHandler) Invitations(w http.ResponseWriter, r *http.Request) {
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listInvitations(w, r, claims)
+	case http.MethodPost:
+		h.invite(w, r, claims)
+	case http.MethodDelete:
+		h.revokeInvitation(w, r, claims)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *InvitationHandler) listInvitations(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	customerID, err := strconv.ParseInt(r.URL.Query().Get("customer_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	invitations, err := h.invitationSvc.List(r.Context(), claims, customerID)
+	if err != nil {
+		sendInvitationError(w, err)
+		return
+	}
+
+	infos := make([]InvitationInfo, 0, len(invitations))
+	for _, invitation := range invitations {
+		infos = append(infos, newInvitationInfo(invitation))
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"invitations": infos,
+	})
+}
+
+func (h *InvitationHandler) invite(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	var req InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CustomerID == 0 || req.Email == "" || req.Role == "" {
+		sendError(w, http.StatusBadRequest, "customer_id, email and role are required")
+		return
+	}
+
+	invitation, err := h.invitationSvc.Invite(r.Context(), claims, req.CustomerID, req.Email, domain.MembershipRole(req.Role))
+	if err != nil {
+		sendInvitationError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, newInvitationInfo(invitation))
+}
+
+func (h *InvitationHandler) revokeInvitation(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	customerID, err := strconv.ParseInt(r.URL.Query().Get("customer_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	invitationID, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	if err := h.invitationSvc.Revoke(r.Context(), claims, customerID, invitationID); err != nil {
+		sendInvitationError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "invitation revoked successfully",
+	})
+}
+
+// AcceptInvitation handles requests to create an account from an invitation link
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		sendError(w, http.StatusBadRequest, "token and password are required")
+		return
+	}
+
+	user, err := h.invitationSvc.Accept(r.Context(), service.AcceptInvitationRequest{
+		Token:     req.Token,
+		Password:  req.Password,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	})
+	if err != nil {
+		if isPasswordError(err) {
+			sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sendInvitationError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, UserInfo{
+		ID:            user.ID,
+		UUID:          user.UUID,
+		Email:         user.Email,
+		EmailVerified: user.IsEmailVerified(),
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Role:          string(user.Role),
+		MFAEnabled:    user.MFAEnabled,
+	})
+}
+
+func newInvitationInfo(invitation *domain.Invitation) InvitationInfo {
+	return InvitationInfo{
+		ID:         invitation.ID,
+		UUID:       invitation.UUID,
+		CustomerID: invitation.CustomerID,
+		Email:      invitation.Email,
+		Role:       string(invitation.Role),
+		Status:     string(invitation.Status()),
+		InvitedBy:  invitation.InvitedBy,
+		ExpiresAt:  invitation.ExpiresAt,
+		AcceptedAt: invitation.AcceptedAt,
+		RevokedAt:  invitation.RevokedAt,
+		CreatedAt:  invitation.CreatedAt,
+	}
+}
+
+func sendInvitationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrCustomerNotFound),
+		errors.Is(err, domain.ErrInvitationNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrUserAlreadyExists),
+		errors.Is(err, domain.ErrInvitationAlreadyExists):
+		sendError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidMembershipRole),
+		errors.Is(err, service.ErrInvalidEmail),
+		errors.Is(err, service.ErrInvalidInvitation):
+		sendError(w, http.StatusBadRequest, err.Error())
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RegisterRoutes registers all invitation routes
+func (h *InvitationHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/invitations", h.Invitations)
+	mux.HandleFunc("/api/v1/auth/invitations/accept", h.AcceptInvitation)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// JWKSHandler serves the public keys access tokens can be verified with
+type JWKSHandler struct {
+	jwtSvc *service.JWTService
+}
+
+// NewJWKSHandler creates a new JWKS handler
+func NewJWKSHandler(jwtSvc *service.JWTService) *JWKSHandler {
+	return &JWKSHandler{
+		jwtSvc: jwtSvc,
+	}
+}
+
+// GetJWKS handles JSON Web Key Set requests
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	set, err := h.jwtSvc.GetKeySet().JWKS()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Verifiers refetch on unknown key IDs, so a short cache lifetime is enough
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	sendJSON(w, http.StatusOK, set)
+}
+
+// RegisterRoutes registers the JWKS route
+func (h *JWKSHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/.well-known/jwks.json", h.GetJWKS)
+}
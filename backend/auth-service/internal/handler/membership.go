@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// MembershipHandler handles customer membership HTTP requests
+type MembershipHandler struct {
+	membershipSvc *service.MembershipService
+	jwtSvc        *service.JWTService
+}
+
+// NewMembershipHandler creates a new membership handler
+func NewMembershipHandler(membershipSvc *service.MembershipService, jwtSvc *service.JWTService) *MembershipHandler {
+	return &MembershipHandler{
+		membershipSvc: membershipSvc,
+		jwtSvc:        jwtSvc,
+	}
+}
+
+// TenantInfo represents a customer the current user can switch to
+type TenantInfo struct {
+	CustomerID int64  `json:"customer_id"`
+	UUID       string `json:"uuid"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Role       string `json:"role"`
+}
+
+// MembershipInfo represents a member of a customer in responses
+type MembershipInfo struct {
+	CustomerID int64     `json:"customer_id"`
+	UserID     int64     `json:"user_id"`
+	UserUUID   string    `json:"user_uuid"`
+	Email      string    `json:"email"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	Role       string    `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MembershipRequest represents a request to add a member or change a member's role
+type MembershipRequest struct {
+	CustomerID int64  `json:"customer_id"`
+	UserID     int64  `json:"user_id,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Role       string `json:"role"`
+}
+
+// ListTenants handles requests for the customers the current user belongs to
+func (h *MembershipHandler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	memberships, err := h.membershipSvc.ListForUser(r.Context(), claims.UserID)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tenants := make([]TenantInfo, 0, len(memberships))
+	for _, membership := range memberships {
+		tenants = append(tenants, TenantInfo{
+			CustomerID: membership.CustomerID,
+			UUID:       membership.Customer.UUID,
+			Name:       membership.Customer.Name,
+			Status:     string(membership.Customer.Status),
+			Role:       string(membership.Role),
+		})
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"tenants": tenants,
+	})
+}
+
+// Memberships handles listing, adding, updating and removing members of a customer
+func (h *MembershipHandler) Memberships(w http.ResponseWriter, r *http.Request) {
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listMembers(w, r, claims)
+	case http.MethodPost:
+		h.addMember(w, r, claims)
+	case http.MethodPut:
+		h.updateMember(w, r, claims)
+	case http.MethodDelete:
+		h.removeMember(w, r, claims)
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *MembershipHandler) listMembers(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	customerID, err := strconv.ParseInt(r.URL.Query().Get("customer_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	memberships, err := h.membershipSvc.ListForCustomer(r.Context(), claims, customerID)
+	if err != nil {
+		sendMembershipError(w, err)
+		return
+	}
+
+	members := make([]MembershipInfo, 0, len(memberships))
+	for _, membership := range memberships {
+		members = append(members, newMembershipInfo(membership))
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"members": members,
+	})
+}
+
+func (h *MembershipHandler) addMember(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	var req MembershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CustomerID == 0 || req.Email == "" || req.Role == "" {
+		sendError(w, http.StatusBadRequest, "customer_id, email and role are required")
+		return
+	}
+
+	membership, err := h.membershipSvc.AddMember(r.Context(), claims, req.CustomerID, req.Email, domain.MembershipRole(req.Role))
+	if err != nil {
+		sendMembershipError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusCreated, newMembershipInfo(membership))
+}
+
+func (h *MembershipHandler) updateMember(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	var req MembershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CustomerID == 0 || req.UserID == 0 || req.Role == "" {
+		sendError(w, http.StatusBadRequest, "customer_id, user_id and role are required")
+		return
+	}
+
+	if err := h.membershipSvc.UpdateRole(r.Context(), claims, req.CustomerID, req.UserID, domain.MembershipRole(req.Role)); err != nil {
+		sendMembershipError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "membership updated successfully",
+	})
+}
+
+func (h *MembershipHandler) removeMember(w http.ResponseWriter, r *http.Request, claims *service.TokenClaims) {
+	customerID, err := strconv.ParseInt(r.URL.Query().Get("customer_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	userID, err := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	if err := h.membershipSvc.RemoveMember(r.Context(), claims, customerID, userID); err != nil {
+		sendMembershipError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, map[string]string{
+		"message": "membership removed successfully",
+	})
+}
+
+func newMembershipInfo(membership *domain.CustomerMembership) MembershipInfo {
+	info := MembershipInfo{
+		CustomerID: membership.CustomerID,
+		UserID:     membership.UserID,
+		Role:       string(membership.Role),
+		CreatedAt:  membership.CreatedAt,
+	}
+	if membership.User != nil {
+		info.UserUUID = membership.User.UUID
+		info.Email = membership.User.Email
+		info.FirstName = membership.User.FirstName
+		info.LastName = membership.User.LastName
+	}
+	return info
+}
+
+func sendMembershipError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrCustomerNotFound),
+		errors.Is(err, domain.ErrMembershipNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrMembershipAlreadyExists),
+		errors.Is(err, domain.ErrLastOwner):
+		sendError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidMembershipRole),
+		errors.Is(err, service.ErrInvalidMember):
+		sendError(w, http.StatusBadRequest, err.Error())
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RegisterRoutes registers all membership routes
+func (h *MembershipHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/tenants", h.ListTenants)
+	mux.HandleFunc("/api/v1/auth/memberships", h.Memberships)
+}
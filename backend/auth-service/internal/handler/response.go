@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+const (
+	// ErrCodeRefreshTokenReused tells clients that a refresh token was replayed
+	// and the session was revoked, so the user must log in again
+	ErrCodeRefreshTokenReused = "refresh_token_reused"
+
+	// ErrCodeSessionExpired tells clients that the login session idled out or was
+	// revoked, so the user must log in again
+	ErrCodeSessionExpired = "session_expired"
+
+	// ErrCodeSessionStoreUnavailable tells clients that logins cannot be checked
+	// right now and the request should be retried, not that the user must log in again
+	ErrCodeSessionStoreUnavailable = "session_store_unavailable"
+
+	// sessionStoreRetryAfter is the number of seconds clients are asked to wait
+	// while the session store is unavailable
+	sessionStoreRetryAfter = 5
+)
+
+// authenticate validates the bearer access token of a request and returns its claims
+func authenticate(r *http.Request, jwtSvc *service.JWTService) (*service.TokenClaims, error) {
+	// Extract token from Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, http.ErrNoCookie
+	}
+
+	// Remove "Bearer " prefix
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, http.ErrNoCookie
+	}
+
+	// Validate token
+	return jwtSvc.ValidateAccessToken(r.Context(), tokenString)
+}
+
+// sendAuthError rejects a request whose access token could not be validated. An
+// unavailable session store is not the client's fault, so it is not reported as
+// an invalid token.
+func sendAuthError(w http.ResponseWriter, err error) {
+	if isUnavailable(err) {
+		sendUnavailable(w, err)
+		return
+	}
+	sendError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+// isUnavailable reports whether a request failed because the session store could not be reached
+func isUnavailable(err error) bool {
+	return errors.Is(err, service.ErrSessionStoreUnavailable)
+}
+
+// isTenantError reports whether login was refused because the user has no usable customer
+func isTenantError(err error) bool {
+	return errors.Is(err, service.ErrNoActiveCustomer) || errors.Is(err, service.ErrCustomerSuspended)
+}
+
+// isPasswordError reports whether a new password was rejected by the strength or reuse rules
+func isPasswordError(err error) bool {
+	return errors.Is(err, service.ErrPasswordTooShort) ||
+		errors.Is(err, service.ErrPasswordTooLong) ||
+		errors.Is(err, service.ErrPasswordNoUppercase) ||
+		errors.Is(err, service.ErrPasswordNoLowercase) ||
+		errors.Is(err, service.ErrPasswordNoDigit) ||
+		errors.Is(err, service.ErrPasswordNoSpecial) ||
+		errors.Is(err, service.ErrPasswordTooWeak) ||
+		errors.Is(err, service.ErrPasswordTooSimilar) ||
+		errors.Is(err, service.ErrPasswordBreached) ||
+		errors.Is(err, service.ErrPasswordReused)
+}
+
+func sendJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func sendError(w http.ResponseWriter, status int, message string) {
+	sendJSON(w, status, ErrorResponse{
+		Error:   http.StatusText(status),
+		Message: message,
+	})
+}
+
+func sendErrorCode(w http.ResponseWriter, status int, code, message string) {
+	sendJSON(w, status, ErrorResponse{
+		Error:   http.StatusText(status),
+		Message: message,
+		Code:    code,
+	})
+}
+
+// sendUnavailable tells the client to retry once the session store is back
+func sendUnavailable(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(sessionStoreRetryAfter))
+	sendErrorCode(w, http.StatusServiceUnavailable, ErrCodeSessionStoreUnavailable, err.Error())
+}
+
+// sendThrottled tells the client to wait before the next login attempt
+func sendThrottled(w http.ResponseWriter, err *service.LoginThrottledError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	sendError(w, http.StatusTooManyRequests, err.Error())
+}
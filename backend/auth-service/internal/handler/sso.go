@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// SSOHandler handles single sign-on HTTP requests. The login and callback
+// endpoints are visited by the browser and end with a redirect to the portal,
+// which exchanges the one-time code it receives for tokens.
+type SSOHandler struct {
+	ssoSvc     *service.SSOService
+	events     service.EventRecorder
+	appBaseURL string
+}
+
+// NewSSOHandler creates a new single sign-on handler. appBaseURL is the portal URL
+// logins are completed at. Logins that fail before the portal gets a code are
+// recorded to events; the others are recorded when the code is exchanged.
+func NewSSOHandler(ssoSvc *service.SSOService, events service.EventRecorder, appBaseURL string) *SSOHandler {
+	return &SSOHandler{
+		ssoSvc:     ssoSvc,
+		events:     events,
+		appBaseURL: strings.TrimSuffix(appBaseURL, "/"),
+	}
+}
+
+// SSOTokenRequest represents a request to exchange a single sign-on code for tokens
+type SSOTokenRequest struct {
+	Code string `json:"code"`
+}
+
+// Login redirects the browser to the identity provider of the customer given by the customer parameter
+func (h *SSOHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	customerUUID := r.URL.Query().Get("customer")
+	if customerUUID == "" {
+		sendError(w, http.StatusBadRequest, "customer is required")
+		return
+	}
+
+	redirectURL, err := h.ssoSvc.BeginLogin(r.Context(), customerUUID)
+	if err != nil {
+		h.redirectError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// OIDCCallback handles the redirect back from an OpenID Connect provider
+func (h *SSOHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	if idpError := query.Get("error"); idpError != "" {
+		log.Printf("SSO login refused by identity provider: %s: %s", idpError, query.Get("error_description"))
+		h.redirect(w, r, "error", "identity_provider_error")
+		return
+	}
+
+	code, err := h.ssoSvc.FinishOIDC(r.Context(), query.Get("state"), query.Get("code"))
+	if err != nil {
+		h.redirectError(w, r, err)
+		return
+	}
+
+	h.redirect(w, r, "code", code)
+}
+
+// SAMLACS handles SAML responses posted by an identity provider
+func (h *SSOHandler) SAMLACS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	code, err := h.ssoSvc.FinishSAML(r.Context(), r.PostForm.Get("SAMLResponse"), r.PostForm.Get("RelayState"))
+	if err != nil {
+		h.redirectError(w, r, err)
+		return
+	}
+
+	h.redirect(w, r, "code", code)
+}
+
+// SAMLMetadata serves the SAML service provider metadata of the customer given by the customer parameter
+func (h *SSOHandler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	metadata, err := h.ssoSvc.ServiceProviderMetadata(r.Context(), r.URL.Query().Get("customer"))
+	if err != nil {
+		if errors.Is(err, service.ErrSSONotConfigured) {
+			sendError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+}
+
+// Token exchanges the one-time code of a single sign-on login for tokens
+func (h *SSOHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req SSOTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Code == "" {
+		sendError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	resp, err := h.ssoSvc.Exchange(r.Context(), req.Code)
+	if err != nil {
+		if isUnavailable(err) {
+			sendUnavailable(w, err)
+			return
+		}
+		if isTenantError(err) {
+			sendError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	sendJSON(w, http.StatusOK, LoginResponse{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		User: &UserInfo{
+			ID:            resp.User.ID,
+			UUID:          resp.User.UUID,
+			Email:         resp.User.Email,
+			FirstName:     resp.User.FirstName,
+			LastName:      resp.User.LastName,
+			Role:          string(resp.User.Role),
+			MFAEnabled:    resp.User.MFAEnabled,
+			EmailVerified: resp.User.IsEmailVerified(),
+		},
+	})
+}
+
+// redirect sends the browser to the portal page that completes single sign-on logins
+func (h *SSOHandler) redirect(w http.ResponseWriter, r *http.Request, key, value string) {
+	http.Redirect(w, r, h.appBaseURL+"/sso/complete?"+key+"="+url.QueryEscape(value), http.StatusFound)
+}
+
+// redirectError sends the browser to the portal with an error code for a failed login.
+// The details are only logged, as they may describe the identity provider's configuration.
+func (h *SSOHandler) redirectError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("SSO login failed: %v", err)
+
+	event := service.NewAuditEvent(r.Context(), service.AuditEventSSOLogin, 0, "", service.FailureReason(err))
+	event.Outcome = domain.AuthEventFailure
+	recordEvent(r, h.events, event)
+
+	var code string
+	switch {
+	case errors.Is(err, service.ErrSSONotConfigured):
+		code = "not_configured"
+	case errors.Is(err, service.ErrInvalidSSOResponse):
+		code = "invalid_response"
+	case errors.Is(err, service.ErrSSOAccountConflict):
+		code = "account_conflict"
+	case errors.Is(err, service.ErrSSODomainNotAllowed):
+		code = "domain_not_allowed"
+	case isTenantError(err):
+		code = "customer_unavailable"
+	default:
+		code = "server_error"
+	}
+
+	h.redirect(w, r, "error", code)
+}
+
+// RegisterRoutes registers all single sign-on routes
+func (h *SSOHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/sso/login", h.Login)
+	mux.HandleFunc("/api/v1/auth/sso/token", h.Token)
+	mux.HandleFunc(service.SSOOIDCCallbackPath, h.OIDCCallback)
+	mux.HandleFunc(service.SSOSAMLACSPath, h.SAMLACS)
+	mux.HandleFunc(service.SSOSAMLMetadataPath, h.SAMLMetadata)
+}
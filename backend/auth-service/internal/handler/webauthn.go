@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+// WebAuthnHandler handles WebAuthn (passkey and security key) HTTP requests.
+// Login ceremonies are finished through the login and MFA challenge endpoints.
+type WebAuthnHandler struct {
+	webauthnSvc *service.WebAuthnService
+	authSvc     *service.AuthService
+	jwtSvc      *service.JWTService
+	events      service.EventRecorder
+}
+
+// NewWebAuthnHandler creates a new WebAuthn handler. Registered and removed
+// credentials are recorded to events.
+func NewWebAuthnHandler(webauthnSvc *service.WebAuthnService, authSvc *service.AuthService, jwtSvc *service.JWTService, events service.EventRecorder) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webauthnSvc: webauthnSvc,
+		authSvc:     authSvc,
+		jwtSvc:      jwtSvc,
+		events:      events,
+	}
+}
+
+// WebAuthnCredentialInfo represents a registered WebAuthn credential in responses
+type WebAuthnCredentialInfo struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"backup_eligible"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// FinishWebAuthnRegistrationRequest represents the response of navigator.credentials.create()
+type FinishWebAuthnRegistrationRequest struct {
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// BeginWebAuthnLoginRequest represents a request to start a WebAuthn login
+type BeginWebAuthnLoginRequest struct {
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+// BeginRegistration handles requests to start registering a credential
+func (h *WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	creation, err := h.webauthnSvc.BeginRegistration(r.Context(), claims.UserID)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	sendJSON(w, http.StatusOK, creation)
+}
+
+// FinishRegistration handles requests to verify and store a new credential
+func (h *WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	var req FinishWebAuthnRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if len(req.Credential) == 0 {
+		sendError(w, http.StatusBadRequest, "credential is required")
+		return
+	}
+
+	credential, err := h.webauthnSvc.FinishRegistration(r.Context(), claims.UserID, req.Name, req.Credential)
+	if err != nil {
+		sendWebAuthnError(w, err)
+		return
+	}
+
+	h.recordCredentialEvent(r, service.AuditEventWebAuthnCredentialAdded, claims, credential.Name)
+
+	sendJSON(w, http.StatusCreated, newWebAuthnCredentialInfo(credential))
+}
+
+// BeginLogin handles requests to start a WebAuthn login. With the mfa_token from
+// login the passkey is the second factor; without it the login is passwordless.
+func (h *WebAuthnHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// The body is optional
+	var req BeginWebAuthnLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	assertion, err := h.authSvc.BeginWebAuthnLogin(r.Context(), req.MFAToken)
+	if err != nil {
+		sendWebAuthnError(w, err)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, assertion)
+}
+
+// Credentials handles listing and removing the current user's credentials
+func (h *WebAuthnHandler) Credentials(w http.ResponseWriter, r *http.Request) {
+	claims, err := authenticate(r, h.jwtSvc)
+	if err != nil {
+		sendAuthError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		credentials, err := h.webauthnSvc.ListCredentials(r.Context(), claims.UserID)
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		infos := make([]WebAuthnCredentialInfo, 0, len(credentials))
+		for _, credential := range credentials {
+			infos = append(infos, newWebAuthnCredentialInfo(credential))
+		}
+
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"credentials": infos,
+		})
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+
+		if err := h.webauthnSvc.DeleteCredential(r.Context(), claims.UserID, id); err != nil {
+			sendWebAuthnError(w, err)
+			return
+		}
+
+		h.recordCredentialEvent(r, service.AuditEventWebAuthnCredentialRemoved, claims, "credential "+strconv.FormatInt(id, 10))
+
+		sendJSON(w, http.StatusOK, map[string]string{
+			"message": "credential removed successfully",
+		})
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// recordCredentialEvent records a change to the credentials of the token's user
+func (h *WebAuthnHandler) recordCredentialEvent(r *http.Request, eventType service.AuditEventType, claims *service.TokenClaims, reason string) {
+	event := service.NewAuditEvent(r.Context(), eventType, claims.UserID, claims.Email, reason)
+	if claims.CustomerID != nil {
+		event.CustomerID = *claims.CustomerID
+	}
+	recordEvent(r, h.events, event)
+}
+
+func newWebAuthnCredentialInfo(credential *domain.WebAuthnCredential) WebAuthnCredentialInfo {
+	return WebAuthnCredentialInfo{
+		ID:             credential.ID,
+		Name:           credential.Name,
+		BackupEligible: credential.BackupEligible,
+		LastUsedAt:     credential.LastUsedAt,
+		CreatedAt:      credential.CreatedAt,
+	}
+}
+
+func sendWebAuthnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebAuthnVerificationFailed),
+		errors.Is(err, service.ErrWebAuthnCeremonyNotFound),
+		errors.Is(err, service.ErrNoWebAuthnCredentials):
+		sendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidToken),
+		errors.Is(err, service.ErrExpiredToken),
+		errors.Is(err, service.ErrRevokedToken):
+		sendError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, domain.ErrWebAuthnCredentialNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrWebAuthnCredentialAlreadyExists):
+		sendError(w, http.StatusConflict, err.Error())
+	default:
+		sendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// RegisterRoutes registers all WebAuthn routes
+func (h *WebAuthnHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/auth/mfa/webauthn/register/begin", h.BeginRegistration)
+	mux.HandleFunc("/api/v1/auth/mfa/webauthn/register/finish", h.FinishRegistration)
+	mux.HandleFunc("/api/v1/auth/mfa/webauthn/login/begin", h.BeginLogin)
+	mux.HandleFunc("/api/v1/auth/mfa/webauthn/credentials", h.Credentials)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// PostgresAccountTokenRepository implements AccountTokenRepository using PostgreSQL
+type PostgresAccountTokenRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAccountTokenRepository creates a new PostgreSQL account token repository
+func NewPostgresAccountTokenRepository(db *sql.DB) *PostgresAccountTokenRepository {
+	return &PostgresAccountTokenRepository{
+		db: db,
+	}
+}
+
+// Create records a newly issued token
+func (r *PostgresAccountTokenRepository) Create(ctx context.Context, token *domain.AccountToken) error {
+	query := `
+		INSERT INTO account_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create account token: %w", err)
+	}
+
+	return nil
+}
+
+// Find retrieves an unused, unexpired token without redeeming it
+func (r *PostgresAccountTokenRepository) Find(ctx context.Context, purpose domain.AccountTokenPurpose, tokenHash string) (*domain.AccountToken, error) {
+	query := `
+		SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at
+		FROM account_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+	`
+
+	token, err := scanAccountToken(r.db.QueryRowContext(ctx, query, tokenHash, purpose))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrAccountTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get account token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Consume atomically marks an unused, unexpired token as used and returns it.
+// The conditional update makes sure a token can be redeemed only once, even by
+// concurrent requests.
+func (r *PostgresAccountTokenRepository) Consume(ctx context.Context, purpose domain.AccountTokenPurpose, tokenHash string) (*domain.AccountToken, error) {
+	query := `
+		UPDATE account_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
+	`
+
+	token, err := scanAccountToken(r.db.QueryRowContext(ctx, query, tokenHash, purpose))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrAccountTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to consume account token: %w", err)
+	}
+
+	return token, nil
+}
+
+// DeleteForUser deletes every token of a user issued for the given purpose
+func (r *PostgresAccountTokenRepository) DeleteForUser(ctx context.Context, userID int64, purpose domain.AccountTokenPurpose) error {
+	query := `
+		DELETE FROM account_tokens
+		WHERE user_id = $1 AND purpose = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, purpose); err != nil {
+		return fmt.Errorf("failed to delete account tokens: %w", err)
+	}
+
+	return nil
+}
+
+func scanAccountToken(row *sql.Row) (*domain.AccountToken, error) {
+	token := &domain.AccountToken{}
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
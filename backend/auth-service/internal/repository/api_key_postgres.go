@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/audit"
+	"github.com/lib/pq"
+)
+
+// PostgresAPIKeyRepository implements APIKeyRepository using PostgreSQL
+type PostgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAPIKeyRepository creates a new PostgreSQL API key repository
+func NewPostgresAPIKeyRepository(db *sql.DB) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{
+		db: db,
+	}
+}
+
+const apiKeyColumns = `id, uuid, name, key_prefix, key_hash, user_id, customer_id, created_by, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+// Create stores a new API key and records it in the audit log
+func (r *PostgresAPIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	return withTenantTx(ctx, r.db, key.CustomerID, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO api_keys (name, key_prefix, key_hash, user_id, customer_id, created_by, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, uuid, created_at
+		`
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			key.Name,
+			key.KeyPrefix,
+			key.KeyHash,
+			key.UserID,
+			key.CustomerID,
+			key.CreatedBy,
+			pq.Array(key.Scopes),
+			key.ExpiresAt,
+		).Scan(&key.ID, &key.UUID, &key.CreatedAt)
+
+		if err != nil {
+			return fmt.Errorf("failed to create api key: %w", err)
+		}
+
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   key.CustomerID,
+			ResourceType: auditAPIKey,
+			ResourceID:   key.UUID,
+			Action:       audit.ActionCreate,
+			After:        auditAPIKeyOf(key),
+		})
+	})
+}
+
+// GetByHash retrieves an API key by the hash of the key
+func (r *PostgresAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetByID retrieves an API key by ID
+func (r *PostgresAPIKeyRepository) GetByID(ctx context.Context, id int64) (*domain.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListByUser returns the personal access tokens of a user, newest first
+func (r *PostgresAPIKeyRepository) ListByUser(ctx context.Context, userID int64) ([]*domain.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	return r.list(ctx, query, userID)
+}
+
+// ListByCustomer returns the keys scoped to a customer, newest first
+func (r *PostgresAPIKeyRepository) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE customer_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	return r.list(ctx, query, customerID)
+}
+
+func (r *PostgresAPIKeyRepository) list(ctx context.Context, query string, args ...interface{}) ([]*domain.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Revoke revokes an API key and records it in the audit log
+func (r *PostgresAPIKeyRepository) Revoke(ctx context.Context, id int64) error {
+	// The customer of a key never changes, so it can be looked up first
+	existing, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return withTenantTx(ctx, r.db, existing.CustomerID, func(tx *sql.Tx) error {
+		query := `
+			UPDATE api_keys
+			SET revoked_at = NOW()
+			WHERE id = $1 AND revoked_at IS NULL
+			RETURNING ` + apiKeyColumns
+
+		key, err := scanAPIKey(tx.QueryRowContext(ctx, query, id))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.ErrAPIKeyNotFound
+			}
+			return fmt.Errorf("failed to revoke api key: %w", err)
+		}
+
+		before := auditAPIKeyOf(key)
+		before.RevokedAt = nil
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   key.CustomerID,
+			ResourceType: auditAPIKey,
+			ResourceID:   key.UUID,
+			Action:       audit.ActionUpdate,
+			Before:       before,
+			After:        auditAPIKeyOf(key),
+		})
+	})
+}
+
+// UpdateLastUsed records that a key was used, at most once a minute
+func (r *PostgresAPIKeyRepository) UpdateLastUsed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to update api key last used: %w", err)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	err := row.Scan(
+		&key.ID,
+		&key.UUID,
+		&key.Name,
+		&key.KeyPrefix,
+		&key.KeyHash,
+		&key.UserID,
+		&key.CustomerID,
+		&key.CreatedBy,
+		pq.Array(&key.Scopes),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/auth"
+	"github.com/hosterizer/shared/database"
+)
+
+// Resource types of the tenant resources the auth service records in the audit log
+const (
+	auditMembership = "membership"
+	auditInvitation = "invitation"
+	auditAPIKey     = "api_key"
+)
+
+// withTenantTx runs fn in a transaction scoped to a customer, if any, so that a
+// change and the audit entry recorded for it with audit.Record commit together.
+// The role is taken from the claims of the request.
+func withTenantTx(ctx context.Context, db *sql.DB, customerID *int64, fn func(*sql.Tx) error) error {
+	var tc database.TenantContext
+	if customerID != nil {
+		tc.CustomerID = *customerID
+	}
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		tc.UserRole = claims.Role
+	}
+
+	return database.WithTenantContext(ctx, db, tc, fn)
+}
+
+// auditedMembership is what the audit log keeps of a membership
+type auditedMembership struct {
+	UserID int64                 `json:"user_id"`
+	Role   domain.MembershipRole `json:"role"`
+}
+
+// auditedInvitation is what the audit log keeps of an invitation
+type auditedInvitation struct {
+	Email          string                `json:"email"`
+	Role           domain.MembershipRole `json:"role"`
+	InvitedBy      *int64                `json:"invited_by"`
+	ExpiresAt      time.Time             `json:"expires_at"`
+	AcceptedAt     *time.Time            `json:"accepted_at"`
+	AcceptedUserID *int64                `json:"accepted_user_id"`
+	RevokedAt      *time.Time            `json:"revoked_at"`
+}
+
+func auditInvitationOf(invitation *domain.Invitation) *auditedInvitation {
+	return &auditedInvitation{
+		Email:          invitation.Email,
+		Role:           invitation.Role,
+		InvitedBy:      invitation.InvitedBy,
+		ExpiresAt:      invitation.ExpiresAt,
+		AcceptedAt:     invitation.AcceptedAt,
+		AcceptedUserID: invitation.AcceptedUserID,
+		RevokedAt:      invitation.RevokedAt,
+	}
+}
+
+// auditedAPIKey is what the audit log keeps of an API key; never its hash
+type auditedAPIKey struct {
+	Name      string     `json:"name"`
+	KeyPrefix string     `json:"key_prefix"`
+	UserID    *int64     `json:"user_id"`
+	CreatedBy *int64     `json:"created_by"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func auditAPIKeyOf(key *domain.APIKey) *auditedAPIKey {
+	return &auditedAPIKey{
+		Name:      key.Name,
+		KeyPrefix: key.KeyPrefix,
+		UserID:    key.UserID,
+		CreatedBy: key.CreatedBy,
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/lib/pq"
+)
+
+// PostgresAuthEventRepository implements AuthEventRepository using PostgreSQL
+type PostgresAuthEventRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAuthEventRepository creates a new PostgreSQL auth event repository
+func NewPostgresAuthEventRepository(db *sql.DB) *PostgresAuthEventRepository {
+	return &PostgresAuthEventRepository{
+		db: db,
+	}
+}
+
+// Create appends an event to the log
+func (r *PostgresAuthEventRepository) Create(ctx context.Context, event *domain.AuthEvent) error {
+	query := `
+		INSERT INTO auth_events (event_type, outcome, user_id, actor_id, customer_id, email, ip_address, user_agent, reason, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		event.Type,
+		event.Outcome,
+		event.UserID,
+		event.ActorID,
+		event.CustomerID,
+		event.Email,
+		event.IPAddress,
+		event.UserAgent,
+		event.Reason,
+		event.OccurredAt,
+	).Scan(&event.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to create auth event: %w", err)
+	}
+
+	return nil
+}
+
+// List returns up to limit events matching the filter with an ID less than
+// beforeID, newest first
+func (r *PostgresAuthEventRepository) List(ctx context.Context, filter domain.AuthEventFilter, beforeID int64, limit int) ([]*domain.AuthEvent, error) {
+	conditions, args := authEventFilterConditions(filter)
+	if beforeID > 0 {
+		args = append(args, beforeID)
+		conditions = append(conditions, fmt.Sprintf("id < $%d", len(args)))
+	}
+	args = append(args, limit)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+		SELECT id, event_type, outcome, user_id, actor_id, customer_id, email, ip_address, user_agent, reason, occurred_at
+		FROM auth_events
+		` + where + fmt.Sprintf(`
+		ORDER BY id DESC
+		LIMIT $%d
+	`, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*domain.AuthEvent
+	for rows.Next() {
+		event := &domain.AuthEvent{}
+		if err := rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.Outcome,
+			&event.UserID,
+			&event.ActorID,
+			&event.CustomerID,
+			&event.Email,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.Reason,
+			&event.OccurredAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate auth events: %w", err)
+	}
+
+	return events, nil
+}
+
+// authEventFilterConditions returns the WHERE conditions and their arguments for a filter
+func authEventFilterConditions(filter domain.AuthEventFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+
+	if filter.CustomerID != nil {
+		args = append(args, *filter.CustomerID)
+		conditions = append(conditions, fmt.Sprintf(`(customer_id = $%[1]d OR (customer_id IS NULL AND user_id IN (
+			SELECT user_id FROM customer_memberships WHERE customer_id = $%[1]d
+		)))`, len(args)))
+	}
+
+	if len(filter.Types) > 0 {
+		args = append(args, pq.Array(filter.Types))
+		conditions = append(conditions, fmt.Sprintf("event_type = ANY($%d)", len(args)))
+	}
+
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		conditions = append(conditions, fmt.Sprintf("occurred_at >= $%d", len(args)))
+	}
+
+	if filter.Until != nil {
+		args = append(args, *filter.Until)
+		conditions = append(conditions, fmt.Sprintf("occurred_at < $%d", len(args)))
+	}
+
+	return conditions, args
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/lib/pq"
+)
+
+// PostgresCustomerRepository implements CustomerRepository using PostgreSQL
+type PostgresCustomerRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresCustomerRepository creates a new PostgreSQL customer repository
+func NewPostgresCustomerRepository(db *sql.DB) *PostgresCustomerRepository {
+	return &PostgresCustomerRepository{
+		db: db,
+	}
+}
+
+// GetByID retrieves a customer by ID
+func (r *PostgresCustomerRepository) GetByID(ctx context.Context, id int64) (*domain.Customer, error) {
+	query := `
+		SELECT c.id, c.uuid, c.name, c.status, c.owner_user_id, c.settings, s.oidc_client_secret
+		FROM customers c
+		LEFT JOIN customer_sso_secrets s ON s.customer_id = c.id
+		WHERE c.id = $1
+	`
+
+	customer, err := scanCustomer(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrCustomerNotFound
+		}
+		return nil, fmt.Errorf("failed to get customer by id: %w", err)
+	}
+
+	return customer, nil
+}
+
+// GetByUUID retrieves a customer by UUID
+func (r *PostgresCustomerRepository) GetByUUID(ctx context.Context, uuid string) (*domain.Customer, error) {
+	query := `
+		SELECT c.id, c.uuid, c.name, c.status, c.owner_user_id, c.settings, s.oidc_client_secret
+		FROM customers c
+		LEFT JOIN customer_sso_secrets s ON s.customer_id = c.id
+		WHERE c.uuid = $1
+	`
+
+	customer, err := scanCustomer(r.db.QueryRowContext(ctx, query, uuid))
+	if err != nil {
+		// A malformed UUID cannot match any customer
+		var pqErr *pq.Error
+		if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pqErr) && pqErr.Code == "22P02") { // invalid_text_representation
+			return nil, domain.ErrCustomerNotFound
+		}
+		return nil, fmt.Errorf("failed to get customer by uuid: %w", err)
+	}
+
+	return customer, nil
+}
+
+func scanCustomer(row *sql.Row) (*domain.Customer, error) {
+	customer := &domain.Customer{}
+	var settings []byte
+	var clientSecret sql.NullString
+	err := row.Scan(
+		&customer.ID,
+		&customer.UUID,
+		&customer.Name,
+		&customer.Status,
+		&customer.OwnerUserID,
+		&settings,
+		&clientSecret,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unmarshalCustomerSettings(settings, &customer.Settings); err != nil {
+		return nil, err
+	}
+
+	// The OIDC client secret lives apart from the settings customers can read
+	if sso := customer.Settings.SSO; sso != nil && sso.OIDC != nil {
+		sso.OIDC.ClientSecret = clientSecret.String
+	}
+
+	return customer, nil
+}
+
+// unmarshalCustomerSettings decodes the settings JSONB column of a customer
+func unmarshalCustomerSettings(data []byte, settings *domain.CustomerSettings) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return fmt.Errorf("failed to decode customer settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/audit"
+	"github.com/lib/pq"
+)
+
+// PostgresInvitationRepository implements InvitationRepository using PostgreSQL
+type PostgresInvitationRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresInvitationRepository creates a new PostgreSQL invitation repository
+func NewPostgresInvitationRepository(db *sql.DB) *PostgresInvitationRepository {
+	return &PostgresInvitationRepository{
+		db: db,
+	}
+}
+
+const invitationColumns = `id, uuid, customer_id, email, role, invited_by, expires_at, accepted_at, accepted_user_id, revoked_at, created_at`
+
+// Create records a new invitation and records it in the audit log
+func (r *PostgresInvitationRepository) Create(ctx context.Context, invitation *domain.Invitation) error {
+	return withTenantTx(ctx, r.db, &invitation.CustomerID, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO invitations (customer_id, email, role, invited_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, uuid, created_at
+		`
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			invitation.CustomerID,
+			invitation.Email,
+			invitation.Role,
+			invitation.InvitedBy,
+			invitation.ExpiresAt,
+		).Scan(&invitation.ID, &invitation.UUID, &invitation.CreatedAt)
+
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+				return domain.ErrInvitationAlreadyExists
+			}
+			return fmt.Errorf("failed to create invitation: %w", err)
+		}
+
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   &invitation.CustomerID,
+			ResourceType: auditInvitation,
+			ResourceID:   invitation.UUID,
+			Action:       audit.ActionCreate,
+			After:        auditInvitationOf(invitation),
+		})
+	})
+}
+
+// GetByUUID retrieves an invitation by UUID
+func (r *PostgresInvitationRepository) GetByUUID(ctx context.Context, uuid string) (*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE uuid = $1`
+
+	invitation, err := scanInvitation(r.db.QueryRowContext(ctx, query, uuid))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrInvitationNotFound
+		}
+		// A malformed UUID cannot match any invitation
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "22P02" { // invalid_text_representation
+			return nil, domain.ErrInvitationNotFound
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// ListByCustomer returns every invitation of a customer, newest first
+func (r *PostgresInvitationRepository) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM invitations
+		WHERE customer_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []*domain.Invitation
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// Revoke revokes a pending invitation of a customer and records it in the audit log
+func (r *PostgresInvitationRepository) Revoke(ctx context.Context, customerID, id int64) error {
+	return withTenantTx(ctx, r.db, &customerID, func(tx *sql.Tx) error {
+		query := `
+			UPDATE invitations
+			SET revoked_at = NOW()
+			WHERE id = $1 AND customer_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+			RETURNING ` + invitationColumns
+
+		invitation, err := scanInvitation(tx.QueryRowContext(ctx, query, id, customerID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.ErrInvitationNotFound
+			}
+			return fmt.Errorf("failed to revoke invitation: %w", err)
+		}
+
+		before := auditInvitationOf(invitation)
+		before.RevokedAt = nil
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   &customerID,
+			ResourceType: auditInvitation,
+			ResourceID:   invitation.UUID,
+			Action:       audit.ActionUpdate,
+			Before:       before,
+			After:        auditInvitationOf(invitation),
+		})
+	})
+}
+
+// Accept atomically marks a pending, unexpired invitation as accepted by a user
+// and records it in the audit log. The conditional update makes sure an
+// invitation can be accepted only once, even by concurrent requests.
+func (r *PostgresInvitationRepository) Accept(ctx context.Context, uuid string, userID int64) error {
+	// The customer of an invitation never changes, so it can be looked up first
+	pending, err := r.GetByUUID(ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	return withTenantTx(ctx, r.db, &pending.CustomerID, func(tx *sql.Tx) error {
+		query := `
+			UPDATE invitations
+			SET 
+				accepted_at = NOW(),
+				accepted_user_id = $2
+			WHERE uuid = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING ` + invitationColumns
+
+		invitation, err := scanInvitation(tx.QueryRowContext(ctx, query, uuid, userID))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.ErrInvitationNotFound
+			}
+			return fmt.Errorf("failed to accept invitation: %w", err)
+		}
+
+		before := auditInvitationOf(invitation)
+		before.AcceptedAt = nil
+		before.AcceptedUserID = nil
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:      &userID,
+			CustomerID:   &invitation.CustomerID,
+			ResourceType: auditInvitation,
+			ResourceID:   invitation.UUID,
+			Action:       audit.ActionUpdate,
+			Before:       before,
+			After:        auditInvitationOf(invitation),
+		})
+	})
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInvitation(row rowScanner) (*domain.Invitation, error) {
+	invitation := &domain.Invitation{}
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.UUID,
+		&invitation.CustomerID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.AcceptedAt,
+		&invitation.AcceptedUserID,
+		&invitation.RevokedAt,
+		&invitation.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
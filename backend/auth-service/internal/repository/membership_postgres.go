@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/audit"
+	"github.com/lib/pq"
+)
+
+// PostgresMembershipRepository implements MembershipRepository using PostgreSQL
+type PostgresMembershipRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresMembershipRepository creates a new PostgreSQL membership repository
+func NewPostgresMembershipRepository(db *sql.DB) *PostgresMembershipRepository {
+	return &PostgresMembershipRepository{
+		db: db,
+	}
+}
+
+// Create adds a user to a customer and records it in the audit log
+func (r *PostgresMembershipRepository) Create(ctx context.Context, membership *domain.CustomerMembership) error {
+	return withTenantTx(ctx, r.db, &membership.CustomerID, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO customer_memberships (customer_id, user_id, role)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at, updated_at
+		`
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			membership.CustomerID,
+			membership.UserID,
+			membership.Role,
+		).Scan(&membership.ID, &membership.CreatedAt, &membership.UpdatedAt)
+
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+				return domain.ErrMembershipAlreadyExists
+			}
+			return fmt.Errorf("failed to create membership: %w", err)
+		}
+
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   &membership.CustomerID,
+			ResourceType: auditMembership,
+			ResourceID:   strconv.FormatInt(membership.ID, 10),
+			Action:       audit.ActionCreate,
+			After:        &auditedMembership{UserID: membership.UserID, Role: membership.Role},
+		})
+	})
+}
+
+// Get retrieves the membership of a user in a customer
+func (r *PostgresMembershipRepository) Get(ctx context.Context, customerID, userID int64) (*domain.CustomerMembership, error) {
+	query := `
+		SELECT id, customer_id, user_id, role, created_at, updated_at
+		FROM customer_memberships
+		WHERE customer_id = $1 AND user_id = $2
+	`
+
+	membership := &domain.CustomerMembership{}
+	err := r.db.QueryRowContext(ctx, query, customerID, userID).Scan(
+		&membership.ID,
+		&membership.CustomerID,
+		&membership.UserID,
+		&membership.Role,
+		&membership.CreatedAt,
+		&membership.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrMembershipNotFound
+		}
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+
+	return membership, nil
+}
+
+// ListByUser returns every membership of a user with its customer, oldest first
+func (r *PostgresMembershipRepository) ListByUser(ctx context.Context, userID int64) ([]*domain.CustomerMembership, error) {
+	query := `
+		SELECT
+			m.id, m.customer_id, m.user_id, m.role, m.created_at, m.updated_at,
+			c.id, c.uuid, c.name, c.status, c.owner_user_id, c.settings
+		FROM customer_memberships m
+		JOIN customers c ON c.id = m.customer_id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at, m.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships for user: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*domain.CustomerMembership
+	for rows.Next() {
+		membership := &domain.CustomerMembership{Customer: &domain.Customer{}}
+		var settings []byte
+		if err := rows.Scan(
+			&membership.ID,
+			&membership.CustomerID,
+			&membership.UserID,
+			&membership.Role,
+			&membership.CreatedAt,
+			&membership.UpdatedAt,
+			&membership.Customer.ID,
+			&membership.Customer.UUID,
+			&membership.Customer.Name,
+			&membership.Customer.Status,
+			&membership.Customer.OwnerUserID,
+			&settings,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		if err := unmarshalCustomerSettings(settings, &membership.Customer.Settings); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list memberships for user: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// ListByCustomer returns every membership of a customer with its user, oldest first
+func (r *PostgresMembershipRepository) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.CustomerMembership, error) {
+	query := `
+		SELECT
+			m.id, m.customer_id, m.user_id, m.role, m.created_at, m.updated_at,
+			u.id, u.uuid, u.email, u.first_name, u.last_name, u.role
+		FROM customer_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.customer_id = $1
+		ORDER BY m.created_at, m.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships for customer: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*domain.CustomerMembership
+	for rows.Next() {
+		membership := &domain.CustomerMembership{User: &domain.User{}}
+		if err := rows.Scan(
+			&membership.ID,
+			&membership.CustomerID,
+			&membership.UserID,
+			&membership.Role,
+			&membership.CreatedAt,
+			&membership.UpdatedAt,
+			&membership.User.ID,
+			&membership.User.UUID,
+			&membership.User.Email,
+			&membership.User.FirstName,
+			&membership.User.LastName,
+			&membership.User.Role,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		memberships = append(memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list memberships for customer: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// UpdateRole changes the role of a user in a customer and records it in the audit
+// log. It returns ErrLastOwner instead of demoting the customer's only owner.
+func (r *PostgresMembershipRepository) UpdateRole(ctx context.Context, customerID, userID int64, role domain.MembershipRole) error {
+	return withTenantTx(ctx, r.db, &customerID, func(tx *sql.Tx) error {
+		if role != domain.MembershipRoleOwner {
+			if err := ensureAnotherOwner(ctx, tx, customerID, userID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			SELECT id, role
+			FROM customer_memberships
+			WHERE customer_id = $1 AND user_id = $2
+			FOR UPDATE
+		`
+
+		var (
+			id      int64
+			oldRole domain.MembershipRole
+		)
+		if err := tx.QueryRowContext(ctx, query, customerID, userID).Scan(&id, &oldRole); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.ErrMembershipNotFound
+			}
+			return fmt.Errorf("failed to get membership: %w", err)
+		}
+
+		query = `
+			UPDATE customer_memberships
+			SET 
+				role = $1,
+				updated_at = NOW()
+			WHERE id = $2
+		`
+
+		if _, err := tx.ExecContext(ctx, query, role, id); err != nil {
+			return fmt.Errorf("failed to update membership role: %w", err)
+		}
+
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   &customerID,
+			ResourceType: auditMembership,
+			ResourceID:   strconv.FormatInt(id, 10),
+			Action:       audit.ActionUpdate,
+			Before:       &auditedMembership{UserID: userID, Role: oldRole},
+			After:        &auditedMembership{UserID: userID, Role: role},
+		})
+	})
+}
+
+// Delete removes a user from a customer and records it in the audit log. It
+// returns ErrLastOwner instead of removing the customer's only owner.
+func (r *PostgresMembershipRepository) Delete(ctx context.Context, customerID, userID int64) error {
+	return withTenantTx(ctx, r.db, &customerID, func(tx *sql.Tx) error {
+		if err := ensureAnotherOwner(ctx, tx, customerID, userID); err != nil {
+			return err
+		}
+
+		query := `
+			DELETE FROM customer_memberships
+			WHERE customer_id = $1 AND user_id = $2
+			RETURNING id, role
+		`
+
+		var (
+			id   int64
+			role domain.MembershipRole
+		)
+		if err := tx.QueryRowContext(ctx, query, customerID, userID).Scan(&id, &role); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.ErrMembershipNotFound
+			}
+			return fmt.Errorf("failed to delete membership: %w", err)
+		}
+
+		return audit.Record(ctx, tx, audit.Entry{
+			CustomerID:   &customerID,
+			ResourceType: auditMembership,
+			ResourceID:   strconv.FormatInt(id, 10),
+			Action:       audit.ActionDelete,
+			Before:       &auditedMembership{UserID: userID, Role: role},
+		})
+	})
+}
+
+// ensureAnotherOwner returns ErrLastOwner if the user is the customer's only
+// owner. It locks the owner memberships until the transaction ends, so
+// concurrent demotions and removals see each other and cannot both go through.
+func ensureAnotherOwner(ctx context.Context, tx *sql.Tx, customerID, userID int64) error {
+	query := `
+		SELECT user_id
+		FROM customer_memberships
+		WHERE customer_id = $1 AND role = $2
+		FOR UPDATE
+	`
+
+	rows, err := tx.QueryContext(ctx, query, customerID, domain.MembershipRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to lock owners: %w", err)
+	}
+	defer rows.Close()
+
+	isOwner := false
+	owners := 0
+	for rows.Next() {
+		var ownerID int64
+		if err := rows.Scan(&ownerID); err != nil {
+			return fmt.Errorf("failed to scan owner: %w", err)
+		}
+		owners++
+		if ownerID == userID {
+			isOwner = true
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to lock owners: %w", err)
+	}
+
+	if isOwner && owners == 1 {
+		return domain.ErrLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/repository"
+	"github.com/hosterizer/auth-service/internal/service"
+	"github.com/hosterizer/shared/audit"
+)
+
+// createTestCustomer stores a customer owned by the user, deleted after the test.
+// The customers_owner_membership trigger makes the user an owner member.
+func createTestCustomer(t *testing.T, db *sql.DB, owner *domain.User) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.QueryRow(`INSERT INTO customers (name, owner_user_id) VALUES ($1, $2) RETURNING id`,
+		fmt.Sprintf("Customer of %s", owner.Email), owner.ID).Scan(&id)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM customers WHERE id = $1`, id) })
+	return id
+}
+
+func TestConcurrentOwnerChangesKeepAnOwner(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	memberships := repository.NewPostgresMembershipRepository(db)
+
+	jane := createTestUser(t, users, "owner-race-jane")
+	john := createTestUser(t, users, "owner-race-john")
+	customerID := createTestCustomer(t, db, jane)
+	if err := memberships.Create(ctx, &domain.CustomerMembership{CustomerID: customerID, UserID: john.ID, Role: domain.MembershipRoleOwner}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Each owner steps down at the same time; only one of them may
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make([]error, 2)
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		<-start
+		errs[0] = memberships.UpdateRole(ctx, customerID, jane.ID, domain.MembershipRoleDeveloper)
+	}()
+	go func() {
+		defer wg.Done()
+		<-start
+		errs[1] = memberships.Delete(ctx, customerID, john.ID)
+	}()
+	close(start)
+	wg.Wait()
+
+	refused := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, domain.ErrLastOwner):
+			refused++
+		case err != nil:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if refused != 1 {
+		t.Fatalf("%d changes refused, want exactly 1: %v", refused, errs)
+	}
+
+	list, err := memberships.ListByCustomer(ctx, customerID)
+	if err != nil {
+		t.Fatalf("ListByCustomer: %v", err)
+	}
+	owners := 0
+	for _, membership := range list {
+		if membership.IsOwner() {
+			owners++
+		}
+	}
+	if owners != 1 {
+		t.Fatalf("%d owners left, want 1", owners)
+	}
+}
+
+func TestMembershipChangesAreAudited(t *testing.T) {
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	memberships := repository.NewPostgresMembershipRepository(db)
+	svc := service.NewMembershipService(memberships, repository.NewPostgresCustomerRepository(db), users)
+
+	jane := createTestUser(t, users, "audit-owner")
+	john := createTestUser(t, users, "audit-member")
+	customerID := createTestCustomer(t, db, jane)
+	actor := &service.TokenClaims{
+		UserID:     jane.ID,
+		Email:      jane.Email,
+		Role:       domain.RoleCustomer,
+		CustomerID: &customerID,
+		TenantRole: domain.MembershipRoleOwner,
+	}
+
+	requestID := fmt.Sprintf("membership-audit-%d", time.Now().UnixNano())
+	ctx := audit.WithRequestID(context.Background(), requestID)
+	membership, err := svc.AddMember(ctx, actor, customerID, john.Email, domain.MembershipRoleDeveloper)
+	if err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if err := svc.UpdateRole(ctx, actor, customerID, john.ID, domain.MembershipRoleBilling); err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if err := svc.RemoveMember(ctx, actor, customerID, john.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+
+	// A refused change records nothing
+	if err := svc.RemoveMember(ctx, actor, customerID, jane.ID); !errors.Is(err, domain.ErrLastOwner) {
+		t.Fatalf("removing the last owner: got %v, want ErrLastOwner", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT actor_id, customer_id, resource_type, resource_id, action, COALESCE(before::TEXT, ''), COALESCE(after::TEXT, '')
+		FROM audit_log
+		WHERE request_id = $1
+		ORDER BY id
+	`, requestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type entry struct {
+		action, before, after string
+	}
+	var entries []entry
+	for rows.Next() {
+		var (
+			actorID, entryCustomerID                        int64
+			resourceType, resourceID, action, before, after string
+		)
+		if err := rows.Scan(&actorID, &entryCustomerID, &resourceType, &resourceID, &action, &before, &after); err != nil {
+			t.Fatal(err)
+		}
+		if actorID != jane.ID || entryCustomerID != customerID {
+			t.Errorf("%s entry by %d for customer %d, want %d for %d", action, actorID, entryCustomerID, jane.ID, customerID)
+		}
+		if resourceType != "membership" || resourceID != strconv.FormatInt(membership.ID, 10) {
+			t.Errorf("%s entry for %s %s, want membership %d", action, resourceType, resourceID, membership.ID)
+		}
+		entries = append(entries, entry{action, before, after})
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []entry{
+		{"create", "", fmt.Sprintf(`{"role": "developer", "user_id": %d}`, john.ID)},
+		{"update", `{"role": "developer"}`, `{"role": "billing"}`},
+		{"delete", fmt.Sprintf(`{"role": "billing", "user_id": %d}`, john.ID), ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("audit entries = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// PostgresMFARecoveryCodeRepository implements MFARecoveryCodeRepository using PostgreSQL
+type PostgresMFARecoveryCodeRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresMFARecoveryCodeRepository creates a new PostgreSQL MFA recovery code repository
+func NewPostgresMFARecoveryCodeRepository(db *sql.DB) *PostgresMFARecoveryCodeRepository {
+	return &PostgresMFARecoveryCodeRepository{
+		db: db,
+	}
+}
+
+// ReplaceForUser atomically replaces all recovery codes of a user with the given hashes
+func (r *PostgresMFARecoveryCodeRepository) ReplaceForUser(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM mfa_recovery_codes
+		WHERE user_id = $1
+	`
+
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	query = `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash)
+		VALUES ($1, $2)
+	`
+
+	for _, codeHash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, query, userID, codeHash); err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Consume atomically marks an unused recovery code as used
+func (r *PostgresMFARecoveryCodeRepository) Consume(ctx context.Context, userID int64, codeHash string) error {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+// CountUnused returns the number of recovery codes a user has left
+func (r *PostgresMFARecoveryCodeRepository) CountUnused(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM mfa_recovery_codes
+		WHERE user_id = $1 AND used_at IS NULL
+	`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
+
+// DeleteForUser deletes all recovery codes of a user
+func (r *PostgresMFARecoveryCodeRepository) DeleteForUser(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM mfa_recovery_codes
+		WHERE user_id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return nil
+}
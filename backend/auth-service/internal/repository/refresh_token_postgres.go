@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// PostgresRefreshTokenRepository implements RefreshTokenRepository using PostgreSQL
+type PostgresRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRefreshTokenRepository creates a new PostgreSQL refresh token repository
+func NewPostgresRefreshTokenRepository(db *sql.DB) *PostgresRefreshTokenRepository {
+	return &PostgresRefreshTokenRepository{
+		db: db,
+	}
+}
+
+// Create records a newly issued refresh token
+func (r *PostgresRefreshTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (jti, family_id, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		token.JTI,
+		token.FamilyID,
+		token.UserID,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// Consume atomically marks an unused, unrevoked token as used and returns it
+func (r *PostgresRefreshTokenRepository) Consume(ctx context.Context, jti string) (*domain.RefreshToken, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE jti = $1 AND used_at IS NULL AND revoked_at IS NULL
+		RETURNING id, jti, family_id, user_id, expires_at, used_at, revoked_at, created_at
+	`
+
+	token, err := scanRefreshToken(r.db.QueryRowContext(ctx, query, jti))
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	// Nothing was updated, so find out why
+	query = `
+		SELECT id, jti, family_id, user_id, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE jti = $1
+	`
+
+	token, err = scanRefreshToken(r.db.QueryRowContext(ctx, query, jti))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if token.IsRevoked() {
+		return token, domain.ErrRefreshTokenRevoked
+	}
+	return token, domain.ErrRefreshTokenUsed
+}
+
+// RevokeFamily revokes every token in a token family
+func (r *PostgresRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllForUser revokes every token issued to a user
+func (r *PostgresRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens for user: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeOtherFamilies revokes every token issued to a user outside the given family
+func (r *PostgresRefreshTokenRepository) RevokeOtherFamilies(ctx context.Context, userID int64, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, familyID); err != nil {
+		return fmt.Errorf("failed to revoke other refresh tokens for user: %w", err)
+	}
+
+	return nil
+}
+
+func scanRefreshToken(row *sql.Row) (*domain.RefreshToken, error) {
+	token := &domain.RefreshToken{}
+	err := row.Scan(
+		&token.ID,
+		&token.JTI,
+		&token.FamilyID,
+		&token.UserID,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
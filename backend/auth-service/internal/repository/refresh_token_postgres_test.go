@@ -0,0 +1,91 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/repository"
+	"github.com/hosterizer/auth-service/internal/service"
+)
+
+func TestConsumeExplainsRejectedTokens(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	tokens := repository.NewPostgresRefreshTokenRepository(db)
+
+	user := &domain.User{
+		Email:        fmt.Sprintf("refresh-consume-%d@example.com", time.Now().UnixNano()),
+		PasswordHash: "unused",
+		Role:         domain.RoleCustomer,
+	}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+	t.Cleanup(func() { users.Delete(context.Background(), user.ID) })
+
+	// jti and family_id are UUID columns
+	newID := func() string {
+		id, err := service.NewTokenID()
+		if err != nil {
+			t.Fatalf("NewTokenID: %v", err)
+		}
+		return id
+	}
+	newToken := func(familyID string) *domain.RefreshToken {
+		token := &domain.RefreshToken{
+			JTI:       newID(),
+			FamilyID:  familyID,
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		if err := tokens.Create(ctx, token); err != nil {
+			t.Fatalf("Create token: %v", err)
+		}
+		return token
+	}
+
+	used := newToken(newID())
+	revoked := newToken(newID())
+
+	// The first exchange goes through the UPDATE ... RETURNING path
+	consumed, err := tokens.Consume(ctx, used.JTI)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if consumed.ID != used.ID || !consumed.IsUsed() {
+		t.Fatalf("unexpected consumed token %+v", consumed)
+	}
+
+	// Later exchanges update nothing and fall back to looking up why
+	consumed, err = tokens.Consume(ctx, used.JTI)
+	if !errors.Is(err, domain.ErrRefreshTokenUsed) {
+		t.Fatalf("second Consume: got %v, want ErrRefreshTokenUsed", err)
+	}
+	if consumed == nil || consumed.FamilyID != used.FamilyID {
+		t.Fatalf("second Consume returned %+v, want the used token for its family", consumed)
+	}
+
+	if err := tokens.RevokeFamily(ctx, revoked.FamilyID); err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+	if _, err := tokens.Consume(ctx, revoked.JTI); !errors.Is(err, domain.ErrRefreshTokenRevoked) {
+		t.Fatalf("revoked token: got %v, want ErrRefreshTokenRevoked", err)
+	}
+
+	// A used token that was revoked afterwards reports the revocation
+	if err := tokens.RevokeFamily(ctx, used.FamilyID); err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+	if _, err := tokens.Consume(ctx, used.JTI); !errors.Is(err, domain.ErrRefreshTokenRevoked) {
+		t.Fatalf("used and revoked token: got %v, want ErrRefreshTokenRevoked", err)
+	}
+
+	if _, err := tokens.Consume(ctx, newID()); !errors.Is(err, domain.ErrRefreshTokenNotFound) {
+		t.Fatalf("unknown token: got %v, want ErrRefreshTokenNotFound", err)
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/lib/pq"
+)
+
+// PostgresSSOIdentityRepository implements SSOIdentityRepository using PostgreSQL
+type PostgresSSOIdentityRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresSSOIdentityRepository creates a new PostgreSQL SSO identity repository
+func NewPostgresSSOIdentityRepository(db *sql.DB) *PostgresSSOIdentityRepository {
+	return &PostgresSSOIdentityRepository{
+		db: db,
+	}
+}
+
+// Create links an identity provider subject to a user
+func (r *PostgresSSOIdentityRepository) Create(ctx context.Context, identity *domain.SSOIdentity) error {
+	query := `
+		INSERT INTO sso_identities (customer_id, subject, user_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		identity.CustomerID,
+		identity.Subject,
+		identity.UserID,
+	).Scan(&identity.ID, &identity.CreatedAt)
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			return domain.ErrSSOIdentityAlreadyExists
+		}
+		return fmt.Errorf("failed to create sso identity: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves the identity of a subject at a customer's identity provider
+func (r *PostgresSSOIdentityRepository) Get(ctx context.Context, customerID int64, subject string) (*domain.SSOIdentity, error) {
+	query := `
+		SELECT id, customer_id, subject, user_id, created_at, last_login_at
+		FROM sso_identities
+		WHERE customer_id = $1 AND subject = $2
+	`
+
+	identity := &domain.SSOIdentity{}
+	err := r.db.QueryRowContext(ctx, query, customerID, subject).Scan(
+		&identity.ID,
+		&identity.CustomerID,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSSOIdentityNotFound
+		}
+		return nil, fmt.Errorf("failed to get sso identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// UpdateLastLogin updates the last login timestamp of an identity
+func (r *PostgresSSOIdentityRepository) UpdateLastLogin(ctx context.Context, id int64) error {
+	query := `UPDATE sso_identities SET last_login_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to update sso identity last login: %w", err)
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hosterizer/auth-service/internal/domain"
@@ -27,9 +28,9 @@ func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
 func (r *PostgresUserRepository) Create(ctx context.Context, user *domain.User) error {
 	query := `
 		INSERT INTO users (
-			email, password_hash, first_name, last_name, role,
+			email, email_verified_at, password_hash, first_name, last_name, role,
 			mfa_enabled, mfa_secret, failed_login_attempts
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, uuid, created_at, updated_at
 	`
 
@@ -37,6 +38,7 @@ func (r *PostgresUserRepository) Create(ctx context.Context, user *domain.User)
 		ctx,
 		query,
 		user.Email,
+		user.EmailVerifiedAt,
 		user.PasswordHash,
 		user.FirstName,
 		user.LastName,
@@ -61,7 +63,7 @@ func (r *PostgresUserRepository) Create(ctx context.Context, user *domain.User)
 func (r *PostgresUserRepository) GetByID(ctx context.Context, id int64) (*domain.User, error) {
 	query := `
 		SELECT 
-			id, uuid, email, password_hash, first_name, last_name, role,
+			id, uuid, email, email_verified_at, password_hash, first_name, last_name, role,
 			mfa_enabled, mfa_secret, failed_login_attempts, locked_until,
 			last_login_at, created_at, updated_at
 		FROM users
@@ -73,6 +75,7 @@ func (r *PostgresUserRepository) GetByID(ctx context.Context, id int64) (*domain
 		&user.ID,
 		&user.UUID,
 		&user.Email,
+		&user.EmailVerifiedAt,
 		&user.PasswordHash,
 		&user.FirstName,
 		&user.LastName,
@@ -100,7 +103,7 @@ func (r *PostgresUserRepository) GetByID(ctx context.Context, id int64) (*domain
 func (r *PostgresUserRepository) GetByUUID(ctx context.Context, uuid string) (*domain.User, error) {
 	query := `
 		SELECT 
-			id, uuid, email, password_hash, first_name, last_name, role,
+			id, uuid, email, email_verified_at, password_hash, first_name, last_name, role,
 			mfa_enabled, mfa_secret, failed_login_attempts, locked_until,
 			last_login_at, created_at, updated_at
 		FROM users
@@ -112,6 +115,7 @@ func (r *PostgresUserRepository) GetByUUID(ctx context.Context, uuid string) (*d
 		&user.ID,
 		&user.UUID,
 		&user.Email,
+		&user.EmailVerifiedAt,
 		&user.PasswordHash,
 		&user.FirstName,
 		&user.LastName,
@@ -139,7 +143,7 @@ func (r *PostgresUserRepository) GetByUUID(ctx context.Context, uuid string) (*d
 func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	query := `
 		SELECT 
-			id, uuid, email, password_hash, first_name, last_name, role,
+			id, uuid, email, email_verified_at, password_hash, first_name, last_name, role,
 			mfa_enabled, mfa_secret, failed_login_attempts, locked_until,
 			last_login_at, created_at, updated_at
 		FROM users
@@ -151,6 +155,7 @@ func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (
 		&user.ID,
 		&user.UUID,
 		&user.Email,
+		&user.EmailVerifiedAt,
 		&user.PasswordHash,
 		&user.FirstName,
 		&user.LastName,
@@ -250,6 +255,108 @@ func (r *PostgresUserRepository) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// List returns up to limit users matching the filter with an ID greater than afterID.
+// Ordering by the primary key keeps pages stable while users are added.
+func (r *PostgresUserRepository) List(ctx context.Context, filter domain.UserFilter, afterID int64, limit int) ([]*domain.User, error) {
+	conditions, args := userFilterConditions(filter)
+	args = append(args, afterID, limit)
+	conditions = append(conditions, fmt.Sprintf("id > $%d", len(args)-1))
+
+	query := `
+		SELECT
+			id, uuid, email, email_verified_at, password_hash, first_name, last_name, role,
+			mfa_enabled, mfa_secret, failed_login_attempts, locked_until,
+			last_login_at, created_at, updated_at
+		FROM users
+		WHERE ` + strings.Join(conditions, " AND ") + fmt.Sprintf(`
+		ORDER BY id
+		LIMIT $%d
+	`, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user := &domain.User{}
+		if err := rows.Scan(
+			&user.ID,
+			&user.UUID,
+			&user.Email,
+			&user.EmailVerifiedAt,
+			&user.PasswordHash,
+			&user.FirstName,
+			&user.LastName,
+			&user.Role,
+			&user.MFAEnabled,
+			&user.MFASecret,
+			&user.FailedLoginAttempts,
+			&user.LockedUntil,
+			&user.LastLoginAt,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, nil
+}
+
+// Count returns the number of users matching the filter
+func (r *PostgresUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int, error) {
+	conditions, args := userFilterConditions(filter)
+
+	query := `
+		SELECT COUNT(*)
+		FROM users
+	`
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// userFilterConditions translates a user filter into SQL conditions and their arguments
+func userFilterConditions(filter domain.UserFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Role != nil {
+		args = append(args, *filter.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+
+	if filter.Locked != nil {
+		if *filter.Locked {
+			conditions = append(conditions, "locked_until > NOW()")
+		} else {
+			conditions = append(conditions, "(locked_until IS NULL OR locked_until <= NOW())")
+		}
+	}
+
+	if filter.MFAEnabled != nil {
+		args = append(args, *filter.MFAEnabled)
+		conditions = append(conditions, fmt.Sprintf("COALESCE(mfa_enabled, FALSE) = $%d", len(args)))
+	}
+
+	return conditions, args
+}
+
 // UpdateFailedAttempts updates the failed login attempts and lock status
 func (r *PostgresUserRepository) UpdateFailedAttempts(ctx context.Context, id int64, attempts int, lockedUntil *time.Time) error {
 	query := `
@@ -278,6 +385,82 @@ func (r *PostgresUserRepository) UpdateFailedAttempts(ctx context.Context, id in
 	return nil
 }
 
+// IncrementFailedAttempts counts a failed login attempt and decides on the lock in a
+// single statement, so concurrent attempts cannot overwrite each other's count.
+// The row lock taken by the CTE makes the lock decision see every earlier attempt.
+// Once a lock has run out, counting starts over, so the next failure does not
+// lock the account again at once.
+func (r *PostgresUserRepository) IncrementFailedAttempts(ctx context.Context, id int64, maxAttempts int, lockoutDuration time.Duration) (*domain.FailedAttempt, error) {
+	query := `
+		WITH previous AS (
+			SELECT
+				id,
+				COALESCE(locked_until > NOW(), FALSE) AS locked,
+				CASE
+					WHEN locked_until <= NOW() THEN 0
+					ELSE failed_login_attempts
+				END AS attempts
+			FROM users
+			WHERE id = $1
+			FOR UPDATE
+		)
+		UPDATE users u
+		SET
+			failed_login_attempts = previous.attempts + 1,
+			locked_until = CASE
+				WHEN previous.locked THEN u.locked_until
+				WHEN previous.attempts + 1 >= $2 THEN NOW() + make_interval(secs => $3)
+				ELSE NULL
+			END,
+			updated_at = NOW()
+		FROM previous
+		WHERE u.id = previous.id
+		RETURNING
+			u.failed_login_attempts,
+			u.locked_until,
+			NOT previous.locked AND u.failed_login_attempts >= $2
+	`
+
+	attempt := &domain.FailedAttempt{}
+	err := r.db.QueryRowContext(ctx, query, id, maxAttempts, lockoutDuration.Seconds()).Scan(
+		&attempt.Attempts,
+		&attempt.LockedUntil,
+		&attempt.Locked,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to increment failed attempts: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// LockAccount sets only locked_until, so failed attempts counted concurrently are
+// not overwritten
+func (r *PostgresUserRepository) LockAccount(ctx context.Context, id int64, lockoutDuration time.Duration) (*time.Time, error) {
+	query := `
+		UPDATE users
+		SET
+			locked_until = GREATEST(locked_until, NOW() + make_interval(secs => $2)),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING locked_until
+	`
+
+	var lockedUntil time.Time
+	err := r.db.QueryRowContext(ctx, query, id, lockoutDuration.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	return &lockedUntil, nil
+}
+
 // UpdateLastLogin updates the last login timestamp
 func (r *PostgresUserRepository) UpdateLastLogin(ctx context.Context, id int64) error {
 	query := `
@@ -310,6 +493,7 @@ func (r *PostgresUserRepository) UpdateMFASecret(ctx context.Context, id int64,
 	query := `
 		UPDATE users
 		SET 
+			mfa_last_used_step = CASE WHEN mfa_secret IS DISTINCT FROM $1 THEN NULL ELSE mfa_last_used_step END,
 			mfa_secret = $1,
 			mfa_enabled = $2,
 			updated_at = NOW()
@@ -332,3 +516,179 @@ func (r *PostgresUserRepository) UpdateMFASecret(ctx context.Context, id int64,
 
 	return nil
 }
+
+// UpdateMFALastUsedStep records the last accepted TOTP time step.
+// The update only succeeds for a step newer than the recorded one, so two
+// concurrent logins with the same code cannot both be accepted.
+func (r *PostgresUserRepository) UpdateMFALastUsedStep(ctx context.Context, id int64, step int64) error {
+	query := `
+		UPDATE users
+		SET mfa_last_used_step = $1
+		WHERE id = $2 AND (mfa_last_used_step IS NULL OR mfa_last_used_step < $1)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, step, id)
+	if err != nil {
+		return fmt.Errorf("failed to update MFA last used step: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrMFACodeReplayed
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the password hash of a user and moves the old hash to
+// the password history. Entries beyond the newest historySize are pruned.
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string, historySize int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row so concurrent changes record every replaced hash
+	query := `
+		SELECT password_hash
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	var oldHash string
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&oldHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get password: %w", err)
+	}
+
+	query = `
+		UPDATE users
+		SET 
+			password_hash = $1,
+			updated_at = NOW()
+		WHERE id = $2
+	`
+
+	if _, err := tx.ExecContext(ctx, query, passwordHash, id); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// Users without a password, e.g. invited ones, have nothing to remember
+	if historySize > 0 && oldHash != "" {
+		query = `
+			INSERT INTO password_history (user_id, password_hash)
+			VALUES ($1, $2)
+		`
+
+		if _, err := tx.ExecContext(ctx, query, id, oldHash); err != nil {
+			return fmt.Errorf("failed to record password history: %w", err)
+		}
+	}
+
+	query = `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id
+			FROM password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, id, historySize); err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash replaces a password hash only while it is still oldHash, so a
+// rehash at login cannot undo a concurrent password change. The old hash is not
+// added to the history, since the password stays the same.
+func (r *PostgresUserRepository) UpdatePasswordHash(ctx context.Context, id int64, oldHash, newHash string) error {
+	query := `
+		UPDATE users
+		SET
+			password_hash = $3,
+			updated_at = NOW()
+		WHERE id = $1 AND password_hash = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, oldHash, newHash); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+
+	return nil
+}
+
+// ListPasswordHistory returns up to limit hashes of replaced passwords, newest first
+func (r *PostgresUserRepository) ListPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error) {
+	query := `
+		SELECT password_hash
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password history: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate password history: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// MarkEmailVerified records that a user confirmed their email address
+func (r *PostgresUserRepository) MarkEmailVerified(ctx context.Context, id int64) error {
+	query := `
+		UPDATE users
+		SET 
+			email_verified_at = COALESCE(email_verified_at, NOW()),
+			updated_at = NOW()
+		WHERE id = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
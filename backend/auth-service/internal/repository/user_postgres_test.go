@@ -0,0 +1,255 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/auth-service/internal/repository"
+	"github.com/hosterizer/auth-service/internal/service"
+	"github.com/pquerna/otp/totp"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL, which must have all
+// migrations applied. Tests that need it are skipped when it is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	return db
+}
+
+// testPassword is the password of the users created by createTestUser
+const testPassword = "kT9#vLq2!mZx"
+
+// newTestPasswordService hashes passwords with cheap Argon2 parameters
+func newTestPasswordService() *service.PasswordService {
+	return service.NewPasswordService(service.PasswordConfig{
+		Argon2: service.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1},
+	})
+}
+
+// createTestUser stores a customer user with a unique address, deleted after the test
+func createTestUser(t *testing.T, users *repository.PostgresUserRepository, name string) *domain.User {
+	t.Helper()
+
+	hash, err := newTestPasswordService().HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &domain.User{
+		Email:        fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano()),
+		PasswordHash: hash,
+		Role:         domain.RoleCustomer,
+	}
+	if err := users.Create(context.Background(), user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	t.Cleanup(func() { users.Delete(context.Background(), user.ID) })
+	return user
+}
+
+// TestConcurrentFailedAttemptsAreAllCounted fires parallel bad logins. Wrong
+// second factors after the right password count towards the lockout, while wrong
+// passwords are left to the login throttle so nobody can lock out a user by their
+// address alone.
+func TestConcurrentFailedAttemptsAreAllCounted(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	user := createTestUser(t, users, "lockout-race")
+
+	const secret = "JBSWY3DPEHPK3PXP"
+	if err := users.UpdateMFASecret(ctx, user.ID, secret, true); err != nil {
+		t.Fatalf("UpdateMFASecret: %v", err)
+	}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(code)
+	wrongCode := fmt.Sprintf("%06d", (n+1)%1000000)
+
+	const maxFailures = 20
+	keys, err := service.GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := service.NewMemoryEventRecorder()
+	authSvc := service.NewAuthService(service.AuthServiceConfig{
+		UserRepo:    users,
+		PasswordSvc: newTestPasswordService(),
+		JWTSvc:      service.NewJWTService(service.JWTConfig{Keys: keys}),
+		MFASvc:      service.NewMFAService(service.MFAConfig{}),
+		LockoutSvc:  service.NewLockoutService(users, service.LockoutConfig{MaxFailedAttempts: maxFailures, Events: events}),
+		TenantSvc:   service.NewTenantService(repository.NewPostgresMembershipRepository(db)),
+		Events:      events,
+	})
+
+	// Fire the logins at once: exactly enough wrong codes to lock the account,
+	// so each of them gets past the lock check, and as many wrong passwords
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	login := func(req service.LoginRequest, want ...error) {
+		defer wg.Done()
+		<-start
+
+		_, err := authSvc.Login(ctx, req)
+		for _, target := range want {
+			if errors.Is(err, target) {
+				return
+			}
+		}
+		t.Errorf("Login: got %v, want one of %v", err, want)
+	}
+	for i := 0; i < maxFailures; i++ {
+		wg.Add(2)
+		go login(service.LoginRequest{Email: user.Email, Password: testPassword, MFACode: wrongCode}, service.ErrInvalidMFACode)
+		// Wrong passwords that arrive after the lock are refused for it
+		go login(service.LoginRequest{Email: user.Email, Password: "wrong-" + testPassword}, domain.ErrInvalidCredentials, service.ErrAccountLocked)
+	}
+	close(start)
+	wg.Wait()
+
+	stored, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if stored.FailedLoginAttempts != maxFailures {
+		t.Fatalf("counted %d failed attempts, want the %d wrong codes", stored.FailedLoginAttempts, maxFailures)
+	}
+	if !stored.IsLocked() {
+		t.Fatalf("account not locked after %d failed attempts", stored.FailedLoginAttempts)
+	}
+
+	var locks int
+	for _, event := range events.Events() {
+		if event.Type == service.AuditEventAccountLocked {
+			locks++
+		}
+	}
+	if locks != 1 {
+		t.Fatalf("recorded %d lockout events, want 1", locks)
+	}
+}
+
+func TestLockAccountKeepsFailedAttempts(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	user := createTestUser(t, users, "mfa-lockout")
+
+	for i := 0; i < 3; i++ {
+		if _, err := users.IncrementFailedAttempts(ctx, user.ID, 10, time.Minute); err != nil {
+			t.Fatalf("IncrementFailedAttempts: %v", err)
+		}
+	}
+
+	lockedUntil, err := users.LockAccount(ctx, user.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("LockAccount: %v", err)
+	}
+	stored, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.FailedLoginAttempts != 3 || !stored.IsLocked() {
+		t.Fatalf("after LockAccount: %d failed attempts, locked until %v", stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+
+	// A shorter lock does not cut the longer one short
+	shorter, err := users.LockAccount(ctx, user.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("LockAccount: %v", err)
+	}
+	if !shorter.Equal(*lockedUntil) {
+		t.Fatalf("shorter lock moved the end from %v to %v", lockedUntil, shorter)
+	}
+}
+
+func TestUpdatePasswordHashChangesOnlyTheHash(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	user := createTestUser(t, users, "rehash")
+
+	// Failures counted after the user was read are kept
+	if _, err := users.IncrementFailedAttempts(ctx, user.ID, 1, time.Hour); err != nil {
+		t.Fatalf("IncrementFailedAttempts: %v", err)
+	}
+	if err := users.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, "rehashed"); err != nil {
+		t.Fatalf("UpdatePasswordHash: %v", err)
+	}
+	stored, err := users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.PasswordHash != "rehashed" || stored.FailedLoginAttempts != 1 || !stored.IsLocked() {
+		t.Fatalf("after rehash: hash %q, %d failed attempts, locked until %v", stored.PasswordHash, stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+
+	// A rehash of a password that was changed in the meantime is dropped
+	if err := users.UpdatePassword(ctx, user.ID, "changed", 0); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if err := users.UpdatePasswordHash(ctx, user.ID, "rehashed", "stale"); err != nil {
+		t.Fatalf("UpdatePasswordHash: %v", err)
+	}
+	if stored, _ := users.GetByID(ctx, user.ID); stored.PasswordHash != "changed" {
+		t.Fatalf("stale rehash overwrote the new password: %q", stored.PasswordHash)
+	}
+}
+
+func TestFailedAttemptsStartOverAfterLockExpires(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	users := repository.NewPostgresUserRepository(db)
+	user := createTestUser(t, users, "lock-expiry")
+
+	expired := time.Now().Add(-time.Minute)
+	if err := users.UpdateFailedAttempts(ctx, user.ID, 5, &expired); err != nil {
+		t.Fatalf("UpdateFailedAttempts: %v", err)
+	}
+
+	attempt, err := users.IncrementFailedAttempts(ctx, user.ID, 5, time.Hour)
+	if err != nil {
+		t.Fatalf("IncrementFailedAttempts: %v", err)
+	}
+	if attempt.Attempts != 1 || attempt.Locked || attempt.LockedUntil != nil {
+		t.Fatalf("first failure after the lock expired: %+v", attempt)
+	}
+
+	// The count still locks the account once it reaches the maximum again
+	for i := 0; i < 4; i++ {
+		if attempt, err = users.IncrementFailedAttempts(ctx, user.ID, 5, time.Hour); err != nil {
+			t.Fatalf("IncrementFailedAttempts: %v", err)
+		}
+	}
+	if attempt.Attempts != 5 || !attempt.Locked {
+		t.Fatalf("fifth failure: %+v", attempt)
+	}
+}
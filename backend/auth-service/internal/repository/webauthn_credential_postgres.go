@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/lib/pq"
+)
+
+// PostgresWebAuthnCredentialRepository implements WebAuthnCredentialRepository using PostgreSQL
+type PostgresWebAuthnCredentialRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresWebAuthnCredentialRepository creates a new PostgreSQL WebAuthn credential repository
+func NewPostgresWebAuthnCredentialRepository(db *sql.DB) *PostgresWebAuthnCredentialRepository {
+	return &PostgresWebAuthnCredentialRepository{
+		db: db,
+	}
+}
+
+// Create registers a new credential
+func (r *PostgresWebAuthnCredentialRepository) Create(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	query := `
+		INSERT INTO webauthn_credentials (
+			user_id, credential_id, public_key, attestation_type, aaguid,
+			sign_count, transports, backup_eligible, backup_state, name
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		credential.UserID,
+		credential.CredentialID,
+		credential.PublicKey,
+		credential.AttestationType,
+		credential.AAGUID,
+		int64(credential.SignCount),
+		pq.Array(credential.Transports),
+		credential.BackupEligible,
+		credential.BackupState,
+		credential.Name,
+	).Scan(&credential.ID, &credential.CreatedAt)
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			return domain.ErrWebAuthnCredentialAlreadyExists
+		}
+		return fmt.Errorf("failed to create webauthn credential: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser retrieves all credentials of a user, oldest first
+func (r *PostgresWebAuthnCredentialRepository) ListByUser(ctx context.Context, userID int64) ([]*domain.WebAuthnCredential, error) {
+	query := `
+		SELECT
+			id, user_id, credential_id, public_key, attestation_type, aaguid,
+			sign_count, transports, backup_eligible, backup_state, name,
+			last_used_at, created_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []*domain.WebAuthnCredential
+	for rows.Next() {
+		credential := &domain.WebAuthnCredential{}
+		var signCount int64
+		if err := rows.Scan(
+			&credential.ID,
+			&credential.UserID,
+			&credential.CredentialID,
+			&credential.PublicKey,
+			&credential.AttestationType,
+			&credential.AAGUID,
+			&signCount,
+			pq.Array(&credential.Transports),
+			&credential.BackupEligible,
+			&credential.BackupState,
+			&credential.Name,
+			&credential.LastUsedAt,
+			&credential.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webauthn credential: %w", err)
+		}
+		credential.SignCount = uint32(signCount)
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// UpdateAfterLogin stores the state reported by a successful assertion
+func (r *PostgresWebAuthnCredentialRepository) UpdateAfterLogin(ctx context.Context, id int64, signCount uint32, backupState bool) error {
+	query := `
+		UPDATE webauthn_credentials
+		SET
+			sign_count = $1,
+			backup_state = $2,
+			last_used_at = NOW()
+		WHERE id = $3
+	`
+
+	result, err := r.db.ExecContext(ctx, query, int64(signCount), backupState, id)
+	if err != nil {
+		return fmt.Errorf("failed to update webauthn credential: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// Delete deletes a credential of a user
+func (r *PostgresWebAuthnCredentialRepository) Delete(ctx context.Context, userID int64, id int64) error {
+	query := `
+		DELETE FROM webauthn_credentials
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,582 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// DefaultPasswordResetTokenDuration is how long a password reset link stays valid
+	DefaultPasswordResetTokenDuration = time.Hour
+
+	// DefaultEmailVerificationTokenDuration is how long an email verification link stays valid
+	DefaultEmailVerificationTokenDuration = 48 * time.Hour
+
+	// DefaultInvitationTokenDuration is how long the link in an invitation email stays valid
+	DefaultInvitationTokenDuration = 7 * 24 * time.Hour
+
+	// DefaultPasswordHistorySize is the number of recent passwords, the current one
+	// included, that cannot be chosen again
+	DefaultPasswordHistorySize = 5
+
+	// accountTokenBytes is the entropy of an emailed account token (256 bits)
+	accountTokenBytes = 32
+)
+
+var (
+	// ErrInvalidAccountToken is returned when a password reset or email verification
+	// token is unknown, expired or already used
+	ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+	// ErrInvalidEmail is returned when an email address is malformed
+	ErrInvalidEmail = errors.New("invalid email address")
+
+	// ErrPasswordReused is returned when a new password matches a recent one
+	ErrPasswordReused = errors.New("password was used recently")
+
+	// ErrInvalidUserRole is returned when an unknown user role is requested
+	ErrInvalidUserRole = errors.New("invalid user role")
+)
+
+// SessionRevoker revokes the logins of a user
+type SessionRevoker interface {
+	// RevokeUserSessions revokes every login of a user
+	RevokeUserSessions(ctx context.Context, userID int64) error
+
+	// RevokeOtherSessions revokes every login of the token's user except the token's
+	// own, and returns a new access token for the login that was kept
+	RevokeOtherSessions(ctx context.Context, claims *TokenClaims) (string, error)
+}
+
+// AccountService handles self-service signup, email verification and password resets
+type AccountService struct {
+	userRepo                  domain.UserRepository
+	tokenRepo                 domain.AccountTokenRepository
+	membershipRepo            domain.MembershipRepository
+	passwordSvc               *PasswordService
+	lockoutSvc                *LockoutService
+	mailer                    Mailer
+	sessions                  SessionRevoker
+	baseURL                   string
+	passwordResetDuration     time.Duration
+	emailVerificationDuration time.Duration
+	invitationDuration        time.Duration
+	passwordHistorySize       int
+}
+
+// AccountConfig holds account service configuration
+type AccountConfig struct {
+	UserRepo       domain.UserRepository
+	TokenRepo      domain.AccountTokenRepository
+	MembershipRepo domain.MembershipRepository
+	PasswordSvc    *PasswordService
+	LockoutSvc     *LockoutService
+	Mailer         Mailer
+	Sessions       SessionRevoker
+
+	// BaseURL is the portal URL the links in emails point to
+	BaseURL string
+
+	PasswordResetTokenDuration     time.Duration
+	EmailVerificationTokenDuration time.Duration
+	InvitationTokenDuration        time.Duration
+
+	// PasswordHistorySize is the number of recent passwords, the current one
+	// included, that cannot be chosen again
+	PasswordHistorySize int
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(config AccountConfig) *AccountService {
+	resetDuration := config.PasswordResetTokenDuration
+	if resetDuration == 0 {
+		resetDuration = DefaultPasswordResetTokenDuration
+	}
+
+	verificationDuration := config.EmailVerificationTokenDuration
+	if verificationDuration == 0 {
+		verificationDuration = DefaultEmailVerificationTokenDuration
+	}
+
+	invitationDuration := config.InvitationTokenDuration
+	if invitationDuration == 0 {
+		invitationDuration = DefaultInvitationTokenDuration
+	}
+
+	historySize := config.PasswordHistorySize
+	if historySize == 0 {
+		historySize = DefaultPasswordHistorySize
+	}
+
+	return &AccountService{
+		userRepo:                  config.UserRepo,
+		tokenRepo:                 config.TokenRepo,
+		membershipRepo:            config.MembershipRepo,
+		passwordSvc:               config.PasswordSvc,
+		lockoutSvc:                config.LockoutSvc,
+		mailer:                    config.Mailer,
+		sessions:                  config.Sessions,
+		baseURL:                   strings.TrimSuffix(config.BaseURL, "/"),
+		passwordResetDuration:     resetDuration,
+		emailVerificationDuration: verificationDuration,
+		invitationDuration:        invitationDuration,
+		passwordHistorySize:       historySize,
+	}
+}
+
+// RegisterRequest represents a self-service signup
+type RegisterRequest struct {
+	Email     string
+	Password  string
+	FirstName string
+	LastName  string
+}
+
+// Register creates a customer user and sends them an email verification link
+func (s *AccountService) Register(ctx context.Context, req RegisterRequest) (*domain.User, error) {
+	email := strings.TrimSpace(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, ErrInvalidEmail
+	}
+
+	user := &domain.User{
+		Email:     email,
+		FirstName: strings.TrimSpace(req.FirstName),
+		LastName:  strings.TrimSpace(req.LastName),
+		Role:      domain.RoleCustomer,
+	}
+
+	// A new user belongs to no customer yet, so the platform rules apply
+	if err := s.passwordSvc.CheckPassword(ctx, req.Password, user); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := s.passwordSvc.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.PasswordHash = passwordHash
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, domain.ErrUserAlreadyExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := s.SendVerificationEmail(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// InviteRequest represents a user created by an administrator
+type InviteRequest struct {
+	Email     string
+	FirstName string
+	LastName  string
+	Role      domain.UserRole
+}
+
+// Invite creates a user without a password and emails them a link to choose one.
+// Choosing the password also verifies the email address.
+func (s *AccountService) Invite(ctx context.Context, req InviteRequest) (*domain.User, error) {
+	email := strings.TrimSpace(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, ErrInvalidEmail
+	}
+
+	if req.Role != domain.RoleAdministrator && req.Role != domain.RoleCustomer {
+		return nil, ErrInvalidUserRole
+	}
+
+	user := &domain.User{
+		Email:     email,
+		FirstName: strings.TrimSpace(req.FirstName),
+		LastName:  strings.TrimSpace(req.LastName),
+		Role:      req.Role,
+	}
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, domain.ErrUserAlreadyExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	token, err := s.issueToken(ctx, user.ID, domain.TokenPurposePasswordReset, s.invitationDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.send(ctx, user, "You have been invited to Hosterizer", fmt.Sprintf(
+		"Hello %s,\n\nAn account was created for you on Hosterizer. Open the link below to choose your password:\n\n%s\n\nThe link expires in %s. Afterwards you can ask for a new one with \"Forgot password\".\n",
+		displayName(user), s.link("/reset-password", token), formatDuration(s.invitationDuration),
+	)); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ForcePasswordReset removes a user's password, signs out every login and emails
+// a password reset link. The old password stays in the history, so it cannot be
+// chosen again.
+func (s *AccountService) ForcePasswordReset(ctx context.Context, user *domain.User) error {
+	if err := s.updatePassword(ctx, user, ""); err != nil {
+		return err
+	}
+
+	if err := s.sessions.RevokeUserSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, domain.TokenPurposePasswordReset, s.passwordResetDuration)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, user, "Please choose a new password", fmt.Sprintf(
+		"Hello %s,\n\nAn administrator reset the password of your Hosterizer account and signed out all your sessions. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %s. Afterwards you can ask for a new one with \"Forgot password\".\n",
+		displayName(user), s.link("/reset-password", token), formatDuration(s.passwordResetDuration),
+	))
+}
+
+// SendVerificationEmail sends a user a new email verification link. Links sent
+// earlier stop working. Nothing is sent if the address is already verified.
+func (s *AccountService) SendVerificationEmail(ctx context.Context, user *domain.User) error {
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	token, err := s.issueToken(ctx, user.ID, domain.TokenPurposeEmailVerification, s.emailVerificationDuration)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, user, "Verify your email address", fmt.Sprintf(
+		"Hello %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+		displayName(user), s.link("/verify-email", token), formatDuration(s.emailVerificationDuration),
+	))
+}
+
+// ResendVerificationEmail sends a new verification link to the user with the given
+// email address. Unknown and already verified addresses are silently ignored, so
+// the response does not reveal whether an account exists.
+func (s *AccountService) ResendVerificationEmail(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.SendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail redeems an email verification token and marks the address as verified
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	accountToken, err := s.consumeToken(ctx, domain.TokenPurposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, accountToken.UserID); err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+// RequestPasswordReset emails a password reset link to the user with the given
+// email address. Links sent earlier stop working. Unknown addresses are silently
+// ignored, so the response does not reveal whether an account exists.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := s.issueToken(ctx, user.ID, domain.TokenPurposePasswordReset, s.passwordResetDuration)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, user, "Reset your password", fmt.Sprintf(
+		"Hello %s,\n\nSomeone asked to reset the password of your Hosterizer account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not ask for this, you can ignore this email.\n",
+		displayName(user), s.link("/reset-password", token), formatDuration(s.passwordResetDuration),
+	))
+}
+
+// ResetPassword redeems a password reset token and sets a new password. Every
+// login of the user is revoked, and a lockout from failed attempts is lifted.
+// Since the token arrived by email, the address is marked as verified too.
+func (s *AccountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// Check the new password before redeeming the token, so a rejected password
+	// does not use it up
+	accountToken, err := s.findToken(ctx, domain.TokenPurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, accountToken.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	passwordHash, err := s.hashNewPassword(ctx, user, newPassword)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.consumeToken(ctx, domain.TokenPurposePasswordReset, token); err != nil {
+		return err
+	}
+
+	if err := s.updatePassword(ctx, user, passwordHash); err != nil {
+		return err
+	}
+
+	// Any other reset link still in flight must not work anymore
+	if err := s.tokenRepo.DeleteForUser(ctx, user.ID, domain.TokenPurposePasswordReset); err != nil {
+		return fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if err := s.userRepo.UpdateFailedAttempts(ctx, user.ID, 0, nil); err != nil {
+		return fmt.Errorf("failed to reset failed attempts: %w", err)
+	}
+
+	if err := s.sessions.RevokeUserSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return s.send(ctx, user, "Your password was changed", fmt.Sprintf(
+		"Hello %s,\n\nThe password of your Hosterizer account was just reset and all your sessions were signed out. If you did not do this, please contact support immediately.\n",
+		displayName(user),
+	))
+}
+
+// ChangePassword sets a new password for the token's user after checking the
+// current one. Every other login of the user is revoked; the returned access
+// token replaces the presented one for the login that was kept.
+func (s *AccountService) ChangePassword(ctx context.Context, claims *TokenClaims, currentPassword, newPassword string) (string, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// A stolen access token must not allow guessing the password without limit
+	if s.lockoutSvc.IsAccountLocked(user) {
+		return "", fmt.Errorf("%w until %v", ErrAccountLocked, user.LockedUntil)
+	}
+
+	if err := s.passwordSvc.ComparePassword(user.PasswordHash, currentPassword); err != nil {
+		if err := s.lockoutSvc.RecordFailedAttempt(ctx, user); err != nil {
+			return "", fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+		return "", domain.ErrInvalidCredentials
+	}
+
+	passwordHash, err := s.hashNewPassword(ctx, user, newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.updatePassword(ctx, user, passwordHash); err != nil {
+		return "", err
+	}
+
+	// Reset links sent before the change must not work anymore
+	if err := s.tokenRepo.DeleteForUser(ctx, user.ID, domain.TokenPurposePasswordReset); err != nil {
+		return "", fmt.Errorf("failed to delete password reset tokens: %w", err)
+	}
+
+	accessToken, err := s.sessions.RevokeOtherSessions(ctx, claims)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.send(ctx, user, "Your password was changed", fmt.Sprintf(
+		"Hello %s,\n\nThe password of your Hosterizer account was just changed and your other sessions were signed out. If you did not do this, reset your password and contact support immediately.\n",
+		displayName(user),
+	)); err != nil {
+		return "", err
+	}
+
+	return accessToken, nil
+}
+
+// hashNewPassword checks a new password against the password policy of the
+// user's customers and the user's recent passwords, and hashes it
+func (s *AccountService) hashNewPassword(ctx context.Context, user *domain.User, password string) (string, error) {
+	memberships, err := s.membershipRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	var overrides []*domain.PasswordPolicyOverrides
+	for _, m := range memberships {
+		if m.Customer != nil {
+			overrides = append(overrides, m.Customer.Settings.PasswordPolicy)
+		}
+	}
+
+	if err := s.passwordSvc.CheckPassword(ctx, password, user, overrides...); err != nil {
+		return "", err
+	}
+
+	recent := []string{user.PasswordHash}
+	if s.passwordHistorySize > 1 {
+		history, err := s.userRepo.ListPasswordHistory(ctx, user.ID, s.passwordHistorySize-1)
+		if err != nil {
+			return "", fmt.Errorf("failed to get password history: %w", err)
+		}
+		recent = append(recent, history...)
+	}
+
+	for _, hash := range recent {
+		if hash != "" && s.passwordSvc.ComparePassword(hash, password) == nil {
+			return "", ErrPasswordReused
+		}
+	}
+
+	return s.passwordSvc.HashPassword(password)
+}
+
+// updatePassword stores a new password hash, keeping the replaced one in the history
+func (s *AccountService) updatePassword(ctx context.Context, user *domain.User, passwordHash string) error {
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, passwordHash, s.passwordHistorySize-1); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	user.PasswordHash = passwordHash
+	return nil
+}
+
+// issueToken replaces the user's outstanding tokens for a purpose with a new one
+// and returns the plaintext token. Only its hash is stored.
+func (s *AccountService) issueToken(ctx context.Context, userID int64, purpose domain.AccountTokenPurpose, ttl time.Duration) (string, error) {
+	b := make([]byte, accountTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := s.tokenRepo.DeleteForUser(ctx, userID, purpose); err != nil {
+		return "", fmt.Errorf("failed to delete account tokens: %w", err)
+	}
+
+	if err := s.tokenRepo.Create(ctx, &domain.AccountToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashAccountToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		return "", fmt.Errorf("failed to store account token: %w", err)
+	}
+
+	return token, nil
+}
+
+// findToken looks up an unused, unexpired token for the given purpose without redeeming it
+func (s *AccountService) findToken(ctx context.Context, purpose domain.AccountTokenPurpose, token string) (*domain.AccountToken, error) {
+	if token == "" {
+		return nil, ErrInvalidAccountToken
+	}
+
+	accountToken, err := s.tokenRepo.Find(ctx, purpose, hashAccountToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountTokenNotFound) {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	return accountToken, nil
+}
+
+// consumeToken redeems a token for the given purpose
+func (s *AccountService) consumeToken(ctx context.Context, purpose domain.AccountTokenPurpose, token string) (*domain.AccountToken, error) {
+	if token == "" {
+		return nil, ErrInvalidAccountToken
+	}
+
+	accountToken, err := s.tokenRepo.Consume(ctx, purpose, hashAccountToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountTokenNotFound) {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, fmt.Errorf("failed to redeem token: %w", err)
+	}
+
+	return accountToken, nil
+}
+
+func (s *AccountService) send(ctx context.Context, user *domain.User, subject, body string) error {
+	if err := s.mailer.Send(ctx, &MailMessage{
+		To:      user.Email,
+		Subject: subject,
+		Body:    body,
+	}); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func (s *AccountService) link(path, token string) string {
+	return s.baseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// hashAccountToken hashes an emailed token. The tokens carry 256 bits of
+// entropy, so a fast hash is sufficient.
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func displayName(user *domain.User) string {
+	if user.FirstName != "" {
+		return user.FirstName
+	}
+	return user.Email
+}
+
+// formatDuration renders a token lifetime for emails, e.g. "7 days", "1 hour" or "30 minutes"
+func formatDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d >= day && d%day == 0 {
+		if d == day {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", d/day)
+	}
+	if d >= time.Hour && d%time.Hour == 0 {
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	if d == time.Minute {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", d/time.Minute)
+}
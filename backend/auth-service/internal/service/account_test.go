@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+func TestRegisterSendsVerificationEmail(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+
+	if user.Role != domain.RoleCustomer || user.IsEmailVerified() {
+		t.Fatalf("new user has role %q and verified=%v", user.Role, user.IsEmailVerified())
+	}
+
+	messages := f.mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "jane@example.com" {
+		t.Fatalf("expected one email to the new user, got %+v", messages)
+	}
+
+	path, token := f.lastLink(t)
+	if path != "/verify-email" {
+		t.Fatalf("link path = %q", path)
+	}
+
+	if err := f.account.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if !user.IsEmailVerified() {
+		t.Fatal("email was not marked verified")
+	}
+
+	if err := f.account.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Fatalf("reused token: got %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestRegisterRejectsInvalidInput(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	if _, err := f.account.Register(ctx, RegisterRequest{Email: "Jane <jane@example.com>", Password: "kT9#vLq2!mZx"}); !errors.Is(err, ErrInvalidEmail) {
+		t.Fatalf("display name address: got %v, want ErrInvalidEmail", err)
+	}
+	if _, err := f.account.Register(ctx, RegisterRequest{Email: "jane@example.com", Password: "weak"}); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("weak password: got %v, want ErrPasswordTooShort", err)
+	}
+
+	f.register(t)
+	if _, err := f.account.Register(ctx, RegisterRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"}); !errors.Is(err, domain.ErrUserAlreadyExists) {
+		t.Fatalf("duplicate email: got %v, want ErrUserAlreadyExists", err)
+	}
+}
+
+func TestResendVerificationReplacesOlderLink(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.register(t)
+	_, first := f.lastLink(t)
+
+	if err := f.account.ResendVerificationEmail(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("ResendVerificationEmail: %v", err)
+	}
+	_, second := f.lastLink(t)
+
+	if err := f.account.VerifyEmail(ctx, first); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Fatalf("superseded token: got %v, want ErrInvalidAccountToken", err)
+	}
+	if err := f.account.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+
+	// Verified addresses get no further emails
+	sent := len(f.mailer.Messages())
+	if err := f.account.ResendVerificationEmail(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("ResendVerificationEmail: %v", err)
+	}
+	if len(f.mailer.Messages()) != sent {
+		t.Fatal("an email was sent to a verified address")
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+	user.FailedLoginAttempts = 3
+	lockedUntil := time.Now().Add(time.Hour)
+	user.LockedUntil = &lockedUntil
+
+	if err := f.account.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	path, token := f.lastLink(t)
+	if path != "/reset-password" {
+		t.Fatalf("link path = %q", path)
+	}
+
+	// Only the hash of the token is stored
+	for _, stored := range f.tokens.tokens {
+		if stored.TokenHash == token || strings.Contains(stored.TokenHash, token) {
+			t.Fatal("plaintext token was stored")
+		}
+	}
+
+	if err := f.account.ResetPassword(ctx, token, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	passwordSvc := NewPasswordService(PasswordConfig{Argon2: testArgon2})
+	if err := passwordSvc.ComparePassword(user.PasswordHash, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatal("password was not changed")
+	}
+	if len(f.revoker.revoked) != 1 || f.revoker.revoked[0] != user.ID {
+		t.Fatalf("sessions revoked for %v, want [%d]", f.revoker.revoked, user.ID)
+	}
+	if user.IsLocked() || user.FailedLoginAttempts != 0 {
+		t.Fatal("lockout was not lifted")
+	}
+	if !user.IsEmailVerified() {
+		t.Fatal("email was not marked verified")
+	}
+	if last := f.mailer.Messages()[len(f.mailer.Messages())-1]; last.Subject != "Your password was changed" {
+		t.Fatalf("last email subject = %q, want a change notification", last.Subject)
+	}
+
+	if err := f.account.ResetPassword(ctx, token, "hB6%gQe1^dWu"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Fatalf("reused token: got %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestRequestPasswordResetIgnoresUnknownEmail(t *testing.T) {
+	f := newFixture(t)
+
+	if err := f.account.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if len(f.mailer.Messages()) != 0 {
+		t.Fatal("an email was sent for an unknown address")
+	}
+}
+
+func TestResetPasswordRejectsExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.register(t)
+
+	if err := f.account.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	_, token := f.lastLink(t)
+
+	for _, stored := range f.tokens.tokens {
+		stored.ExpiresAt = time.Now().Add(-time.Second)
+	}
+
+	if err := f.account.ResetPassword(ctx, token, "Rw4$pYn8@cJs"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Fatalf("expired token: got %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestResetPasswordWithWeakPasswordKeepsToken(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.register(t)
+
+	if err := f.account.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	_, token := f.lastLink(t)
+
+	if err := f.account.ResetPassword(ctx, token, "weak"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("weak password: got %v, want ErrPasswordTooShort", err)
+	}
+	if err := f.account.ResetPassword(ctx, token, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatalf("ResetPassword after weak attempt: %v", err)
+	}
+}
+
+func TestTokensAreBoundToPurpose(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.register(t)
+	_, verificationToken := f.lastLink(t)
+
+	if err := f.account.ResetPassword(ctx, verificationToken, "Rw4$pYn8@cJs"); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Fatalf("verification token used for reset: got %v, want ErrInvalidAccountToken", err)
+	}
+
+	if err := f.account.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	_, resetToken := f.lastLink(t)
+
+	if err := f.account.VerifyEmail(ctx, resetToken); !errors.Is(err, ErrInvalidAccountToken) {
+		t.Fatalf("reset token used for verification: got %v, want ErrInvalidAccountToken", err)
+	}
+}
+
+func TestResetPasswordRejectsCurrentPassword(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.register(t)
+
+	if err := f.account.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	_, token := f.lastLink(t)
+
+	if err := f.account.ResetPassword(ctx, token, "kT9#vLq2!mZx"); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("current password: got %v, want ErrPasswordReused", err)
+	}
+	if err := f.account.ResetPassword(ctx, token, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatalf("ResetPassword after reused password: %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+	claims := &TokenClaims{UserID: user.ID, FamilyID: "family-1"}
+
+	accessToken, err := f.account.ChangePassword(ctx, claims, "kT9#vLq2!mZx", "Rw4$pYn8@cJs")
+	if err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if accessToken != "new-access-token" {
+		t.Fatalf("access token = %q, want the one for the kept login", accessToken)
+	}
+	if len(f.revoker.kept) != 1 || f.revoker.kept[0] != "family-1" {
+		t.Fatalf("kept logins %v, want [family-1]", f.revoker.kept)
+	}
+	if len(f.revoker.revoked) != 0 {
+		t.Fatal("the current login was revoked")
+	}
+
+	passwordSvc := NewPasswordService(PasswordConfig{Argon2: testArgon2})
+	if err := passwordSvc.ComparePassword(user.PasswordHash, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatal("password was not changed")
+	}
+	if history := f.users.history[user.ID]; len(history) != 1 || passwordSvc.ComparePassword(history[0], "kT9#vLq2!mZx") != nil {
+		t.Fatal("old password hash was not kept in the history")
+	}
+}
+
+func TestChangePasswordRequiresCurrentPassword(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+	claims := &TokenClaims{UserID: user.ID, FamilyID: "family-1"}
+
+	if _, err := f.account.ChangePassword(ctx, claims, "WrongPassw0rd!", "Rw4$pYn8@cJs"); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("wrong current password: got %v, want ErrInvalidCredentials", err)
+	}
+	if user.FailedLoginAttempts != 1 {
+		t.Fatalf("failed attempts = %d, want 1", user.FailedLoginAttempts)
+	}
+	if len(f.revoker.kept) != 0 {
+		t.Fatal("sessions were revoked after a failed change")
+	}
+}
+
+func TestChangePasswordRejectsRecentPasswords(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+	claims := &TokenClaims{UserID: user.ID, FamilyID: "family-1"}
+
+	change := func(current, next string) error {
+		_, err := f.account.ChangePassword(ctx, claims, current, next)
+		return err
+	}
+
+	if err := change("kT9#vLq2!mZx", "zF3&kMa7*tXo"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if err := change("zF3&kMa7*tXo", "nP5!rVy2#lCe"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+
+	// With a history size of 3, the current and the two previous passwords are rejected
+	for _, reused := range []string{"nP5!rVy2#lCe", "zF3&kMa7*tXo", "kT9#vLq2!mZx"} {
+		if err := change("nP5!rVy2#lCe", reused); !errors.Is(err, ErrPasswordReused) {
+			t.Fatalf("reusing %q: got %v, want ErrPasswordReused", reused, err)
+		}
+	}
+
+	if err := change("nP5!rVy2#lCe", "wJ8@sDi4$qGb"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if err := change("wJ8@sDi4$qGb", "kT9#vLq2!mZx"); err != nil {
+		t.Fatalf("password older than the history was rejected: %v", err)
+	}
+}
+
+func TestRegisterRejectsPasswordsSimilarToAccount(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	_, err := f.account.Register(ctx, RegisterRequest{Email: "jane.doe@example.com", Password: "J4ne-Qz8#wVk", FirstName: "Jane"})
+	if !errors.Is(err, ErrPasswordTooSimilar) {
+		t.Fatalf("got %v, want ErrPasswordTooSimilar", err)
+	}
+	if len(f.users.users) != 0 {
+		t.Fatal("user was created with a rejected password")
+	}
+}
+
+func TestChangePasswordAppliesCustomerOverrides(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+	claims := &TokenClaims{UserID: user.ID, FamilyID: "family-1"}
+
+	minLength := 16
+	f.memberships.memberships = append(f.memberships.memberships,
+		&domain.CustomerMembership{UserID: user.ID, Customer: &domain.Customer{}},
+		&domain.CustomerMembership{UserID: user.ID, Customer: &domain.Customer{
+			Settings: domain.CustomerSettings{
+				PasswordPolicy: &domain.PasswordPolicyOverrides{MinLength: &minLength},
+			},
+		}},
+	)
+
+	if _, err := f.account.ChangePassword(ctx, claims, "kT9#vLq2!mZx", "Rw4$pYn8@cJs"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("got %v, want ErrPasswordTooShort", err)
+	}
+	if _, err := f.account.ChangePassword(ctx, claims, "kT9#vLq2!mZx", "Rw4$pYn8@cJs-Hd2f"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	_, err := formatMailMessage("no-reply@example.com", &MailMessage{
+		To:      "jane@example.com",
+		Subject: "Hello\r\nBcc: victim@example.com",
+	})
+	if !errors.Is(err, ErrInvalidMailHeader) {
+		t.Fatalf("got %v, want ErrInvalidMailHeader", err)
+	}
+}
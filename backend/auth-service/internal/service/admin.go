@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// DefaultUserPageSize is the number of users listed per page
+	DefaultUserPageSize = 50
+
+	// MaxUserPageSize is the largest page of users a client may ask for
+	MaxUserPageSize = 200
+)
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrCannotDeleteSelf is returned when an administrator tries to delete their own account
+	ErrCannotDeleteSelf = errors.New("administrators cannot delete their own account")
+)
+
+const (
+	// AuditEventUserInvited is recorded when an administrator creates a user by invite
+	AuditEventUserInvited AuditEventType = "user_invited"
+
+	// AuditEventPasswordResetForced is recorded when an administrator resets a user's password
+	AuditEventPasswordResetForced AuditEventType = "password_reset_forced"
+
+	// AuditEventMFAReset is recorded when an administrator removes a user's second factors
+	AuditEventMFAReset AuditEventType = "mfa_reset"
+
+	// AuditEventUserDeleted is recorded when an administrator deletes a user
+	AuditEventUserDeleted AuditEventType = "user_deleted"
+)
+
+// MFAResetter removes every second factor of a user
+type MFAResetter interface {
+	ResetMFA(ctx context.Context, userID int64) error
+}
+
+// AdminService handles platform administration of user accounts
+type AdminService struct {
+	userRepo   domain.UserRepository
+	lockoutSvc *LockoutService
+	accountSvc *AccountService
+	mfa        MFAResetter
+	sessions   SessionRevoker
+	throttle   *LoginThrottle
+	events     EventRecorder
+}
+
+// AdminConfig holds admin service configuration
+type AdminConfig struct {
+	UserRepo   domain.UserRepository
+	LockoutSvc *LockoutService
+	AccountSvc *AccountService
+	MFA        MFAResetter
+	Sessions   SessionRevoker
+	Throttle   *LoginThrottle
+
+	// Events receives an audit event for every administrative change; defaults to the log
+	Events EventRecorder
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(config AdminConfig) *AdminService {
+	events := config.Events
+	if events == nil {
+		events = NewLogEventRecorder()
+	}
+
+	return &AdminService{
+		userRepo:   config.UserRepo,
+		lockoutSvc: config.LockoutSvc,
+		accountSvc: config.AccountSvc,
+		mfa:        config.MFA,
+		sessions:   config.Sessions,
+		throttle:   config.Throttle,
+		events:     events,
+	}
+}
+
+// UserPage is one page of a user listing
+type UserPage struct {
+	Users []*domain.User
+
+	// Total is the number of users matching the filter across all pages
+	Total int
+
+	// NextCursor fetches the following page; it is empty on the last page
+	NextCursor string
+}
+
+// ListUsers returns a page of the users matching the filter, starting after the
+// cursor of the previous page. Only administrators may list users.
+func (s *AdminService) ListUsers(ctx context.Context, actor *TokenClaims, filter domain.UserFilter, cursor string, limit int) (*UserPage, error) {
+	if actor.Role != domain.RoleAdministrator {
+		return nil, ErrForbidden
+	}
+
+	afterID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultUserPageSize
+	}
+	limit = min(limit, MaxUserPageSize)
+
+	// Fetch one extra user to learn whether another page follows
+	users, err := s.userRepo.List(ctx, filter, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	total, err := s.userRepo.Count(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	page := &UserPage{Users: users, Total: total}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = encodeCursor(page.Users[limit-1].ID)
+	}
+
+	return page, nil
+}
+
+// InviteUser creates a user and emails them a link to choose their password.
+// Only administrators may invite users.
+func (s *AdminService) InviteUser(ctx context.Context, actor *TokenClaims, req InviteRequest) (*domain.User, error) {
+	if actor.Role != domain.RoleAdministrator {
+		return nil, ErrForbidden
+	}
+
+	user, err := s.accountSvc.Invite(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.recordEvent(ctx, actor, AuditEventUserInvited, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ForcePasswordReset removes a user's password, signs them out everywhere and
+// emails them a password reset link. Only administrators may reset passwords.
+func (s *AdminService) ForcePasswordReset(ctx context.Context, actor *TokenClaims, userID int64) error {
+	user, err := s.getUser(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.accountSvc.ForcePasswordReset(ctx, user); err != nil {
+		return err
+	}
+
+	return s.recordEvent(ctx, actor, AuditEventPasswordResetForced, user)
+}
+
+// ResetMFA removes every second factor of a user, e.g. after they lost their
+// authenticator. Only administrators may reset MFA.
+func (s *AdminService) ResetMFA(ctx context.Context, actor *TokenClaims, userID int64) error {
+	user, err := s.getUser(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mfa.ResetMFA(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return s.recordEvent(ctx, actor, AuditEventMFAReset, user)
+}
+
+// UnlockAccount lifts the lockout of a user and forgets the failed logins for
+// their email address. Only administrators may unlock accounts.
+func (s *AdminService) UnlockAccount(ctx context.Context, actor *TokenClaims, userID int64) error {
+	user, err := s.getUser(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.lockoutSvc.UnlockAccount(ctx, user, actor.UserID); err != nil {
+		return err
+	}
+
+	if s.throttle != nil {
+		if err := s.throttle.Reset(ctx, user.Email); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteUser signs a user out everywhere and deletes them. Only administrators
+// may delete users, and not themselves.
+func (s *AdminService) DeleteUser(ctx context.Context, actor *TokenClaims, userID int64) error {
+	user, err := s.getUser(ctx, actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.ID == actor.UserID {
+		return ErrCannotDeleteSelf
+	}
+
+	if err := s.sessions.RevokeUserSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Delete(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return s.recordEvent(ctx, actor, AuditEventUserDeleted, user)
+}
+
+// getUser checks that the actor is an administrator and loads the target user
+func (s *AdminService) getUser(ctx context.Context, actor *TokenClaims, userID int64) (*domain.User, error) {
+	if actor.Role != domain.RoleAdministrator {
+		return nil, ErrForbidden
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// recordEvent records an audit event for an administrative change to a user
+func (s *AdminService) recordEvent(ctx context.Context, actor *TokenClaims, eventType AuditEventType, user *domain.User) error {
+	event := NewAuditEvent(ctx, eventType, user.ID, user.Email, "")
+	event.ActorID = actor.UserID
+
+	if err := s.events.Record(ctx, event); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// encodeCursor returns an opaque cursor for the page that continues after the row with the given ID
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the ID a page continues after; an empty cursor starts at the beginning
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
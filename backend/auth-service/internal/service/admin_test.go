@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+func TestListUsersPaginatesWithCursor(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	lockedUntil := time.Now().Add(time.Hour)
+	for i := 1; i <= 7; i++ {
+		user := &domain.User{Email: fmt.Sprintf("user%d@example.com", i), Role: domain.RoleCustomer, MFAEnabled: i%2 == 0}
+		if i == 3 {
+			user.Role = domain.RoleAdministrator
+		}
+		if i == 5 {
+			user.LockedUntil = &lockedUntil
+		}
+		if err := f.users.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	customer := domain.RoleCustomer
+	filter := domain.UserFilter{Role: &customer}
+
+	var emails []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination does not end")
+		}
+		page, err := f.admin.ListUsers(ctx, testAdmin, filter, cursor, 4)
+		if err != nil {
+			t.Fatalf("ListUsers: %v", err)
+		}
+		if page.Total != 6 {
+			t.Fatalf("total = %d, want 6", page.Total)
+		}
+		for _, u := range page.Users {
+			emails = append(emails, u.Email)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := []string{"user1@example.com", "user2@example.com", "user4@example.com", "user5@example.com", "user6@example.com", "user7@example.com"}
+	if fmt.Sprint(emails) != fmt.Sprint(want) {
+		t.Fatalf("listed %v, want %v", emails, want)
+	}
+
+	locked, mfa := true, true
+	page, err := f.admin.ListUsers(ctx, testAdmin, domain.UserFilter{Locked: &locked}, "", 0)
+	if err != nil || len(page.Users) != 1 || page.Users[0].Email != "user5@example.com" {
+		t.Fatalf("locked users: got %v, %v", page, err)
+	}
+	page, err = f.admin.ListUsers(ctx, testAdmin, domain.UserFilter{MFAEnabled: &mfa}, "", 0)
+	if err != nil || page.Total != 3 {
+		t.Fatalf("users with MFA: got %v, %v", page, err)
+	}
+
+	if _, err := f.admin.ListUsers(ctx, testAdmin, filter, "not a cursor", 4); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("bad cursor: got %v, want ErrInvalidCursor", err)
+	}
+	if _, err := f.admin.ListUsers(ctx, testCustomer, filter, "", 4); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("list by customer: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestInviteUserSetsPasswordThroughEmailLink(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	if _, err := f.admin.InviteUser(ctx, testCustomer, InviteRequest{Email: "jane@example.com", Role: domain.RoleCustomer}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("invite by customer: got %v, want ErrForbidden", err)
+	}
+	if _, err := f.admin.InviteUser(ctx, testAdmin, InviteRequest{Email: "jane@example.com", Role: "owner"}); !errors.Is(err, ErrInvalidUserRole) {
+		t.Fatalf("invite with unknown role: got %v, want ErrInvalidUserRole", err)
+	}
+
+	user, err := f.admin.InviteUser(ctx, testAdmin, InviteRequest{Email: "jane@example.com", FirstName: "Jane", Role: domain.RoleCustomer})
+	if err != nil {
+		t.Fatalf("InviteUser: %v", err)
+	}
+	if user.HasPassword() {
+		t.Fatal("invited user has a password")
+	}
+
+	path, token := f.lastLink(t)
+	if path != "/reset-password" {
+		t.Fatalf("link path = %q", path)
+	}
+	if err := f.account.ResetPassword(ctx, token, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if !user.HasPassword() || !user.IsEmailVerified() {
+		t.Fatal("accepting the invitation did not set the password and verify the email")
+	}
+
+	events := f.events.Events()
+	if len(events) != 1 || events[0].Type != AuditEventUserInvited || events[0].ActorID != testAdmin.UserID {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestForcePasswordResetRemovesPassword(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+
+	if err := f.admin.ForcePasswordReset(ctx, testCustomer, user.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("reset by customer: got %v, want ErrForbidden", err)
+	}
+	if err := f.admin.ForcePasswordReset(ctx, testAdmin, user.ID); err != nil {
+		t.Fatalf("ForcePasswordReset: %v", err)
+	}
+
+	if user.HasPassword() {
+		t.Fatal("password was not removed")
+	}
+	if len(f.revoker.revoked) != 1 || f.revoker.revoked[0] != user.ID {
+		t.Fatalf("sessions revoked for %v, want [%d]", f.revoker.revoked, user.ID)
+	}
+
+	// The old password cannot be chosen again
+	_, token := f.lastLink(t)
+	if err := f.account.ResetPassword(ctx, token, "kT9#vLq2!mZx"); !errors.Is(err, ErrPasswordReused) {
+		t.Fatalf("old password: got %v, want ErrPasswordReused", err)
+	}
+	if err := f.account.ResetPassword(ctx, token, "Rw4$pYn8@cJs"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+}
+
+func TestResetMFAAndDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.register(t)
+
+	if err := f.admin.ResetMFA(ctx, testAdmin, user.ID); err != nil {
+		t.Fatalf("ResetMFA: %v", err)
+	}
+	if len(f.mfaResetter.reset) != 1 || f.mfaResetter.reset[0] != user.ID {
+		t.Fatalf("MFA reset for %v, want [%d]", f.mfaResetter.reset, user.ID)
+	}
+
+	self := &TokenClaims{UserID: user.ID, Role: domain.RoleAdministrator}
+	if err := f.admin.DeleteUser(ctx, self, user.ID); !errors.Is(err, ErrCannotDeleteSelf) {
+		t.Fatalf("delete self: got %v, want ErrCannotDeleteSelf", err)
+	}
+	if err := f.admin.DeleteUser(ctx, testAdmin, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := f.users.GetByID(ctx, user.ID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("deleted user: got %v, want ErrUserNotFound", err)
+	}
+	if err := f.admin.DeleteUser(ctx, testAdmin, user.ID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("delete unknown user: got %v, want ErrUserNotFound", err)
+	}
+
+	var types []AuditEventType
+	for _, event := range f.events.Events() {
+		types = append(types, event.Type)
+	}
+	if fmt.Sprint(types) != fmt.Sprint([]AuditEventType{AuditEventMFAReset, AuditEventUserDeleted}) {
+		t.Fatalf("recorded events %v", types)
+	}
+}
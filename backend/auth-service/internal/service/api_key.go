@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/auth"
+)
+
+const (
+	// DefaultAPIKeyDuration is how long API keys are valid when no expiry is given
+	DefaultAPIKeyDuration = 90 * 24 * time.Hour
+
+	// MaxAPIKeyDuration is the longest an API key can be valid
+	MaxAPIKeyDuration = 365 * 24 * time.Hour
+
+	// apiKeyBytes is the number of random bytes in an API key
+	apiKeyBytes = 32
+
+	// apiKeyDisplayPrefixLength is the number of leading characters of a key
+	// stored in the clear to tell keys apart
+	apiKeyDisplayPrefixLength = 12
+
+	// maxAPIKeyNameLength is the longest name an API key can have
+	maxAPIKeyNameLength = 100
+)
+
+var (
+	// ErrInvalidAPIKey is returned when an API key is unknown, revoked or expired,
+	// or the principal it acts as can no longer sign in
+	ErrInvalidAPIKey = errors.New("invalid or expired api key")
+
+	// ErrInvalidAPIKeyName is returned when an API key has no name or a name that is too long
+	ErrInvalidAPIKeyName = errors.New("api key name must be between 1 and 100 characters")
+
+	// ErrInvalidScope is returned when an API key is requested without scopes or with an unknown scope
+	ErrInvalidScope = errors.New("invalid scope")
+
+	// ErrInvalidAPIKeyDuration is returned when an API key is requested with an expiry out of range
+	ErrInvalidAPIKeyDuration = errors.New("api key expiry must be between 1 and 365 days")
+
+	// ErrCustomerRequired is returned when a service key is requested without a customer
+	ErrCustomerRequired = errors.New("customer is required")
+)
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name   string
+	Scopes []string
+
+	// ExpiresIn is how long the key is valid, DefaultAPIKeyDuration if zero
+	ExpiresIn time.Duration
+
+	// CustomerID is the customer the key is scoped to. Personal access tokens of
+	// customer users default to the customer of the caller's token; service keys
+	// must name one.
+	CustomerID *int64
+
+	// Service requests a service key of the customer rather than a personal access token
+	Service bool
+}
+
+// APIKeyService manages long-lived, scoped API keys for automation and resolves
+// them to the principal they act as. Personal access tokens act as the user who
+// created them, limited to their scopes; service keys act on behalf of a customer.
+type APIKeyService struct {
+	apiKeyRepo     domain.APIKeyRepository
+	userRepo       domain.UserRepository
+	customerRepo   domain.CustomerRepository
+	membershipRepo domain.MembershipRepository
+	tenantSvc      *TenantService
+}
+
+// APIKeyConfig holds API key service configuration
+type APIKeyConfig struct {
+	APIKeyRepo     domain.APIKeyRepository
+	UserRepo       domain.UserRepository
+	CustomerRepo   domain.CustomerRepository
+	MembershipRepo domain.MembershipRepository
+	TenantSvc      *TenantService
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(config APIKeyConfig) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo:     config.APIKeyRepo,
+		userRepo:       config.UserRepo,
+		customerRepo:   config.CustomerRepo,
+		membershipRepo: config.MembershipRepo,
+		tenantSvc:      config.TenantSvc,
+	}
+}
+
+// Create creates an API key and returns it along with the plaintext key, which is
+// not stored and cannot be retrieved again. Personal access tokens of customer
+// users are scoped to a customer they belong to; service keys may only be created
+// by owners of the customer and administrators.
+func (s *APIKeyService) Create(ctx context.Context, actor *TokenClaims, req CreateAPIKeyRequest) (*domain.APIKey, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return nil, "", ErrInvalidAPIKeyName
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	expiresIn := req.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = DefaultAPIKeyDuration
+	}
+	if expiresIn < 0 || expiresIn > MaxAPIKeyDuration {
+		return nil, "", ErrInvalidAPIKeyDuration
+	}
+
+	createdBy := actor.UserID
+	apiKey := &domain.APIKey{
+		Name:      name,
+		CreatedBy: &createdBy,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+
+	switch {
+	case req.Service:
+		if req.CustomerID == nil {
+			return nil, "", ErrCustomerRequired
+		}
+		if err := authorizeMember(ctx, s.membershipRepo, actor, *req.CustomerID, true); err != nil {
+			return nil, "", err
+		}
+		if _, err := s.customerRepo.GetByID(ctx, *req.CustomerID); err != nil {
+			return nil, "", err
+		}
+		apiKey.CustomerID = req.CustomerID
+
+	case actor.Role == domain.RoleAdministrator:
+		// Administrators are not scoped to a customer, and neither are their tokens
+		apiKey.UserID = &createdBy
+
+	default:
+		customerID := req.CustomerID
+		if customerID == nil {
+			customerID = actor.CustomerID
+		}
+		if customerID == nil {
+			return nil, "", ErrNoActiveCustomer
+		}
+		if err := authorizeMember(ctx, s.membershipRepo, actor, *customerID, false); err != nil {
+			return nil, "", err
+		}
+		apiKey.UserID = &createdBy
+		apiKey.CustomerID = customerID
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey.KeyPrefix = key[:apiKeyDisplayPrefixLength]
+	apiKey.KeyHash = hashAccountToken(key)
+
+	if err := s.apiKeyRepo.Create(withActor(ctx, actor), apiKey); err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return apiKey, key, nil
+}
+
+// ListForUser returns the personal access tokens of a user, newest first. Users
+// may list their own tokens and administrators those of anyone.
+func (s *APIKeyService) ListForUser(ctx context.Context, actor *TokenClaims, userID int64) ([]*domain.APIKey, error) {
+	if actor.UserID != userID && actor.Role != domain.RoleAdministrator {
+		return nil, ErrForbidden
+	}
+
+	keys, err := s.apiKeyRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// ListForCustomer returns the keys scoped to a customer, newest first: its service
+// keys and the personal access tokens of its members. Only owners and
+// administrators may list them.
+func (s *APIKeyService) ListForCustomer(ctx context.Context, actor *TokenClaims, customerID int64) ([]*domain.APIKey, error) {
+	if err := authorizeMember(ctx, s.membershipRepo, actor, customerID, true); err != nil {
+		return nil, err
+	}
+
+	keys, err := s.apiKeyRepo.ListByCustomer(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key. Users may revoke their own tokens, owners any key
+// scoped to their customer and administrators any key.
+func (s *APIKeyService) Revoke(ctx context.Context, actor *TokenClaims, id int64) error {
+	apiKey, err := s.apiKeyRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	isOwn := apiKey.UserID != nil && *apiKey.UserID == actor.UserID
+	if !isOwn {
+		if apiKey.CustomerID == nil {
+			if actor.Role != domain.RoleAdministrator {
+				return ErrForbidden
+			}
+		} else if err := authorizeMember(ctx, s.membershipRepo, actor, *apiKey.CustomerID, true); err != nil {
+			return err
+		}
+	}
+
+	return s.apiKeyRepo.Revoke(withActor(ctx, actor), id)
+}
+
+// Authenticate resolves an API key to the claims of the principal it acts as.
+// The principal is checked as on every login: personal access tokens stop working
+// when their user is locked or leaves the customer, and every key stops working
+// when its customer is suspended.
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*auth.Claims, error) {
+	if !auth.IsAPIKey(key) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.apiKeyRepo.GetByHash(ctx, hashAccountToken(key))
+	if err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if !apiKey.IsActive() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var claims *auth.Claims
+	if apiKey.IsService() {
+		claims, err = s.serviceClaims(ctx, apiKey)
+	} else {
+		claims, err = s.personalClaims(ctx, apiKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed update must not lock automation out
+	if err := s.apiKeyRepo.UpdateLastUsed(ctx, apiKey.ID); err != nil {
+		log.Printf("failed to update api key last used: %v", err)
+	}
+
+	return claims, nil
+}
+
+// personalClaims returns the claims of the user a personal access token acts as
+func (s *APIKeyService) personalClaims(ctx context.Context, apiKey *domain.APIKey) (*auth.Claims, error) {
+	user, err := s.userRepo.GetByID(ctx, *apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.IsLocked() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// A token created by an administrator has no customer; it must not fall back
+	// to an arbitrary customer if the user has since become a customer user
+	if user.Role != domain.RoleAdministrator && apiKey.CustomerID == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	tenant, err := s.tenantSvc.ResolveTenant(ctx, user, apiKey.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Claims{
+		UserID:           user.ID,
+		UUID:             user.UUID,
+		Email:            user.Email,
+		Role:             string(user.Role),
+		CustomerID:       customerIDOf(tenant),
+		TenantRole:       string(tenantRoleOf(tenant)),
+		TokenType:        auth.TokenTypeAPIKey,
+		APIKeyID:         apiKey.UUID,
+		Scopes:           apiKey.Scopes,
+		RegisteredClaims: apiKeyRegisteredClaims(apiKey, user.UUID),
+	}, nil
+}
+
+// serviceClaims returns the claims of a service key, which acts as its customer
+// rather than a user. They carry the customer role and no user ID.
+func (s *APIKeyService) serviceClaims(ctx context.Context, apiKey *domain.APIKey) (*auth.Claims, error) {
+	customer, err := s.customerRepo.GetByID(ctx, *apiKey.CustomerID)
+	if err != nil {
+		if errors.Is(err, domain.ErrCustomerNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	switch {
+	case customer.IsSuspended():
+		return nil, ErrCustomerSuspended
+	case !customer.IsActive():
+		return nil, ErrNoActiveCustomer
+	}
+
+	return &auth.Claims{
+		UUID:             apiKey.UUID,
+		Role:             string(domain.RoleCustomer),
+		CustomerID:       apiKey.CustomerID,
+		TokenType:        auth.TokenTypeAPIKey,
+		APIKeyID:         apiKey.UUID,
+		Scopes:           apiKey.Scopes,
+		RegisteredClaims: apiKeyRegisteredClaims(apiKey, apiKey.UUID),
+	}, nil
+}
+
+func apiKeyRegisteredClaims(apiKey *domain.APIKey, subject string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		ID:        apiKey.UUID,
+		Subject:   subject,
+		Issuer:    auth.Issuer,
+		ExpiresAt: jwt.NewNumericDate(apiKey.ExpiresAt),
+		IssuedAt:  jwt.NewNumericDate(apiKey.CreatedAt),
+	}
+}
+
+// normalizeScopes checks that scopes are known and removes duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !auth.IsValidScope(scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+// generateAPIKey returns a new random API key. The keys carry 256 bits of
+// entropy, so they are stored with the same fast hash as emailed tokens.
+func generateAPIKey() (string, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return auth.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
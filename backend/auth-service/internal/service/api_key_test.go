@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/auth"
+)
+
+func TestPersonalAPIKeyActsAsUser(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addTenantMembers(t)
+	customerID := int64(testCustomerID)
+	developer := &TokenClaims{UserID: testDeveloper.UserID, Role: domain.RoleCustomer, CustomerID: &customerID}
+
+	if _, _, err := f.apiKeys.Create(ctx, developer, CreateAPIKeyRequest{Name: "ci", Scopes: []string{"sites:admin"}}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("unknown scope: got %v, want ErrInvalidScope", err)
+	}
+	if _, _, err := f.apiKeys.Create(ctx, developer, CreateAPIKeyRequest{Name: "ci", Scopes: []string{auth.ScopeSitesRead}, ExpiresIn: 2 * MaxAPIKeyDuration}); !errors.Is(err, ErrInvalidAPIKeyDuration) {
+		t.Fatalf("long expiry: got %v, want ErrInvalidAPIKeyDuration", err)
+	}
+	other := int64(99)
+	if _, _, err := f.apiKeys.Create(ctx, developer, CreateAPIKeyRequest{Name: "ci", Scopes: []string{auth.ScopeSitesRead}, CustomerID: &other}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("foreign customer: got %v, want ErrForbidden", err)
+	}
+
+	apiKey, key, err := f.apiKeys.Create(ctx, developer, CreateAPIKeyRequest{
+		Name:   " ci ",
+		Scopes: []string{auth.ScopeSitesWrite, auth.ScopeDeploymentsRead, auth.ScopeSitesWrite},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(key, auth.APIKeyPrefix) || !strings.HasPrefix(key, apiKey.KeyPrefix) || apiKey.KeyHash == key {
+		t.Fatalf("key %q stored as prefix %q, hash %q", key, apiKey.KeyPrefix, apiKey.KeyHash)
+	}
+	if apiKey.Name != "ci" || len(apiKey.Scopes) != 2 || apiKey.IsService() || *apiKey.CustomerID != testCustomerID {
+		t.Fatalf("unexpected key: %+v", apiKey)
+	}
+
+	claims, err := f.apiKeys.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if claims.UserID != testDeveloper.UserID || claims.TenantRole != string(domain.MembershipRoleDeveloper) || *claims.CustomerID != testCustomerID || claims.APIKeyID != apiKey.UUID {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if !claims.HasScope(auth.ScopeSitesRead) || !claims.HasScope(auth.ScopeDeploymentsRead) || claims.HasScope(auth.ScopeDeploymentsWrite) {
+		t.Fatalf("scopes %v not enforced", claims.Scopes)
+	}
+	if apiKey.LastUsedAt == nil {
+		t.Fatal("last use not recorded")
+	}
+
+	// The key stops working with the user's ability to sign in
+	lockedUntil := time.Now().Add(time.Hour)
+	f.users.users[2].LockedUntil = &lockedUntil
+	if _, err := f.apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("locked user: got %v, want ErrInvalidAPIKey", err)
+	}
+	f.users.users[2].LockedUntil = nil
+
+	if _, err := f.apiKeys.Authenticate(ctx, key+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("wrong key: got %v, want ErrInvalidAPIKey", err)
+	}
+
+	// Owners can see and revoke the tokens scoped to their customer
+	keys, err := f.apiKeys.ListForCustomer(ctx, testOwner, testCustomerID)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("ListForCustomer: got %v, %v", keys, err)
+	}
+	if err := f.apiKeys.Revoke(ctx, testOwner, apiKey.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := f.apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("revoked key: got %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestServiceAPIKeyActsAsCustomer(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addTenantMembers(t)
+	customerID := int64(testCustomerID)
+	req := CreateAPIKeyRequest{Name: "deploy bot", Scopes: []string{auth.ScopeDeploymentsWrite}, CustomerID: &customerID, Service: true}
+
+	if _, _, err := f.apiKeys.Create(ctx, testDeveloper, req); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("create by developer: got %v, want ErrForbidden", err)
+	}
+
+	apiKey, key, err := f.apiKeys.Create(ctx, testOwner, req)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	claims, err := f.apiKeys.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if claims.UserID != 0 || claims.Role != auth.RoleCustomer || *claims.CustomerID != testCustomerID || claims.Subject != apiKey.UUID || !claims.IsAPIKey() {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := f.apiKeys.ListForCustomer(ctx, testDeveloper, testCustomerID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("list by developer: got %v, want ErrForbidden", err)
+	}
+	if err := f.apiKeys.Revoke(ctx, testDeveloper, apiKey.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("revoke by developer: got %v, want ErrForbidden", err)
+	}
+
+	f.customer.Status = domain.CustomerStatusSuspended
+	if _, err := f.apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrCustomerSuspended) {
+		t.Fatalf("suspended customer: got %v, want ErrCustomerSuspended", err)
+	}
+	f.customer.Status = domain.CustomerStatusActive
+
+	apiKey.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := f.apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expired key: got %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestAdministratorAPIKeyIsUnscoped(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addTenantMembers(t)
+
+	apiKey, key, err := f.apiKeys.Create(ctx, testAdmin, CreateAPIKeyRequest{Name: "ops", Scopes: []string{auth.ScopePoliciesWrite}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if apiKey.CustomerID != nil {
+		t.Fatalf("administrator key scoped to customer %d", *apiKey.CustomerID)
+	}
+
+	claims, err := f.apiKeys.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !claims.IsAdministrator() || claims.CustomerID != nil {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := f.apiKeys.ListForUser(ctx, testOwner, testAdmin.UserID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("list other user: got %v, want ErrForbidden", err)
+	}
+	if err := f.apiKeys.Revoke(ctx, testOwner, apiKey.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("revoke by customer: got %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/hosterizer/shared/auth"
+)
+
+// AuditEventType identifies a security-relevant event
+type AuditEventType string
+
+const (
+	// AuditEventAccountLocked is recorded when an account is locked after failures
+	AuditEventAccountLocked AuditEventType = "account_locked"
+
+	// AuditEventAccountUnlocked is recorded when an administrator unlocks an account
+	AuditEventAccountUnlocked AuditEventType = "account_unlocked"
+
+	// AuditEventLogin is recorded for every login attempt, successful or not
+	AuditEventLogin AuditEventType = "login"
+
+	// AuditEventMFAChallenge is recorded for every second factor presented at an MFA challenge
+	AuditEventMFAChallenge AuditEventType = "mfa_challenge"
+
+	// AuditEventSSOLogin is recorded for every login through single sign-on
+	AuditEventSSOLogin AuditEventType = "sso_login"
+
+	// AuditEventTokenRefresh is recorded for every refresh token exchange
+	AuditEventTokenRefresh AuditEventType = "token_refresh"
+
+	// AuditEventTenantSwitched is recorded when a login switches to another customer
+	AuditEventTenantSwitched AuditEventType = "tenant_switched"
+
+	// AuditEventLogout is recorded when a user logs out of one or all sessions
+	AuditEventLogout AuditEventType = "logout"
+
+	// AuditEventSessionRevoked is recorded when sessions are revoked from another session
+	AuditEventSessionRevoked AuditEventType = "session_revoked"
+
+	// AuditEventMFAEnabled is recorded when a user enables TOTP
+	AuditEventMFAEnabled AuditEventType = "mfa_enabled"
+
+	// AuditEventMFADisabled is recorded when a user disables TOTP
+	AuditEventMFADisabled AuditEventType = "mfa_disabled"
+
+	// AuditEventRecoveryCodesRegenerated is recorded when a user replaces their recovery codes
+	AuditEventRecoveryCodesRegenerated AuditEventType = "recovery_codes_regenerated"
+
+	// AuditEventWebAuthnCredentialAdded is recorded when a user registers a passkey or security key
+	AuditEventWebAuthnCredentialAdded AuditEventType = "webauthn_credential_added"
+
+	// AuditEventWebAuthnCredentialRemoved is recorded when a user removes a passkey or security key
+	AuditEventWebAuthnCredentialRemoved AuditEventType = "webauthn_credential_removed"
+)
+
+// AuditEvent describes a security-relevant event. Zero IDs are unknown or not applicable.
+type AuditEvent struct {
+	Type    AuditEventType
+	Outcome domain.AuthEventOutcome
+	UserID  int64
+
+	// ActorID is the user who triggered the event, if not the user themselves
+	ActorID int64
+
+	// CustomerID is the customer tenant the event happened in
+	CustomerID int64
+
+	Email      string
+	IPAddress  string
+	UserAgent  string
+	Reason     string
+	OccurredAt time.Time
+}
+
+// EventRecorder records audit events
+type EventRecorder interface {
+	Record(ctx context.Context, event *AuditEvent) error
+}
+
+// NewAuditEvent creates a successful event with the client details of the request in ctx
+func NewAuditEvent(ctx context.Context, eventType AuditEventType, userID int64, email, reason string) *AuditEvent {
+	info := RequestInfoFrom(ctx)
+	return &AuditEvent{
+		Type:       eventType,
+		Outcome:    domain.AuthEventSuccess,
+		UserID:     userID,
+		Email:      email,
+		IPAddress:  info.IPAddress,
+		UserAgent:  info.UserAgent,
+		Reason:     reason,
+		OccurredAt: time.Now(),
+	}
+}
+
+// RequestInfo describes the client a request came from
+type RequestInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo returns a context carrying the client details of a request
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the client details carried by ctx, if any
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// withActor returns a context carrying the claims of the user making a change in
+// their shared form, so the audit log entries recorded with it name that user
+func withActor(ctx context.Context, actor *TokenClaims) context.Context {
+	return auth.WithClaims(ctx, &auth.Claims{
+		UserID:     actor.UserID,
+		UUID:       actor.UUID,
+		Email:      actor.Email,
+		Role:       string(actor.Role),
+		CustomerID: actor.CustomerID,
+		TenantRole: string(actor.TenantRole),
+		SessionID:  actor.SessionID,
+		TokenType:  actor.TokenType,
+	})
+}
+
+// LogEventRecorder implements EventRecorder by writing events to the log
+type LogEventRecorder struct{}
+
+// NewLogEventRecorder creates a new logging event recorder
+func NewLogEventRecorder() *LogEventRecorder {
+	return &LogEventRecorder{}
+}
+
+// Record logs an event
+func (r *LogEventRecorder) Record(ctx context.Context, event *AuditEvent) error {
+	log.Printf("AUDIT %s outcome=%s user=%d actor=%d customer=%d email=%q ip=%s reason=%q",
+		event.Type, event.Outcome, event.UserID, event.ActorID, event.CustomerID, event.Email, event.IPAddress, event.Reason)
+	return nil
+}
+
+// RepositoryEventRecorder implements EventRecorder by appending events to the
+// auth_events table, where administrators and customer owners can query them
+type RepositoryEventRecorder struct {
+	repo domain.AuthEventRepository
+}
+
+// NewRepositoryEventRecorder creates a new event recorder that stores events in a repository
+func NewRepositoryEventRecorder(repo domain.AuthEventRepository) *RepositoryEventRecorder {
+	return &RepositoryEventRecorder{
+		repo: repo,
+	}
+}
+
+// Record stores an event
+func (r *RepositoryEventRecorder) Record(ctx context.Context, event *AuditEvent) error {
+	outcome := event.Outcome
+	if outcome == "" {
+		outcome = domain.AuthEventSuccess
+	}
+
+	authEvent := &domain.AuthEvent{
+		Type:       string(event.Type),
+		Outcome:    outcome,
+		UserID:     optionalID(event.UserID),
+		ActorID:    optionalID(event.ActorID),
+		CustomerID: optionalID(event.CustomerID),
+		Email:      event.Email,
+		IPAddress:  event.IPAddress,
+		UserAgent:  event.UserAgent,
+		Reason:     event.Reason,
+		OccurredAt: event.OccurredAt,
+	}
+	if authEvent.OccurredAt.IsZero() {
+		authEvent.OccurredAt = time.Now()
+	}
+
+	if err := r.repo.Create(ctx, authEvent); err != nil {
+		return fmt.Errorf("failed to store audit event: %w", err)
+	}
+	return nil
+}
+
+// optionalID returns nil for a zero ID
+func optionalID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// MemoryEventRecorder implements EventRecorder by keeping events in memory, for tests
+type MemoryEventRecorder struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+// NewMemoryEventRecorder creates a new in-memory event recorder
+func NewMemoryEventRecorder() *MemoryEventRecorder {
+	return &MemoryEventRecorder{}
+}
+
+// Record stores an event
+func (r *MemoryEventRecorder) Record(ctx context.Context, event *AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// Events returns every event recorded so far, oldest first
+func (r *MemoryEventRecorder) Events() []AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]AuditEvent(nil), r.events...)
+}
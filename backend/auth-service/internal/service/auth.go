@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/hosterizer/auth-service/internal/domain"
 )
 
@@ -14,8 +17,14 @@ type AuthService struct {
 	passwordSvc *PasswordService
 	jwtSvc      *JWTService
 	mfaSvc      *MFAService
+	recoverySvc *RecoveryCodeService
+	webauthnSvc *WebAuthnService
 	lockoutSvc  *LockoutService
 	sessionSvc  *SessionService
+	refreshSvc  *RefreshTokenService
+	tenantSvc   *TenantService
+	throttle    *LoginThrottle
+	events      EventRecorder
 }
 
 // AuthServiceConfig holds auth service configuration
@@ -24,27 +33,53 @@ type AuthServiceConfig struct {
 	PasswordSvc *PasswordService
 	JWTSvc      *JWTService
 	MFASvc      *MFAService
+	RecoverySvc *RecoveryCodeService
+	WebAuthnSvc *WebAuthnService
 	LockoutSvc  *LockoutService
 	SessionSvc  *SessionService
+	RefreshSvc  *RefreshTokenService
+	TenantSvc   *TenantService
+
+	// Throttle delays repeated failed logins; logins are not throttled without one
+	Throttle *LoginThrottle
+
+	// Events receives an audit event for every login, MFA challenge, token refresh,
+	// logout and change of second factors; defaults to the log. The events record
+	// what has already happened, so failing to record one is logged, not returned.
+	Events EventRecorder
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(config AuthServiceConfig) *AuthService {
+	events := config.Events
+	if events == nil {
+		events = NewLogEventRecorder()
+	}
+
 	return &AuthService{
 		userRepo:    config.UserRepo,
 		passwordSvc: config.PasswordSvc,
 		jwtSvc:      config.JWTSvc,
 		mfaSvc:      config.MFASvc,
+		recoverySvc: config.RecoverySvc,
+		webauthnSvc: config.WebAuthnSvc,
 		lockoutSvc:  config.LockoutSvc,
 		sessionSvc:  config.SessionSvc,
+		refreshSvc:  config.RefreshSvc,
+		tenantSvc:   config.TenantSvc,
+		throttle:    config.Throttle,
+		events:      events,
 	}
 }
 
-// LoginRequest represents a login request
+// LoginRequest represents a login request. A WebAuthn assertion may serve as the
+// second factor, or as the only factor when no email and password are given.
 type LoginRequest struct {
-	Email    string
-	Password string
-	MFACode  string
+	Email        string
+	Password     string
+	MFACode      string
+	RecoveryCode string
+	WebAuthn     []byte
 }
 
 // LoginResponse represents a login response
@@ -53,11 +88,58 @@ type LoginResponse struct {
 	RefreshToken string
 	User         *domain.User
 	RequiresMFA  bool
+	MFAToken     string
+
+	// CustomerID is the customer the tokens are scoped to, if any
+	CustomerID *int64
+}
+
+// MFAChallengeRequest represents the second step of a login with MFA
+type MFAChallengeRequest struct {
+	MFAToken     string
+	MFACode      string
+	RecoveryCode string
+	WebAuthn     []byte
+}
+
+// loginAttempt collects who is behind a login, MFA challenge or token refresh as
+// soon as it is known, so that failed attempts are recorded against them too
+type loginAttempt struct {
+	userID int64
+	email  string
+}
+
+// identify notes the user an attempt is for
+func (a *loginAttempt) identify(user *domain.User) {
+	a.userID = user.ID
+	a.email = user.Email
 }
 
-// Login authenticates a user and returns tokens
+// Login authenticates a user and returns tokens. Every attempt is recorded.
 func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
-	// Get user by email
+	attempt := &loginAttempt{email: req.Email}
+	resp, err := s.login(ctx, req, attempt)
+	s.recordAttempt(ctx, AuditEventLogin, attempt, resp, err)
+	return resp, err
+}
+
+// login performs a login for Login
+func (s *AuthService) login(ctx context.Context, req LoginRequest, attempt *loginAttempt) (*LoginResponse, error) {
+	// Passwordless login with a passkey, throttled by client IP only
+	if req.Email == "" && req.Password == "" && len(req.WebAuthn) > 0 {
+		return s.throttled(ctx, "", func() (*LoginResponse, error) {
+			return s.loginWithPasskey(ctx, req.WebAuthn, attempt)
+		})
+	}
+
+	return s.throttled(ctx, req.Email, func() (*LoginResponse, error) {
+		return s.loginWithPassword(ctx, req, attempt)
+	})
+}
+
+// loginWithPassword performs a login with an email address and password
+func (s *AuthService) loginWithPassword(ctx context.Context, req LoginRequest, attempt *loginAttempt) (*LoginResponse, error) {
+	// Get user by email; guesses against unknown addresses count too, for password spraying
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
@@ -65,31 +147,57 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*LoginRespon
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	attempt.identify(user)
 
 	// Check if account is locked
 	if s.lockoutSvc.IsAccountLocked(user) {
-		return nil, fmt.Errorf("account is locked until %v", user.LockedUntil)
+		return nil, lockedError(user)
+	}
+
+	// Invited users and users whose password was reset have to choose one first
+	if !user.HasPassword() {
+		return nil, domain.ErrInvalidCredentials
 	}
 
-	// Verify password
+	// Verify password. Wrong passwords are left to the throttle rather than
+	// locking the account, which anyone knowing the address could do.
 	if err := s.passwordSvc.ComparePassword(user.PasswordHash, req.Password); err != nil {
-		// Record failed attempt
-		if err := s.lockoutSvc.RecordFailedAttempt(ctx, user); err != nil {
-			return nil, fmt.Errorf("failed to record failed attempt: %w", err)
-		}
 		return nil, domain.ErrInvalidCredentials
 	}
 
+	// Members of a customer that enforces single sign-on must log in through it
+	if err := s.checkSSORequired(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// Upgrade a hash with an outdated algorithm or cost while the password is at hand
+	if s.passwordSvc.NeedsRehash(user.PasswordHash) {
+		if err := s.rehashPassword(ctx, user, req.Password); err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if MFA is enabled
-	if user.MFAEnabled {
-		if req.MFACode == "" {
+	requiresMFA, err := s.requiresMFA(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if requiresMFA {
+		// Without a code, hand out a challenge token for the second step
+		if req.MFACode == "" && req.RecoveryCode == "" && len(req.WebAuthn) == 0 {
+			mfaToken, err := s.jwtSvc.GenerateMFAToken(user)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate MFA token: %w", err)
+			}
+
 			return &LoginResponse{
 				RequiresMFA: true,
+				MFAToken:    mfaToken,
 			}, nil
 		}
 
-		// Validate MFA code
-		valid, err := s.mfaSvc.ValidateCodeWithWindow(user.MFASecret, req.MFACode, 1)
+		// Validate MFA code, passkey or recovery code
+		valid, err := s.verifySecondFactor(ctx, user, req.MFACode, req.RecoveryCode, req.WebAuthn)
 		if err != nil {
 			return nil, fmt.Errorf("failed to validate MFA code: %w", err)
 		}
@@ -97,10 +205,226 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*LoginRespon
 			if err := s.lockoutSvc.RecordFailedAttempt(ctx, user); err != nil {
 				return nil, fmt.Errorf("failed to record failed attempt: %w", err)
 			}
-			return nil, errors.New("invalid MFA code")
+			return nil, ErrInvalidMFACode
+		}
+	}
+
+	return s.completeLogin(ctx, user, nil)
+}
+
+// throttled runs a login step for an email address, which may be empty, under the
+// throttle for it and the client IP. The step counts as a failed login until it
+// succeeds, which forgets the failures of the address, or fails for another
+// reason than a wrong guess, which takes it back.
+func (s *AuthService) throttled(ctx context.Context, email string, step func() (*LoginResponse, error)) (*LoginResponse, error) {
+	if s.throttle == nil {
+		return step()
+	}
+
+	throttled, err := s.throttle.Begin(ctx, email, RequestInfoFrom(ctx).IPAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := step()
+	switch {
+	case err == nil:
+		if err := s.throttle.Succeed(ctx, throttled); err != nil {
+			return nil, err
+		}
+	case !isWrongGuess(err):
+		if err := s.throttle.Release(ctx, throttled); err != nil {
+			return nil, err
 		}
 	}
 
+	return resp, err
+}
+
+// isWrongGuess reports whether a login step failed on the credentials, including
+// attempts against a locked account
+func isWrongGuess(err error) bool {
+	return errors.Is(err, domain.ErrInvalidCredentials) ||
+		errors.Is(err, ErrInvalidMFACode) ||
+		errors.Is(err, ErrAccountLocked)
+}
+
+// rehashPassword stores a new hash of a user's verified password
+func (s *AuthService) rehashPassword(ctx context.Context, user *domain.User, password string) error {
+	passwordHash, err := s.passwordSvc.RehashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, passwordHash); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	user.PasswordHash = passwordHash
+
+	return nil
+}
+
+// CompleteMFAChallenge exchanges an MFA token from Login plus a TOTP or recovery code
+// for tokens. Each MFA token can be exchanged once and allows MaxMFAAttempts wrong
+// codes before the account is locked. Every attempt is recorded.
+func (s *AuthService) CompleteMFAChallenge(ctx context.Context, req MFAChallengeRequest) (*LoginResponse, error) {
+	attempt := &loginAttempt{}
+	resp, err := s.completeMFAChallenge(ctx, req, attempt)
+	s.recordAttempt(ctx, AuditEventMFAChallenge, attempt, resp, err)
+	return resp, err
+}
+
+// completeMFAChallenge performs an MFA challenge for CompleteMFAChallenge
+func (s *AuthService) completeMFAChallenge(ctx context.Context, req MFAChallengeRequest, attempt *loginAttempt) (*LoginResponse, error) {
+	claims, err := s.jwtSvc.ValidateMFAToken(ctx, req.MFAToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MFA token: %w", err)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	attempt.identify(user)
+
+	// Wrong codes are throttled like wrong passwords, on top of the attempts
+	// each MFA token allows
+	return s.throttled(ctx, user.Email, func() (*LoginResponse, error) {
+		return s.verifyMFAChallenge(ctx, req, claims, user)
+	})
+}
+
+// verifyMFAChallenge checks the second factor of an MFA challenge for a user
+func (s *AuthService) verifyMFAChallenge(ctx context.Context, req MFAChallengeRequest, claims *TokenClaims, user *domain.User) (*LoginResponse, error) {
+	// Check if account is locked
+	if s.lockoutSvc.IsAccountLocked(user) {
+		return nil, lockedError(user)
+	}
+
+	requiresMFA, err := s.requiresMFA(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !requiresMFA {
+		return nil, ErrMFANotEnabled
+	}
+
+	valid, err := s.verifySecondFactor(ctx, user, req.MFACode, req.RecoveryCode, req.WebAuthn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate MFA code: %w", err)
+	}
+	if !valid {
+		exhausted, err := s.lockoutSvc.RecordFailedMFAAttempt(ctx, user, claims.ID, time.Until(claims.ExpiresAt.Time))
+		if err != nil {
+			return nil, fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+		if exhausted {
+			if err := s.sessionSvc.DenylistToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidMFACode
+	}
+
+	// The MFA token is single-use
+	if err := s.sessionSvc.DenylistToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, user, nil)
+}
+
+// BeginWebAuthnLogin starts a WebAuthn login ceremony. With an MFA token from Login
+// the assertion is the second factor for that user; without one it starts a
+// passwordless login with any passkey.
+func (s *AuthService) BeginWebAuthnLogin(ctx context.Context, mfaToken string) (*protocol.CredentialAssertion, error) {
+	if mfaToken == "" {
+		return s.webauthnSvc.BeginLogin(ctx, nil)
+	}
+
+	claims, err := s.jwtSvc.ValidateMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MFA token: %w", err)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.webauthnSvc.BeginLogin(ctx, user)
+}
+
+// loginWithPasskey logs a user in with a passkey alone. The passkey was created with
+// user verification, so it counts as both factors.
+func (s *AuthService) loginWithPasskey(ctx context.Context, assertion []byte, attempt *loginAttempt) (*LoginResponse, error) {
+	user, err := s.webauthnSvc.FinishLogin(ctx, nil, assertion)
+	if err != nil {
+		if errors.Is(err, ErrWebAuthnVerificationFailed) || errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+			return nil, domain.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	attempt.identify(user)
+
+	// Check if account is locked
+	if s.lockoutSvc.IsAccountLocked(user) {
+		return nil, lockedError(user)
+	}
+
+	if err := s.checkSSORequired(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, user, nil)
+}
+
+// CompleteSSOLogin logs in a user authenticated by a customer's identity provider,
+// with tokens scoped to that customer. Second factors are left to the identity
+// provider. It implements SSOLoginCompleter.
+func (s *AuthService) CompleteSSOLogin(ctx context.Context, user *domain.User, customerID int64) (*LoginResponse, error) {
+	attempt := &loginAttempt{}
+	attempt.identify(user)
+
+	var resp *LoginResponse
+	var err error
+	if s.lockoutSvc.IsAccountLocked(user) {
+		err = lockedError(user)
+	} else {
+		resp, err = s.completeLogin(ctx, user, &customerID)
+	}
+
+	s.recordAttempt(ctx, AuditEventSSOLogin, attempt, resp, err)
+	return resp, err
+}
+
+// lockedError returns the error for a login refused because the account is locked
+func lockedError(user *domain.User) error {
+	return fmt.Errorf("%w until %v", ErrAccountLocked, user.LockedUntil)
+}
+
+// checkSSORequired returns ErrSSORequired if the user must log in through single sign-on
+func (s *AuthService) checkSSORequired(ctx context.Context, user *domain.User) error {
+	required, err := s.tenantSvc.RequiresSSO(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrSSORequired
+	}
+	return nil
+}
+
+// completeLogin starts a new login for a fully authenticated user and issues its
+// tokens. A login through a customer's identity provider gives that customer as
+// ssoCustomerID and is scoped to it.
+func (s *AuthService) completeLogin(ctx context.Context, user *domain.User, ssoCustomerID *int64) (*LoginResponse, error) {
+	// Resolve the customer tenant the tokens are scoped to
+	tenant, err := s.tenantSvc.ResolveLoginTenant(ctx, user, ssoCustomerID, ssoCustomerID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Reset failed attempts on successful login
 	if err := s.lockoutSvc.ResetFailedAttempts(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to reset failed attempts: %w", err)
@@ -111,17 +435,34 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*LoginRespon
 		return nil, fmt.Errorf("failed to update last login: %w", err)
 	}
 
-	// Determine customer ID for token
-	var customerID *int64
-	// This would be populated from a customer relationship if the user is a customer
+	// Start a new token family; the login session is keyed by the same ID
+	familyID, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	info := RequestInfoFrom(ctx)
+	if err := s.sessionSvc.CreateSession(ctx, familyID, &SessionData{
+		UserID:        user.ID,
+		UUID:          user.UUID,
+		Email:         user.Email,
+		Role:          string(user.Role),
+		CustomerID:    customerIDOf(tenant),
+		SSOCustomerID: ssoCustomerID,
+		IPAddress:     info.IPAddress,
+		UserAgent:     info.UserAgent,
+		Device:        describeDevice(info.UserAgent),
+	}); err != nil {
+		return nil, err
+	}
 
 	// Generate tokens
-	accessToken, err := s.jwtSvc.GenerateAccessToken(user, customerID)
+	accessToken, err := s.jwtSvc.GenerateAccessToken(user, tenant, familyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := s.jwtSvc.GenerateRefreshToken(user)
+	refreshToken, err := s.refreshSvc.Issue(ctx, user, customerIDOf(tenant), familyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -131,14 +472,34 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*LoginRespon
 		RefreshToken: refreshToken,
 		User:         user,
 		RequiresMFA:  false,
+		CustomerID:   customerIDOf(tenant),
 	}, nil
 }
 
-// RefreshTokens refreshes access and refresh tokens
+// RefreshTokens exchanges a refresh token for a new access and refresh token pair.
+// The presented refresh token is single-use; reusing it revokes its token family.
+// Every exchange is recorded.
 func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*LoginResponse, error) {
-	// Validate refresh token
-	claims, err := s.jwtSvc.ValidateRefreshToken(refreshToken)
+	// Note whose token it is, so that failures such as reuse are recorded against them
+	attempt := &loginAttempt{}
+	if claims, err := s.jwtSvc.ValidateRefreshToken(refreshToken); err == nil {
+		attempt.userID = claims.UserID
+		attempt.email = claims.Email
+	}
+
+	resp, err := s.refreshTokens(ctx, refreshToken, attempt)
+	s.recordAttempt(ctx, AuditEventTokenRefresh, attempt, resp, err)
+	return resp, err
+}
+
+// refreshTokens performs a token refresh for RefreshTokens
+func (s *AuthService) refreshTokens(ctx context.Context, refreshToken string, attempt *loginAttempt) (*LoginResponse, error) {
+	// Validate and consume refresh token
+	claims, err := s.refreshSvc.Rotate(ctx, refreshToken)
 	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("invalid refresh token: %w", err)
 	}
 
@@ -147,19 +508,38 @@ func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	attempt.identify(user)
 
 	// Check if account is locked
 	if s.lockoutSvc.IsAccountLocked(user) {
-		return nil, fmt.Errorf("account is locked")
+		return nil, ErrAccountLocked
+	}
+
+	// Re-check the tenant so suspended or removed customers lose access on refresh
+	tenant, err := s.tenantSvc.ResolveTenant(ctx, user, claims.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A refresh token outlives the login session; once the session has idled out
+	// the login is over, so its remaining refresh tokens are revoked
+	if err := s.sessionSvc.RefreshSession(ctx, claims.FamilyID); err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			return nil, err
+		}
+		if err := s.refreshSvc.RevokeFamily(ctx, claims.FamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return nil, ErrSessionExpired
 	}
 
 	// Generate new tokens
-	accessToken, err := s.jwtSvc.GenerateAccessToken(user, claims.CustomerID)
+	accessToken, err := s.jwtSvc.GenerateAccessToken(user, tenant, claims.FamilyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	newRefreshToken, err := s.jwtSvc.GenerateRefreshToken(user)
+	newRefreshToken, err := s.refreshSvc.Issue(ctx, user, customerIDOf(tenant), claims.FamilyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -168,9 +548,233 @@ func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*
 		AccessToken:  accessToken,
 		RefreshToken: newRefreshToken,
 		User:         user,
+		CustomerID:   customerIDOf(tenant),
 	}, nil
 }
 
+// SwitchTenant mints a new access token for the same login scoped to another customer
+// the user is a member of. If the login's refresh token is presented it is rotated
+// into one scoped to the new customer, so later refreshes stay in that tenant.
+func (s *AuthService) SwitchTenant(ctx context.Context, claims *TokenClaims, customerID int64, refreshToken string) (*LoginResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.Role == domain.RoleAdministrator {
+		return nil, errors.New("administrators are not scoped to a customer")
+	}
+
+	// A customer that enforces single sign-on can only be switched to by a login
+	// through its identity provider, which the session remembers
+	var session *SessionData
+	var ssoCustomerID *int64
+	if claims.SessionID != "" {
+		session, err = s.sessionSvc.GetSession(ctx, claims.SessionID)
+		if err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				return nil, ErrSessionExpired
+			}
+			return nil, err
+		}
+		ssoCustomerID = session.SSOCustomerID
+	}
+
+	tenant, err := s.tenantSvc.ResolveLoginTenant(ctx, user, &customerID, ssoCustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the session's customer in step with its tokens
+	if session != nil {
+		session.CustomerID = customerIDOf(tenant)
+		if err := s.sessionSvc.UpdateSession(ctx, claims.SessionID, session); err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				return nil, ErrSessionExpired
+			}
+			return nil, err
+		}
+	}
+
+	accessToken, err := s.jwtSvc.GenerateAccessToken(user, tenant, claims.FamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	resp := &LoginResponse{
+		AccessToken: accessToken,
+		User:        user,
+		CustomerID:  customerIDOf(tenant),
+	}
+
+	if refreshToken != "" {
+		// Only the refresh token of this login may be rotated here
+		refreshClaims, err := s.jwtSvc.ValidateRefreshToken(refreshToken)
+		if err != nil || refreshClaims.UserID != user.ID || refreshClaims.FamilyID != claims.FamilyID {
+			return nil, fmt.Errorf("invalid refresh token: %w", ErrInvalidToken)
+		}
+
+		if _, err := s.refreshSvc.Rotate(ctx, refreshToken); err != nil {
+			if errors.Is(err, ErrRefreshTokenReused) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("invalid refresh token: %w", err)
+		}
+
+		resp.RefreshToken, err = s.refreshSvc.Issue(ctx, user, customerIDOf(tenant), claims.FamilyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		}
+	}
+
+	event := NewAuditEvent(ctx, AuditEventTenantSwitched, user.ID, user.Email, "")
+	event.CustomerID = customerID
+	s.recordEvent(ctx, event)
+
+	return resp, nil
+}
+
+// Logout revokes the login the access token belongs to: its refresh token family,
+// the access token itself and the login session. A refresh token presented alongside
+// is revoked too, even if it belongs to another of the user's logins.
+func (s *AuthService) Logout(ctx context.Context, claims *TokenClaims, refreshToken string) error {
+	if refreshToken != "" {
+		refreshClaims, err := s.jwtSvc.ValidateRefreshToken(refreshToken)
+		if err == nil && refreshClaims.UserID == claims.UserID && refreshClaims.FamilyID != claims.FamilyID {
+			if err := s.refreshSvc.RevokeFamily(ctx, refreshClaims.FamilyID); err != nil {
+				return fmt.Errorf("failed to revoke refresh token: %w", err)
+			}
+			if err := s.sessionSvc.DeleteSession(ctx, refreshClaims.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if claims.FamilyID != "" {
+		if err := s.refreshSvc.RevokeFamily(ctx, claims.FamilyID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		if err := s.sessionSvc.DeleteSession(ctx, claims.FamilyID); err != nil {
+			return err
+		}
+	}
+
+	if claims.ExpiresAt != nil {
+		if err := s.sessionSvc.DenylistToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	s.recordEvent(ctx, s.sessionEvent(ctx, AuditEventLogout, claims, claims.UserID, ""))
+	return nil
+}
+
+// LogoutAll revokes every session, refresh token family and access token of the token's user
+func (s *AuthService) LogoutAll(ctx context.Context, claims *TokenClaims) error {
+	if err := s.RevokeUserSessions(ctx, claims.UserID); err != nil {
+		return err
+	}
+
+	// The revocation marker has second precision, so also denylist the presenting token
+	if claims.ExpiresAt != nil {
+		if err := s.sessionSvc.DenylistToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	s.recordEvent(ctx, s.sessionEvent(ctx, AuditEventLogout, claims, claims.UserID, "all sessions"))
+	return nil
+}
+
+// ListSessions returns the active sessions of a user, most recently used first.
+// Users may list their own sessions and administrators those of anyone.
+func (s *AuthService) ListSessions(ctx context.Context, actor *TokenClaims, userID int64) ([]*UserSession, error) {
+	if actor.UserID != userID && actor.Role != domain.RoleAdministrator {
+		return nil, ErrForbidden
+	}
+
+	return s.sessionSvc.ListUserSessions(ctx, userID)
+}
+
+// RevokeSession ends a single login: its session and refresh token family. Users
+// may revoke their own sessions and administrators those of anyone.
+func (s *AuthService) RevokeSession(ctx context.Context, actor *TokenClaims, sessionID string) error {
+	session, err := s.sessionSvc.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.UserID != actor.UserID && actor.Role != domain.RoleAdministrator {
+		return ErrForbidden
+	}
+
+	if err := s.refreshSvc.RevokeFamily(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := s.sessionSvc.DeleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, s.sessionEvent(ctx, AuditEventSessionRevoked, actor, session.UserID, session.Device))
+	return nil
+}
+
+// RevokeUserSessions revokes every session, refresh token family and access token of a user
+func (s *AuthService) RevokeUserSessions(ctx context.Context, userID int64) error {
+	if err := s.refreshSvc.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := s.sessionSvc.DeleteUserSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.sessionSvc.RevokeUserTokens(ctx, userID, s.jwtSvc.GetAccessTokenDuration())
+}
+
+// RevokeOtherSessions revokes every session, refresh token family and access token
+// of the token's user except the token's own login. Since access tokens issued before
+// now are rejected, it returns a new access token for the login that was kept.
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, claims *TokenClaims) (string, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	tenant, err := s.tenantSvc.ResolveTenant(ctx, user, claims.CustomerID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.refreshSvc.RevokeOtherFamilies(ctx, user.ID, claims.FamilyID); err != nil {
+		return "", fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := s.sessionSvc.DeleteOtherUserSessions(ctx, user.ID, claims.FamilyID); err != nil {
+		return "", err
+	}
+
+	if err := s.sessionSvc.RevokeUserTokens(ctx, user.ID, s.jwtSvc.GetAccessTokenDuration()); err != nil {
+		return "", err
+	}
+
+	// The revocation marker has second precision, so also denylist the presenting token
+	if claims.ExpiresAt != nil {
+		if err := s.sessionSvc.DenylistToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return "", err
+		}
+	}
+
+	accessToken, err := s.jwtSvc.GenerateAccessToken(user, tenant, claims.FamilyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	s.recordEvent(ctx, s.sessionEvent(ctx, AuditEventSessionRevoked, claims, user.ID, "all other sessions"))
+	return accessToken, nil
+}
+
 // SetupMFA sets up MFA for a user
 func (s *AuthService) SetupMFA(ctx context.Context, userID int64) (*MFASetupResult, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
@@ -192,42 +796,150 @@ func (s *AuthService) SetupMFA(ctx context.Context, userID int64) (*MFASetupResu
 	return result, nil
 }
 
-// VerifyAndEnableMFA verifies MFA setup and enables it
-func (s *AuthService) VerifyAndEnableMFA(ctx context.Context, userID int64, code string) error {
+// VerifyAndEnableMFA verifies MFA setup and enables it. It returns a fresh set of
+// recovery codes, which are shown to the user only this once.
+func (s *AuthService) VerifyAndEnableMFA(ctx context.Context, userID int64, code string) ([]string, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	if user.MFASecret == "" {
-		return errors.New("MFA not set up")
+		return nil, errors.New("MFA not set up")
 	}
 
 	// Validate the code
-	valid, err := s.mfaSvc.ValidateCodeWithWindow(user.MFASecret, code, 1)
+	valid, err := s.mfaSvc.VerifyCode(ctx, user.ID, user.MFASecret, code)
 	if err != nil {
-		return fmt.Errorf("failed to validate MFA code: %w", err)
+		return nil, fmt.Errorf("failed to validate MFA code: %w", err)
 	}
 	if !valid {
-		return errors.New("invalid MFA code")
+		return nil, ErrInvalidMFACode
+	}
+
+	// Store the recovery codes first, so MFA is never enabled without them
+	codes, err := s.recoverySvc.Generate(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Enable MFA
 	if err := s.userRepo.UpdateMFASecret(ctx, userID, user.MFASecret, true); err != nil {
-		return fmt.Errorf("failed to enable MFA: %w", err)
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
 	}
 
-	return nil
+	s.recordEvent(ctx, NewAuditEvent(ctx, AuditEventMFAEnabled, user.ID, user.Email, ""))
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new set.
+// A current TOTP code is required so a stolen access token alone cannot do this.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	valid, err := s.mfaSvc.VerifyCode(ctx, user.ID, user.MFASecret, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate MFA code: %w", err)
+	}
+	if !valid {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := s.recoverySvc.Generate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(ctx, NewAuditEvent(ctx, AuditEventRecoveryCodesRegenerated, user.ID, user.Email, ""))
+	return codes, nil
+}
+
+// RemainingRecoveryCodes returns the number of unused recovery codes of a user
+func (s *AuthService) RemainingRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	return s.recoverySvc.Remaining(ctx, userID)
 }
 
 // DisableMFA disables MFA for a user
 func (s *AuthService) DisableMFA(ctx context.Context, userID int64) error {
+	if err := s.disableMFA(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, NewAuditEvent(ctx, AuditEventMFADisabled, userID, "", ""))
+	return nil
+}
+
+// disableMFA removes the TOTP secret and recovery codes of a user
+func (s *AuthService) disableMFA(ctx context.Context, userID int64) error {
 	if err := s.userRepo.UpdateMFASecret(ctx, userID, "", false); err != nil {
 		return fmt.Errorf("failed to disable MFA: %w", err)
 	}
+	if err := s.recoverySvc.Delete(ctx, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResetMFA removes every second factor of a user: TOTP, recovery codes and
+// WebAuthn credentials. The user can log in with their password alone afterwards.
+// The administrator who asked for it records the event.
+func (s *AuthService) ResetMFA(ctx context.Context, userID int64) error {
+	if err := s.disableMFA(ctx, userID); err != nil {
+		return err
+	}
+
+	credentials, err := s.webauthnSvc.ListCredentials(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, credential := range credentials {
+		if err := s.webauthnSvc.DeleteCredential(ctx, userID, credential.ID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// requiresMFA checks whether a password login needs a second factor, which is
+// the case once TOTP is enabled or a WebAuthn credential is registered
+func (s *AuthService) requiresMFA(ctx context.Context, user *domain.User) (bool, error) {
+	if user.MFAEnabled {
+		return true, nil
+	}
+	return s.webauthnSvc.HasCredentials(ctx, user.ID)
+}
+
+// verifySecondFactor checks a WebAuthn assertion, a TOTP code or a recovery code, in that order
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *domain.User, mfaCode, recoveryCode string, assertion []byte) (bool, error) {
+	switch {
+	case len(assertion) > 0:
+		if _, err := s.webauthnSvc.FinishLogin(ctx, user, assertion); err != nil {
+			if errors.Is(err, ErrWebAuthnVerificationFailed) || errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	case mfaCode != "":
+		if !user.MFAEnabled {
+			return false, nil
+		}
+		return s.mfaSvc.VerifyCode(ctx, user.ID, user.MFASecret, mfaCode)
+	case recoveryCode != "":
+		return s.recoverySvc.Redeem(ctx, user.ID, recoveryCode)
+	default:
+		return false, nil
+	}
+}
+
 // GetCurrentUser retrieves the current user information
 func (s *AuthService) GetCurrentUser(ctx context.Context, userID int64) (*domain.User, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
@@ -236,3 +948,76 @@ func (s *AuthService) GetCurrentUser(ctx context.Context, userID int64) (*domain
 	}
 	return user, nil
 }
+
+// recordAttempt records the outcome of a login, MFA challenge or token refresh
+func (s *AuthService) recordAttempt(ctx context.Context, eventType AuditEventType, attempt *loginAttempt, resp *LoginResponse, err error) {
+	event := NewAuditEvent(ctx, eventType, attempt.userID, attempt.email, "")
+	switch {
+	case err != nil:
+		event.Outcome = domain.AuthEventFailure
+		event.Reason = FailureReason(err)
+	case resp.RequiresMFA:
+		event.Reason = "second factor required"
+	case resp.CustomerID != nil:
+		event.CustomerID = *resp.CustomerID
+	}
+
+	s.recordEvent(ctx, event)
+}
+
+// sessionEvent creates an event for a change to the sessions of a user made with
+// the given token, in the token's tenant
+func (s *AuthService) sessionEvent(ctx context.Context, eventType AuditEventType, claims *TokenClaims, userID int64, reason string) *AuditEvent {
+	event := NewAuditEvent(ctx, eventType, userID, "", reason)
+	if claims.UserID == userID {
+		event.Email = claims.Email
+	} else {
+		event.ActorID = claims.UserID
+	}
+	if claims.CustomerID != nil {
+		event.CustomerID = *claims.CustomerID
+	}
+	return event
+}
+
+// recordEvent records an audit event, logging rather than returning a failure
+func (s *AuthService) recordEvent(ctx context.Context, event *AuditEvent) {
+	if err := s.events.Record(ctx, event); err != nil {
+		log.Printf("failed to record %s event for user %d: %v", event.Type, event.UserID, err)
+	}
+}
+
+// failureReasons are the errors that explain a failed attempt to whoever reads the
+// audit log. Other errors are internal and recorded as such.
+var failureReasons = []error{
+	domain.ErrInvalidCredentials,
+	ErrAccountLocked,
+	ErrLoginThrottled,
+	ErrSSORequired,
+	ErrSSONotConfigured,
+	ErrInvalidSSOResponse,
+	ErrInvalidSSOCode,
+	ErrSSOAccountConflict,
+	ErrSSODomainNotAllowed,
+	ErrInvalidMFACode,
+	ErrMFANotEnabled,
+	ErrRefreshTokenReused,
+	ErrSessionExpired,
+	ErrExpiredToken,
+	ErrRevokedToken,
+	ErrInvalidToken,
+	ErrNoActiveCustomer,
+	ErrCustomerSuspended,
+	ErrSessionStoreUnavailable,
+}
+
+// FailureReason describes why an authentication attempt failed, for the audit log.
+// Internal errors are not described, as customer owners can read the log.
+func FailureReason(err error) string {
+	for _, reason := range failureReasons {
+		if errors.Is(err, reason) {
+			return reason.Error()
+		}
+	}
+	return "internal error"
+}
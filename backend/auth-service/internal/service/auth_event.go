@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// DefaultAuthEventPageSize is the number of auth events listed per page
+	DefaultAuthEventPageSize = 50
+
+	// MaxAuthEventPageSize is the largest page of auth events a client may ask for
+	MaxAuthEventPageSize = 200
+)
+
+// AuthEventService queries the authentication audit log written by RepositoryEventRecorder
+type AuthEventService struct {
+	eventRepo      domain.AuthEventRepository
+	membershipRepo domain.MembershipRepository
+}
+
+// AuthEventConfig holds auth event service configuration
+type AuthEventConfig struct {
+	EventRepo      domain.AuthEventRepository
+	MembershipRepo domain.MembershipRepository
+}
+
+// NewAuthEventService creates a new auth event service
+func NewAuthEventService(config AuthEventConfig) *AuthEventService {
+	return &AuthEventService{
+		eventRepo:      config.EventRepo,
+		membershipRepo: config.MembershipRepo,
+	}
+}
+
+// AuthEventPage is one page of an auth event listing
+type AuthEventPage struct {
+	Events []*domain.AuthEvent
+
+	// NextCursor fetches the following, older page; it is empty on the last page
+	NextCursor string
+}
+
+// List returns a page of the events matching the filter, newest first, starting
+// after the cursor of the previous page. Only administrators may list events
+// across customers.
+func (s *AuthEventService) List(ctx context.Context, actor *TokenClaims, filter domain.AuthEventFilter, cursor string, limit int) (*AuthEventPage, error) {
+	if actor.Role != domain.RoleAdministrator {
+		return nil, ErrForbidden
+	}
+
+	return s.list(ctx, filter, cursor, limit)
+}
+
+// ListForCustomer returns a page of the events of a customer's tenant matching
+// the filter, newest first: events in the tenant and events of its members outside
+// any tenant, such as failed logins. Only owners and administrators may list them.
+func (s *AuthEventService) ListForCustomer(ctx context.Context, actor *TokenClaims, customerID int64, filter domain.AuthEventFilter, cursor string, limit int) (*AuthEventPage, error) {
+	if err := authorizeMember(ctx, s.membershipRepo, actor, customerID, true); err != nil {
+		return nil, err
+	}
+
+	filter.CustomerID = &customerID
+	return s.list(ctx, filter, cursor, limit)
+}
+
+func (s *AuthEventService) list(ctx context.Context, filter domain.AuthEventFilter, cursor string, limit int) (*AuthEventPage, error) {
+	beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultAuthEventPageSize
+	}
+	limit = min(limit, MaxAuthEventPageSize)
+
+	// Fetch one extra event to learn whether another page follows
+	events, err := s.eventRepo.List(ctx, filter, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+
+	page := &AuthEventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = encodeCursor(page.Events[limit-1].ID)
+	}
+
+	return page, nil
+}
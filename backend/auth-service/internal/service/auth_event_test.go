@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+func TestLoginAttemptsAreRecorded(t *testing.T) {
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IPAddress: "203.0.113.9", UserAgent: "curl/8.0"})
+	f := newFixture(t)
+	f.addJane(t, domain.RoleAdministrator)
+
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "nobody@example.com", Password: "guess"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("unknown email: got %v", err)
+	}
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "guess"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v", err)
+	}
+	login, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	refreshed, err := f.auth.RefreshTokens(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if _, err := f.auth.RefreshTokens(ctx, login.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused refresh token: got %v", err)
+	}
+
+	claims, err := f.jwt.ValidateAccessToken(ctx, refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if err := f.auth.Logout(ctx, claims, ""); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	want := []struct {
+		eventType AuditEventType
+		outcome   domain.AuthEventOutcome
+		userID    int64
+		email     string
+		reason    string
+	}{
+		{AuditEventLogin, domain.AuthEventFailure, 0, "nobody@example.com", "invalid credentials"},
+		{AuditEventLogin, domain.AuthEventFailure, 1, "jane@example.com", "invalid credentials"},
+		{AuditEventLogin, domain.AuthEventSuccess, 1, "jane@example.com", ""},
+		{AuditEventTokenRefresh, domain.AuthEventSuccess, 1, "jane@example.com", ""},
+		{AuditEventTokenRefresh, domain.AuthEventFailure, 1, "jane@example.com", ErrRefreshTokenReused.Error()},
+		{AuditEventLogout, domain.AuthEventSuccess, 1, "jane@example.com", ""},
+	}
+
+	events := f.events.Events()
+	if len(events) != len(want) {
+		t.Fatalf("recorded %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Type != w.eventType || e.Outcome != w.outcome || e.UserID != w.userID || e.Email != w.email || e.Reason != w.reason {
+			t.Errorf("event %d = %+v, want %+v", i, e, w)
+		}
+		if e.IPAddress != "203.0.113.9" || e.UserAgent != "curl/8.0" {
+			t.Errorf("event %d lacks the client details: %+v", i, e)
+		}
+	}
+}
+
+func TestRepositoryEventRecorder(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryAuthEvents{}
+	recorder := NewRepositoryEventRecorder(repo)
+
+	event := NewAuditEvent(ctx, AuditEventAccountUnlocked, 5, "jane@example.com", "unlocked by administrator")
+	event.ActorID = 100
+	if err := recorder.Record(ctx, event); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if len(repo.events) != 1 {
+		t.Fatalf("stored %d events, want 1", len(repo.events))
+	}
+	stored := repo.events[0]
+	if stored.Type != "account_unlocked" || stored.Outcome != domain.AuthEventSuccess || *stored.UserID != 5 || *stored.ActorID != 100 || stored.CustomerID != nil {
+		t.Fatalf("unexpected event: %+v", stored)
+	}
+}
+
+func TestListAuthEvents(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	repo := &memoryAuthEvents{memberships: f.memberships}
+	svc := NewAuthEventService(AuthEventConfig{EventRepo: repo, MembershipRepo: f.memberships})
+
+	customerID, otherCustomerID := int64(testCustomerID), int64(8)
+	developerID, outsiderID := testDeveloper.UserID, int64(300)
+	start := time.Now().Add(-time.Hour)
+	for i, e := range []*domain.AuthEvent{
+		{Type: "login", Outcome: domain.AuthEventFailure, UserID: &developerID},
+		{Type: "login", Outcome: domain.AuthEventSuccess, UserID: &developerID, CustomerID: &customerID},
+		{Type: "login", Outcome: domain.AuthEventSuccess, UserID: &outsiderID, CustomerID: &otherCustomerID},
+		{Type: "login", Outcome: domain.AuthEventFailure, UserID: &outsiderID},
+		{Type: "token_refresh", Outcome: domain.AuthEventSuccess, UserID: &developerID, CustomerID: &customerID},
+	} {
+		e.OccurredAt = start.Add(time.Duration(i) * time.Minute)
+		if err := repo.Create(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Administrators page through everything, newest first
+	var ids []int64
+	cursor := ""
+	for {
+		page, err := svc.List(ctx, testAdmin, domain.AuthEventFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, e := range page.Events {
+			ids = append(ids, e.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(ids) != 5 || ids[0] != 5 || ids[4] != 1 {
+		t.Fatalf("admin listing = %v, want 5..1", ids)
+	}
+
+	since := start.Add(90 * time.Second)
+	page, err := svc.List(ctx, testAdmin, domain.AuthEventFilter{Types: []string{"login"}, Since: &since}, "", 0)
+	if err != nil || len(page.Events) != 2 || page.Events[0].ID != 4 || page.Events[1].ID != 3 {
+		t.Fatalf("filtered admin listing = %+v, %v", page, err)
+	}
+
+	if _, err := svc.List(ctx, testOwner, domain.AuthEventFilter{}, "", 0); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("owner listing all events: got %v, want ErrForbidden", err)
+	}
+	if _, err := svc.List(ctx, testAdmin, domain.AuthEventFilter{}, "not a cursor", 0); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("bad cursor: got %v, want ErrInvalidCursor", err)
+	}
+
+	// Owners see their tenant and their members' events outside any tenant
+	page, err = svc.ListForCustomer(ctx, testOwner, testCustomerID, domain.AuthEventFilter{}, "", 0)
+	if err != nil {
+		t.Fatalf("ListForCustomer: %v", err)
+	}
+	ids = nil
+	for _, e := range page.Events {
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 3 || ids[0] != 5 || ids[1] != 2 || ids[2] != 1 {
+		t.Fatalf("tenant listing = %v, want [5 2 1]", ids)
+	}
+
+	// A filter for another customer's user cannot widen the view
+	page, err = svc.ListForCustomer(ctx, testOwner, testCustomerID, domain.AuthEventFilter{UserID: &outsiderID}, "", 0)
+	if err != nil || len(page.Events) != 0 {
+		t.Fatalf("tenant listing of outsider = %+v, %v", page, err)
+	}
+
+	if _, err := svc.ListForCustomer(ctx, testDeveloper, testCustomerID, domain.AuthEventFilter{}, "", 0); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("developer listing tenant events: got %v, want ErrForbidden", err)
+	}
+}
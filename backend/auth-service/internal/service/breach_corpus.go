@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// breachHashPrefixLength is the number of SHA-1 hex digits a breach corpus is
+	// queried with, so the corpus never learns the full hash of a password
+	breachHashPrefixLength = 5
+
+	// breachHashLength is the number of hex digits of a SHA-1 hash
+	breachHashLength = 40
+)
+
+// ErrInvalidBreachCorpus is returned when a breach corpus file cannot be parsed
+var ErrInvalidBreachCorpus = errors.New("invalid breach corpus")
+
+// BreachCorpus looks up breached password hashes by k-anonymity: it is asked for
+// every breached SHA-1 hash sharing a 5 hex digit prefix with a password's hash,
+// like the Have I Been Pwned range API.
+type BreachCorpus interface {
+	// Range returns the breach count of every known hash starting with the prefix,
+	// keyed by the remaining 35 uppercase hex digits
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// BreachCount returns how often a password appears in a breach corpus
+func BreachCount(ctx context.Context, corpus BreachCorpus, password string) (int, error) {
+	hash := breachHash(password)
+
+	suffixes, err := corpus.Range(ctx, hash[:breachHashPrefixLength])
+	if err != nil {
+		return 0, fmt.Errorf("failed to query breach corpus: %w", err)
+	}
+
+	return suffixes[hash[breachHashPrefixLength:]], nil
+}
+
+// OpenBreachCorpus opens a local breach corpus, so breached passwords can be
+// rejected without network access. The path is either a file of "HASH:COUNT"
+// lines, which is loaded into memory, or a directory of range files named after
+// their prefix ("5BAA6.txt") holding "SUFFIX:COUNT" lines, as downloaded from Have
+// I Been Pwned, which are read on demand.
+func OpenBreachCorpus(path string) (BreachCorpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach corpus: %w", err)
+	}
+
+	if info.IsDir() {
+		return &directoryBreachCorpus{dir: path}, nil
+	}
+
+	return loadBreachCorpusFile(path)
+}
+
+// MemoryBreachCorpus is a breach corpus held in memory
+type MemoryBreachCorpus struct {
+	ranges map[string]map[string]int
+}
+
+// NewMemoryBreachCorpus creates an empty in-memory breach corpus
+func NewMemoryBreachCorpus() *MemoryBreachCorpus {
+	return &MemoryBreachCorpus{
+		ranges: make(map[string]map[string]int),
+	}
+}
+
+// Add records the breach count of a SHA-1 hash in hex
+func (c *MemoryBreachCorpus) Add(hash string, count int) error {
+	hash = strings.ToUpper(hash)
+	if !isHex(hash) || len(hash) != breachHashLength {
+		return fmt.Errorf("%w: malformed hash %q", ErrInvalidBreachCorpus, hash)
+	}
+
+	c.add(hash, count)
+	return nil
+}
+
+// AddPassword records a breached password
+func (c *MemoryBreachCorpus) AddPassword(password string, count int) {
+	c.add(breachHash(password), count)
+}
+
+func (c *MemoryBreachCorpus) add(hash string, count int) {
+	prefix, suffix := hash[:breachHashPrefixLength], hash[breachHashPrefixLength:]
+	if c.ranges[prefix] == nil {
+		c.ranges[prefix] = make(map[string]int)
+	}
+	c.ranges[prefix][suffix] += count
+}
+
+// Range returns the breach counts of the hashes starting with the prefix
+func (c *MemoryBreachCorpus) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	return c.ranges[strings.ToUpper(prefix)], nil
+}
+
+func loadBreachCorpusFile(path string) (*MemoryBreachCorpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach corpus: %w", err)
+	}
+	defer file.Close()
+
+	corpus := NewMemoryBreachCorpus()
+	err = scanBreachLines(file.Name(), bufio.NewScanner(file), func(hash string, count int) error {
+		return corpus.Add(hash, count)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return corpus, nil
+}
+
+// directoryBreachCorpus reads range files from a directory on demand
+type directoryBreachCorpus struct {
+	dir string
+}
+
+// Range reads the range file of the prefix. A missing file means no hash with
+// the prefix is known.
+func (c *directoryBreachCorpus) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if !isHex(prefix) || len(prefix) != breachHashPrefixLength {
+		return nil, fmt.Errorf("%w: malformed prefix %q", ErrInvalidBreachCorpus, prefix)
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open breach range: %w", err)
+	}
+	defer file.Close()
+
+	suffixes := make(map[string]int)
+	err = scanBreachLines(file.Name(), bufio.NewScanner(file), func(suffix string, count int) error {
+		suffix = strings.ToUpper(suffix)
+		if !isHex(suffix) || len(suffix) != breachHashLength-breachHashPrefixLength {
+			return fmt.Errorf("%w: malformed hash suffix %q", ErrInvalidBreachCorpus, suffix)
+		}
+		suffixes[suffix] += count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return suffixes, nil
+}
+
+// scanBreachLines parses "HASH:COUNT" lines. The count is optional and defaults
+// to one; blank lines and lines starting with # are skipped.
+func scanBreachLines(name string, scanner *bufio.Scanner, add func(hash string, count int) error) error {
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, countText, hasCount := strings.Cut(text, ":")
+		count := 1
+		if hasCount {
+			var err error
+			count, err = strconv.Atoi(countText)
+			if err != nil || count < 0 {
+				return fmt.Errorf("%s:%d: %w: malformed count", name, line, ErrInvalidBreachCorpus)
+			}
+		}
+
+		if err := add(hash, count); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breach corpus: %w", err)
+	}
+
+	return nil
+}
+
+// breachHash returns the uppercase hex SHA-1 hash of a password
+func breachHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789ABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
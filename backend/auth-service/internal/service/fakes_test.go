@@ -0,0 +1,722 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// The fakes below keep repositories and stores in memory for the service tests.
+// They mirror the behavior the tests rely on, such as the conditional updates of
+// the PostgreSQL repositories, rather than every detail of them.
+
+// memoryUsers is an in-memory UserRepository. Methods the tests do not need are
+// left to the embedded interface and panic when called.
+type memoryUsers struct {
+	domain.UserRepository
+	users   []*domain.User
+	history map[int64][]string
+}
+
+func (r *memoryUsers) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *memoryUsers) GetByUUID(ctx context.Context, uuid string) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.UUID == uuid {
+			return u, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *domain.User) error {
+	for _, u := range r.users {
+		if u.Email == user.Email {
+			return domain.ErrUserAlreadyExists
+		}
+	}
+	if user.ID == 0 {
+		user.ID = int64(len(r.users) + 1)
+		for _, err := r.GetByID(ctx, user.ID); err == nil; _, err = r.GetByID(ctx, user.ID) {
+			user.ID++
+		}
+	}
+	if user.UUID == "" {
+		user.UUID = "user-" + user.Email
+	}
+	r.users = append(r.users, user)
+	return nil
+}
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *memoryUsers) UpdatePassword(ctx context.Context, id int64, passwordHash string, historySize int) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if r.history == nil {
+		r.history = make(map[int64][]string)
+	}
+	history := r.history[id]
+	if user.PasswordHash != "" {
+		history = append([]string{user.PasswordHash}, history...)
+	}
+	if len(history) > historySize {
+		history = history[:historySize]
+	}
+	r.history[id] = history
+	user.PasswordHash = passwordHash
+	return nil
+}
+
+func (r *memoryUsers) ListPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error) {
+	history := r.history[id]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+func (r *memoryUsers) MarkEmailVerified(ctx context.Context, id int64) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return nil
+}
+
+func (r *memoryUsers) UpdateFailedAttempts(ctx context.Context, id int64, attempts int, lockedUntil *time.Time) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.FailedLoginAttempts = attempts
+	user.LockedUntil = lockedUntil
+	return nil
+}
+
+func (r *memoryUsers) IncrementFailedAttempts(ctx context.Context, id int64, maxAttempts int, lockoutDuration time.Duration) (*domain.FailedAttempt, error) {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	locked := user.IsLocked()
+	if user.LockedUntil != nil && !locked {
+		user.ResetFailedAttempts()
+	}
+	user.FailedLoginAttempts++
+	if !locked && user.FailedLoginAttempts >= maxAttempts {
+		user.LockAccount(lockoutDuration)
+	}
+	return &domain.FailedAttempt{
+		Attempts:    user.FailedLoginAttempts,
+		LockedUntil: user.LockedUntil,
+		Locked:      !locked && user.FailedLoginAttempts >= maxAttempts,
+	}, nil
+}
+
+func (r *memoryUsers) LockAccount(ctx context.Context, id int64, lockoutDuration time.Duration) (*time.Time, error) {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	lockedUntil := time.Now().Add(lockoutDuration)
+	if user.LockedUntil == nil || user.LockedUntil.Before(lockedUntil) {
+		user.LockedUntil = &lockedUntil
+	}
+	return user.LockedUntil, nil
+}
+
+func (r *memoryUsers) List(ctx context.Context, filter domain.UserFilter, afterID int64, limit int) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, u := range r.users {
+		if u.ID > afterID && matchesUserFilter(u, filter) && len(users) < limit {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (r *memoryUsers) Count(ctx context.Context, filter domain.UserFilter) (int, error) {
+	var count int
+	for _, u := range r.users {
+		if matchesUserFilter(u, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, id int64) error {
+	for i, u := range r.users {
+		if u.ID == id {
+			r.users = append(r.users[:i], r.users[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (r *memoryUsers) UpdateMFASecret(ctx context.Context, id int64, secret string, enabled bool) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.MFASecret = secret
+	user.MFAEnabled = enabled
+	return nil
+}
+
+func (r *memoryUsers) UpdatePasswordHash(ctx context.Context, id int64, oldHash, newHash string) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == oldHash {
+		user.PasswordHash = newHash
+	}
+	return nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, user *domain.User) error {
+	for i, u := range r.users {
+		if u.ID == user.ID {
+			updated := *user
+			r.users[i] = &updated
+			return nil
+		}
+	}
+	return domain.ErrUserNotFound
+}
+
+func (r *memoryUsers) UpdateLastLogin(ctx context.Context, id int64) error {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.LastLoginAt = &now
+	return nil
+}
+
+func matchesUserFilter(u *domain.User, filter domain.UserFilter) bool {
+	return (filter.Role == nil || u.Role == *filter.Role) &&
+		(filter.Locked == nil || u.IsLocked() == *filter.Locked) &&
+		(filter.MFAEnabled == nil || u.MFAEnabled == *filter.MFAEnabled)
+}
+
+type memoryMemberships struct {
+	domain.MembershipRepository
+	memberships []*domain.CustomerMembership
+}
+
+func (r *memoryMemberships) ListByUser(ctx context.Context, userID int64) ([]*domain.CustomerMembership, error) {
+	var memberships []*domain.CustomerMembership
+	for _, m := range r.memberships {
+		if m.UserID == userID {
+			memberships = append(memberships, m)
+		}
+	}
+	return memberships, nil
+}
+
+func (r *memoryMemberships) Create(ctx context.Context, membership *domain.CustomerMembership) error {
+	if _, err := r.Get(ctx, membership.CustomerID, membership.UserID); err == nil {
+		return domain.ErrMembershipAlreadyExists
+	}
+	membership.ID = int64(len(r.memberships) + 1)
+	r.memberships = append(r.memberships, membership)
+	return nil
+}
+
+func (r *memoryMemberships) Get(ctx context.Context, customerID, userID int64) (*domain.CustomerMembership, error) {
+	for _, m := range r.memberships {
+		if m.CustomerID == customerID && m.UserID == userID {
+			return m, nil
+		}
+	}
+	return nil, domain.ErrMembershipNotFound
+}
+
+type memoryCustomers struct {
+	customers []*domain.Customer
+}
+
+func (r *memoryCustomers) GetByUUID(ctx context.Context, uuid string) (*domain.Customer, error) {
+	for _, c := range r.customers {
+		if c.UUID == uuid {
+			return c, nil
+		}
+	}
+	return nil, domain.ErrCustomerNotFound
+}
+
+func (r *memoryCustomers) GetByID(ctx context.Context, id int64) (*domain.Customer, error) {
+	for _, c := range r.customers {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, domain.ErrCustomerNotFound
+}
+
+type memoryAccountTokens struct {
+	tokens []*domain.AccountToken
+}
+
+func (r *memoryAccountTokens) Create(ctx context.Context, token *domain.AccountToken) error {
+	token.ID = int64(len(r.tokens) + 1)
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryAccountTokens) Find(ctx context.Context, purpose domain.AccountTokenPurpose, tokenHash string) (*domain.AccountToken, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash && t.Purpose == purpose && !t.IsUsed() && !t.IsExpired() {
+			return t, nil
+		}
+	}
+	return nil, domain.ErrAccountTokenNotFound
+}
+
+func (r *memoryAccountTokens) Consume(ctx context.Context, purpose domain.AccountTokenPurpose, tokenHash string) (*domain.AccountToken, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash && t.Purpose == purpose && !t.IsUsed() && !t.IsExpired() {
+			now := time.Now()
+			t.UsedAt = &now
+			return t, nil
+		}
+	}
+	return nil, domain.ErrAccountTokenNotFound
+}
+
+func (r *memoryAccountTokens) DeleteForUser(ctx context.Context, userID int64, purpose domain.AccountTokenPurpose) error {
+	kept := r.tokens[:0]
+	for _, t := range r.tokens {
+		if t.UserID != userID || t.Purpose != purpose {
+			kept = append(kept, t)
+		}
+	}
+	r.tokens = kept
+	return nil
+}
+
+type memoryRefreshTokens struct {
+	domain.RefreshTokenRepository
+	tokens []*domain.RefreshToken
+}
+
+func (r *memoryRefreshTokens) Create(ctx context.Context, token *domain.RefreshToken) error {
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryRefreshTokens) Consume(ctx context.Context, jti string) (*domain.RefreshToken, error) {
+	for _, t := range r.tokens {
+		if t.JTI != jti {
+			continue
+		}
+		switch {
+		case t.IsRevoked():
+			return nil, domain.ErrRefreshTokenRevoked
+		case t.IsUsed():
+			return t, domain.ErrRefreshTokenUsed
+		}
+		now := time.Now()
+		t.UsedAt = &now
+		return t, nil
+	}
+	return nil, domain.ErrRefreshTokenNotFound
+}
+
+func (r *memoryRefreshTokens) RevokeFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	for _, t := range r.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *memoryRefreshTokens) RevokeAllForUser(ctx context.Context, userID int64) error {
+	now := time.Now()
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type memoryInvitations struct {
+	invitations []*domain.Invitation
+}
+
+func (r *memoryInvitations) Create(ctx context.Context, invitation *domain.Invitation) error {
+	for _, i := range r.invitations {
+		if i.CustomerID == invitation.CustomerID && strings.EqualFold(i.Email, invitation.Email) && i.AcceptedAt == nil && i.RevokedAt == nil {
+			return domain.ErrInvitationAlreadyExists
+		}
+	}
+	invitation.ID = int64(len(r.invitations) + 1)
+	invitation.UUID = fmt.Sprintf("invitation-%d", invitation.ID)
+	invitation.CreatedAt = time.Now()
+	r.invitations = append(r.invitations, invitation)
+	return nil
+}
+
+func (r *memoryInvitations) GetByUUID(ctx context.Context, uuid string) (*domain.Invitation, error) {
+	for _, i := range r.invitations {
+		if i.UUID == uuid {
+			return i, nil
+		}
+	}
+	return nil, domain.ErrInvitationNotFound
+}
+
+func (r *memoryInvitations) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Invitation, error) {
+	var invitations []*domain.Invitation
+	for _, i := range r.invitations {
+		if i.CustomerID == customerID {
+			invitations = append([]*domain.Invitation{i}, invitations...)
+		}
+	}
+	return invitations, nil
+}
+
+func (r *memoryInvitations) Revoke(ctx context.Context, customerID, id int64) error {
+	for _, i := range r.invitations {
+		if i.ID == id && i.CustomerID == customerID && i.AcceptedAt == nil && i.RevokedAt == nil {
+			now := time.Now()
+			i.RevokedAt = &now
+			return nil
+		}
+	}
+	return domain.ErrInvitationNotFound
+}
+
+func (r *memoryInvitations) Accept(ctx context.Context, uuid string, userID int64) error {
+	i, err := r.GetByUUID(ctx, uuid)
+	if err != nil || !i.IsPending() {
+		return domain.ErrInvitationNotFound
+	}
+	now := time.Now()
+	i.AcceptedAt = &now
+	i.AcceptedUserID = &userID
+	return nil
+}
+
+type memoryAPIKeys struct {
+	keys []*domain.APIKey
+}
+
+func (r *memoryAPIKeys) Create(ctx context.Context, key *domain.APIKey) error {
+	key.ID = int64(len(r.keys) + 1)
+	key.UUID = fmt.Sprintf("api-key-%d", key.ID)
+	key.CreatedAt = time.Now()
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *memoryAPIKeys) GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash {
+			return k, nil
+		}
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeys) GetByID(ctx context.Context, id int64) (*domain.APIKey, error) {
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeys) ListByUser(ctx context.Context, userID int64) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	for _, k := range r.keys {
+		if k.UserID != nil && *k.UserID == userID {
+			keys = append([]*domain.APIKey{k}, keys...)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryAPIKeys) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	for _, k := range r.keys {
+		if k.CustomerID != nil && *k.CustomerID == customerID {
+			keys = append([]*domain.APIKey{k}, keys...)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryAPIKeys) Revoke(ctx context.Context, id int64) error {
+	for _, k := range r.keys {
+		if k.ID == id && k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+	return domain.ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeys) UpdateLastUsed(ctx context.Context, id int64) error {
+	for _, k := range r.keys {
+		if k.ID == id {
+			now := time.Now()
+			k.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+type memorySSOIdentities struct {
+	identities []*domain.SSOIdentity
+}
+
+func (r *memorySSOIdentities) Create(ctx context.Context, identity *domain.SSOIdentity) error {
+	if _, err := r.Get(ctx, identity.CustomerID, identity.Subject); err == nil {
+		return domain.ErrSSOIdentityAlreadyExists
+	}
+	identity.ID = int64(len(r.identities) + 1)
+	identity.CreatedAt = time.Now()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *memorySSOIdentities) Get(ctx context.Context, customerID int64, subject string) (*domain.SSOIdentity, error) {
+	for _, i := range r.identities {
+		if i.CustomerID == customerID && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return nil, domain.ErrSSOIdentityNotFound
+}
+
+func (r *memorySSOIdentities) UpdateLastLogin(ctx context.Context, id int64) error {
+	for _, i := range r.identities {
+		if i.ID == id {
+			now := time.Now()
+			i.LastLoginAt = &now
+			return nil
+		}
+	}
+	return domain.ErrSSOIdentityNotFound
+}
+
+type memoryWebAuthnCredentials struct {
+	credentials []*domain.WebAuthnCredential
+}
+
+func (r *memoryWebAuthnCredentials) Create(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	credential.ID = int64(len(r.credentials) + 1)
+	credential.CreatedAt = time.Now()
+	r.credentials = append(r.credentials, credential)
+	return nil
+}
+
+func (r *memoryWebAuthnCredentials) ListByUser(ctx context.Context, userID int64) ([]*domain.WebAuthnCredential, error) {
+	var credentials []*domain.WebAuthnCredential
+	for _, c := range r.credentials {
+		if c.UserID == userID {
+			copied := *c
+			credentials = append(credentials, &copied)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *memoryWebAuthnCredentials) UpdateAfterLogin(ctx context.Context, id int64, signCount uint32, backupState bool) error {
+	for _, c := range r.credentials {
+		if c.ID == id {
+			now := time.Now()
+			c.SignCount = signCount
+			c.BackupState = backupState
+			c.LastUsedAt = &now
+			return nil
+		}
+	}
+	return domain.ErrWebAuthnCredentialNotFound
+}
+
+func (r *memoryWebAuthnCredentials) Delete(ctx context.Context, userID int64, id int64) error {
+	return errors.New("not implemented")
+}
+
+// memoryAuthEvents is an in-memory AuthEventRepository. Tenant filters look up
+// members in memberships, like the membership subquery of the PostgreSQL one.
+type memoryAuthEvents struct {
+	events      []*domain.AuthEvent
+	memberships *memoryMemberships
+}
+
+func (r *memoryAuthEvents) Create(ctx context.Context, event *domain.AuthEvent) error {
+	event.ID = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *memoryAuthEvents) List(ctx context.Context, filter domain.AuthEventFilter, beforeID int64, limit int) ([]*domain.AuthEvent, error) {
+	var events []*domain.AuthEvent
+	for i := len(r.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if e := r.events[i]; (beforeID == 0 || e.ID < beforeID) && r.matches(ctx, e, filter) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryAuthEvents) matches(ctx context.Context, e *domain.AuthEvent, filter domain.AuthEventFilter) bool {
+	if filter.UserID != nil && (e.UserID == nil || *e.UserID != *filter.UserID) {
+		return false
+	}
+	if filter.CustomerID != nil {
+		inTenant := e.CustomerID != nil && *e.CustomerID == *filter.CustomerID
+		ofMember := false
+		if e.CustomerID == nil && e.UserID != nil {
+			_, err := r.memberships.Get(ctx, *filter.CustomerID, *e.UserID)
+			ofMember = err == nil
+		}
+		if !inTenant && !ofMember {
+			return false
+		}
+	}
+	if len(filter.Types) > 0 {
+		found := false
+		for _, t := range filter.Types {
+			found = found || t == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.Since != nil && e.OccurredAt.Before(*filter.Since) {
+		return false
+	}
+	if filter.Until != nil && !e.OccurredAt.Before(*filter.Until) {
+		return false
+	}
+	return true
+}
+
+// memoryRecoveryCodes keeps recovery code hashes per user, or fails every
+// replacement with err
+type memoryRecoveryCodes struct {
+	codes map[int64]map[string]bool
+	err   error
+}
+
+func (r *memoryRecoveryCodes) ReplaceForUser(ctx context.Context, userID int64, codeHashes []string) error {
+	if r.err != nil {
+		return r.err
+	}
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	r.codes[userID] = codes
+	return nil
+}
+
+func (r *memoryRecoveryCodes) Consume(ctx context.Context, userID int64, codeHash string) error {
+	used, ok := r.codes[userID][codeHash]
+	if !ok || used {
+		return domain.ErrRecoveryCodeNotFound
+	}
+	r.codes[userID][codeHash] = true
+	return nil
+}
+
+func (r *memoryRecoveryCodes) CountUnused(ctx context.Context, userID int64) (int, error) {
+	var count int
+	for _, used := range r.codes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRecoveryCodes) DeleteForUser(ctx context.Context, userID int64) error {
+	delete(r.codes, userID)
+	return nil
+}
+
+// memoryStepRecorder mirrors the conditional update of PostgresUserRepository
+type memoryStepRecorder struct {
+	steps map[int64]int64
+}
+
+func (r *memoryStepRecorder) UpdateMFALastUsedStep(ctx context.Context, id int64, step int64) error {
+	if last, ok := r.steps[id]; ok && last >= step {
+		return domain.ErrMFACodeReplayed
+	}
+	r.steps[id] = step
+	return nil
+}
+
+type recordingRevoker struct {
+	revoked []int64
+	kept    []string
+}
+
+func (r *recordingRevoker) RevokeUserSessions(ctx context.Context, userID int64) error {
+	r.revoked = append(r.revoked, userID)
+	return nil
+}
+
+func (r *recordingRevoker) RevokeOtherSessions(ctx context.Context, claims *TokenClaims) (string, error) {
+	r.kept = append(r.kept, claims.FamilyID)
+	return "new-access-token", nil
+}
+
+type recordingMFAResetter struct {
+	reset []int64
+}
+
+func (r *recordingMFAResetter) ResetMFA(ctx context.Context, userID int64) error {
+	r.reset = append(r.reset, userID)
+	return nil
+}
+
+// recordingSSOLogins stands in for AuthService and remembers the customer of the last login
+type recordingSSOLogins struct {
+	customerID int64
+}
+
+func (r *recordingSSOLogins) CompleteSSOLogin(ctx context.Context, user *domain.User, customerID int64) (*LoginResponse, error) {
+	r.customerID = customerID
+	return &LoginResponse{User: user}, nil
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// testArgon2 keeps hashing fast in tests
+var testArgon2 = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+const testCustomerID = 7
+
+var (
+	testAdmin     = &TokenClaims{UserID: 100, Role: domain.RoleAdministrator}
+	testCustomer  = &TokenClaims{UserID: 101, Role: domain.RoleCustomer}
+	testOwner     = &TokenClaims{UserID: 200, Role: domain.RoleCustomer}
+	testDeveloper = &TokenClaims{UserID: 201, Role: domain.RoleCustomer}
+)
+
+// fixtureConfig adjusts the services built by newFixtureWith
+type fixtureConfig struct {
+	// Sessions keeps sessions and short-lived login state; in memory when nil
+	Sessions *SessionService
+
+	Lockout  LockoutConfig
+	Throttle *LoginThrottle
+}
+
+// fixture wires every service to the in-memory fakes. The Acme customer exists
+// with testOwner as its owner and testDeveloper as a developer; tests add the
+// users they need with addUser or addTenantMembers.
+type fixture struct {
+	users         *memoryUsers
+	tokens        *memoryAccountTokens
+	memberships   *memoryMemberships
+	customer      *domain.Customer
+	invitations   *memoryInvitations
+	keys          *memoryAPIKeys
+	identities    *memorySSOIdentities
+	credentials   *memoryWebAuthnCredentials
+	refreshTokens *memoryRefreshTokens
+	recoveryCodes *memoryRecoveryCodes
+	mailer        *MemoryMailer
+	revoker       *recordingRevoker
+	mfaResetter   *recordingMFAResetter
+	logins        *recordingSSOLogins
+	events        *MemoryEventRecorder
+
+	passwords  *PasswordService
+	sessions   *SessionService
+	jwt        *JWTService
+	mfa        *MFAService
+	recovery   *RecoveryCodeService
+	lockout    *LockoutService
+	account    *AccountService
+	admin      *AdminService
+	invitation *InvitationService
+	apiKeys    *APIKeyService
+	sso        *SSOService
+	webauthn   *WebAuthnService
+	auth       *AuthService
+}
+
+func newFixture(t *testing.T) *fixture {
+	return newFixtureWith(t, fixtureConfig{})
+}
+
+func newFixtureWith(t *testing.T, config fixtureConfig) *fixture {
+	t.Helper()
+
+	f := &fixture{
+		users:         &memoryUsers{},
+		tokens:        &memoryAccountTokens{},
+		invitations:   &memoryInvitations{},
+		keys:          &memoryAPIKeys{},
+		identities:    &memorySSOIdentities{},
+		credentials:   &memoryWebAuthnCredentials{},
+		refreshTokens: &memoryRefreshTokens{},
+		mailer:        NewMemoryMailer(),
+		revoker:       &recordingRevoker{},
+		mfaResetter:   &recordingMFAResetter{},
+		logins:        &recordingSSOLogins{},
+		events:        NewMemoryEventRecorder(),
+		passwords:     NewPasswordService(PasswordConfig{Argon2: testArgon2}),
+		sessions:      config.Sessions,
+		customer: &domain.Customer{
+			ID:     testCustomerID,
+			UUID:   "0b8f4c3e-8a51-4f0e-9d8e-7f4f3b9a2c11",
+			Name:   "Acme",
+			Status: domain.CustomerStatusActive,
+		},
+	}
+	f.memberships = &memoryMemberships{memberships: []*domain.CustomerMembership{
+		{ID: 1, CustomerID: testCustomerID, UserID: testOwner.UserID, Role: domain.MembershipRoleOwner, Customer: f.customer},
+		{ID: 2, CustomerID: testCustomerID, UserID: testDeveloper.UserID, Role: domain.MembershipRoleDeveloper, Customer: f.customer},
+	}}
+	customers := &memoryCustomers{customers: []*domain.Customer{f.customer}}
+	if f.sessions == nil {
+		f.sessions = NewSessionService(SessionConfig{})
+	}
+
+	keys, err := GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.jwt = NewJWTService(JWTConfig{Keys: keys, Denylist: f.sessions, Sessions: f.sessions})
+
+	f.mfa = NewMFAService(MFAConfig{Issuer: "Hosterizer", Steps: &memoryStepRecorder{steps: make(map[int64]int64)}})
+	f.recoveryCodes = &memoryRecoveryCodes{codes: make(map[int64]map[string]bool)}
+	f.recovery = NewRecoveryCodeService(f.recoveryCodes)
+
+	lockoutConfig := config.Lockout
+	if lockoutConfig.Events == nil {
+		lockoutConfig.Events = f.events
+	}
+	if lockoutConfig.MFAAttempts == nil {
+		lockoutConfig.MFAAttempts = f.sessions
+	}
+	f.lockout = NewLockoutService(f.users, lockoutConfig)
+
+	f.account = NewAccountService(AccountConfig{
+		UserRepo:       f.users,
+		TokenRepo:      f.tokens,
+		MembershipRepo: f.memberships,
+		PasswordSvc:    f.passwords,
+		LockoutSvc:     f.lockout,
+		Mailer:         f.mailer,
+		Sessions:       f.revoker,
+		BaseURL:        "https://portal.example.com/",
+
+		PasswordHistorySize: 3,
+	})
+	f.admin = NewAdminService(AdminConfig{
+		UserRepo:   f.users,
+		LockoutSvc: f.lockout,
+		AccountSvc: f.account,
+		MFA:        f.mfaResetter,
+		Sessions:   f.revoker,
+		Throttle:   config.Throttle,
+		Events:     f.events,
+	})
+	f.invitation = NewInvitationService(InvitationConfig{
+		InvitationRepo: f.invitations,
+		MembershipRepo: f.memberships,
+		CustomerRepo:   customers,
+		UserRepo:       f.users,
+		PasswordSvc:    f.passwords,
+		JWTSvc:         f.jwt,
+		Mailer:         f.mailer,
+		BaseURL:        "https://portal.example.com/",
+	})
+	tenantSvc := NewTenantService(f.memberships)
+	f.apiKeys = NewAPIKeyService(APIKeyConfig{
+		APIKeyRepo:     f.keys,
+		UserRepo:       f.users,
+		CustomerRepo:   customers,
+		MembershipRepo: f.memberships,
+		TenantSvc:      tenantSvc,
+	})
+	f.sso = NewSSOService(SSOConfig{
+		CustomerRepo:   customers,
+		UserRepo:       f.users,
+		MembershipRepo: f.memberships,
+		IdentityRepo:   f.identities,
+		Store:          f.sessions,
+		Logins:         f.logins,
+		BaseURL:        "https://auth.example.com/",
+	})
+	f.webauthn, err = NewWebAuthnService(WebAuthnConfig{
+		RPID:          testRPID,
+		RPDisplayName: "Hosterizer",
+		RPOrigins:     []string{testOrigin},
+		Credentials:   f.credentials,
+		Users:         f.users,
+		Ceremonies:    f.sessions,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.auth = NewAuthService(AuthServiceConfig{
+		UserRepo:    f.users,
+		PasswordSvc: f.passwords,
+		JWTSvc:      f.jwt,
+		MFASvc:      f.mfa,
+		RecoverySvc: f.recovery,
+		WebAuthnSvc: f.webauthn,
+		LockoutSvc:  f.lockout,
+		SessionSvc:  f.sessions,
+		RefreshSvc:  NewRefreshTokenService(f.refreshTokens, f.jwt),
+		TenantSvc:   tenantSvc,
+		Throttle:    config.Throttle,
+		Events:      f.events,
+	})
+
+	return f
+}
+
+// addUser stores a user, hashing password unless the user already has a hash
+func (f *fixture) addUser(t *testing.T, user *domain.User, password string) *domain.User {
+	t.Helper()
+	if password != "" && user.PasswordHash == "" {
+		hash, err := f.passwords.HashPassword(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.PasswordHash = hash
+	}
+	if err := f.users.Create(context.Background(), user); err != nil {
+		t.Fatalf("failed to add user %s: %v", user.Email, err)
+	}
+	return user
+}
+
+// addJane stores jane@example.com with the password "kT9#vLq2!mZx"
+func (f *fixture) addJane(t *testing.T, role domain.UserRole) *domain.User {
+	t.Helper()
+	return f.addUser(t, &domain.User{Email: "jane@example.com", Role: role}, "kT9#vLq2!mZx")
+}
+
+// addTenantMembers stores the users behind testAdmin, testOwner and testDeveloper
+func (f *fixture) addTenantMembers(t *testing.T) (admin, owner, developer *domain.User) {
+	t.Helper()
+	admin = f.addUser(t, &domain.User{ID: testAdmin.UserID, UUID: "6f1c1f2e-5d1a-4c4e-9a53-2d7f1b6f0a01", Email: "admin@example.com", Role: domain.RoleAdministrator}, "")
+	owner = f.addUser(t, &domain.User{ID: testOwner.UserID, UUID: "6f1c1f2e-5d1a-4c4e-9a53-2d7f1b6f0a02", Email: "owner@example.com", Role: domain.RoleCustomer}, "")
+	developer = f.addUser(t, &domain.User{ID: testDeveloper.UserID, UUID: "6f1c1f2e-5d1a-4c4e-9a53-2d7f1b6f0a03", Email: "dev@example.com", Role: domain.RoleCustomer}, "")
+	return admin, owner, developer
+}
+
+// register signs up jane@example.com through the account service
+func (f *fixture) register(t *testing.T) *domain.User {
+	t.Helper()
+	user, err := f.account.Register(context.Background(), RegisterRequest{
+		Email:     "jane@example.com",
+		Password:  "kT9#vLq2!mZx",
+		FirstName: "Jane",
+	})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	return user
+}
+
+var linkToken = regexp.MustCompile(`https://portal\.example\.com(/[a-z-]+)\?token=([A-Za-z0-9_.-]+)`)
+
+// lastLink returns the path and token of the link in the most recent email
+func (f *fixture) lastLink(t *testing.T) (string, string) {
+	t.Helper()
+	messages := f.mailer.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no email was sent")
+	}
+	match := linkToken.FindStringSubmatch(messages[len(messages)-1].Body)
+	if match == nil {
+		t.Fatalf("no link in email: %q", messages[len(messages)-1].Body)
+	}
+	return match[1], match[2]
+}
+
+// registerPasskey registers a new software authenticator for a user
+func (f *fixture) registerPasskey(t *testing.T, user *domain.User) *softAuthenticator {
+	t.Helper()
+	ctx := context.Background()
+	authenticator := newSoftAuthenticator(t)
+
+	creation, err := f.webauthn.BeginRegistration(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration returned error: %v", err)
+	}
+
+	credential, err := f.webauthn.FinishRegistration(ctx, user.ID, "YubiKey", authenticator.register(t, creation))
+	if err != nil {
+		t.Fatalf("FinishRegistration returned error: %v", err)
+	}
+	if credential.UserID != user.ID || credential.Name != "YubiKey" {
+		t.Fatalf("unexpected credential %+v", credential)
+	}
+
+	return authenticator
+}
+
+// exchange redeems a single sign-on login code and checks the login is scoped to
+// the customer
+func (f *fixture) exchange(t *testing.T, code string) *domain.User {
+	t.Helper()
+	resp, err := f.sso.Exchange(context.Background(), code)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if f.logins.customerID != testCustomerID {
+		t.Fatalf("login scoped to customer %d, want %d", f.logins.customerID, testCustomerID)
+	}
+	return resp.User
+}
+
+// newTestSessionService returns a session service backed by a Redis server the
+// test can fast-forward
+func newTestSessionService(t *testing.T) (*SessionService, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	svc := NewSessionService(SessionConfig{Store: NewRedisSessionStore(RedisConfig{Addr: mr.Addr()})})
+	t.Cleanup(func() { svc.Close() })
+	return svc, mr
+}
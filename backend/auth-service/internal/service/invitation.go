@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// ErrInvalidInvitation is returned when an invitation link is unknown, expired,
+// revoked or already accepted
+var ErrInvalidInvitation = errors.New("invalid or expired invitation")
+
+// InvitationService lets customer owners invite new users to their tenant. The
+// invitee receives a signed, expiring link and creates their account by accepting it.
+type InvitationService struct {
+	invitationRepo     domain.InvitationRepository
+	membershipRepo     domain.MembershipRepository
+	customerRepo       domain.CustomerRepository
+	userRepo           domain.UserRepository
+	passwordSvc        *PasswordService
+	jwtSvc             *JWTService
+	mailer             Mailer
+	baseURL            string
+	invitationDuration time.Duration
+}
+
+// InvitationConfig holds invitation service configuration
+type InvitationConfig struct {
+	InvitationRepo domain.InvitationRepository
+	MembershipRepo domain.MembershipRepository
+	CustomerRepo   domain.CustomerRepository
+	UserRepo       domain.UserRepository
+	PasswordSvc    *PasswordService
+	JWTSvc         *JWTService
+	Mailer         Mailer
+
+	// BaseURL is the portal URL the links in emails point to
+	BaseURL string
+
+	InvitationDuration time.Duration
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(config InvitationConfig) *InvitationService {
+	invitationDuration := config.InvitationDuration
+	if invitationDuration == 0 {
+		invitationDuration = DefaultInvitationTokenDuration
+	}
+
+	return &InvitationService{
+		invitationRepo:     config.InvitationRepo,
+		membershipRepo:     config.MembershipRepo,
+		customerRepo:       config.CustomerRepo,
+		userRepo:           config.UserRepo,
+		passwordSvc:        config.PasswordSvc,
+		jwtSvc:             config.JWTSvc,
+		mailer:             config.Mailer,
+		baseURL:            strings.TrimSuffix(config.BaseURL, "/"),
+		invitationDuration: invitationDuration,
+	}
+}
+
+// Invite invites a new user to a customer with the given role and emails them a
+// link to create their account. Only owners and administrators may invite users.
+// Existing users are added with MembershipService.AddMember instead.
+func (s *InvitationService) Invite(ctx context.Context, actor *TokenClaims, customerID int64, email string, role domain.MembershipRole) (*domain.Invitation, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidMembershipRole
+	}
+
+	if err := authorizeMember(ctx, s.membershipRepo, actor, customerID, true); err != nil {
+		return nil, err
+	}
+
+	email = strings.TrimSpace(email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, ErrInvalidEmail
+	}
+
+	customer, err := s.customerRepo.GetByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.userRepo.GetByEmail(ctx, email); err == nil {
+		return nil, domain.ErrUserAlreadyExists
+	} else if !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	invitedBy := actor.UserID
+	invitation := &domain.Invitation{
+		CustomerID: customerID,
+		Email:      email,
+		Role:       role,
+		InvitedBy:  &invitedBy,
+		ExpiresAt:  time.Now().Add(s.invitationDuration),
+	}
+	if err := s.invitationRepo.Create(withActor(ctx, actor), invitation); err != nil {
+		if errors.Is(err, domain.ErrInvitationAlreadyExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	token, err := s.jwtSvc.GenerateInvitationToken(invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mailer.Send(ctx, &MailMessage{
+		To:      email,
+		Subject: fmt.Sprintf("You have been invited to join %s on Hosterizer", customer.Name),
+		Body: fmt.Sprintf(
+			"Hello,\n\nYou have been invited to join %s on Hosterizer. Open the link below to create your account:\n\n%s\n\nThe invitation expires in %s. If you did not expect it, you can ignore this email.\n",
+			customer.Name, s.baseURL+"/accept-invitation?token="+url.QueryEscape(token), formatDuration(s.invitationDuration),
+		),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// List returns every invitation of a customer, newest first. Only owners and
+// administrators may list invitations.
+func (s *InvitationService) List(ctx context.Context, actor *TokenClaims, customerID int64) ([]*domain.Invitation, error) {
+	if err := authorizeMember(ctx, s.membershipRepo, actor, customerID, true); err != nil {
+		return nil, err
+	}
+
+	invitations, err := s.invitationRepo.ListByCustomer(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// Revoke revokes a pending invitation, so its link stops working. Only owners and
+// administrators may revoke invitations.
+func (s *InvitationService) Revoke(ctx context.Context, actor *TokenClaims, customerID, invitationID int64) error {
+	if err := authorizeMember(ctx, s.membershipRepo, actor, customerID, true); err != nil {
+		return err
+	}
+
+	return s.invitationRepo.Revoke(withActor(ctx, actor), customerID, invitationID)
+}
+
+// AcceptInvitationRequest represents the account an invitee creates
+type AcceptInvitationRequest struct {
+	Token     string
+	Password  string
+	FirstName string
+	LastName  string
+}
+
+// Accept redeems an invitation link: it creates a customer user with the chosen
+// password and adds them to the inviting customer with the invited role. Since
+// the link arrived by email, the address is marked as verified.
+func (s *InvitationService) Accept(ctx context.Context, req AcceptInvitationRequest) (*domain.User, error) {
+	claims, err := s.jwtSvc.ValidateInvitationToken(req.Token)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation, err := s.invitationRepo.GetByUUID(ctx, claims.ID)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	if !invitation.IsPending() || invitation.CustomerID != *claims.CustomerID {
+		return nil, ErrInvalidInvitation
+	}
+
+	customer, err := s.customerRepo.GetByID(ctx, invitation.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	now := time.Now()
+	user := &domain.User{
+		Email:           invitation.Email,
+		EmailVerifiedAt: &now,
+		FirstName:       strings.TrimSpace(req.FirstName),
+		LastName:        strings.TrimSpace(req.LastName),
+		Role:            domain.RoleCustomer,
+	}
+
+	if err := s.passwordSvc.CheckPassword(ctx, req.Password, user, customer.Settings.PasswordPolicy); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := s.passwordSvc.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.PasswordHash = passwordHash
+
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, domain.ErrUserAlreadyExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	// Claim the invitation only once the user exists. If a concurrent request
+	// claimed or revoked it in the meantime, the user is removed again.
+	if err := s.invitationRepo.Accept(ctx, invitation.UUID, user.ID); err != nil {
+		if deleteErr := s.userRepo.Delete(ctx, user.ID); deleteErr != nil {
+			return nil, fmt.Errorf("failed to delete user after failed invitation: %w", deleteErr)
+		}
+		if errors.Is(err, domain.ErrInvitationNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	if err := s.membershipRepo.Create(ctx, &domain.CustomerMembership{
+		CustomerID: invitation.CustomerID,
+		UserID:     user.ID,
+		Role:       invitation.Role,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create membership: %w", err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+func TestAcceptInvitationCreatesMember(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.register(t)
+
+	if _, err := f.invitation.Invite(ctx, testDeveloper, testCustomerID, "sam@example.com", domain.MembershipRoleDeveloper); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("invite by developer: got %v, want ErrForbidden", err)
+	}
+	if _, err := f.invitation.Invite(ctx, testOwner, testCustomerID, "jane@example.com", domain.MembershipRoleDeveloper); !errors.Is(err, domain.ErrUserAlreadyExists) {
+		t.Fatalf("invite existing user: got %v, want ErrUserAlreadyExists", err)
+	}
+
+	invitation, err := f.invitation.Invite(ctx, testOwner, testCustomerID, "sam@example.com", domain.MembershipRoleDeveloper)
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	if _, err := f.invitation.Invite(ctx, testOwner, testCustomerID, "sam@example.com", domain.MembershipRoleBilling); !errors.Is(err, domain.ErrInvitationAlreadyExists) {
+		t.Fatalf("second invite: got %v, want ErrInvitationAlreadyExists", err)
+	}
+
+	path, token := f.lastLink(t)
+	if path != "/accept-invitation" {
+		t.Fatalf("link path = %q", path)
+	}
+
+	// A rejected password leaves the invitation open
+	if _, err := f.invitation.Accept(ctx, AcceptInvitationRequest{Token: token, Password: "short"}); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("short password: got %v, want ErrPasswordTooShort", err)
+	}
+
+	user, err := f.invitation.Accept(ctx, AcceptInvitationRequest{Token: token, Password: "Rw4$pYn8@cJs", FirstName: "Sam"})
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if user.Email != "sam@example.com" || user.Role != domain.RoleCustomer || !user.IsEmailVerified() || !user.HasPassword() {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	membership, err := f.memberships.Get(ctx, testCustomerID, user.ID)
+	if err != nil || membership.Role != domain.MembershipRoleDeveloper {
+		t.Fatalf("membership: got %+v, %v", membership, err)
+	}
+
+	if _, err := f.invitation.Accept(ctx, AcceptInvitationRequest{Token: token, Password: "hB6%gQe1^dWu"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("second accept: got %v, want ErrInvalidInvitation", err)
+	}
+
+	invitations, err := f.invitation.List(ctx, testOwner, testCustomerID)
+	if err != nil || len(invitations) != 1 || invitations[0].ID != invitation.ID {
+		t.Fatalf("List: got %v, %v", invitations, err)
+	}
+	if invitations[0].Status() != domain.InvitationStatusAccepted || *invitations[0].AcceptedUserID != user.ID {
+		t.Fatalf("accepted invitation: %+v", invitations[0])
+	}
+}
+
+func TestRevokedAndExpiredInvitationsCannotBeAccepted(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	revoked, err := f.invitation.Invite(ctx, testOwner, testCustomerID, "sam@example.com", domain.MembershipRoleReadOnly)
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	_, revokedToken := f.lastLink(t)
+
+	if err := f.invitation.Revoke(ctx, testDeveloper, testCustomerID, revoked.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("revoke by developer: got %v, want ErrForbidden", err)
+	}
+	if err := f.invitation.Revoke(ctx, testOwner, testCustomerID, revoked.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := f.invitation.Revoke(ctx, testOwner, testCustomerID, revoked.ID); !errors.Is(err, domain.ErrInvitationNotFound) {
+		t.Fatalf("second revoke: got %v, want ErrInvitationNotFound", err)
+	}
+	if _, err := f.invitation.Accept(ctx, AcceptInvitationRequest{Token: revokedToken, Password: "Rw4$pYn8@cJs"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("accept revoked: got %v, want ErrInvalidInvitation", err)
+	}
+
+	// Revoking makes room for a new invitation to the same address
+	expired, err := f.invitation.Invite(ctx, testOwner, testCustomerID, "sam@example.com", domain.MembershipRoleReadOnly)
+	if err != nil {
+		t.Fatalf("Invite after revoke: %v", err)
+	}
+	_, expiredToken := f.lastLink(t)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+
+	if _, err := f.invitation.Accept(ctx, AcceptInvitationRequest{Token: expiredToken, Password: "Rw4$pYn8@cJs"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("accept expired: got %v, want ErrInvalidInvitation", err)
+	}
+	if _, err := f.invitation.Accept(ctx, AcceptInvitationRequest{Token: "not a token", Password: "Rw4$pYn8@cJs"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("accept garbage: got %v, want ErrInvalidInvitation", err)
+	}
+
+	if _, err := f.users.GetByEmail(ctx, "sam@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("user was created: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"time"
@@ -15,6 +17,9 @@ const (
 
 	// DefaultRefreshTokenDuration is the default duration for refresh tokens
 	DefaultRefreshTokenDuration = 7 * 24 * time.Hour
+
+	// DefaultMFATokenDuration is the default duration for MFA challenge tokens
+	DefaultMFATokenDuration = 5 * time.Minute
 )
 
 var (
@@ -23,31 +28,62 @@ var (
 
 	// ErrExpiredToken is returned when a token has expired
 	ErrExpiredToken = errors.New("token has expired")
+
+	// ErrRevokedToken is returned when a token has been revoked by logout
+	ErrRevokedToken = errors.New("token has been revoked")
+
+	// ErrSessionExpired is returned when the login session of a token has idled out or was revoked
+	ErrSessionExpired = errors.New("session has expired")
 )
 
+// TokenDenylist reports whether an otherwise valid access token has been revoked
+type TokenDenylist interface {
+	IsTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+}
+
+// SessionTracker keeps login sessions alive while their tokens are used
+type SessionTracker interface {
+	// RefreshSession records an access to a session and extends its idle timeout.
+	// It returns ErrSessionNotFound if the session has timed out or was deleted.
+	RefreshSession(ctx context.Context, sessionID string) error
+}
+
 // TokenClaims represents the JWT claims
 type TokenClaims struct {
-	UserID     int64           `json:"user_id"`
-	UUID       string          `json:"uuid"`
-	Email      string          `json:"email"`
-	Role       domain.UserRole `json:"role"`
-	CustomerID *int64          `json:"customer_id,omitempty"`
-	TokenType  string          `json:"token_type"` // "access" or "refresh"
+	UserID     int64                 `json:"user_id"`
+	UUID       string                `json:"uuid"`
+	Email      string                `json:"email"`
+	Role       domain.UserRole       `json:"role"`
+	CustomerID *int64                `json:"customer_id,omitempty"`
+	TenantRole domain.MembershipRole `json:"tenant_role,omitempty"`
+	FamilyID   string                `json:"fid,omitempty"` // refresh token family
+	SessionID  string                `json:"sid,omitempty"` // login session, the same ID as the family
+	TokenType  string                `json:"token_type"`    // "access", "refresh", "mfa" or "invitation"
 	jwt.RegisteredClaims
 }
 
-// JWTService handles JWT token generation and validation
+// JWTService handles JWT token generation and validation.
+// Tokens are signed with the key set's signing key and carry its ID in the kid header.
 type JWTService struct {
-	secretKey            []byte
+	keys                 *KeySet
 	accessTokenDuration  time.Duration
 	refreshTokenDuration time.Duration
+	mfaTokenDuration     time.Duration
+	denylist             TokenDenylist
+	sessions             SessionTracker
 }
 
 // JWTConfig holds JWT service configuration
 type JWTConfig struct {
-	SecretKey            string
+	Keys                 *KeySet
 	AccessTokenDuration  time.Duration
 	RefreshTokenDuration time.Duration
+	MFATokenDuration     time.Duration
+	Denylist             TokenDenylist
+
+	// Sessions slides the login session of every validated access token forward;
+	// sessions are not checked without one
+	Sessions SessionTracker
 }
 
 // NewJWTService creates a new JWT service
@@ -62,24 +98,43 @@ func NewJWTService(config JWTConfig) *JWTService {
 		refreshDuration = DefaultRefreshTokenDuration
 	}
 
+	mfaDuration := config.MFATokenDuration
+	if mfaDuration == 0 {
+		mfaDuration = DefaultMFATokenDuration
+	}
+
 	return &JWTService{
-		secretKey:            []byte(config.SecretKey),
+		keys:                 config.Keys,
 		accessTokenDuration:  accessDuration,
 		refreshTokenDuration: refreshDuration,
+		mfaTokenDuration:     mfaDuration,
+		denylist:             config.Denylist,
+		sessions:             config.Sessions,
 	}
 }
 
-// GenerateAccessToken generates an access token for a user
-func (s *JWTService) GenerateAccessToken(user *domain.User, customerID *int64) (string, error) {
+// GenerateAccessToken generates an access token for a user scoped to a tenant (nil for none).
+// The familyID ties the access token to the login it was issued for so logout can revoke both;
+// it is also the ID of the login session, carried as the sid claim.
+func (s *JWTService) GenerateAccessToken(user *domain.User, tenant *Tenant, familyID string) (string, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 	claims := TokenClaims{
 		UserID:     user.ID,
 		UUID:       user.UUID,
 		Email:      user.Email,
 		Role:       user.Role,
-		CustomerID: customerID,
+		CustomerID: customerIDOf(tenant),
+		TenantRole: tenantRoleOf(tenant),
+		FamilyID:   familyID,
+		SessionID:  familyID,
 		TokenType:  "access",
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
@@ -88,8 +143,7 @@ func (s *JWTService) GenerateAccessToken(user *domain.User, customerID *int64) (
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.secretKey)
+	tokenString, err := s.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign access token: %w", err)
 	}
@@ -97,17 +151,65 @@ func (s *JWTService) GenerateAccessToken(user *domain.User, customerID *int64) (
 	return tokenString, nil
 }
 
-// GenerateRefreshToken generates a refresh token for a user
-func (s *JWTService) GenerateRefreshToken(user *domain.User) (string, error) {
+// GenerateRefreshToken generates a refresh token for a user in the given token family.
+// Every refresh token gets a unique jti; an empty familyID starts a new family.
+// The customer ID is carried along so refreshed tokens keep the same tenant.
+func (s *JWTService) GenerateRefreshToken(user *domain.User, customerID *int64, familyID string) (string, *TokenClaims, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = NewTokenID()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	now := time.Now()
+	claims := &TokenClaims{
+		UserID:     user.ID,
+		UUID:       user.UUID,
+		Email:      user.Email,
+		Role:       user.Role,
+		CustomerID: customerID,
+		FamilyID:   familyID,
+		TokenType:  "refresh",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.refreshTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "hosterizer-auth",
+			Subject:   user.UUID,
+		},
+	}
+
+	tokenString, err := s.sign(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+
+	return tokenString, claims, nil
+}
+
+// GenerateMFAToken generates a short-lived token proving that a user passed the
+// password step of a login. It can only be exchanged at the MFA challenge endpoint.
+func (s *JWTService) GenerateMFAToken(user *domain.User) (string, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 	claims := TokenClaims{
 		UserID:    user.ID,
 		UUID:      user.UUID,
-		Email:     user.Email,
-		Role:      user.Role,
-		TokenType: "refresh",
+		TokenType: "mfa",
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.refreshTokenDuration)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.mfaTokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "hosterizer-auth",
@@ -115,10 +217,37 @@ func (s *JWTService) GenerateRefreshToken(user *domain.User) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.secretKey)
+	tokenString, err := s.sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign MFA token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// GenerateInvitationToken generates the signed link token of an invitation to join
+// a customer. It carries the invitation UUID as its jti and expires with the invitation.
+func (s *JWTService) GenerateInvitationToken(invitation *domain.Invitation) (string, error) {
+	now := time.Now()
+	customerID := invitation.CustomerID
+	claims := TokenClaims{
+		Email:      invitation.Email,
+		CustomerID: &customerID,
+		TenantRole: invitation.Role,
+		TokenType:  "invitation",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        invitation.UUID,
+			ExpiresAt: jwt.NewNumericDate(invitation.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "hosterizer-auth",
+			Subject:   invitation.UUID,
+		},
+	}
+
+	tokenString, err := s.sign(claims)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign refresh token: %w", err)
+		return "", fmt.Errorf("failed to sign invitation token: %w", err)
 	}
 
 	return tokenString, nil
@@ -127,11 +256,17 @@ func (s *JWTService) GenerateRefreshToken(user *domain.User) (string, error) {
 // ValidateToken validates a JWT token and returns the claims
 func (s *JWTService) ValidateToken(tokenString string) (*TokenClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.VerificationKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+
+		// Verify signing method matches the key
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return s.secretKey, nil
+		return key.PublicKey, nil
 	})
 
 	if err != nil {
@@ -149,8 +284,9 @@ func (s *JWTService) ValidateToken(tokenString string) (*TokenClaims, error) {
 	return claims, nil
 }
 
-// ValidateAccessToken validates an access token
-func (s *JWTService) ValidateAccessToken(tokenString string) (*TokenClaims, error) {
+// ValidateAccessToken validates an access token, checks it against the denylist and
+// slides its login session forward. Tokens whose session has idled out are refused.
+func (s *JWTService) ValidateAccessToken(ctx context.Context, tokenString string) (*TokenClaims, error) {
 	claims, err := s.ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
@@ -160,6 +296,14 @@ func (s *JWTService) ValidateAccessToken(tokenString string) (*TokenClaims, erro
 		return nil, errors.New("invalid token type: expected access token")
 	}
 
+	if err := s.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	if err := s.touchSession(ctx, claims); err != nil {
+		return nil, err
+	}
+
 	return claims, nil
 }
 
@@ -177,6 +321,45 @@ func (s *JWTService) ValidateRefreshToken(tokenString string) (*TokenClaims, err
 	return claims, nil
 }
 
+// ValidateMFAToken validates an MFA challenge token and checks it against the denylist,
+// which holds tokens that were already exchanged or exhausted their attempts
+func (s *JWTService) ValidateMFAToken(ctx context.Context, tokenString string) (*TokenClaims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != "mfa" {
+		return nil, errors.New("invalid token type: expected MFA token")
+	}
+
+	if err := s.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// ValidateInvitationToken validates the token of an invitation link. Whether the
+// invitation is still pending is up to the caller.
+func (s *JWTService) ValidateInvitationToken(tokenString string) (*TokenClaims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != "invitation" || claims.CustomerID == nil {
+		return nil, errors.New("invalid token type: expected invitation token")
+	}
+
+	return claims, nil
+}
+
+// GetKeySet returns the signing and verification keys
+func (s *JWTService) GetKeySet() *KeySet {
+	return s.keys
+}
+
 // GetAccessTokenDuration returns the access token duration
 func (s *JWTService) GetAccessTokenDuration() time.Duration {
 	return s.accessTokenDuration
@@ -186,3 +369,66 @@ func (s *JWTService) GetAccessTokenDuration() time.Duration {
 func (s *JWTService) GetRefreshTokenDuration() time.Duration {
 	return s.refreshTokenDuration
 }
+
+// sign signs claims with the active signing key and sets the kid header
+func (s *JWTService) sign(claims jwt.Claims) (string, error) {
+	key := s.keys.SigningKey()
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// checkRevoked returns ErrRevokedToken if the token is on the denylist
+func (s *JWTService) checkRevoked(ctx context.Context, claims *TokenClaims) error {
+	if s.denylist == nil {
+		return nil
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	revoked, err := s.denylist.IsTokenRevoked(ctx, claims.ID, claims.UserID, issuedAt)
+	if err != nil {
+		return fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return ErrRevokedToken
+	}
+
+	return nil
+}
+
+// NewTokenID generates a random UUIDv4 string for use as a token or family ID
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// touchSession returns ErrSessionExpired if the token's login session is gone, and
+// otherwise extends it. Tokens issued before they carried a sid are not checked.
+func (s *JWTService) touchSession(ctx context.Context, claims *TokenClaims) error {
+	if s.sessions == nil || claims.SessionID == "" {
+		return nil
+	}
+
+	if err := s.sessions.RefreshSession(ctx, claims.SessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return ErrSessionExpired
+		}
+		return fmt.Errorf("failed to refresh session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hosterizer/shared/auth"
+)
+
+// VerificationKey is a public key tokens can be verified with
+type VerificationKey struct {
+	ID        string
+	Algorithm string
+	PublicKey crypto.PublicKey
+}
+
+// SigningKey is the private key new tokens are signed with
+type SigningKey struct {
+	VerificationKey
+	PrivateKey crypto.Signer
+}
+
+// KeySet holds the active signing key and every key tokens may still be verified with.
+// To rotate keys, make the new key the signing key and keep the old one as a
+// verification key until the longest-lived token signed with it has expired.
+type KeySet struct {
+	signing      *SigningKey
+	verification map[string]*VerificationKey
+	order        []string
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key. Its key ID is the RFC 7638 thumbprint.
+func NewSigningKey(privateKey crypto.Signer) (*SigningKey, error) {
+	verification, err := NewVerificationKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		VerificationKey: *verification,
+		PrivateKey:      privateKey,
+	}, nil
+}
+
+// NewVerificationKey wraps an RSA or Ed25519 public key. Its key ID is the RFC 7638 thumbprint.
+func NewVerificationKey(publicKey crypto.PublicKey) (*VerificationKey, error) {
+	algorithm, err := auth.Algorithm(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := auth.Thumbprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerificationKey{
+		ID:        kid,
+		Algorithm: algorithm,
+		PublicKey: publicKey,
+	}, nil
+}
+
+// NewKeySet creates a key set. The signing key is always a verification key too.
+func NewKeySet(signing *SigningKey, verification ...*VerificationKey) *KeySet {
+	ks := &KeySet{
+		signing:      signing,
+		verification: make(map[string]*VerificationKey),
+	}
+
+	ks.add(&signing.VerificationKey)
+	for _, key := range verification {
+		ks.add(key)
+	}
+
+	return ks
+}
+
+// LoadKeySet loads the signing key and any additional verification keys from PEM files.
+// Verification key files may hold either a public or a private key.
+func LoadKeySet(signingKeyFile string, verificationKeyFiles []string) (*KeySet, error) {
+	privateKey, err := loadPrivateKey(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	signing, err := NewSigningKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", signingKeyFile, err)
+	}
+
+	var verification []*VerificationKey
+	for _, file := range verificationKeyFiles {
+		publicKey, err := loadPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := NewVerificationKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verification key %s: %w", file, err)
+		}
+		verification = append(verification, key)
+	}
+
+	return NewKeySet(signing, verification...), nil
+}
+
+// GenerateKeySet creates a key set with a fresh Ed25519 signing key.
+// Tokens signed with it become invalid when the process restarts.
+func GenerateKeySet() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	signing, err := NewSigningKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeySet(signing), nil
+}
+
+// SigningKey returns the key new tokens are signed with
+func (ks *KeySet) SigningKey() *SigningKey {
+	return ks.signing
+}
+
+// VerificationKey returns the verification key with the given key ID
+func (ks *KeySet) VerificationKey(kid string) (*VerificationKey, bool) {
+	key, ok := ks.verification[kid]
+	return key, ok
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set
+func (ks *KeySet) JWKS() (auth.JWKSet, error) {
+	set := auth.JWKSet{Keys: make([]auth.JWK, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		jwk, err := auth.NewJWK(kid, ks.verification[kid].PublicKey)
+		if err != nil {
+			return auth.JWKSet{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+func (ks *KeySet) add(key *VerificationKey) {
+	if _, ok := ks.verification[key.ID]; ok {
+		return
+	}
+	ks.verification[key.ID] = key
+	ks.order = append(ks.order, key.ID)
+}
+
+// signingMethod returns the jwt signing method for a JWS algorithm
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case auth.AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case auth.AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+func loadPrivateKey(file string) (crypto.Signer, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q in %s", block.Type, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", file, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key in %s", file)
+	}
+	return signer, nil
+}
+
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		signer, err := loadPrivateKey(file)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", file, err)
+	}
+	return key, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found in " + file)
+	}
+	return block, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,24 +10,46 @@ import (
 )
 
 const (
-	// MaxFailedAttempts is the maximum number of failed login attempts before lockout
-	MaxFailedAttempts = 3
+	// MaxFailedAttempts is the maximum number of failed attempts before lockout, for
+	// callers who already got past the password: wrong current passwords with an
+	// access token and wrong second factors. Wrong passwords at login are left to
+	// the login throttle, so that nobody can lock out a user by their address.
+	MaxFailedAttempts = 10
 
 	// LockoutDuration is the duration for which an account is locked
 	LockoutDuration = 15 * time.Minute
+
+	// MaxMFAAttempts is the maximum number of wrong codes per MFA challenge before lockout
+	MaxMFAAttempts = 5
 )
 
+// ErrAccountLocked is returned when an action is refused because the account is locked
+var ErrAccountLocked = errors.New("account is locked")
+
+// MFAAttemptCounter counts failed attempts per MFA challenge
+type MFAAttemptCounter interface {
+	IncrementMFAAttempts(ctx context.Context, challengeID string, ttl time.Duration) (int, error)
+}
+
 // LockoutService handles account lockout logic
 type LockoutService struct {
 	userRepo          domain.UserRepository
 	maxFailedAttempts int
 	lockoutDuration   time.Duration
+	mfaAttempts       MFAAttemptCounter
+	maxMFAAttempts    int
+	events            EventRecorder
 }
 
 // LockoutConfig holds lockout service configuration
 type LockoutConfig struct {
 	MaxFailedAttempts int
 	LockoutDuration   time.Duration
+	MFAAttempts       MFAAttemptCounter
+	MaxMFAAttempts    int
+
+	// Events receives an audit event for every lockout and unlock; defaults to the log
+	Events EventRecorder
 }
 
 // NewLockoutService creates a new lockout service
@@ -41,29 +64,67 @@ func NewLockoutService(userRepo domain.UserRepository, config LockoutConfig) *Lo
 		duration = LockoutDuration
 	}
 
+	maxMFAAttempts := config.MaxMFAAttempts
+	if maxMFAAttempts == 0 {
+		maxMFAAttempts = MaxMFAAttempts
+	}
+
+	events := config.Events
+	if events == nil {
+		events = NewLogEventRecorder()
+	}
+
 	return &LockoutService{
 		userRepo:          userRepo,
 		maxFailedAttempts: maxAttempts,
 		lockoutDuration:   duration,
+		mfaAttempts:       config.MFAAttempts,
+		maxMFAAttempts:    maxMFAAttempts,
+		events:            events,
 	}
 }
 
-// RecordFailedAttempt records a failed login attempt and locks the account if necessary
+// RecordFailedAttempt records a failed login attempt and locks the account if necessary.
+// The count is incremented in the database, so concurrent failures are all counted.
 func (s *LockoutService) RecordFailedAttempt(ctx context.Context, user *domain.User) error {
-	user.IncrementFailedAttempts()
+	attempt, err := s.userRepo.IncrementFailedAttempts(ctx, user.ID, s.maxFailedAttempts, s.lockoutDuration)
+	if err != nil {
+		return fmt.Errorf("failed to update failed attempts: %w", err)
+	}
+
+	user.FailedLoginAttempts = attempt.Attempts
+	user.LockedUntil = attempt.LockedUntil
+
+	if attempt.Locked {
+		reason := fmt.Sprintf("%d failed attempts", attempt.Attempts)
+		return s.recordEvent(ctx, NewAuditEvent(ctx, AuditEventAccountLocked, user.ID, user.Email, reason))
+	}
+
+	return nil
+}
+
+// RecordFailedMFAAttempt records a wrong code at an MFA challenge. The password step
+// already succeeded, so these failures are counted per challenge rather than against
+// the login attempt counter. When the challenge runs out of attempts the account is
+// locked and true is returned.
+func (s *LockoutService) RecordFailedMFAAttempt(ctx context.Context, user *domain.User, challengeID string, ttl time.Duration) (bool, error) {
+	attempts, err := s.mfaAttempts.IncrementMFAAttempts(ctx, challengeID, ttl)
+	if err != nil {
+		return false, err
+	}
 
-	// Check if we should lock the account
-	if user.FailedLoginAttempts >= s.maxFailedAttempts {
-		user.LockAccount(s.lockoutDuration)
+	if attempts < s.maxMFAAttempts {
+		return false, nil
 	}
 
-	// Update the database
-	err := s.userRepo.UpdateFailedAttempts(ctx, user.ID, user.FailedLoginAttempts, user.LockedUntil)
+	lockedUntil, err := s.userRepo.LockAccount(ctx, user.ID, s.lockoutDuration)
 	if err != nil {
-		return fmt.Errorf("failed to update failed attempts: %w", err)
+		return true, fmt.Errorf("failed to lock account: %w", err)
 	}
+	user.LockedUntil = lockedUntil
 
-	return nil
+	reason := fmt.Sprintf("%d wrong MFA codes", attempts)
+	return true, s.recordEvent(ctx, NewAuditEvent(ctx, AuditEventAccountLocked, user.ID, user.Email, reason))
 }
 
 // ResetFailedAttempts resets the failed login attempts for a user
@@ -83,8 +144,8 @@ func (s *LockoutService) IsAccountLocked(user *domain.User) bool {
 	return user.IsLocked()
 }
 
-// UnlockAccount manually unlocks an account
-func (s *LockoutService) UnlockAccount(ctx context.Context, user *domain.User) error {
+// UnlockAccount manually unlocks an account on behalf of an administrator
+func (s *LockoutService) UnlockAccount(ctx context.Context, user *domain.User, actorID int64) error {
 	user.ResetFailedAttempts()
 
 	err := s.userRepo.UpdateFailedAttempts(ctx, user.ID, 0, nil)
@@ -92,7 +153,9 @@ func (s *LockoutService) UnlockAccount(ctx context.Context, user *domain.User) e
 		return fmt.Errorf("failed to unlock account: %w", err)
 	}
 
-	return nil
+	event := NewAuditEvent(ctx, AuditEventAccountUnlocked, user.ID, user.Email, "unlocked by administrator")
+	event.ActorID = actorID
+	return s.recordEvent(ctx, event)
 }
 
 // GetRemainingLockoutTime returns the remaining lockout time for a user
@@ -108,3 +171,11 @@ func (s *LockoutService) GetRemainingLockoutTime(user *domain.User) time.Duratio
 
 	return remaining
 }
+
+// recordEvent records an audit event
+func (s *LockoutService) recordEvent(ctx context.Context, event *AuditEvent) error {
+	if err := s.events.Record(ctx, event); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
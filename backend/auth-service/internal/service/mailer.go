@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidMailHeader is returned when a recipient or subject would inject mail headers
+var ErrInvalidMailHeader = errors.New("invalid mail header")
+
+// MailMessage represents a plain text email
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	Send(ctx context.Context, msg *MailMessage) error
+}
+
+// SMTPConfig holds SMTP mailer configuration
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer implements Mailer using an SMTP relay. STARTTLS is used when the
+// server offers it; credentials are only sent over TLS or to localhost.
+type SMTPMailer struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	envelope string
+}
+
+// NewSMTPMailer creates a new SMTP mailer
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	// The envelope sender is the bare address of a "Name <address>" sender
+	envelope := config.From
+	if addr, err := mail.ParseAddress(config.From); err == nil {
+		envelope = addr.Address
+	}
+
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		auth:     auth,
+		from:     config.From,
+		envelope: envelope,
+	}
+}
+
+// Send sends an email through the SMTP relay
+func (m *SMTPMailer) Send(ctx context.Context, msg *MailMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := formatMailMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, m.envelope, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+
+	return nil
+}
+
+// formatMailMessage renders the headers and body of a plain text email
+func formatMailMessage(from string, msg *MailMessage) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidMailHeader
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + msg.To + "\r\n")
+	sb.WriteString("Subject: " + msg.Subject + "\r\n")
+	sb.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(sb.String()), nil
+}
+
+// MemoryMailer implements Mailer by keeping sent emails in memory, for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+// NewMemoryMailer creates a new in-memory mailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send records an email
+func (m *MemoryMailer) Send(ctx context.Context, msg *MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns every email sent so far, oldest first
+func (m *MemoryMailer) Messages() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]MailMessage(nil), m.messages...)
+}
+
+// LogMailer implements Mailer by writing emails to the log. It is only suitable
+// for local development, where links can be copied from the output.
+type LogMailer struct{}
+
+// NewLogMailer creates a new logging mailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs an email
+func (m *LogMailer) Send(ctx context.Context, msg *MailMessage) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+var (
+	// ErrForbidden is returned when the caller may not perform an operation
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrInvalidMembershipRole is returned when an unknown membership role is requested
+	ErrInvalidMembershipRole = errors.New("invalid membership role")
+
+	// ErrInvalidMember is returned when a user cannot be added to a customer
+	ErrInvalidMember = errors.New("only customer users can be members of a customer")
+)
+
+// MembershipService manages which users belong to which customer tenants
+type MembershipService struct {
+	membershipRepo domain.MembershipRepository
+	customerRepo   domain.CustomerRepository
+	userRepo       domain.UserRepository
+}
+
+// NewMembershipService creates a new membership service
+func NewMembershipService(membershipRepo domain.MembershipRepository, customerRepo domain.CustomerRepository, userRepo domain.UserRepository) *MembershipService {
+	return &MembershipService{
+		membershipRepo: membershipRepo,
+		customerRepo:   customerRepo,
+		userRepo:       userRepo,
+	}
+}
+
+// ListForUser returns the customers a user belongs to
+func (s *MembershipService) ListForUser(ctx context.Context, userID int64) ([]*domain.CustomerMembership, error) {
+	memberships, err := s.membershipRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	return memberships, nil
+}
+
+// ListForCustomer returns the members of a customer. Any member may list them.
+func (s *MembershipService) ListForCustomer(ctx context.Context, actor *TokenClaims, customerID int64) ([]*domain.CustomerMembership, error) {
+	if err := s.authorize(ctx, actor, customerID, false); err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.membershipRepo.ListByCustomer(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	return memberships, nil
+}
+
+// AddMember adds an existing customer user to a customer. Only owners and administrators may add members.
+func (s *MembershipService) AddMember(ctx context.Context, actor *TokenClaims, customerID int64, email string, role domain.MembershipRole) (*domain.CustomerMembership, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidMembershipRole
+	}
+
+	if err := s.authorize(ctx, actor, customerID, true); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.customerRepo.GetByID(ctx, customerID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Role != domain.RoleCustomer {
+		return nil, ErrInvalidMember
+	}
+
+	membership := &domain.CustomerMembership{
+		CustomerID: customerID,
+		UserID:     user.ID,
+		Role:       role,
+	}
+	if err := s.membershipRepo.Create(withActor(ctx, actor), membership); err != nil {
+		return nil, err
+	}
+
+	membership.User = user
+	return membership, nil
+}
+
+// UpdateRole changes a member's role. Only owners and administrators may change roles.
+func (s *MembershipService) UpdateRole(ctx context.Context, actor *TokenClaims, customerID, userID int64, role domain.MembershipRole) error {
+	if !role.IsValid() {
+		return ErrInvalidMembershipRole
+	}
+
+	if err := s.authorize(ctx, actor, customerID, true); err != nil {
+		return err
+	}
+
+	// The repository refuses to demote the last owner in the same transaction
+	return s.membershipRepo.UpdateRole(withActor(ctx, actor), customerID, userID, role)
+}
+
+// RemoveMember removes a user from a customer. Owners and administrators may remove
+// anyone, and every member may remove themselves.
+func (s *MembershipService) RemoveMember(ctx context.Context, actor *TokenClaims, customerID, userID int64) error {
+	if actor.UserID != userID {
+		if err := s.authorize(ctx, actor, customerID, true); err != nil {
+			return err
+		}
+	}
+
+	return s.membershipRepo.Delete(withActor(ctx, actor), customerID, userID)
+}
+
+// authorize checks that the actor is an administrator or a member of the customer,
+// and an owner if requireOwner is set
+func (s *MembershipService) authorize(ctx context.Context, actor *TokenClaims, customerID int64, requireOwner bool) error {
+	return authorizeMember(ctx, s.membershipRepo, actor, customerID, requireOwner)
+}
+
+// authorizeMember returns ErrForbidden unless the actor is an administrator or a
+// member of the customer, and an owner if requireOwner is set
+func authorizeMember(ctx context.Context, membershipRepo domain.MembershipRepository, actor *TokenClaims, customerID int64, requireOwner bool) error {
+	if actor.Role == domain.RoleAdministrator {
+		return nil
+	}
+
+	membership, err := membershipRepo.Get(ctx, customerID, actor.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrMembershipNotFound) {
+			return ErrForbidden
+		}
+		return err
+	}
+
+	if requireOwner && !membership.IsOwner() {
+		return ErrForbidden
+	}
+
+	return nil
+}
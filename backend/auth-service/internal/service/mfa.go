@@ -1,16 +1,61 @@
 package service
 
 import (
-	"encoding/base32"
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/hosterizer/auth-service/internal/domain"
 	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
 	"github.com/pquerna/otp/totp"
 )
 
+const (
+	// TOTPPeriod is the TOTP time step in seconds
+	TOTPPeriod = 30
+
+	// DefaultTOTPSkew is the default number of time steps accepted on either side of the current one
+	DefaultTOTPSkew = 1
+)
+
+var (
+	// ErrInvalidMFACode is returned when a TOTP code, recovery code or passkey is not accepted
+	ErrInvalidMFACode = errors.New("invalid MFA code")
+
+	// ErrMFANotEnabled is returned when a second factor is required from a user without one
+	ErrMFANotEnabled = errors.New("MFA not enabled")
+)
+
+// MFAStepRecorder records the last TOTP time step accepted for a user.
+// It must fail with domain.ErrMFACodeReplayed unless the step is newer than the recorded one.
+type MFAStepRecorder interface {
+	UpdateMFALastUsedStep(ctx context.Context, id int64, step int64) error
+}
+
 // MFAService handles multi-factor authentication operations
 type MFAService struct {
 	issuer string
+	skew   int
+	steps  MFAStepRecorder
+	now    func() time.Time
+}
+
+// MFAConfig holds MFA service configuration
+type MFAConfig struct {
+	Issuer string
+
+	// Skew is the number of time steps accepted before and after the current one;
+	// DefaultTOTPSkew when nil. Point it at 0 to accept only the current step.
+	Skew *int
+
+	// Steps records accepted time steps to prevent replay
+	Steps MFAStepRecorder
+
+	// Now returns the current time; defaults to time.Now
+	Now func() time.Time
 }
 
 // MFASetupResult contains the result of MFA setup
@@ -20,9 +65,22 @@ type MFASetupResult struct {
 }
 
 // NewMFAService creates a new MFA service
-func NewMFAService(issuer string) *MFAService {
+func NewMFAService(config MFAConfig) *MFAService {
+	skew := DefaultTOTPSkew
+	if config.Skew != nil {
+		skew = *config.Skew
+	}
+
+	now := config.Now
+	if now == nil {
+		now = time.Now
+	}
+
 	return &MFAService{
-		issuer: issuer,
+		issuer: config.Issuer,
+		skew:   skew,
+		steps:  config.Steps,
+		now:    now,
 	}
 }
 
@@ -31,7 +89,7 @@ func (s *MFAService) GenerateSecret(accountName string) (*MFASetupResult, error)
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      s.issuer,
 		AccountName: accountName,
-		Period:      30,
+		Period:      TOTPPeriod,
 		Digits:      otp.DigitsSix,
 		Algorithm:   otp.AlgorithmSHA1,
 	})
@@ -45,59 +103,64 @@ func (s *MFAService) GenerateSecret(accountName string) (*MFASetupResult, error)
 	}, nil
 }
 
-// ValidateCode validates a TOTP code against a secret
+// ValidateCode validates a TOTP code against a secret for the current time step only
 func (s *MFAService) ValidateCode(secret, code string) (bool, error) {
-	// Normalize the secret (remove spaces, convert to uppercase)
-	secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(
-		[]byte(secret),
-	)
-
-	valid := totp.Validate(code, secret)
-	return valid, nil
+	return s.ValidateCodeWithWindow(secret, code, 0)
 }
 
 // ValidateCodeWithWindow validates a TOTP code with a time window
 // This allows for clock skew between client and server
 func (s *MFAService) ValidateCodeWithWindow(secret, code string, window int) (bool, error) {
-	// Normalize the secret
-	secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(
-		[]byte(secret),
-	)
+	_, ok, err := s.matchStep(secret, code, window)
+	return ok, err
+}
 
-	// Try current time and surrounding windows
-	for i := -window; i <= window; i++ {
-		valid, err := totp.ValidateCustom(
-			code,
-			secret,
-			totp.ValidateOpts{
-				Period:    30,
-				Skew:      uint(i),
-				Digits:    otp.DigitsSix,
-				Algorithm: otp.AlgorithmSHA1,
-			},
-		)
-		if err != nil {
-			return false, fmt.Errorf("failed to validate TOTP code: %w", err)
-		}
-		if valid {
-			return true, nil
+// VerifyCode validates a user's TOTP code within the configured skew and records
+// the matched time step, so a code cannot be used twice
+func (s *MFAService) VerifyCode(ctx context.Context, userID int64, secret, code string) (bool, error) {
+	step, ok, err := s.matchStep(secret, code, s.skew)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if s.steps != nil {
+		if err := s.steps.UpdateMFALastUsedStep(ctx, userID, step); err != nil {
+			if errors.Is(err, domain.ErrMFACodeReplayed) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to record TOTP step: %w", err)
 		}
 	}
 
-	return false, nil
+	return true, nil
 }
 
-// GenerateBackupCodes generates backup codes for MFA recovery
-func (s *MFAService) GenerateBackupCodes(count int) ([]string, error) {
-	// This is a simplified implementation
-	// In production, you'd want to use a cryptographically secure random generator
-	codes := make([]string, count)
-	for i := 0; i < count; i++ {
-		code, err := totp.GenerateCode(fmt.Sprintf("backup-%d", i), totp.Now())
+// matchStep returns the time step within ±window steps of now whose code matches.
+// The secret is the base32 string provisioned by GenerateSecret.
+func (s *MFAService) matchStep(secret, code string, window int) (int64, bool, error) {
+	if len(code) != otp.DigitsSix.Length() {
+		return 0, false, nil
+	}
+
+	current := s.now().Unix() / TOTPPeriod
+	for i := -window; i <= window; i++ {
+		step := current + int64(i)
+		if step < 0 {
+			continue
+		}
+
+		expected, err := hotp.GenerateCodeCustom(secret, uint64(step), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate backup code: %w", err)
+			return 0, false, fmt.Errorf("failed to validate TOTP code: %w", err)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
 		}
-		codes[i] = code
 	}
-	return codes, nil
+
+	return 0, false, nil
 }
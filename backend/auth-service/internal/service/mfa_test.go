@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func newTestMFAService(now *time.Time) (*MFAService, *memoryStepRecorder) {
+	steps := &memoryStepRecorder{steps: make(map[int64]int64)}
+	svc := NewMFAService(MFAConfig{
+		Issuer: "Hosterizer",
+		Steps:  steps,
+		Now:    func() time.Time { return *now },
+	})
+	return svc, steps
+}
+
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(testTOTPSecret, at, totp.ValidateOpts{
+		Period:    TOTPPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+	return code
+}
+
+func TestVerifyCodeAcceptsSkew(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	svc, _ := newTestMFAService(&now)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		valid  bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -TOTPPeriod * time.Second, true},
+		{"next step", TOTPPeriod * time.Second, true},
+		{"two steps behind", -2 * TOTPPeriod * time.Second, false},
+		{"two steps ahead", 2 * TOTPPeriod * time.Second, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A different user per case so replay protection does not interfere
+			valid, err := svc.VerifyCode(context.Background(), int64(i+1), testTOTPSecret, codeAt(t, now.Add(tt.offset)))
+			if err != nil {
+				t.Fatalf("VerifyCode returned error: %v", err)
+			}
+			if valid != tt.valid {
+				t.Errorf("VerifyCode = %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestVerifyCodeWithoutSkew(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	skew := 0
+	svc := NewMFAService(MFAConfig{
+		Issuer: "Hosterizer",
+		Skew:   &skew,
+		Steps:  &memoryStepRecorder{steps: make(map[int64]int64)},
+		Now:    func() time.Time { return now },
+	})
+
+	for i, offset := range []time.Duration{-TOTPPeriod * time.Second, TOTPPeriod * time.Second} {
+		valid, err := svc.VerifyCode(context.Background(), int64(i+1), testTOTPSecret, codeAt(t, now.Add(offset)))
+		if err != nil || valid {
+			t.Fatalf("code %v off: %v, %v; want it rejected", offset, valid, err)
+		}
+	}
+	if valid, err := svc.VerifyCode(context.Background(), 3, testTOTPSecret, codeAt(t, now)); err != nil || !valid {
+		t.Fatalf("current code: %v, %v", valid, err)
+	}
+}
+
+func TestVerifyCodeRejectsReplay(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	svc, _ := newTestMFAService(&now)
+	ctx := context.Background()
+	code := codeAt(t, now)
+
+	if valid, err := svc.VerifyCode(ctx, 1, testTOTPSecret, code); err != nil || !valid {
+		t.Fatalf("first use: got (%v, %v), want (true, nil)", valid, err)
+	}
+
+	if valid, err := svc.VerifyCode(ctx, 1, testTOTPSecret, code); err != nil || valid {
+		t.Fatalf("replay: got (%v, %v), want (false, nil)", valid, err)
+	}
+
+	// The code stays inside the skew window one step later but must still be rejected
+	now = now.Add(TOTPPeriod * time.Second)
+	if valid, err := svc.VerifyCode(ctx, 1, testTOTPSecret, code); err != nil || valid {
+		t.Fatalf("replay in next step: got (%v, %v), want (false, nil)", valid, err)
+	}
+
+	if valid, err := svc.VerifyCode(ctx, 1, testTOTPSecret, codeAt(t, now)); err != nil || !valid {
+		t.Fatalf("new code: got (%v, %v), want (true, nil)", valid, err)
+	}
+}
+
+func TestVerifyCodeRejectsOlderStepAfterNewer(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	svc, _ := newTestMFAService(&now)
+	ctx := context.Background()
+
+	if valid, err := svc.VerifyCode(ctx, 1, testTOTPSecret, codeAt(t, now)); err != nil || !valid {
+		t.Fatalf("current code: got (%v, %v), want (true, nil)", valid, err)
+	}
+
+	previous := codeAt(t, now.Add(-TOTPPeriod*time.Second))
+	if valid, err := svc.VerifyCode(ctx, 1, testTOTPSecret, previous); err != nil || valid {
+		t.Fatalf("older code: got (%v, %v), want (false, nil)", valid, err)
+	}
+}
+
+func TestValidateCodeUsesProvisionedSecret(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	svc, _ := newTestMFAService(&now)
+
+	setup, err := svc.GenerateSecret("user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+
+	code, err := totp.GenerateCode(setup.Secret, now)
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+
+	valid, err := svc.ValidateCode(setup.Secret, code)
+	if err != nil {
+		t.Fatalf("ValidateCode returned error: %v", err)
+	}
+	if !valid {
+		t.Error("ValidateCode rejected a code generated from the provisioned secret")
+	}
+}
+
+func TestValidateCodeRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	svc, _ := newTestMFAService(&now)
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		valid, err := svc.ValidateCodeWithWindow(testTOTPSecret, code, 1)
+		if err != nil {
+			t.Fatalf("ValidateCodeWithWindow(%q) returned error: %v", code, err)
+		}
+		if valid {
+			t.Errorf("ValidateCodeWithWindow(%q) = true, want false", code)
+		}
+	}
+}
+
+// mfaChallenge logs jane in with her password and returns the MFA token of the challenge
+func mfaChallenge(t *testing.T, f *fixture) string {
+	t.Helper()
+	resp, err := f.auth.Login(context.Background(), LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !resp.RequiresMFA || resp.MFAToken == "" || resp.AccessToken != "" || resp.RefreshToken != "" {
+		t.Fatalf("expected only an MFA challenge: %+v", resp)
+	}
+	return resp.MFAToken
+}
+
+func TestMFAChallengeCompletesLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleAdministrator)
+	jane.MFAEnabled = true
+	jane.MFASecret = testTOTPSecret
+
+	mfaToken := mfaChallenge(t, f)
+
+	// The MFA token is no access token
+	if _, err := f.jwt.ValidateAccessToken(ctx, mfaToken); err == nil {
+		t.Fatal("MFA token accepted as an access token")
+	}
+
+	resp, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: mfaToken, MFACode: codeAt(t, time.Now())})
+	if err != nil {
+		t.Fatalf("CompleteMFAChallenge: %v", err)
+	}
+	claims, err := f.jwt.ValidateAccessToken(ctx, resp.AccessToken)
+	if err != nil || claims.UserID != jane.ID {
+		t.Fatalf("access token: %+v, %v", claims, err)
+	}
+
+	// The MFA token is single-use, even with a code that was not used yet
+	next := codeAt(t, time.Now().Add(TOTPPeriod*time.Second))
+	if _, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: mfaToken, MFACode: next}); err == nil {
+		t.Fatal("MFA token accepted twice")
+	}
+
+	// Access tokens cannot stand in for MFA tokens
+	if _, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: resp.AccessToken, MFACode: next}); err == nil {
+		t.Fatal("access token accepted as an MFA token")
+	}
+}
+
+func TestMFAChallengeLocksAccountAfterWrongCodes(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleAdministrator)
+	jane.MFAEnabled = true
+	jane.MFASecret = testTOTPSecret
+	jane.FailedLoginAttempts = 3
+
+	mfaToken := mfaChallenge(t, f)
+	for i := 0; i < MaxMFAAttempts; i++ {
+		_, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: mfaToken, MFACode: "000000"})
+		if !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: got %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+
+	// The lock leaves the failed attempt count alone
+	if !jane.IsLocked() {
+		t.Fatal("account not locked after the challenge ran out of attempts")
+	}
+	if jane.FailedLoginAttempts != 3 {
+		t.Fatalf("failed attempts = %d, want 3", jane.FailedLoginAttempts)
+	}
+
+	// The exhausted challenge cannot be completed, and new logins are refused
+	if _, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: mfaToken, MFACode: codeAt(t, time.Now())}); err == nil {
+		t.Fatal("exhausted MFA token accepted")
+	}
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"}); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Login while locked: got %v, want ErrAccountLocked", err)
+	}
+
+	var locked int
+	for _, event := range f.events.Events() {
+		if event.Type == AuditEventAccountLocked {
+			locked++
+		}
+	}
+	if locked != 1 {
+		t.Fatalf("recorded %d lockouts, want 1", locked)
+	}
+}
@@ -1,30 +1,29 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"unicode"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/hosterizer/auth-service/internal/domain"
 )
 
 const (
 	// MinPasswordLength is the minimum required password length
 	MinPasswordLength = 8
 
-	// MaxPasswordLength is the maximum allowed password length
-	MaxPasswordLength = 72 // bcrypt limitation
-
-	// BcryptCost is the cost factor for bcrypt hashing
-	BcryptCost = 12
+	// MaxPasswordLength is the maximum allowed password length, which bounds the
+	// work spent hashing and checking a password
+	MaxPasswordLength = 256
 )
 
 var (
 	// ErrPasswordTooShort is returned when password is too short
-	ErrPasswordTooShort = errors.New("password must be at least 8 characters long")
+	ErrPasswordTooShort = errors.New("password is too short")
 
 	// ErrPasswordTooLong is returned when password is too long
-	ErrPasswordTooLong = errors.New("password must not exceed 72 characters")
+	ErrPasswordTooLong = errors.New("password must not exceed 256 characters")
 
 	// ErrPasswordNoUppercase is returned when password has no uppercase letter
 	ErrPasswordNoUppercase = errors.New("password must contain at least one uppercase letter")
@@ -40,46 +39,153 @@ var (
 )
 
 // PasswordService handles password hashing and validation
-type PasswordService struct{}
+type PasswordService struct {
+	rules    PasswordRules
+	policies []PasswordPolicy
+	argon2   Argon2Params
+}
+
+// PasswordConfig holds password policy configuration
+type PasswordConfig struct {
+	// MinLength is the minimum password length; it cannot be lower than MinPasswordLength
+	MinLength int
+
+	// MinScore is the minimum strength score from 1 to 4
+	MinScore int
+
+	// AllowBreached and AllowSimilar turn off the breached password and the
+	// email and name similarity checks, unless a customer's overrides turn them on
+	AllowBreached bool
+	AllowSimilar  bool
+
+	// BreachCorpus is where breached passwords are looked up; without a corpus
+	// breached passwords are not rejected
+	BreachCorpus BreachCorpus
+
+	// Policies replaces the default policy chain
+	Policies []PasswordPolicy
+
+	// Argon2 holds the cost parameters of new hashes. Stored hashes with lower
+	// parameters are upgraded at the next login.
+	Argon2 Argon2Params
+}
 
 // NewPasswordService creates a new password service
-func NewPasswordService() *PasswordService {
-	return &PasswordService{}
+func NewPasswordService(config PasswordConfig) *PasswordService {
+	minLength := max(config.MinLength, MinPasswordLength)
+
+	minScore := config.MinScore
+	if minScore == 0 {
+		minScore = DefaultPasswordMinScore
+	}
+
+	policies := config.Policies
+	if policies == nil {
+		policies = DefaultPasswordPolicies(config.BreachCorpus)
+	}
+
+	argon2Params := config.Argon2
+	if argon2Params.Memory == 0 {
+		argon2Params.Memory = DefaultArgon2Memory
+	}
+	if argon2Params.Iterations == 0 {
+		argon2Params.Iterations = DefaultArgon2Iterations
+	}
+	if argon2Params.Parallelism == 0 {
+		argon2Params.Parallelism = DefaultArgon2Parallelism
+	}
+
+	return &PasswordService{
+		rules: PasswordRules{
+			MinLength:      minLength,
+			MinScore:       min(minScore, MaxPasswordScore),
+			RejectBreached: !config.AllowBreached,
+			RejectSimilar:  !config.AllowSimilar,
+		},
+		policies: policies,
+		argon2:   argon2Params,
+	}
+}
+
+// Rules returns the platform password rules, before customer overrides
+func (s *PasswordService) Rules() PasswordRules {
+	return s.rules
+}
+
+// CheckPassword runs a new password of a user through the policy chain. The
+// customer overrides of every tenant the user belongs to tighten the rules.
+func (s *PasswordService) CheckPassword(ctx context.Context, password string, user *domain.User, overrides ...*domain.PasswordPolicyOverrides) error {
+	rules := s.rules
+	for _, o := range overrides {
+		rules = rules.Tighten(o)
+	}
+
+	check := &PasswordCheck{
+		Password:  password,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Rules:     rules,
+	}
+
+	for _, policy := range s.policies {
+		if err := policy.Check(ctx, check); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// HashPassword hashes a password using bcrypt
+// HashPassword hashes a password using Argon2id
 func (s *PasswordService) HashPassword(password string) (string, error) {
 	if err := s.ValidatePasswordStrength(password); err != nil {
 		return "", err
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %w", err)
-	}
+	return hashArgon2id(password, s.argon2)
+}
 
-	return string(hash), nil
+// RehashPassword hashes a password that was just verified against an outdated
+// hash. The strength rules are not checked again, so users whose password
+// predates them can still log in.
+func (s *PasswordService) RehashPassword(password string) (string, error) {
+	return hashArgon2id(password, s.argon2)
 }
 
-// ComparePassword compares a password with a hash
+// ComparePassword compares a password with a hash. Argon2id and legacy bcrypt
+// hashes are supported.
 func (s *PasswordService) ComparePassword(hashedPassword, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return verifyPasswordHash(hashedPassword, password)
+}
+
+// NeedsRehash reports whether a hash uses an outdated algorithm or lower cost
+// parameters than new hashes
+func (s *PasswordService) NeedsRehash(hashedPassword string) bool {
+	hash, err := parseArgon2id(hashedPassword)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return errors.New("invalid password")
-		}
-		return fmt.Errorf("failed to compare password: %w", err)
+		return true
 	}
-	return nil
+	return hash.params.weakerThan(s.argon2) || len(hash.key) < argon2KeyLength
 }
 
-// ValidatePasswordStrength validates password strength requirements
+// ValidatePasswordStrength validates the basic length and character class
+// requirements. Use CheckPassword for the full policy chain.
 func (s *PasswordService) ValidatePasswordStrength(password string) error {
+	return validateCharacters(password, MinPasswordLength)
+}
+
+// IsPasswordValid checks if a password meets strength requirements without returning specific errors
+func (s *PasswordService) IsPasswordValid(password string) bool {
+	return s.ValidatePasswordStrength(password) == nil
+}
+
+func validateCharacters(password string, minLength int) error {
 	// Check length
-	if len(password) < MinPasswordLength {
-		return ErrPasswordTooShort
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrPasswordTooShort, minLength)
 	}
-	if len(password) > MaxPasswordLength {
+	if len([]rune(password)) > MaxPasswordLength {
 		return ErrPasswordTooLong
 	}
 
@@ -119,8 +225,3 @@ func (s *PasswordService) ValidatePasswordStrength(password string) error {
 
 	return nil
 }
-
-// IsPasswordValid checks if a password meets strength requirements without returning specific errors
-func (s *PasswordService) IsPasswordValid(password string) bool {
-	return s.ValidatePasswordStrength(password) == nil
-}
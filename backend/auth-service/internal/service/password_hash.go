@@ -0,0 +1,157 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are stored in a self-describing, versioned format, so the
+// algorithm and its parameters can change without invalidating stored hashes:
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>   new hashes (PHC string format)
+//	$2a$12$<salt and hash>                         legacy bcrypt hashes
+const (
+	// DefaultArgon2Memory is the Argon2id memory cost in KiB (64 MiB)
+	DefaultArgon2Memory = 64 * 1024
+
+	// DefaultArgon2Iterations is the Argon2id time cost
+	DefaultArgon2Iterations = 3
+
+	// DefaultArgon2Parallelism is the number of Argon2id lanes
+	DefaultArgon2Parallelism = 4
+
+	// argon2SaltLength is the length of the random salt of a hash in bytes
+	argon2SaltLength = 16
+
+	// argon2KeyLength is the length of the derived key in bytes
+	argon2KeyLength = 32
+
+	// bcryptMaxPasswordLength is the number of bytes bcrypt looks at; the rest of
+	// a longer password is ignored
+	bcryptMaxPasswordLength = 72
+)
+
+var (
+	// ErrPasswordMismatch is returned when a password does not match a hash
+	ErrPasswordMismatch = errors.New("invalid password")
+
+	// ErrUnsupportedPasswordHash is returned when a stored hash has an unknown format
+	ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+)
+
+// Argon2Params are the Argon2id cost parameters
+type Argon2Params struct {
+	// Memory is the memory cost in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// weakerThan reports whether any parameter is lower than in other
+func (p Argon2Params) weakerThan(other Argon2Params) bool {
+	return p.Memory < other.Memory || p.Iterations < other.Iterations || p.Parallelism < other.Parallelism
+}
+
+// argon2Hash is a decoded Argon2id hash
+type argon2Hash struct {
+	params Argon2Params
+	salt   []byte
+	key    []byte
+}
+
+// hashArgon2id hashes a password with Argon2id and a random salt
+func hashArgon2id(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// parseArgon2id decodes a hash in the PHC string format
+func parseArgon2id(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, ErrUnsupportedPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w: argon2 version %q", ErrUnsupportedPasswordHash, parts[2])
+	}
+
+	hash := &argon2Hash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.params.Memory, &hash.params.Iterations, &hash.params.Parallelism); err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2 parameters", ErrUnsupportedPasswordHash)
+	}
+	if hash.params.Iterations == 0 || hash.params.Parallelism == 0 {
+		return nil, fmt.Errorf("%w: malformed argon2 parameters", ErrUnsupportedPasswordHash)
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2 salt", ErrUnsupportedPasswordHash)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, fmt.Errorf("%w: malformed argon2 key", ErrUnsupportedPasswordHash)
+	}
+
+	return hash, nil
+}
+
+// isBcryptHash reports whether a stored hash is a legacy bcrypt hash
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// verifyPasswordHash compares a password with a stored hash of any supported format
+func verifyPasswordHash(encoded, password string) error {
+	if isBcryptHash(encoded) {
+		// bcrypt ignores everything after 72 bytes, so a longer password could
+		// never have been the one that was hashed
+		if len(password) > bcryptMaxPasswordLength {
+			return ErrPasswordMismatch
+		}
+
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrPasswordMismatch
+			}
+			return fmt.Errorf("failed to compare password: %w", err)
+		}
+		return nil
+	}
+
+	hash, err := parseArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), hash.salt, hash.params.Iterations, hash.params.Memory, hash.params.Parallelism, uint32(len(hash.key)))
+	if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// DefaultPasswordMinScore is the minimum strength score, from 0 to 4, a
+	// password needs by default
+	DefaultPasswordMinScore = 3
+)
+
+var (
+	// ErrPasswordBreached is returned when a password appears in a breach corpus
+	ErrPasswordBreached = errors.New("password has appeared in a data breach")
+
+	// ErrPasswordTooSimilar is returned when a password contains the user's email address or name
+	ErrPasswordTooSimilar = errors.New("password must not contain your email address or name")
+
+	// ErrPasswordTooWeak is returned when a password is too easy to guess
+	ErrPasswordTooWeak = errors.New("password is too easy to guess")
+)
+
+// PasswordRules are the requirements a password is checked against
+type PasswordRules struct {
+	MinLength      int
+	MinScore       int
+	RejectBreached bool
+	RejectSimilar  bool
+}
+
+// Tighten returns the rules made stricter by a customer's overrides. Overrides
+// cannot loosen the rules.
+func (r PasswordRules) Tighten(overrides *domain.PasswordPolicyOverrides) PasswordRules {
+	if overrides == nil {
+		return r
+	}
+
+	if overrides.MinLength != nil && *overrides.MinLength > r.MinLength {
+		r.MinLength = min(*overrides.MinLength, MaxPasswordLength)
+	}
+	if overrides.MinScore != nil && *overrides.MinScore > r.MinScore {
+		r.MinScore = min(*overrides.MinScore, MaxPasswordScore)
+	}
+	if overrides.RejectBreached != nil && *overrides.RejectBreached {
+		r.RejectBreached = true
+	}
+	if overrides.RejectSimilar != nil && *overrides.RejectSimilar {
+		r.RejectSimilar = true
+	}
+
+	return r
+}
+
+// PasswordCheck is a password being set for a user, with the rules that apply
+type PasswordCheck struct {
+	Password  string
+	Email     string
+	FirstName string
+	LastName  string
+	Rules     PasswordRules
+}
+
+// userInputs returns the user details an attacker is assumed to know
+func (c *PasswordCheck) userInputs() []string {
+	return []string{c.Email, c.FirstName, c.LastName}
+}
+
+// PasswordPolicy is one check of the password policy chain
+type PasswordPolicy interface {
+	// Check returns an error if the password does not satisfy the policy
+	Check(ctx context.Context, check *PasswordCheck) error
+}
+
+// DefaultPasswordPolicies returns the built-in policy chain. The breach check is
+// left out when no corpus is given.
+func DefaultPasswordPolicies(corpus BreachCorpus) []PasswordPolicy {
+	policies := []PasswordPolicy{
+		CharacterPolicy{},
+		SimilarityPolicy{},
+		StrengthPolicy{},
+	}
+	if corpus != nil {
+		policies = append(policies, BreachPolicy{Corpus: corpus})
+	}
+	return policies
+}
+
+// CharacterPolicy requires a minimum length and upper and lower case letters,
+// digits and special characters
+type CharacterPolicy struct{}
+
+// Check validates the length and character classes of the password
+func (CharacterPolicy) Check(ctx context.Context, check *PasswordCheck) error {
+	return validateCharacters(check.Password, check.Rules.MinLength)
+}
+
+// SimilarityPolicy rejects passwords that contain the user's email address or
+// name, also when spelled with leet substitutions
+type SimilarityPolicy struct{}
+
+// Check looks for the parts of the user's email address and name in the password
+func (SimilarityPolicy) Check(ctx context.Context, check *PasswordCheck) error {
+	if !check.Rules.RejectSimilar {
+		return nil
+	}
+
+	password := strings.ToLower(check.Password)
+	candidates := []string{password}
+	for _, variant := range unleetVariants([]rune(password)) {
+		candidates = append(candidates, string(variant.runes))
+	}
+
+	for _, token := range similarityTokens(check) {
+		for _, candidate := range candidates {
+			if strings.Contains(candidate, token) {
+				return ErrPasswordTooSimilar
+			}
+		}
+	}
+
+	return nil
+}
+
+// similarityTokens returns the words of three or more characters of the user's
+// email address and name. Of the email domain only the first label is used, so
+// "example" of "example.com".
+func similarityTokens(check *PasswordCheck) []string {
+	local, domainName, _ := strings.Cut(check.Email, "@")
+	domainLabel, _, _ := strings.Cut(domainName, ".")
+
+	var tokens []string
+	for _, input := range []string{local, domainLabel, check.FirstName, check.LastName} {
+		tokens = append(tokens, splitWords(input)...)
+	}
+	return tokens
+}
+
+// StrengthPolicy requires a minimum zxcvbn-style strength score
+type StrengthPolicy struct{}
+
+// Check estimates the password strength, treating the user's details as known
+func (StrengthPolicy) Check(ctx context.Context, check *PasswordCheck) error {
+	if check.Rules.MinScore <= 0 {
+		return nil
+	}
+
+	if PasswordScore(check.Password, check.userInputs()...) < check.Rules.MinScore {
+		return ErrPasswordTooWeak
+	}
+
+	return nil
+}
+
+// BreachPolicy rejects passwords that appear in a breach corpus
+type BreachPolicy struct {
+	Corpus BreachCorpus
+}
+
+// Check looks the password up in the breach corpus
+func (p BreachPolicy) Check(ctx context.Context, check *PasswordCheck) error {
+	if !check.Rules.RejectBreached {
+		return nil
+	}
+
+	count, err := BreachCount(ctx, p.Corpus, check.Password)
+	if err != nil {
+		return fmt.Errorf("failed to check breached passwords: %w", err)
+	}
+	if count > 0 {
+		return ErrPasswordBreached
+	}
+
+	return nil
+}
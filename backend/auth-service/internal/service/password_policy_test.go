@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+var policyUser = &domain.User{
+	Email:     "jane.doe@example.com",
+	FirstName: "Jane",
+	LastName:  "Doe",
+}
+
+func TestPasswordScore(t *testing.T) {
+	weak := []string{"password", "Password1!", "P@ssw0rd", "drowssap", "abcdef123456", "aaaaaaaaaaaa", "Summer2024!"}
+	for _, password := range weak {
+		if score := PasswordScore(password); score >= DefaultPasswordMinScore {
+			t.Errorf("PasswordScore(%q) = %d, want below %d", password, score, DefaultPasswordMinScore)
+		}
+	}
+
+	strong := []string{"kT9#vLq2!mZx", "correct-horse-battery-staple"}
+	for _, password := range strong {
+		if score := PasswordScore(password); score != MaxPasswordScore {
+			t.Errorf("PasswordScore(%q) = %d, want %d", password, score, MaxPasswordScore)
+		}
+	}
+}
+
+func TestPasswordScoreTreatsUserInputsAsKnown(t *testing.T) {
+	password := "Hosterpilot+Marguerite"
+	without := PasswordScore(password)
+	with := PasswordScore(password, "hosterpilot@example.com", "Marguerite")
+	if with >= without {
+		t.Fatalf("score with user inputs = %d, without = %d; want lower", with, without)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	ctx := context.Background()
+	corpus := NewMemoryBreachCorpus()
+	corpus.AddPassword("Vt7#Lq9!pWz3", 42)
+	svc := NewPasswordService(PasswordConfig{BreachCorpus: corpus})
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{name: "strong", password: "kT9#vLq2!mZx"},
+		{name: "short", password: "kT9#vL", want: ErrPasswordTooShort},
+		{name: "character classes", password: "kt9#vlq2!mzx", want: ErrPasswordNoUppercase},
+		{name: "common", password: "Password1!", want: ErrPasswordTooWeak},
+		{name: "email", password: "xQ7!Jane.Doe#4", want: ErrPasswordTooSimilar},
+		{name: "leet name", password: "xQ7!D0e-hWk#4", want: ErrPasswordTooSimilar},
+		{name: "email domain", password: "Ex4mple!rW9#k", want: ErrPasswordTooSimilar},
+		{name: "breached", password: "Vt7#Lq9!pWz3", want: ErrPasswordBreached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.CheckPassword(ctx, tt.password, policyUser)
+			if tt.want == nil && err != nil {
+				t.Fatalf("CheckPassword: %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordOverridesOnlyTighten(t *testing.T) {
+	ctx := context.Background()
+	corpus := NewMemoryBreachCorpus()
+	corpus.AddPassword("Vt7#Lq9!pWz3", 1)
+	svc := NewPasswordService(PasswordConfig{
+		MinScore:      2,
+		AllowBreached: true,
+		AllowSimilar:  true,
+		BreachCorpus:  corpus,
+	})
+
+	minLength, minScore, reject, allow := 4, 4, true, false
+	loose := &domain.PasswordPolicyOverrides{MinLength: &minLength, RejectBreached: &allow, RejectSimilar: &allow}
+
+	// Overrides cannot lower the platform minimum length
+	if err := svc.CheckPassword(ctx, "kT9#vL", policyUser, loose); !errors.Is(err, ErrPasswordTooShort) {
+		t.Fatalf("short password: got %v, want ErrPasswordTooShort", err)
+	}
+	if err := svc.CheckPassword(ctx, "Vt7#Lq9!pWz3", policyUser, loose); err != nil {
+		t.Fatalf("breached password with the check turned off: %v", err)
+	}
+	if err := svc.CheckPassword(ctx, "Summer2024!", policyUser, loose); err != nil {
+		t.Fatalf("password meeting the platform score: %v", err)
+	}
+
+	strict := &domain.PasswordPolicyOverrides{MinScore: &minScore, RejectBreached: &reject, RejectSimilar: &reject}
+	if err := svc.CheckPassword(ctx, "Vt7#Lq9!pWz3", policyUser, loose, strict); !errors.Is(err, ErrPasswordBreached) {
+		t.Fatalf("breached password: got %v, want ErrPasswordBreached", err)
+	}
+	if err := svc.CheckPassword(ctx, "xQ7!Jane.Doe#4", policyUser, strict); !errors.Is(err, ErrPasswordTooSimilar) {
+		t.Fatalf("similar password: got %v, want ErrPasswordTooSimilar", err)
+	}
+	if err := svc.CheckPassword(ctx, "Summer2024!", policyUser, strict); !errors.Is(err, ErrPasswordTooWeak) {
+		t.Fatalf("weak password: got %v, want ErrPasswordTooWeak", err)
+	}
+}
+
+func TestOpenBreachCorpus(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	file := filepath.Join(dir, "breached.txt")
+	content := "# breached passwords\n5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:3861493\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := filepath.Join(dir, "ranges")
+	if err := os.Mkdir(ranges, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ranges, "5BAA6.txt"), []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, ranges} {
+		corpus, err := OpenBreachCorpus(path)
+		if err != nil {
+			t.Fatalf("OpenBreachCorpus(%s): %v", path, err)
+		}
+
+		if count, err := BreachCount(ctx, corpus, "password"); err != nil || count != 3861493 {
+			t.Fatalf("%s: BreachCount(password) = %d, %v; want 3861493", path, count, err)
+		}
+		if count, err := BreachCount(ctx, corpus, "kT9#vLq2!mZx"); err != nil || count != 0 {
+			t.Fatalf("%s: BreachCount(unbreached) = %d, %v; want 0", path, count, err)
+		}
+	}
+
+	malformed := filepath.Join(dir, "malformed.txt")
+	if err := os.WriteFile(malformed, []byte("not-a-hash:1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBreachCorpus(malformed); !errors.Is(err, ErrInvalidBreachCorpus) {
+		t.Fatalf("malformed corpus: got %v, want ErrInvalidBreachCorpus", err)
+	}
+}
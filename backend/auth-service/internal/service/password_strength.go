@@ -0,0 +1,433 @@
+package service
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The password strength estimator follows the approach of zxcvbn: a password is
+// split into the sequence of patterns (dictionary words, sequences, repeats,
+// years and brute-forced characters) that needs the fewest guesses to crack,
+// and the estimated number of guesses is mapped to a score from 0 to 4.
+
+const (
+	// MaxPasswordScore is the score of a very hard to guess password
+	MaxPasswordScore = 4
+
+	// maxEstimatedLength caps the part of a password the estimator looks at;
+	// longer passwords are strong enough either way
+	maxEstimatedLength = 100
+
+	// bruteforceCardinality is the number of guesses per brute-forced character
+	bruteforceCardinality = 10
+
+	// minSubmatchGuesses is the minimum number of guesses for a pattern that
+	// covers only part of the password
+	minSubmatchGuesses = 50
+
+	// minYearSpace is the minimum number of years an attacker tries around now
+	minYearSpace = 20
+
+	// patternSequencePenalty accounts for the attacker not knowing how many
+	// patterns a password is made of
+	patternSequencePenalty = 10000
+)
+
+//go:embed data/common_passwords.txt
+var commonPasswordsData string
+
+// commonPasswords ranks common passwords and words by frequency
+var commonPasswords = loadRankedWords(commonPasswordsData)
+
+// leetSubstitutions maps common character substitutions back to letters
+var leetSubstitutions = map[rune][]rune{
+	'0': {'o'},
+	'1': {'i', 'l'},
+	'3': {'e'},
+	'4': {'a'},
+	'5': {'s'},
+	'7': {'t'},
+	'8': {'b'},
+	'@': {'a'},
+	'$': {'s'},
+	'!': {'i'},
+	'|': {'i', 'l'},
+	'+': {'t'},
+}
+
+// scoreThresholds are the guess counts below which a password gets score 0 to 3
+var scoreThresholds = []float64{1e3 + 5, 1e6 + 5, 1e8 + 5, 1e10 + 5}
+
+// PasswordScore estimates how hard a password is to guess, from 0 (too
+// guessable) to 4 (very unguessable). Words from userInputs, such as the user's
+// name and email address, are treated as known to the attacker.
+func PasswordScore(password string, userInputs ...string) int {
+	guesses := EstimatePasswordGuesses(password, userInputs...)
+	for score, threshold := range scoreThresholds {
+		if guesses < threshold {
+			return score
+		}
+	}
+	return MaxPasswordScore
+}
+
+// EstimatePasswordGuesses estimates the number of guesses needed to find a password
+func EstimatePasswordGuesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) > maxEstimatedLength {
+		runes = runes[:maxEstimatedLength]
+	}
+	if len(runes) == 0 {
+		return 1
+	}
+
+	dictionary := commonPasswords
+	if len(userInputs) > 0 {
+		dictionary = commonPasswords.with(userInputs)
+	}
+
+	return minimumGuesses(runes, findPatterns(runes, dictionary))
+}
+
+// passwordPattern is a part of a password matched by a known pattern
+type passwordPattern struct {
+	i, j    int // first and last rune index
+	guesses float64
+}
+
+// rankedWords maps words to their frequency rank, 1 being the most common
+type rankedWords struct {
+	ranks     map[string]int
+	maxLength int
+}
+
+// with returns a copy of the words extended with the words of user inputs,
+// which are ranked first
+func (w *rankedWords) with(userInputs []string) *rankedWords {
+	extended := &rankedWords{
+		ranks:     make(map[string]int, len(w.ranks)+len(userInputs)),
+		maxLength: w.maxLength,
+	}
+	for word, rank := range w.ranks {
+		extended.ranks[word] = rank
+	}
+	for _, input := range userInputs {
+		for _, word := range splitWords(input) {
+			extended.add(word, 1)
+		}
+	}
+	return extended
+}
+
+func (w *rankedWords) add(word string, rank int) {
+	if existing, ok := w.ranks[word]; ok && existing <= rank {
+		return
+	}
+	w.ranks[word] = rank
+	w.maxLength = max(w.maxLength, len([]rune(word)))
+}
+
+// findPatterns returns every pattern found in a password
+func findPatterns(runes []rune, dictionary *rankedWords) []passwordPattern {
+	var patterns []passwordPattern
+	patterns = append(patterns, dictionaryPatterns(runes, dictionary)...)
+	patterns = append(patterns, sequencePatterns(runes)...)
+	patterns = append(patterns, repeatPatterns(runes, dictionary)...)
+	patterns = append(patterns, yearPatterns(runes)...)
+	return patterns
+}
+
+// minimumGuesses finds the sequence of patterns covering the whole password that
+// needs the fewest guesses. Characters not covered by a pattern are brute-forced.
+// A sequence of l patterns needs l! * product(guesses) + penalty^(l-1) guesses.
+func minimumGuesses(runes []rune, patterns []passwordPattern) float64 {
+	n := len(runes)
+
+	byEnd := make([][]passwordPattern, n)
+	for _, p := range patterns {
+		byEnd[p.j] = append(byEnd[p.j], p)
+	}
+	for j := 0; j < n; j++ {
+		for i := 0; i <= j; i++ {
+			byEnd[j] = append(byEnd[j], passwordPattern{i: i, j: j, guesses: bruteforceGuesses(j - i + 1)})
+		}
+	}
+
+	// best[k][l] is the smallest product of guesses for the first k runes made of l patterns
+	best := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for l := range best[k] {
+			best[k][l] = math.Inf(1)
+		}
+	}
+	best[0][0] = 1
+
+	for j := 0; j < n; j++ {
+		for _, p := range byEnd[j] {
+			guesses := p.guesses
+			if p.j-p.i+1 < n {
+				guesses = math.Max(guesses, minSubmatchGuesses)
+			}
+			for l := 0; l < n; l++ {
+				if product := best[p.i][l] * guesses; product < best[j+1][l+1] {
+					best[j+1][l+1] = product
+				}
+			}
+		}
+	}
+
+	minimum := math.Inf(1)
+	factorial := 1.0
+	for l := 1; l <= n; l++ {
+		factorial *= float64(l)
+		total := factorial*best[n][l] + math.Pow(patternSequencePenalty, float64(l-1))
+		minimum = math.Min(minimum, total)
+	}
+	return minimum
+}
+
+func bruteforceGuesses(length int) float64 {
+	return math.Pow(bruteforceCardinality, float64(length))
+}
+
+// dictionaryPatterns finds dictionary words, also when spelled backwards or with
+// leet substitutions
+func dictionaryPatterns(runes []rune, dictionary *rankedWords) []passwordPattern {
+	var patterns []passwordPattern
+	for i := range runes {
+		for j := i + 2; j < len(runes) && j-i < dictionary.maxLength; j++ {
+			token := runes[i : j+1]
+			guesses := math.Inf(1)
+
+			for _, candidate := range unleetVariants(token) {
+				word := strings.ToLower(string(candidate.runes))
+				extra := 1.0
+				if candidate.substituted {
+					extra = 2
+				}
+
+				if rank, ok := dictionary.ranks[word]; ok {
+					guesses = math.Min(guesses, float64(rank)*extra)
+				}
+				if rank, ok := dictionary.ranks[reverse(word)]; ok {
+					guesses = math.Min(guesses, float64(rank)*extra*2)
+				}
+			}
+
+			if !math.IsInf(guesses, 1) {
+				patterns = append(patterns, passwordPattern{i: i, j: j, guesses: guesses * uppercaseVariations(token)})
+			}
+		}
+	}
+	return patterns
+}
+
+type unleetVariant struct {
+	runes       []rune
+	substituted bool
+}
+
+// unleetVariants returns the token itself and the tokens its leet substitutions
+// may stand for. The number of variants is bounded by trying one mapping per
+// ambiguous character at a time.
+func unleetVariants(token []rune) []unleetVariant {
+	variants := []unleetVariant{{runes: token}}
+
+	for choice := 0; choice < 2; choice++ {
+		replaced := make([]rune, len(token))
+		substituted := false
+		for k, r := range token {
+			replaced[k] = r
+			if options, ok := leetSubstitutions[r]; ok {
+				replaced[k] = options[min(choice, len(options)-1)]
+				substituted = true
+			}
+		}
+		if !substituted {
+			break
+		}
+		variants = append(variants, unleetVariant{runes: replaced, substituted: true})
+	}
+
+	return variants
+}
+
+// uppercaseVariations counts the ways the letters of a token may have been capitalized
+func uppercaseVariations(token []rune) float64 {
+	var upper, lower int
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	if upper == 0 {
+		return 1
+	}
+
+	// Capitalizing the first or last letter, or all of them, is common
+	first, last := token[0], token[len(token)-1]
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(first) || unicode.IsUpper(last))) {
+		return 2
+	}
+
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+// sequencePatterns finds runs like "abc", "9876" or "acegi"
+func sequencePatterns(runes []rune) []passwordPattern {
+	var patterns []passwordPattern
+
+	add := func(i, j int, delta rune) {
+		if j-i+1 < 3 {
+			return
+		}
+		first := runes[i]
+		var base float64
+		switch {
+		case strings.ContainsRune("aAzZ019", first):
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		default:
+			base = 26
+		}
+		if delta < 0 {
+			base *= 2
+		}
+		patterns = append(patterns, passwordPattern{i: i, j: j, guesses: base * float64(j-i+1)})
+	}
+
+	start := 0
+	for k := 1; k < len(runes); k++ {
+		delta := runes[k] - runes[k-1]
+		if k-start >= 2 && delta != runes[start+1]-runes[start] {
+			add(start, k-1, runes[start+1]-runes[start])
+			start = k - 1
+		}
+		if delta == 0 || delta > 5 || delta < -5 {
+			if k-start >= 2 {
+				add(start, k-1, runes[start+1]-runes[start])
+			}
+			start = k
+		}
+	}
+	if len(runes)-start >= 3 {
+		add(start, len(runes)-1, runes[start+1]-runes[start])
+	}
+
+	return patterns
+}
+
+// repeatPatterns finds repeated characters or blocks like "aaa" or "abcabc". The
+// unit of a repeat is the shortest block that repeats from where it starts.
+func repeatPatterns(runes []rune, dictionary *rankedWords) []passwordPattern {
+	var patterns []passwordPattern
+	unitGuesses := make(map[string]float64)
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		for unit := 1; i+2*unit <= n; unit++ {
+			// A repeat starting one unit earlier covers this one
+			if i >= unit && string(runes[i-unit:i]) == string(runes[i:i+unit]) {
+				continue
+			}
+			count := 1
+			for i+(count+1)*unit <= n && string(runes[i+count*unit:i+(count+1)*unit]) == string(runes[i:i+unit]) {
+				count++
+			}
+			if count < 2 || (unit == 1 && count < 3) {
+				continue
+			}
+			unitRunes := runes[i : i+unit]
+			guesses, ok := unitGuesses[string(unitRunes)]
+			if !ok {
+				guesses = minimumGuesses(unitRunes, findPatterns(unitRunes, dictionary))
+				unitGuesses[string(unitRunes)] = guesses
+			}
+			patterns = append(patterns, passwordPattern{i: i, j: i + count*unit - 1, guesses: guesses * float64(count)})
+
+			// Repeats of longer units are made of the shortest one
+			break
+		}
+	}
+	return patterns
+}
+
+// yearPatterns finds years between 1900 and 2099
+func yearPatterns(runes []rune) []passwordPattern {
+	var patterns []passwordPattern
+	current := time.Now().Year()
+	for i := 0; i+4 <= len(runes); i++ {
+		year := 0
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year < 1900 || year > 2099 {
+			continue
+		}
+		space := math.Max(math.Abs(float64(year-current)), minYearSpace)
+		patterns = append(patterns, passwordPattern{i: i, j: i + 3, guesses: space})
+	}
+	return patterns
+}
+
+// splitWords lowercases a user input and splits it into words of three or more
+// characters, e.g. "jane.doe@example.com" into "jane", "doe", "example" and "com"
+func splitWords(input string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var words []string
+	for _, field := range fields {
+		if len([]rune(field)) >= 3 {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+func loadRankedWords(data string) *rankedWords {
+	words := &rankedWords{ranks: make(map[string]int)}
+	rank := 0
+	for _, line := range strings.Split(data, "\n") {
+		word := strings.ToLower(strings.TrimSpace(line))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		rank++
+		words.add(word, rank)
+	}
+	return words
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result *= float64(n-k+i) / float64(i)
+	}
+	return result
+}
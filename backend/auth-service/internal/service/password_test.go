@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordUsesArgon2id(t *testing.T) {
+	svc := NewPasswordService(PasswordConfig{Argon2: testArgon2})
+
+	hash, err := svc.HashPassword("kT9#vLq2!mZx")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+
+	if err := svc.ComparePassword(hash, "kT9#vLq2!mZx"); err != nil {
+		t.Fatalf("ComparePassword: %v", err)
+	}
+	if err := svc.ComparePassword(hash, "kT9#vLq2!mZy"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("wrong password: got %v, want ErrPasswordMismatch", err)
+	}
+	if svc.NeedsRehash(hash) {
+		t.Fatal("fresh hash needs a rehash")
+	}
+
+	// A service with higher costs upgrades the hash
+	stronger := NewPasswordService(PasswordConfig{Argon2: Argon2Params{Memory: 2048, Iterations: 1, Parallelism: 1}})
+	if !stronger.NeedsRehash(hash) {
+		t.Fatal("hash with a lower memory cost does not need a rehash")
+	}
+	if err := stronger.ComparePassword(hash, "kT9#vLq2!mZx"); err != nil {
+		t.Fatalf("ComparePassword with other parameters: %v", err)
+	}
+}
+
+func TestComparePasswordAcceptsLegacyBcrypt(t *testing.T) {
+	svc := NewPasswordService(PasswordConfig{Argon2: testArgon2})
+
+	password := strings.Repeat("kT9#vLq2!mZx", 6) // exactly 72 bytes
+	legacy, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.ComparePassword(string(legacy), password); err != nil {
+		t.Fatalf("ComparePassword: %v", err)
+	}
+	if !svc.NeedsRehash(string(legacy)) {
+		t.Fatal("bcrypt hash does not need a rehash")
+	}
+
+	// bcrypt ignores everything after 72 bytes; such passwords must not match
+	if err := svc.ComparePassword(string(legacy), password+"extra"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("longer password: got %v, want ErrPasswordMismatch", err)
+	}
+}
+
+func TestComparePasswordRejectsUnknownHashes(t *testing.T) {
+	svc := NewPasswordService(PasswordConfig{Argon2: testArgon2})
+
+	for _, hash := range []string{"", "plaintext", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if err := svc.ComparePassword(hash, "kT9#vLq2!mZx"); !errors.Is(err, ErrUnsupportedPasswordHash) {
+			t.Fatalf("ComparePassword(%q): got %v, want ErrUnsupportedPasswordHash", hash, err)
+		}
+	}
+}
+
+func TestHashPasswordAcceptsLongPasswords(t *testing.T) {
+	svc := NewPasswordService(PasswordConfig{Argon2: testArgon2})
+
+	password := "kT9#vLq2!mZx " + strings.Repeat("a long passphrase ", 10)
+	hash, err := svc.HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if err := svc.ComparePassword(hash, password[:len(password)-1]); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("truncated password: got %v, want ErrPasswordMismatch", err)
+	}
+
+	if _, err := svc.HashPassword("kT9#vLq2!mZx" + strings.Repeat("x", MaxPasswordLength)); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatalf("overlong password: got %v, want ErrPasswordTooLong", err)
+	}
+}
+
+func TestLoginUpgradesOutdatedHash(t *testing.T) {
+	ctx := context.Background()
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("kT9#vLq2!mZx"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(t)
+	jane := f.addUser(t, &domain.User{
+		Email:        "jane@example.com",
+		PasswordHash: string(legacy),
+		Role:         domain.RoleCustomer,
+		MFAEnabled:   true,
+	}, "")
+	jane.FailedLoginAttempts = 2
+
+	// The MFA challenge is handed out after the password was verified and upgraded
+	resp, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !resp.RequiresMFA {
+		t.Fatal("expected an MFA challenge")
+	}
+
+	user, _ := f.users.GetByID(ctx, jane.ID)
+	if f.passwords.NeedsRehash(user.PasswordHash) {
+		t.Fatalf("hash was not upgraded: %q", user.PasswordHash)
+	}
+	if err := f.passwords.ComparePassword(user.PasswordHash, "kT9#vLq2!mZx"); err != nil {
+		t.Fatalf("upgraded hash does not verify: %v", err)
+	}
+	if user.FailedLoginAttempts != 2 {
+		t.Fatalf("rehash changed the failed attempts to %d", user.FailedLoginAttempts)
+	}
+
+	// A wrong password leaves the hash alone
+	upgraded := user.PasswordHash
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "wrong"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if user, _ := f.users.GetByID(ctx, jane.ID); user.PasswordHash != upgraded {
+		t.Fatal("hash changed after a failed login")
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes in a set
+	RecoveryCodeCount = 10
+
+	// recoveryCodeBytes is the entropy of a recovery code (80 bits)
+	recoveryCodeBytes = 10
+
+	// recoveryCodeGroup is the number of characters between dashes in a formatted code
+	recoveryCodeGroup = 4
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RecoveryCodeService handles single-use MFA recovery codes
+type RecoveryCodeService struct {
+	repo domain.MFARecoveryCodeRepository
+}
+
+// NewRecoveryCodeService creates a new recovery code service
+func NewRecoveryCodeService(repo domain.MFARecoveryCodeRepository) *RecoveryCodeService {
+	return &RecoveryCodeService{
+		repo: repo,
+	}
+}
+
+// Generate creates a new set of recovery codes for a user, replacing any previous set.
+// The plaintext codes are returned once; only their hashes are stored.
+func (s *RecoveryCodeService) Generate(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	if err := s.repo.ReplaceForUser(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Redeem checks a recovery code and marks it as used. It returns false if the code
+// is unknown or was already used.
+func (s *RecoveryCodeService) Redeem(ctx context.Context, userID int64, code string) (bool, error) {
+	if err := s.repo.Consume(ctx, userID, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, domain.ErrRecoveryCodeNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to redeem recovery code: %w", err)
+	}
+	return true, nil
+}
+
+// Remaining returns the number of unused recovery codes of a user
+func (s *RecoveryCodeService) Remaining(ctx context.Context, userID int64) (int, error) {
+	count, err := s.repo.CountUnused(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// Delete removes all recovery codes of a user
+func (s *RecoveryCodeService) Delete(ctx context.Context, userID int64) error {
+	if err := s.repo.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+// newRecoveryCode generates a random code formatted as xxxx-xxxx-xxxx-xxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+
+	var sb strings.Builder
+	for i, r := range encoded {
+		if i > 0 && i%recoveryCodeGroup == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), nil
+}
+
+// hashRecoveryCode hashes a recovery code after normalizing case, dashes and spaces.
+// The codes carry 80 bits of entropy, so a fast hash is sufficient.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
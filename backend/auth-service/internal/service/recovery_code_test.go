@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+var recoveryCodeFormat = regexp.MustCompile(`^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`)
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryRecoveryCodes{codes: make(map[int64]map[string]bool)}
+	svc := NewRecoveryCodeService(repo)
+
+	codes, err := svc.Generate(ctx, 1)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if !recoveryCodeFormat.MatchString(code) || seen[code] {
+			t.Fatalf("bad or repeated code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if ok, err := svc.Redeem(ctx, 1, codes[0]); err != nil || !ok {
+		t.Fatalf("first use: %v, %v", ok, err)
+	}
+	if ok, err := svc.Redeem(ctx, 1, codes[0]); err != nil || ok {
+		t.Fatalf("second use: %v, %v", ok, err)
+	}
+
+	// Codes are accepted however they are typed, but only by their user
+	typed := strings.ToUpper(strings.ReplaceAll(codes[1], "-", " "))
+	if ok, err := svc.Redeem(ctx, 1, typed); err != nil || !ok {
+		t.Fatalf("code typed as %q: %v, %v", typed, ok, err)
+	}
+	if ok, err := svc.Redeem(ctx, 2, codes[2]); err != nil || ok {
+		t.Fatalf("code of another user: %v, %v", ok, err)
+	}
+
+	if remaining, err := svc.Remaining(ctx, 1); err != nil || remaining != RecoveryCodeCount-2 {
+		t.Fatalf("Remaining = %d, %v", remaining, err)
+	}
+}
+
+func TestRecoveryCodesAreStoredHashed(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryRecoveryCodes{codes: make(map[int64]map[string]bool)}
+	svc := NewRecoveryCodeService(repo)
+
+	codes, err := svc.Generate(ctx, 1)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	for _, code := range codes {
+		if _, ok := repo.codes[1][hashRecoveryCode(code)]; !ok {
+			t.Fatalf("no hash stored for %q", code)
+		}
+	}
+	for hash := range repo.codes[1] {
+		if len(hash) != 64 {
+			t.Fatalf("stored value %q is not a SHA-256 hash", hash)
+		}
+		for _, code := range codes {
+			normalized := strings.ReplaceAll(code, "-", "")
+			if strings.Contains(hash, code) || strings.Contains(hash, normalized) {
+				t.Fatalf("stored value %q contains a plaintext code", hash)
+			}
+		}
+	}
+}
+
+func TestRegeneratingRecoveryCodesInvalidatesOldOnes(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleAdministrator)
+	jane.MFAEnabled = true
+	jane.MFASecret = testTOTPSecret
+
+	old, err := f.recovery.Generate(ctx, jane.ID)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	// A current TOTP code is required
+	if _, err := f.auth.RegenerateRecoveryCodes(ctx, jane.ID, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("wrong code: got %v, want ErrInvalidMFACode", err)
+	}
+	codes, err := f.auth.RegenerateRecoveryCodes(ctx, jane.ID, codeAt(t, time.Now()))
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+
+	for _, code := range old {
+		if ok, err := f.recovery.Redeem(ctx, jane.ID, code); err != nil || ok {
+			t.Fatalf("old code %q still works: %v, %v", code, ok, err)
+		}
+	}
+
+	// The new codes complete an MFA challenge
+	resp, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: mfaChallenge(t, f), RecoveryCode: codes[0]})
+	if err != nil || resp.AccessToken == "" {
+		t.Fatalf("challenge with a new code: %+v, %v", resp, err)
+	}
+}
+
+func TestVerifyAndEnableMFAStoresRecoveryCodesFirst(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleAdministrator)
+	jane.MFASecret = testTOTPSecret
+
+	// MFA stays off when the recovery codes cannot be stored
+	f.recoveryCodes.err = errors.New("connection refused")
+	if _, err := f.auth.VerifyAndEnableMFA(ctx, jane.ID, codeAt(t, time.Now())); err == nil {
+		t.Fatal("MFA enabled although the recovery codes were not stored")
+	}
+	if jane.MFAEnabled {
+		t.Fatal("MFA enabled without recovery codes")
+	}
+
+	f.recoveryCodes.err = nil
+	codes, err := f.auth.VerifyAndEnableMFA(ctx, jane.ID, codeAt(t, time.Now().Add(TOTPPeriod*time.Second)))
+	if err != nil {
+		t.Fatalf("VerifyAndEnableMFA: %v", err)
+	}
+	if !jane.MFAEnabled {
+		t.Fatal("MFA not enabled")
+	}
+	if remaining, err := f.recovery.Remaining(ctx, jane.ID); err != nil || remaining != len(codes) {
+		t.Fatalf("Remaining = %d, %v; want %d", remaining, err, len(codes))
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+var (
+	// ErrRefreshTokenReused is returned when an already used refresh token is presented.
+	// The whole token family is revoked and the client must log in again.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshTokenService handles single-use refresh token rotation
+type RefreshTokenService struct {
+	repo   domain.RefreshTokenRepository
+	jwtSvc *JWTService
+}
+
+// NewRefreshTokenService creates a new refresh token service
+func NewRefreshTokenService(repo domain.RefreshTokenRepository, jwtSvc *JWTService) *RefreshTokenService {
+	return &RefreshTokenService{
+		repo:   repo,
+		jwtSvc: jwtSvc,
+	}
+}
+
+// Issue generates a refresh token in the given family and records it.
+// An empty familyID starts a new family.
+func (s *RefreshTokenService) Issue(ctx context.Context, user *domain.User, customerID *int64, familyID string) (string, error) {
+	tokenString, claims, err := s.jwtSvc.GenerateRefreshToken(user, customerID, familyID)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.Create(ctx, &domain.RefreshToken{
+		JTI:       claims.ID,
+		FamilyID:  claims.FamilyID,
+		UserID:    user.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// Rotate validates a refresh token and marks it as used so it cannot be exchanged again.
+// Presenting a token that was already used revokes its entire family.
+func (s *RefreshTokenService) Rotate(ctx context.Context, tokenString string) (*TokenClaims, error) {
+	claims, err := s.jwtSvc.ValidateRefreshToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" || claims.FamilyID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if _, err := s.repo.Consume(ctx, claims.ID); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrRefreshTokenUsed):
+			if err := s.repo.RevokeFamily(ctx, claims.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshTokenReused
+		case errors.Is(err, domain.ErrRefreshTokenNotFound), errors.Is(err, domain.ErrRefreshTokenRevoked):
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		default:
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// RevokeFamily revokes every refresh token in a family
+func (s *RefreshTokenService) RevokeFamily(ctx context.Context, familyID string) error {
+	return s.repo.RevokeFamily(ctx, familyID)
+}
+
+// RevokeAllForUser revokes every refresh token issued to a user
+func (s *RefreshTokenService) RevokeAllForUser(ctx context.Context, userID int64) error {
+	return s.repo.RevokeAllForUser(ctx, userID)
+}
+
+// RevokeOtherFamilies revokes every refresh token issued to a user outside the given family
+func (s *RefreshTokenService) RevokeOtherFamilies(ctx context.Context, userID int64, familyID string) error {
+	return s.repo.RevokeOtherFamilies(ctx, userID, familyID)
+}
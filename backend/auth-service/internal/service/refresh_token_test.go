@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleCustomer)
+	refreshSvc := NewRefreshTokenService(f.refreshTokens, f.jwt)
+
+	first, err := refreshSvc.Issue(ctx, jane, nil, "")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	claims, err := refreshSvc.Rotate(ctx, first)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if claims.UserID != jane.ID || claims.FamilyID == "" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// The successor stays in the family and can be rotated in turn
+	second, err := refreshSvc.Issue(ctx, jane, nil, claims.FamilyID)
+	if err != nil {
+		t.Fatalf("Issue successor: %v", err)
+	}
+	next, err := refreshSvc.Rotate(ctx, second)
+	if err != nil {
+		t.Fatalf("Rotate successor: %v", err)
+	}
+	if next.FamilyID != claims.FamilyID || next.ID == claims.ID {
+		t.Fatalf("successor claims %+v, want family %s with a new ID", next, claims.FamilyID)
+	}
+
+	if len(f.refreshTokens.tokens) != 2 {
+		t.Fatalf("stored %d refresh tokens, want 2", len(f.refreshTokens.tokens))
+	}
+	for _, token := range f.refreshTokens.tokens {
+		if !token.IsUsed() || token.IsRevoked() {
+			t.Fatalf("token %s: used %v revoked %v, want used and not revoked", token.JTI, token.IsUsed(), token.IsRevoked())
+		}
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleCustomer)
+	refreshSvc := NewRefreshTokenService(f.refreshTokens, f.jwt)
+
+	stolen, err := refreshSvc.Issue(ctx, jane, nil, "")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := refreshSvc.Rotate(ctx, stolen)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	current, err := refreshSvc.Issue(ctx, jane, nil, claims.FamilyID)
+	if err != nil {
+		t.Fatalf("Issue successor: %v", err)
+	}
+	other, err := refreshSvc.Issue(ctx, jane, nil, "")
+	if err != nil {
+		t.Fatalf("Issue other login: %v", err)
+	}
+
+	if _, err := refreshSvc.Rotate(ctx, stolen); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: got %v, want ErrRefreshTokenReused", err)
+	}
+
+	// The legitimate successor went down with the family
+	if _, err := refreshSvc.Rotate(ctx, current); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("successor after reuse: got %v, want ErrInvalidToken", err)
+	}
+
+	// Other logins of the user are left alone
+	if _, err := refreshSvc.Rotate(ctx, other); err != nil {
+		t.Fatalf("token of another login: %v", err)
+	}
+}
+
+func TestRefreshTokenRotateRejectsUnknownTokens(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleCustomer)
+	refreshSvc := NewRefreshTokenService(f.refreshTokens, f.jwt)
+
+	// Signed by the service but never recorded
+	unrecorded, _, err := f.jwt.GenerateRefreshToken(jane, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refreshSvc.Rotate(ctx, unrecorded); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("unrecorded token: got %v, want ErrInvalidToken", err)
+	}
+
+	// Access tokens are not refresh tokens
+	access, err := f.jwt.GenerateAccessToken(jane, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refreshSvc.Rotate(ctx, access); err == nil {
+		t.Fatal("access token was accepted as a refresh token")
+	}
+}
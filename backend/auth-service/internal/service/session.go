@@ -3,59 +3,101 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 const (
 	// DefaultSessionTimeout is the default session timeout duration
 	DefaultSessionTimeout = 30 * time.Minute
 
-	// SessionKeyPrefix is the prefix for session keys in Redis
-	SessionKeyPrefix = "session:"
+	// DenylistKeyPrefix is the prefix for revoked access token IDs in the session store
+	DenylistKeyPrefix = "denylist:"
+
+	// UserRevocationKeyPrefix is the prefix for per-user token revocation timestamps in the session store
+	UserRevocationKeyPrefix = "revoked-before:"
+
+	// MFAAttemptsKeyPrefix is the prefix for per-challenge MFA attempt counters in the session store
+	MFAAttemptsKeyPrefix = "mfa-attempts:"
+
+	// WebAuthnCeremonyKeyPrefix is the prefix for pending WebAuthn ceremonies in the session store
+	WebAuthnCeremonyKeyPrefix = "webauthn:"
+
+	// LoginFailuresKeyPrefix is the prefix for sliding windows of failed logins in the session store
+	LoginFailuresKeyPrefix = "login-failures:"
+
+	// SSOStateKeyPrefix is the prefix for pending single sign-on logins in the session store
+	SSOStateKeyPrefix = "sso-state:"
+
+	// SSOLoginKeyPrefix is the prefix for single sign-on login codes in the session store
+	SSOLoginKeyPrefix = "sso-login:"
+)
+
+var (
+	// ErrSessionNotFound is returned when a session does not exist or has timed out
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionStoreUnavailable is returned when the session store cannot be reached
+	ErrSessionStoreUnavailable = errors.New("session store unavailable")
 )
 
-// SessionData represents the data stored in a session
+// SessionData represents the data stored in a session. SSOCustomerID is the
+// customer whose identity provider authenticated the login, if any.
 type SessionData struct {
-	UserID     int64     `json:"user_id"`
-	UUID       string    `json:"uuid"`
-	Email      string    `json:"email"`
-	Role       string    `json:"role"`
-	CustomerID *int64    `json:"customer_id,omitempty"`
-	CreatedAt  time.Time `json:"created_at"`
-	LastAccess time.Time `json:"last_access"`
+	UserID        int64     `json:"user_id"`
+	UUID          string    `json:"uuid"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	CustomerID    *int64    `json:"customer_id,omitempty"`
+	SSOCustomerID *int64    `json:"sso_customer_id,omitempty"`
+	IPAddress     string    `json:"ip_address,omitempty"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	Device        string    `json:"device,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastAccess    time.Time `json:"last_access"`
 }
 
-// SessionService handles session management with Redis
+// UserSession is a session of a user together with its ID
+type UserSession struct {
+	ID string
+	SessionData
+}
+
+// SessionService handles sessions and the other short-lived state of logins,
+// such as revoked tokens, pending WebAuthn and single sign-on logins and failed
+// login windows, on top of a SessionStore.
+//
+// When the store cannot be reached, the service fails closed: errors wrap
+// ErrSessionStoreUnavailable and logins, refreshes, logouts and token validation
+// are refused until the store is back. With FailOpen set, the checks made when an
+// access token or refresh token is used are skipped instead, so users who are
+// already logged in can keep working, but revoked tokens are accepted and idle
+// sessions do not time out for as long as the store is down. Everything that
+// creates or ends a login fails closed either way.
 type SessionService struct {
-	client         *redis.Client
+	store          SessionStore
 	sessionTimeout time.Duration
+	failOpen       bool
 }
 
 // SessionConfig holds session service configuration
 type SessionConfig struct {
-	RedisAddr      string
-	RedisPassword  string
-	RedisDB        int
+	Store          SessionStore
 	SessionTimeout time.Duration
+	FailOpen       bool
 }
 
-// NewSessionService creates a new session service
-func NewSessionService(config SessionConfig) (*SessionService, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     config.RedisAddr,
-		Password: config.RedisPassword,
-		DB:       config.RedisDB,
-	})
-
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+// NewSessionService creates a new session service. Without a store it keeps
+// sessions in memory.
+func NewSessionService(config SessionConfig) *SessionService {
+	store := config.Store
+	if store == nil {
+		store = NewMemorySessionStore()
 	}
 
 	timeout := config.SessionTimeout
@@ -64,9 +106,10 @@ func NewSessionService(config SessionConfig) (*SessionService, error) {
 	}
 
 	return &SessionService{
-		client:         client,
+		store:          store,
 		sessionTimeout: timeout,
-	}, nil
+		failOpen:       config.FailOpen,
+	}
 }
 
 // CreateSession creates a new session for a user
@@ -75,15 +118,8 @@ func (s *SessionService) CreateSession(ctx context.Context, sessionID string, da
 	data.CreatedAt = now
 	data.LastAccess = now
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal session data: %w", err)
-	}
-
-	key := SessionKeyPrefix + sessionID
-	err = s.client.Set(ctx, key, jsonData, s.sessionTimeout).Err()
-	if err != nil {
-		return fmt.Errorf("failed to create session: %w", err)
+	if err := s.store.SaveSession(ctx, sessionID, data, s.sessionTimeout); err != nil {
+		return fmt.Errorf("failed to create session: %w", unavailable(err))
 	}
 
 	return nil
@@ -91,108 +127,356 @@ func (s *SessionService) CreateSession(ctx context.Context, sessionID string, da
 
 // GetSession retrieves a session by ID
 func (s *SessionService) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
-	key := SessionKeyPrefix + sessionID
-	jsonData, err := s.client.Get(ctx, key).Result()
+	data, err := s.store.GetSession(ctx, sessionID)
 	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("session not found")
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to get session: %w", err)
-	}
-
-	var data SessionData
-	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", unavailable(err))
 	}
 
-	return &data, nil
+	return data, nil
 }
 
-// UpdateSession updates an existing session
+// UpdateSession updates an existing session. It returns ErrSessionNotFound if
+// the session ended meanwhile rather than bringing it back.
 func (s *SessionService) UpdateSession(ctx context.Context, sessionID string, data *SessionData) error {
 	data.LastAccess = time.Now()
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal session data: %w", err)
+	if err := s.store.UpdateSession(ctx, sessionID, data, s.sessionTimeout); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to update session: %w", unavailable(err))
 	}
 
-	key := SessionKeyPrefix + sessionID
-	err = s.client.Set(ctx, key, jsonData, s.sessionTimeout).Err()
+	return nil
+}
+
+// RefreshSession records an access to a session and extends its timeout. It
+// implements SessionTracker. In fail-open mode an unavailable store is only logged.
+func (s *SessionService) RefreshSession(ctx context.Context, sessionID string) error {
+	data, err := s.GetSession(ctx, sessionID)
+	if err == nil {
+		err = s.UpdateSession(ctx, sessionID, data)
+	}
+	if err != nil && s.failOpen && errors.Is(err, ErrSessionStoreUnavailable) {
+		log.Printf("WARNING: not checking session %s: %v", sessionID, err)
+		return nil
+	}
+
+	return err
+}
+
+// DeleteSession deletes a session
+func (s *SessionService) DeleteSession(ctx context.Context, sessionID string) error {
+	if err := s.store.DeleteSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", unavailable(err))
+	}
+
+	return nil
+}
+
+// ListUserSessions returns the active sessions of a user, most recently used first
+func (s *SessionService) ListUserSessions(ctx context.Context, userID int64) ([]*UserSession, error) {
+	sessions, err := s.store.ListUserSessions(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update session: %w", err)
+		return nil, fmt.Errorf("failed to list sessions: %w", unavailable(err))
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastAccess.After(sessions[j].LastAccess)
+	})
+
+	return sessions, nil
+}
+
+// DeleteUserSessions deletes all sessions for a user
+func (s *SessionService) DeleteUserSessions(ctx context.Context, userID int64) error {
+	return s.deleteUserSessions(ctx, userID, "")
+}
+
+// DeleteOtherUserSessions deletes all sessions for a user except the given one
+func (s *SessionService) DeleteOtherUserSessions(ctx context.Context, userID int64, keepSessionID string) error {
+	return s.deleteUserSessions(ctx, userID, keepSessionID)
+}
+
+func (s *SessionService) deleteUserSessions(ctx context.Context, userID int64, keepSessionID string) error {
+	if err := s.store.DeleteUserSessions(ctx, userID, keepSessionID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", unavailable(err))
 	}
 
 	return nil
 }
 
-// RefreshSession extends the session timeout
-func (s *SessionService) RefreshSession(ctx context.Context, sessionID string) error {
-	key := SessionKeyPrefix + sessionID
+// describeDevice returns a short description of the browser and operating system
+// in a user agent, such as "Firefox on Windows", for telling sessions apart
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		// Order matters: Edge and Opera announce Chrome, and Chrome announces Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		// iOS and Android announce macOS and Linux
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
+
+// DenylistToken revokes a single access token until it expires
+func (s *SessionService) DenylistToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+
+	if err := s.store.SetValue(ctx, DenylistKeyPrefix+jti, "1", ttl); err != nil {
+		return fmt.Errorf("failed to denylist token: %w", unavailable(err))
+	}
 
-	// Check if session exists
-	exists, err := s.client.Exists(ctx, key).Result()
+	return nil
+}
+
+// RevokeUserTokens revokes every access token issued to a user before the
+// current second. Tokens carry their issue time in whole seconds, so those issued
+// in the current second stay valid and callers denylist them separately.
+// The marker only needs to outlive the longest-lived access token.
+func (s *SessionService) RevokeUserTokens(ctx context.Context, userID int64, ttl time.Duration) error {
+	key := UserRevocationKeyPrefix + strconv.FormatInt(userID, 10)
+	if err := s.store.SetValue(ctx, key, strconv.FormatInt(time.Now().Unix(), 10), ttl); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", unavailable(err))
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks whether an access token was denylisted or issued before
+// its user's tokens were revoked. It implements TokenDenylist. In fail-open mode
+// tokens count as not revoked while the store is unavailable.
+func (s *SessionService) IsTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	revoked, err := s.isTokenRevoked(ctx, jti, userID, issuedAt)
+	if err != nil && s.failOpen && errors.Is(err, ErrSessionStoreUnavailable) {
+		log.Printf("WARNING: not checking revocation of token %s: %v", jti, err)
+		return false, nil
+	}
+
+	return revoked, err
+}
+
+func (s *SessionService) isTokenRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		_, err := s.store.GetValue(ctx, DenylistKeyPrefix+jti)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, ErrStoreKeyNotFound) {
+			return false, fmt.Errorf("failed to check token denylist: %w", unavailable(err))
+		}
+	}
+
+	value, err := s.store.GetValue(ctx, UserRevocationKeyPrefix+strconv.FormatInt(userID, 10))
 	if err != nil {
-		return fmt.Errorf("failed to check session existence: %w", err)
+		if errors.Is(err, ErrStoreKeyNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check user token revocation: %w", unavailable(err))
 	}
-	if exists == 0 {
-		return fmt.Errorf("session not found")
+
+	revokedBefore, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse user token revocation: %w", err)
 	}
 
-	// Extend the TTL
-	err = s.client.Expire(ctx, key, s.sessionTimeout).Err()
+	return issuedAt.Unix() < revokedBefore, nil
+}
+
+// IncrementMFAAttempts counts a failed attempt at an MFA challenge and returns the
+// number of failures so far. The counter expires together with the challenge.
+// It implements MFAAttemptCounter.
+func (s *SessionService) IncrementMFAAttempts(ctx context.Context, challengeID string, ttl time.Duration) (int, error) {
+	count, err := s.store.Increment(ctx, MFAAttemptsKeyPrefix+challengeID, ttl)
 	if err != nil {
-		return fmt.Errorf("failed to refresh session: %w", err)
+		return 0, fmt.Errorf("failed to count MFA attempt: %w", unavailable(err))
 	}
 
-	return nil
+	return int(count), nil
 }
 
-// DeleteSession deletes a session
-func (s *SessionService) DeleteSession(ctx context.Context, sessionID string) error {
-	key := SessionKeyPrefix + sessionID
-	err := s.client.Del(ctx, key).Err()
+// SaveWebAuthnCeremony stores a pending WebAuthn ceremony under its challenge.
+// It implements WebAuthnCeremonyStore.
+func (s *SessionService) SaveWebAuthnCeremony(ctx context.Context, challenge string, ceremony *WebAuthnCeremony, ttl time.Duration) error {
+	jsonData, err := json.Marshal(ceremony)
 	if err != nil {
-		return fmt.Errorf("failed to delete session: %w", err)
+		return fmt.Errorf("failed to marshal webauthn ceremony: %w", err)
+	}
+
+	if err := s.store.SetValue(ctx, WebAuthnCeremonyKeyPrefix+challenge, string(jsonData), ttl); err != nil {
+		return fmt.Errorf("failed to save webauthn ceremony: %w", unavailable(err))
 	}
 
 	return nil
 }
 
-// DeleteUserSessions deletes all sessions for a user
-func (s *SessionService) DeleteUserSessions(ctx context.Context, userID int64) error {
-	// Scan for all session keys
-	pattern := SessionKeyPrefix + "*"
-	iter := s.client.Scan(ctx, 0, pattern, 0).Iterator()
+// TakeWebAuthnCeremony atomically loads and deletes the WebAuthn ceremony for a challenge.
+// It implements WebAuthnCeremonyStore.
+func (s *SessionService) TakeWebAuthnCeremony(ctx context.Context, challenge string) (*WebAuthnCeremony, error) {
+	jsonData, err := s.store.TakeValue(ctx, WebAuthnCeremonyKeyPrefix+challenge)
+	if err != nil {
+		if errors.Is(err, ErrStoreKeyNotFound) {
+			return nil, ErrWebAuthnCeremonyNotFound
+		}
+		return nil, fmt.Errorf("failed to get webauthn ceremony: %w", unavailable(err))
+	}
+
+	var ceremony WebAuthnCeremony
+	if err := json.Unmarshal([]byte(jsonData), &ceremony); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webauthn ceremony: %w", err)
+	}
 
-	for iter.Next(ctx) {
-		key := iter.Val()
+	return &ceremony, nil
+}
 
-		// Get session data
-		jsonData, err := s.client.Get(ctx, key).Result()
-		if err != nil {
-			continue
-		}
+// SaveSSOState stores a pending single sign-on login under its state.
+// It implements SSOStore.
+func (s *SessionService) SaveSSOState(ctx context.Context, state string, data *SSOState, ttl time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sso state: %w", err)
+	}
+
+	if err := s.store.SetValue(ctx, SSOStateKeyPrefix+state, string(jsonData), ttl); err != nil {
+		return fmt.Errorf("failed to save sso state: %w", unavailable(err))
+	}
+
+	return nil
+}
 
-		var data SessionData
-		if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
-			continue
+// TakeSSOState atomically loads and deletes a pending single sign-on login.
+// It implements SSOStore.
+func (s *SessionService) TakeSSOState(ctx context.Context, state string) (*SSOState, error) {
+	jsonData, err := s.store.TakeValue(ctx, SSOStateKeyPrefix+state)
+	if err != nil {
+		if errors.Is(err, ErrStoreKeyNotFound) {
+			return nil, ErrInvalidSSOResponse
 		}
+		return nil, fmt.Errorf("failed to get sso state: %w", unavailable(err))
+	}
+
+	var data SSOState
+	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sso state: %w", err)
+	}
+
+	return &data, nil
+}
 
-		// Delete if it belongs to the user
-		if data.UserID == userID {
-			s.client.Del(ctx, key)
+// SaveSSOLogin stores a completed single sign-on login under its one-time code.
+// It implements SSOStore.
+func (s *SessionService) SaveSSOLogin(ctx context.Context, code string, login *SSOLogin, ttl time.Duration) error {
+	jsonData, err := json.Marshal(login)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sso login: %w", err)
+	}
+
+	if err := s.store.SetValue(ctx, SSOLoginKeyPrefix+code, string(jsonData), ttl); err != nil {
+		return fmt.Errorf("failed to save sso login: %w", unavailable(err))
+	}
+
+	return nil
+}
+
+// TakeSSOLogin atomically loads and deletes the single sign-on login of a code.
+// It implements SSOStore.
+func (s *SessionService) TakeSSOLogin(ctx context.Context, code string) (*SSOLogin, error) {
+	jsonData, err := s.store.TakeValue(ctx, SSOLoginKeyPrefix+code)
+	if err != nil {
+		if errors.Is(err, ErrStoreKeyNotFound) {
+			return nil, ErrInvalidSSOCode
 		}
+		return nil, fmt.Errorf("failed to get sso login: %w", unavailable(err))
 	}
 
-	if err := iter.Err(); err != nil {
-		return fmt.Errorf("failed to scan sessions: %w", err)
+	var login SSOLogin
+	if err := json.Unmarshal([]byte(jsonData), &login); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sso login: %w", err)
 	}
 
+	return &login, nil
+}
+
+// AddFailure records a failed login, trims the failures that fell out of the
+// window and returns the ones before it. It implements FailureWindow.
+func (s *SessionService) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (*RecordedEvent, error) {
+	failure, err := s.store.AddEvent(ctx, LoginFailuresKeyPrefix+key, at, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", unavailable(err))
+	}
+
+	return failure, nil
+}
+
+// RemoveFailure forgets a single failed login. It implements FailureWindow.
+func (s *SessionService) RemoveFailure(ctx context.Context, key, failureID string) error {
+	if err := s.store.RemoveEvent(ctx, LoginFailuresKeyPrefix+key, failureID); err != nil {
+		return fmt.Errorf("failed to remove login failure: %w", unavailable(err))
+	}
+	return nil
+}
+
+// ClearFailures forgets the failed logins of a key. It implements FailureWindow.
+func (s *SessionService) ClearFailures(ctx context.Context, key string) error {
+	if err := s.store.DeleteEvents(ctx, LoginFailuresKeyPrefix+key); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", unavailable(err))
+	}
 	return nil
 }
 
-// Close closes the Redis connection
+// Ping checks that the session store can be reached
+func (s *SessionService) Ping(ctx context.Context) error {
+	if err := s.store.Ping(ctx); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// Close closes the session store
 func (s *SessionService) Close() error {
-	return s.client.Close()
+	return s.store.Close()
+}
+
+// unavailable marks an error of the session store as ErrSessionStoreUnavailable
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %v", ErrSessionStoreUnavailable, err)
 }
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PostgresSessionStore is a SessionStore backed by the sessions, session_values
+// and session_events tables. It lets the service run without Redis at the cost of
+// a database write for every authenticated request. Expired rows are ignored by
+// every query and removed by PurgeExpired, which should run periodically.
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+// NewPostgresSessionStore creates a new PostgreSQL session store
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{
+		db: db,
+	}
+}
+
+// SaveSession implements SessionStore
+func (s *PostgresSessionStore) SaveSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	query := `
+		INSERT INTO sessions (id, user_id, data, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE
+		SET user_id = EXCLUDED.user_id, data = EXCLUDED.data, expires_at = EXCLUDED.expires_at
+	`
+
+	_, err = s.db.ExecContext(ctx, query, sessionID, data.UserID, jsonData, time.Now().Add(ttl))
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSession implements SessionStore. Unlike SaveSession it never inserts, so
+// a session deleted meanwhile stays deleted.
+func (s *PostgresSessionStore) UpdateSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	query := `
+		UPDATE sessions
+		SET data = $2, expires_at = $3
+		WHERE id = $1 AND expires_at > NOW()
+	`
+
+	result, err := s.db.ExecContext(ctx, query, sessionID, jsonData, time.Now().Add(ttl))
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// GetSession implements SessionStore
+func (s *PostgresSessionStore) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
+	query := `SELECT data FROM sessions WHERE id = $1 AND expires_at > $2`
+
+	var jsonData []byte
+	err := s.db.QueryRowContext(ctx, query, sessionID, time.Now()).Scan(&jsonData)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var data SessionData
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// DeleteSession implements SessionStore
+func (s *PostgresSessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	query := `DELETE FROM sessions WHERE id = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return nil
+}
+
+// ListUserSessions implements SessionStore
+func (s *PostgresSessionStore) ListUserSessions(ctx context.Context, userID int64) ([]*UserSession, error) {
+	query := `SELECT id, data FROM sessions WHERE user_id = $1 AND expires_at > $2`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*UserSession
+	for rows.Next() {
+		var session UserSession
+		var jsonData []byte
+		if err := rows.Scan(&session.ID, &jsonData); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if err := json.Unmarshal(jsonData, &session.SessionData); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSessions implements SessionStore
+func (s *PostgresSessionStore) DeleteUserSessions(ctx context.Context, userID int64, keepSessionID string) error {
+	query := `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`
+
+	if _, err := s.db.ExecContext(ctx, query, userID, keepSessionID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	return nil
+}
+
+// SetValue implements SessionStore
+func (s *PostgresSessionStore) SetValue(ctx context.Context, key, value string, ttl time.Duration) error {
+	query := `
+		INSERT INTO session_values (key, value, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE
+		SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, key, value, time.Now().Add(ttl)); err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// GetValue implements SessionStore
+func (s *PostgresSessionStore) GetValue(ctx context.Context, key string) (string, error) {
+	query := `SELECT value FROM session_values WHERE key = $1 AND expires_at > $2`
+
+	var value string
+	if err := s.db.QueryRowContext(ctx, query, key, time.Now()).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrStoreKeyNotFound
+		}
+		return "", fmt.Errorf("failed to get %s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// TakeValue implements SessionStore
+func (s *PostgresSessionStore) TakeValue(ctx context.Context, key string) (string, error) {
+	query := `DELETE FROM session_values WHERE key = $1 RETURNING value, expires_at`
+
+	var value string
+	var expiresAt time.Time
+	if err := s.db.QueryRowContext(ctx, query, key).Scan(&value, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrStoreKeyNotFound
+		}
+		return "", fmt.Errorf("failed to take %s: %w", key, err)
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return "", ErrStoreKeyNotFound
+	}
+
+	return value, nil
+}
+
+// Increment implements SessionStore. The upsert restarts counters that expired
+// but were not purged yet.
+func (s *PostgresSessionStore) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	query := `
+		INSERT INTO session_values (key, value, expires_at)
+		VALUES ($1, '1', $3)
+		ON CONFLICT (key) DO UPDATE
+		SET value = CASE
+				WHEN session_values.expires_at > $2 THEN (session_values.value::BIGINT + 1)::TEXT
+				ELSE '1'
+			END,
+			expires_at = EXCLUDED.expires_at
+		RETURNING value::BIGINT
+	`
+
+	now := time.Now()
+	var count int64
+	if err := s.db.QueryRowContext(ctx, query, key, now, now.Add(ttl)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to increment %s: %w", key, err)
+	}
+
+	return count, nil
+}
+
+// AddEvent implements SessionStore. A transaction-level advisory lock on the key
+// serializes concurrent events of the same key, so each one counts the others.
+func (s *PostgresSessionStore) AddEvent(ctx context.Context, key string, at time.Time, window time.Duration) (*RecordedEvent, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return nil, fmt.Errorf("failed to lock events of %s: %w", key, err)
+	}
+
+	trim := `DELETE FROM session_events WHERE key = $1 AND occurred_at <= $2`
+	if _, err := tx.ExecContext(ctx, trim, key, at.Add(-window)); err != nil {
+		return nil, fmt.Errorf("failed to trim events of %s: %w", key, err)
+	}
+
+	count := `SELECT COUNT(*), MAX(occurred_at) FROM session_events WHERE key = $1`
+	recorded := &RecordedEvent{}
+	var latest sql.NullTime
+	if err := tx.QueryRowContext(ctx, count, key).Scan(&recorded.Before, &latest); err != nil {
+		return nil, fmt.Errorf("failed to count events of %s: %w", key, err)
+	}
+	recorded.Latest = latest.Time
+
+	insert := `INSERT INTO session_events (key, occurred_at, expires_at) VALUES ($1, $2, $3) RETURNING id`
+	var id int64
+	if err := tx.QueryRowContext(ctx, insert, key, at, at.Add(window)).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to add event to %s: %w", key, err)
+	}
+	recorded.ID = strconv.FormatInt(id, 10)
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return recorded, nil
+}
+
+// RemoveEvent implements SessionStore
+func (s *PostgresSessionStore) RemoveEvent(ctx context.Context, key, eventID string) error {
+	id, err := strconv.ParseInt(eventID, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	query := `DELETE FROM session_events WHERE key = $1 AND id = $2`
+	if _, err := s.db.ExecContext(ctx, query, key, id); err != nil {
+		return fmt.Errorf("failed to remove event from %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// DeleteEvents implements SessionStore
+func (s *PostgresSessionStore) DeleteEvents(ctx context.Context, key string) error {
+	query := `DELETE FROM session_events WHERE key = $1`
+
+	if _, err := s.db.ExecContext(ctx, query, key); err != nil {
+		return fmt.Errorf("failed to delete events of %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes the sessions, values and events that have expired and
+// returns how many rows were deleted
+func (s *PostgresSessionStore) PurgeExpired(ctx context.Context) (int64, error) {
+	var purged int64
+	for _, table := range []string{"sessions", "session_values", "session_events"} {
+		result, err := s.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE expires_at <= $1`, time.Now())
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return purged, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		purged += rows
+	}
+
+	return purged, nil
+}
+
+// Ping implements SessionStore
+func (s *PostgresSessionStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close implements SessionStore. The database connection belongs to the caller
+// and is left open.
+func (s *PostgresSessionStore) Close() error {
+	return nil
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// SessionKeyPrefix is the prefix for session keys in Redis
+	SessionKeyPrefix = "session:"
+
+	// UserSessionsKeyPrefix is the prefix for the per-user session indexes in Redis
+	UserSessionsKeyPrefix = "user-sessions:"
+)
+
+// RedisSessionStore is a SessionStore backed by Redis. Besides the sessions
+// themselves it keeps a sorted set per user of the user's session IDs, scored by
+// expiry, so a user's sessions are found without scanning every session. The
+// index is written in the same pipeline as the session but not atomically, as
+// the keys may live on different Redis Cluster nodes; readers tolerate stale
+// entries. The index lives as long as the latest session saved to it, so the
+// sessions of a user are expected to share a timeout.
+type RedisSessionStore struct {
+	client *redis.Client
+}
+
+// RedisConfig holds Redis session store configuration
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// NewRedisSessionStore creates a new Redis session store. It does not connect
+// until the store is first used, so it can be created while Redis is down.
+func NewRedisSessionStore(config RedisConfig) *RedisSessionStore {
+	return &RedisSessionStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     config.Addr,
+			Password: config.Password,
+			DB:       config.DB,
+		}),
+	}
+}
+
+// SaveSession writes a session and its entry in the user's index, and drops the
+// index entries of sessions that have expired. It implements SessionStore.
+func (s *RedisSessionStore) SaveSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	now := time.Now()
+	indexKey := userSessionsKey(data.UserID)
+	pipe := s.client.Pipeline()
+	pipe.Set(ctx, SessionKeyPrefix+sessionID, jsonData, ttl)
+	pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: sessionID})
+	pipe.ZRemRangeByScore(ctx, indexKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.Expire(ctx, indexKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSession writes a session with SET XX, which only replaces a key that
+// exists, so a session deleted meanwhile stays deleted. Its index entry is
+// extended afterwards; should the session be deleted in between, listing drops
+// the entry. It implements SessionStore.
+func (s *RedisSessionStore) UpdateSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	updated, err := s.client.SetXX(ctx, SessionKeyPrefix+sessionID, jsonData, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if !updated {
+		return ErrSessionNotFound
+	}
+
+	now := time.Now()
+	indexKey := userSessionsKey(data.UserID)
+	pipe := s.client.Pipeline()
+	pipe.ZAddXX(ctx, indexKey, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: sessionID})
+	pipe.Expire(ctx, indexKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update session index: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession implements SessionStore
+func (s *RedisSessionStore) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
+	jsonData, err := s.client.Get(ctx, SessionKeyPrefix+sessionID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var data SessionData
+	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+
+	return &data, nil
+}
+
+// DeleteSession deletes a session and its entry in the user's index. It
+// implements SessionStore.
+func (s *RedisSessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	data, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	pipe := s.client.Pipeline()
+	pipe.Del(ctx, SessionKeyPrefix+sessionID)
+	pipe.ZRem(ctx, userSessionsKey(data.UserID), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return nil
+}
+
+// ListUserSessions returns the sessions in a user's index and prunes the entries
+// of sessions that are gone. It implements SessionStore.
+func (s *RedisSessionStore) ListUserSessions(ctx context.Context, userID int64) ([]*UserSession, error) {
+	indexKey := userSessionsKey(userID)
+	now := "(" + strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	sessionIDs, err := s.client.ZRangeByScore(ctx, indexKey, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+
+	// One GET per session rather than MGET, which Redis Cluster refuses across slots
+	pipe := s.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		gets[i] = pipe.Get(ctx, SessionKeyPrefix+sessionID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var sessions []*UserSession
+	var stale []interface{}
+	for i, get := range gets {
+		jsonData, err := get.Result()
+		if err != nil {
+			// Deleted or timed out since it was indexed
+			stale = append(stale, sessionIDs[i])
+			continue
+		}
+
+		session := &UserSession{ID: sessionIDs[i]}
+		if err := json.Unmarshal([]byte(jsonData), &session.SessionData); err != nil || session.UserID != userID {
+			stale = append(stale, sessionIDs[i])
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	if len(stale) > 0 {
+		if err := s.client.ZRem(ctx, indexKey, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to prune sessions: %w", err)
+		}
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSessions implements SessionStore
+func (s *RedisSessionStore) DeleteUserSessions(ctx context.Context, userID int64, keepSessionID string) error {
+	indexKey := userSessionsKey(userID)
+
+	sessionIDs, err := s.client.ZRange(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// One DEL per session, as the keys may live on different cluster nodes
+	pipe := s.client.Pipeline()
+	for _, sessionID := range sessionIDs {
+		if sessionID == keepSessionID {
+			continue
+		}
+		pipe.Del(ctx, SessionKeyPrefix+sessionID)
+		pipe.ZRem(ctx, indexKey, sessionID)
+	}
+	if pipe.Len() == 0 {
+		return nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	return nil
+}
+
+// SetValue implements SessionStore
+func (s *RedisSessionStore) SetValue(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := s.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set %s: %w", key, err)
+	}
+	return nil
+}
+
+// GetValue implements SessionStore
+func (s *RedisSessionStore) GetValue(ctx context.Context, key string) (string, error) {
+	value, err := s.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", ErrStoreKeyNotFound
+		}
+		return "", fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// TakeValue implements SessionStore
+func (s *RedisSessionStore) TakeValue(ctx context.Context, key string) (string, error) {
+	value, err := s.client.GetDel(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", ErrStoreKeyNotFound
+		}
+		return "", fmt.Errorf("failed to take %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Increment implements SessionStore
+func (s *RedisSessionStore) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increment %s: %w", key, err)
+	}
+
+	return incr.Val(), nil
+}
+
+// addEventScript trims a sorted set of event times to the window, reads the count
+// and latest score of what is left and adds the new event, all in one step.
+// KEYS[1] is the set; ARGV holds the event ID, its time, the window cutoff and
+// the window in milliseconds.
+var addEventScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+local count = redis.call('ZCARD', KEYS[1])
+local latest = redis.call('ZREVRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {count, latest[2] or '0'}
+`)
+
+// AddEvent records an event in a sorted set scored by time. It implements SessionStore.
+func (s *RedisSessionStore) AddEvent(ctx context.Context, key string, at time.Time, window time.Duration) (*RecordedEvent, error) {
+	id, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{id, at.UnixMilli(), at.Add(-window).UnixMilli(), window.Milliseconds()}
+	result, err := addEventScript.Run(ctx, s.client, []string{key}, args...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to add event to %s: %w", key, err)
+	}
+
+	count, _ := result[0].(int64)
+	latestScore, _ := result[1].(string)
+	latest, err := strconv.ParseInt(latestScore, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse latest event of %s: %w", key, err)
+	}
+
+	recorded := &RecordedEvent{ID: id, Before: int(count)}
+	if count > 0 {
+		recorded.Latest = time.UnixMilli(latest)
+	}
+
+	return recorded, nil
+}
+
+// RemoveEvent implements SessionStore
+func (s *RedisSessionStore) RemoveEvent(ctx context.Context, key, eventID string) error {
+	if err := s.client.ZRem(ctx, key, eventID).Err(); err != nil {
+		return fmt.Errorf("failed to remove event from %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteEvents implements SessionStore
+func (s *RedisSessionStore) DeleteEvents(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("failed to delete events of %s: %w", key, err)
+	}
+	return nil
+}
+
+// Ping implements SessionStore
+func (s *RedisSessionStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis connection
+func (s *RedisSessionStore) Close() error {
+	return s.client.Close()
+}
+
+// userSessionsKey returns the key of a user's session index
+func userSessionsKey(userID int64) string {
+	return UserSessionsKeyPrefix + strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrStoreKeyNotFound is returned when a session store value does not exist or has expired
+var ErrStoreKeyNotFound = errors.New("session store key not found")
+
+// SessionStore is the storage backend of the session service. Besides sessions
+// it holds short-lived values, counters and sliding windows of event times under
+// namespaced keys. Everything it holds expires, so losing it logs users out but
+// loses nothing permanent. Implementations return ErrSessionNotFound and
+// ErrStoreKeyNotFound for missing or expired entries; any other error means the
+// backend could not be reached.
+type SessionStore interface {
+	// SaveSession writes a session, replacing any session with the same ID. The
+	// session expires after ttl unless it is saved again.
+	SaveSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error
+
+	// UpdateSession replaces a session that exists and extends it by ttl. It
+	// fails with ErrSessionNotFound when the session expired or was deleted, so a
+	// revoked session is never brought back.
+	UpdateSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error
+
+	// GetSession returns a session
+	GetSession(ctx context.Context, sessionID string) (*SessionData, error)
+
+	// DeleteSession deletes a session; deleting a missing session is not an error
+	DeleteSession(ctx context.Context, sessionID string) error
+
+	// ListUserSessions returns the sessions of a user in no particular order
+	ListUserSessions(ctx context.Context, userID int64) ([]*UserSession, error)
+
+	// DeleteUserSessions deletes the sessions of a user except keepSessionID,
+	// which may be empty
+	DeleteUserSessions(ctx context.Context, userID int64, keepSessionID string) error
+
+	// SetValue stores a value under a key until ttl has passed
+	SetValue(ctx context.Context, key, value string, ttl time.Duration) error
+
+	// GetValue returns the value of a key
+	GetValue(ctx context.Context, key string) (string, error)
+
+	// TakeValue atomically returns and deletes the value of a key
+	TakeValue(ctx context.Context, key string) (string, error)
+
+	// Increment adds one to the counter under a key, starting from zero, and
+	// returns the new count. The counter expires ttl after its latest increment.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	// AddEvent records an event at a time under a key and drops the events that
+	// are older than window. The events recorded before it within the window are
+	// counted in the same atomic step, so concurrent callers each see the others.
+	AddEvent(ctx context.Context, key string, at time.Time, window time.Duration) (*RecordedEvent, error)
+
+	// RemoveEvent forgets a single event; removing a missing event is not an error
+	RemoveEvent(ctx context.Context, key, eventID string) error
+
+	// DeleteEvents forgets every event of a key
+	DeleteEvents(ctx context.Context, key string) error
+
+	// Ping checks that the backend can be reached
+	Ping(ctx context.Context) error
+
+	// Close releases the connections of the store
+	Close() error
+}
+
+// RecordedEvent is an event added by SessionStore.AddEvent, with the events of its
+// key that preceded it within the window
+type RecordedEvent struct {
+	// ID identifies the event for RemoveEvent
+	ID string
+
+	// Before is the number of earlier events within the window
+	Before int
+
+	// Latest is the time of the latest earlier event; zero without one
+	Latest time.Time
+}
+
+// memorySweepInterval is how often the in-memory store drops expired entries
+// that were never read again
+const memorySweepInterval = time.Minute
+
+// MemorySessionStore is a SessionStore that keeps everything in process memory.
+// It suits tests and single-instance development setups: its contents are lost
+// on restart and are not shared between instances of the service.
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	sessions  map[string]memorySession
+	values    map[string]memoryValue
+	events    map[string]memoryEvents
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data      SessionData
+	expiresAt time.Time
+}
+
+type memoryValue struct {
+	value     string
+	count     int64
+	expiresAt time.Time
+}
+
+type memoryEvents struct {
+	events    []memoryEvent
+	expiresAt time.Time
+}
+
+type memoryEvent struct {
+	id string
+	at time.Time
+}
+
+// NewMemorySessionStore creates a new in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		now:      time.Now,
+		sessions: make(map[string]memorySession),
+		values:   make(map[string]memoryValue),
+		events:   make(map[string]memoryEvents),
+	}
+}
+
+// SaveSession implements SessionStore
+func (s *MemorySessionStore) SaveSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.sessions[sessionID] = memorySession{data: copySessionData(data), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// UpdateSession implements SessionStore
+func (s *MemorySessionStore) UpdateSession(ctx context.Context, sessionID string, data *SessionData, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	session, ok := s.sessions[sessionID]
+	if !ok || !now.Before(session.expiresAt) {
+		return ErrSessionNotFound
+	}
+
+	s.sessions[sessionID] = memorySession{data: copySessionData(data), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// GetSession implements SessionStore
+func (s *MemorySessionStore) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || !s.now().Before(session.expiresAt) {
+		return nil, ErrSessionNotFound
+	}
+
+	data := copySessionData(&session.data)
+	return &data, nil
+}
+
+// DeleteSession implements SessionStore
+func (s *MemorySessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// ListUserSessions implements SessionStore
+func (s *MemorySessionStore) ListUserSessions(ctx context.Context, userID int64) ([]*UserSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var sessions []*UserSession
+	for id, session := range s.sessions {
+		if session.data.UserID == userID && now.Before(session.expiresAt) {
+			sessions = append(sessions, &UserSession{ID: id, SessionData: copySessionData(&session.data)})
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteUserSessions implements SessionStore
+func (s *MemorySessionStore) DeleteUserSessions(ctx context.Context, userID int64, keepSessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.data.UserID == userID && id != keepSessionID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// SetValue implements SessionStore
+func (s *MemorySessionStore) SetValue(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.values[key] = memoryValue{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// GetValue implements SessionStore
+func (s *MemorySessionStore) GetValue(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[key]
+	if !ok || !s.now().Before(value.expiresAt) {
+		return "", ErrStoreKeyNotFound
+	}
+	return value.value, nil
+}
+
+// TakeValue implements SessionStore
+func (s *MemorySessionStore) TakeValue(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[key]
+	delete(s.values, key)
+	if !ok || !s.now().Before(value.expiresAt) {
+		return "", ErrStoreKeyNotFound
+	}
+	return value.value, nil
+}
+
+// Increment implements SessionStore
+func (s *MemorySessionStore) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	value := s.values[key]
+	if !now.Before(value.expiresAt) {
+		value = memoryValue{}
+	}
+	value.count++
+	value.expiresAt = now.Add(ttl)
+	s.values[key] = value
+
+	return value.count, nil
+}
+
+// AddEvent implements SessionStore
+func (s *MemorySessionStore) AddEvent(ctx context.Context, key string, at time.Time, window time.Duration) (*RecordedEvent, error) {
+	id, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	recorded := &RecordedEvent{ID: id}
+	var kept []memoryEvent
+	if events, ok := s.events[key]; ok && now.Before(events.expiresAt) {
+		cutoff := at.Add(-window)
+		for _, event := range events.events {
+			if !event.at.After(cutoff) {
+				continue
+			}
+			kept = append(kept, event)
+			recorded.Before++
+			if event.at.After(recorded.Latest) {
+				recorded.Latest = event.at
+			}
+		}
+	}
+	s.events[key] = memoryEvents{events: append(kept, memoryEvent{id: id, at: at}), expiresAt: now.Add(window)}
+
+	return recorded, nil
+}
+
+// RemoveEvent implements SessionStore
+func (s *MemorySessionStore) RemoveEvent(ctx context.Context, key, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, ok := s.events[key]
+	if !ok {
+		return nil
+	}
+
+	var kept []memoryEvent
+	for _, event := range events.events {
+		if event.id != eventID {
+			kept = append(kept, event)
+		}
+	}
+	events.events = kept
+	s.events[key] = events
+	return nil
+}
+
+// DeleteEvents implements SessionStore
+func (s *MemorySessionStore) DeleteEvents(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, key)
+	return nil
+}
+
+// Ping implements SessionStore; the in-memory store is always available
+func (s *MemorySessionStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close implements SessionStore
+func (s *MemorySessionStore) Close() error {
+	return nil
+}
+
+// sweep drops expired entries, at most once per sweep interval. The caller must
+// hold the lock.
+func (s *MemorySessionStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for id, session := range s.sessions {
+		if !now.Before(session.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	for key, value := range s.values {
+		if !now.Before(value.expiresAt) {
+			delete(s.values, key)
+		}
+	}
+	for key, events := range s.events {
+		if !now.Before(events.expiresAt) {
+			delete(s.events, key)
+		}
+	}
+}
+
+// copySessionData returns a copy of session data that shares no pointers with it
+func copySessionData(data *SessionData) SessionData {
+	c := *data
+	if data.CustomerID != nil {
+		customerID := *data.CustomerID
+		c.CustomerID = &customerID
+	}
+	if data.SSOCustomerID != nil {
+		ssoCustomerID := *data.SSOCustomerID
+		c.SSOCustomerID = &ssoCustomerID
+	}
+	return c
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	_ "github.com/lib/pq"
+)
+
+// storeTTL is the expiry used by the conformance tests. It is short so that the
+// PostgreSQL store, whose clock cannot be faked, only has to wait for a moment.
+const storeTTL = time.Second
+
+// sessionStoreHarness is a session store under test together with a way to let
+// its entries expire
+type sessionStoreHarness struct {
+	store   SessionStore
+	advance func(d time.Duration)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, func(t *testing.T) sessionStoreHarness {
+		store := NewMemorySessionStore()
+		now := time.Now()
+		store.now = func() time.Time { return now }
+		return sessionStoreHarness{store: store, advance: func(d time.Duration) { now = now.Add(d) }}
+	})
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	testSessionStore(t, func(t *testing.T) sessionStoreHarness {
+		mr := miniredis.RunT(t)
+		store := NewRedisSessionStore(RedisConfig{Addr: mr.Addr()})
+		t.Cleanup(func() { store.Close() })
+		return sessionStoreHarness{store: store, advance: mr.FastForward}
+	})
+}
+
+// TestPostgresSessionStore runs against the database in TEST_DATABASE_URL, which
+// must have all migrations applied, and is skipped when it is not set
+func TestPostgresSessionStore(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	testSessionStore(t, func(t *testing.T) sessionStoreHarness {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return sessionStoreHarness{store: NewPostgresSessionStore(db), advance: time.Sleep}
+	})
+}
+
+// testSessionStore is the conformance suite every SessionStore has to pass. Keys
+// and user IDs are unique per run, so stores may hold data of earlier runs.
+func testSessionStore(t *testing.T, newHarness func(t *testing.T) sessionStoreHarness) {
+	ctx := context.Background()
+	run := time.Now().UnixNano()
+	key := func(name string) string { return fmt.Sprintf("test:%d:%s", run, name) }
+	user := func(n int64) int64 { return run%1_000_000_000*10 + n }
+
+	t.Run("Sessions", func(t *testing.T) {
+		store := newHarness(t).store
+		customerID := int64(7)
+
+		for _, s := range []struct {
+			id     string
+			userID int64
+		}{{key("laptop"), user(1)}, {key("phone"), user(1)}, {key("other"), user(2)}} {
+			data := &SessionData{UserID: s.userID, Email: "jane@example.com", CustomerID: &customerID, LastAccess: time.Now()}
+			if err := store.SaveSession(ctx, s.id, data, time.Hour); err != nil {
+				t.Fatalf("SaveSession(%s): %v", s.id, err)
+			}
+		}
+
+		data, err := store.GetSession(ctx, key("laptop"))
+		if err != nil {
+			t.Fatalf("GetSession: %v", err)
+		}
+		if data.UserID != user(1) || data.Email != "jane@example.com" || data.CustomerID == nil || *data.CustomerID != customerID {
+			t.Fatalf("unexpected session: %+v", data)
+		}
+
+		// Saving again replaces the session
+		data.Device = "Firefox on Linux"
+		if err := store.SaveSession(ctx, key("laptop"), data, time.Hour); err != nil {
+			t.Fatalf("SaveSession: %v", err)
+		}
+		sessions, err := store.ListUserSessions(ctx, user(1))
+		if err != nil || len(sessions) != 2 {
+			t.Fatalf("ListUserSessions = %+v, %v", sessions, err)
+		}
+		for _, session := range sessions {
+			if session.ID == key("laptop") && session.Device != "Firefox on Linux" {
+				t.Fatalf("session not replaced: %+v", session)
+			}
+		}
+
+		if err := store.DeleteSession(ctx, key("phone")); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, err := store.GetSession(ctx, key("phone")); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("GetSession after delete: got %v, want ErrSessionNotFound", err)
+		}
+		if err := store.DeleteSession(ctx, key("phone")); err != nil {
+			t.Fatalf("DeleteSession of missing session: %v", err)
+		}
+
+		if err := store.SaveSession(ctx, key("tablet"), &SessionData{UserID: user(1)}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteUserSessions(ctx, user(1), key("laptop")); err != nil {
+			t.Fatalf("DeleteUserSessions: %v", err)
+		}
+		if sessions, err := store.ListUserSessions(ctx, user(1)); err != nil || len(sessions) != 1 || sessions[0].ID != key("laptop") {
+			t.Fatalf("sessions after deleting others = %+v, %v", sessions, err)
+		}
+		if err := store.DeleteUserSessions(ctx, user(1), ""); err != nil {
+			t.Fatalf("DeleteUserSessions: %v", err)
+		}
+		if sessions, err := store.ListUserSessions(ctx, user(1)); err != nil || len(sessions) != 0 {
+			t.Fatalf("sessions after deleting all = %+v, %v", sessions, err)
+		}
+
+		// Other users' sessions are untouched
+		if _, err := store.GetSession(ctx, key("other")); err != nil {
+			t.Fatalf("GetSession(other): %v", err)
+		}
+	})
+
+	t.Run("SessionExpiry", func(t *testing.T) {
+		h := newHarness(t)
+
+		if err := h.store.SaveSession(ctx, key("idle"), &SessionData{UserID: user(3)}, storeTTL); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.store.SaveSession(ctx, key("active"), &SessionData{UserID: user(3)}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		h.advance(storeTTL + 100*time.Millisecond)
+
+		if _, err := h.store.GetSession(ctx, key("idle")); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("GetSession after expiry: got %v, want ErrSessionNotFound", err)
+		}
+		if sessions, err := h.store.ListUserSessions(ctx, user(3)); err != nil || len(sessions) != 1 || sessions[0].ID != key("active") {
+			t.Fatalf("sessions after expiry = %+v, %v", sessions, err)
+		}
+	})
+
+	t.Run("UpdateSession", func(t *testing.T) {
+		h := newHarness(t)
+
+		if err := h.store.SaveSession(ctx, key("updated"), &SessionData{UserID: user(4)}, storeTTL); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.store.UpdateSession(ctx, key("updated"), &SessionData{UserID: user(4), Device: "curl"}, time.Hour); err != nil {
+			t.Fatalf("UpdateSession: %v", err)
+		}
+
+		// The update extended the session past its first expiry
+		h.advance(storeTTL + 100*time.Millisecond)
+		data, err := h.store.GetSession(ctx, key("updated"))
+		if err != nil || data.Device != "curl" {
+			t.Fatalf("GetSession after update = %+v, %v", data, err)
+		}
+		if sessions, err := h.store.ListUserSessions(ctx, user(4)); err != nil || len(sessions) != 1 {
+			t.Fatalf("ListUserSessions after update = %+v, %v", sessions, err)
+		}
+
+		// Deleted and expired sessions are not brought back
+		if err := h.store.DeleteSession(ctx, key("updated")); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.store.SaveSession(ctx, key("expired"), &SessionData{UserID: user(4)}, storeTTL); err != nil {
+			t.Fatal(err)
+		}
+		h.advance(storeTTL + 100*time.Millisecond)
+		for _, id := range []string{key("updated"), key("expired"), key("never")} {
+			if err := h.store.UpdateSession(ctx, id, &SessionData{UserID: user(4)}, time.Hour); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("UpdateSession(%s): got %v, want ErrSessionNotFound", id, err)
+			}
+			if _, err := h.store.GetSession(ctx, id); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("GetSession(%s) after update: got %v, want ErrSessionNotFound", id, err)
+			}
+		}
+		if sessions, err := h.store.ListUserSessions(ctx, user(4)); err != nil || len(sessions) != 0 {
+			t.Fatalf("ListUserSessions after delete = %+v, %v", sessions, err)
+		}
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		h := newHarness(t)
+
+		if _, err := h.store.GetValue(ctx, key("missing")); !errors.Is(err, ErrStoreKeyNotFound) {
+			t.Fatalf("GetValue of missing key: got %v, want ErrStoreKeyNotFound", err)
+		}
+
+		if err := h.store.SetValue(ctx, key("value"), `{"a":1}`, time.Hour); err != nil {
+			t.Fatalf("SetValue: %v", err)
+		}
+		if value, err := h.store.GetValue(ctx, key("value")); err != nil || value != `{"a":1}` {
+			t.Fatalf("GetValue = %q, %v", value, err)
+		}
+		if value, err := h.store.TakeValue(ctx, key("value")); err != nil || value != `{"a":1}` {
+			t.Fatalf("TakeValue = %q, %v", value, err)
+		}
+		if _, err := h.store.TakeValue(ctx, key("value")); !errors.Is(err, ErrStoreKeyNotFound) {
+			t.Fatalf("second TakeValue: got %v, want ErrStoreKeyNotFound", err)
+		}
+
+		if err := h.store.SetValue(ctx, key("short"), "1", storeTTL); err != nil {
+			t.Fatal(err)
+		}
+		h.advance(storeTTL + 100*time.Millisecond)
+		if _, err := h.store.GetValue(ctx, key("short")); !errors.Is(err, ErrStoreKeyNotFound) {
+			t.Fatalf("GetValue after expiry: got %v, want ErrStoreKeyNotFound", err)
+		}
+		if _, err := h.store.TakeValue(ctx, key("short")); !errors.Is(err, ErrStoreKeyNotFound) {
+			t.Fatalf("TakeValue after expiry: got %v, want ErrStoreKeyNotFound", err)
+		}
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		h := newHarness(t)
+
+		for want := int64(1); want <= 3; want++ {
+			if count, err := h.store.Increment(ctx, key("counter"), storeTTL); err != nil || count != want {
+				t.Fatalf("Increment = %d, %v, want %d", count, err, want)
+			}
+		}
+
+		h.advance(storeTTL + 100*time.Millisecond)
+		if count, err := h.store.Increment(ctx, key("counter"), storeTTL); err != nil || count != 1 {
+			t.Fatalf("Increment after expiry = %d, %v, want 1", count, err)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		store := newHarness(t).store
+		now := time.Now().Truncate(time.Second)
+
+		add := func(at time.Time, window time.Duration) *RecordedEvent {
+			t.Helper()
+			event, err := store.AddEvent(ctx, key("events"), at, window)
+			if err != nil {
+				t.Fatalf("AddEvent: %v", err)
+			}
+			return event
+		}
+
+		add(now.Add(-3*time.Minute), 5*time.Minute)
+		add(now.Add(-2*time.Minute), 5*time.Minute)
+		middle := add(now.Add(-time.Minute), 5*time.Minute)
+		if middle.Before != 2 || !middle.Latest.Equal(now.Add(-2*time.Minute)) || middle.ID == "" {
+			t.Fatalf("third event = %+v, want 2 before it", middle)
+		}
+
+		// A shorter window drops the older events
+		if event := add(now, 90*time.Second); event.Before != 1 || !event.Latest.Equal(now.Add(-time.Minute)) {
+			t.Fatalf("event after trim = %+v, want 1 before it", event)
+		}
+
+		if err := store.RemoveEvent(ctx, key("events"), middle.ID); err != nil {
+			t.Fatalf("RemoveEvent: %v", err)
+		}
+		if event := add(now, time.Hour); event.Before != 1 || !event.Latest.Equal(now) {
+			t.Fatalf("event after remove = %+v, want 1 before it", event)
+		}
+
+		if err := store.DeleteEvents(ctx, key("events")); err != nil {
+			t.Fatalf("DeleteEvents: %v", err)
+		}
+		if event := add(now, time.Hour); event.Before != 0 || !event.Latest.IsZero() {
+			t.Fatalf("event after delete = %+v, want none before it", event)
+		}
+	})
+
+	t.Run("ConcurrentEvents", func(t *testing.T) {
+		store := newHarness(t).store
+		now := time.Now()
+
+		// Every event sees a different number of events before it
+		const events = 20
+		seen := make(chan int, events)
+		var wg sync.WaitGroup
+		for i := 0; i < events; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				event, err := store.AddEvent(ctx, key("concurrent"), now, time.Minute)
+				if err != nil {
+					t.Errorf("AddEvent: %v", err)
+					return
+				}
+				seen <- event.Before
+			}()
+		}
+		wg.Wait()
+		close(seen)
+
+		counts := make(map[int]bool)
+		for before := range seen {
+			counts[before] = true
+		}
+		if len(counts) != events {
+			t.Fatalf("events saw %d distinct counts, want %d", len(counts), events)
+		}
+	})
+
+	t.Run("Ping", func(t *testing.T) {
+		if err := newHarness(t).store.Ping(ctx); err != nil {
+			t.Fatalf("Ping: %v", err)
+		}
+	})
+}
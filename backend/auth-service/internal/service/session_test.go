@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+func TestSessionIndexTracksUserSessions(t *testing.T) {
+	ctx := context.Background()
+	svc, mr := newTestSessionService(t)
+
+	for _, s := range []struct {
+		id     string
+		userID int64
+	}{{"laptop", 1}, {"phone", 1}, {"other", 2}} {
+		if err := svc.CreateSession(ctx, s.id, &SessionData{UserID: s.userID}); err != nil {
+			t.Fatalf("CreateSession(%s): %v", s.id, err)
+		}
+	}
+
+	// An access moves a session to the front
+	time.Sleep(2 * time.Millisecond)
+	if err := svc.RefreshSession(ctx, "laptop"); err != nil {
+		t.Fatalf("RefreshSession: %v", err)
+	}
+
+	sessions, err := svc.ListUserSessions(ctx, 1)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "laptop" || sessions[1].ID != "phone" {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+
+	if err := svc.DeleteSession(ctx, "phone"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if members, _ := mr.ZMembers(UserSessionsKeyPrefix + "1"); len(members) != 1 || members[0] != "laptop" {
+		t.Fatalf("index after delete = %v", members)
+	}
+
+	if err := svc.DeleteUserSessions(ctx, 1); err != nil {
+		t.Fatalf("DeleteUserSessions: %v", err)
+	}
+	if _, err := svc.GetSession(ctx, "laptop"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("GetSession after delete: got %v, want ErrSessionNotFound", err)
+	}
+
+	// Other users' sessions are untouched
+	if _, err := svc.GetSession(ctx, "other"); err != nil {
+		t.Fatalf("GetSession(other): %v", err)
+	}
+}
+
+func TestSessionIndexKeepsCurrentAndPrunesExpired(t *testing.T) {
+	ctx := context.Background()
+	svc, mr := newTestSessionService(t)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := svc.CreateSession(ctx, id, &SessionData{UserID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := svc.DeleteOtherUserSessions(ctx, 1, "b"); err != nil {
+		t.Fatalf("DeleteOtherUserSessions: %v", err)
+	}
+	sessions, err := svc.ListUserSessions(ctx, 1)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != "b" {
+		t.Fatalf("sessions = %+v, %v", sessions, err)
+	}
+
+	// A session key that timed out leaves a stale index entry behind, which
+	// listing drops
+	mr.Del(SessionKeyPrefix + "b")
+	sessions, err = svc.ListUserSessions(ctx, 1)
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("sessions after timeout = %+v, %v", sessions, err)
+	}
+	if members, _ := mr.ZMembers(UserSessionsKeyPrefix + "1"); len(members) != 0 {
+		t.Fatalf("stale index entries = %v", members)
+	}
+
+	if err := svc.RefreshSession(ctx, "b"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("RefreshSession: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+// refreshStore deletes a session between the read and the write of a refresh, like
+// a logout racing with a request of the same login
+type refreshStore struct {
+	SessionStore
+}
+
+func (s refreshStore) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
+	data, err := s.SessionStore.GetSession(ctx, sessionID)
+	if err == nil {
+		err = s.SessionStore.DeleteSession(ctx, sessionID)
+	}
+	return data, err
+}
+
+func TestRefreshSessionDoesNotResurrectDeletedSession(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySessionStore()
+	svc := NewSessionService(SessionConfig{Store: refreshStore{store}})
+
+	if err := svc.CreateSession(ctx, "laptop", &SessionData{UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RefreshSession(ctx, "laptop"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("RefreshSession: got %v, want ErrSessionNotFound", err)
+	}
+	if _, err := store.GetSession(ctx, "laptop"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("session after the racing refresh: got %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestDescribeDevice(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36 Edg/122.0.0.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.3 Safari/605.1.15":         "Safari on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_3 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.3 Safari/604.1":     "Safari on iOS",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Mobile Safari/537.36":         "Chrome on Android",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:123.0) Gecko/20100101 Firefox/123.0":                                                        "Firefox on Linux",
+		"curl/8.4.0": "curl",
+		"":           "",
+	}
+
+	for userAgent, want := range tests {
+		if got := describeDevice(userAgent); got != want {
+			t.Errorf("describeDevice(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
+
+func TestIdleSessionEndsLogin(t *testing.T) {
+	ctx := context.Background()
+	sessions, mr := newTestSessionService(t)
+	f := newFixtureWith(t, fixtureConfig{Sessions: sessions})
+	f.addJane(t, domain.RoleAdministrator)
+
+	login, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.SessionID == "" || claims.SessionID != claims.FamilyID {
+		t.Fatalf("sid = %q, fid = %q", claims.SessionID, claims.FamilyID)
+	}
+
+	// Using the access token keeps the session alive past the idle timeout
+	mr.FastForward(20 * time.Minute)
+	if _, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken); err != nil {
+		t.Fatalf("ValidateAccessToken after 20 minutes: %v", err)
+	}
+	mr.FastForward(20 * time.Minute)
+	refreshed, err := f.auth.RefreshTokens(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens after 40 minutes of use: %v", err)
+	}
+
+	// After 30 idle minutes the login is over, although its tokens have not expired
+	mr.FastForward(DefaultSessionTimeout + time.Second)
+	if _, err := f.jwt.ValidateAccessToken(ctx, refreshed.AccessToken); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("ValidateAccessToken after idling: got %v, want ErrSessionExpired", err)
+	}
+	if _, err := f.auth.RefreshTokens(ctx, refreshed.RefreshToken); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("RefreshTokens after idling: got %v, want ErrSessionExpired", err)
+	}
+	for _, token := range f.refreshTokens.tokens {
+		if !token.IsRevoked() {
+			t.Fatalf("refresh token %s of the idle session was not revoked", token.JTI)
+		}
+	}
+}
+
+func TestAuthServiceWithMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addJane(t, domain.RoleAdministrator)
+
+	login, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	claims, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+
+	sessions, err := f.auth.ListSessions(ctx, claims, claims.UserID)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != claims.SessionID {
+		t.Fatalf("ListSessions = %+v, %v", sessions, err)
+	}
+
+	if err := f.auth.Logout(ctx, claims, login.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken); err == nil {
+		t.Fatal("access token still valid after logout")
+	}
+}
+
+// loginTwice logs jane in on two devices and returns both logins with their claims
+func loginTwice(t *testing.T, f *fixture) ([]*LoginResponse, []*TokenClaims) {
+	t.Helper()
+	ctx := context.Background()
+
+	var logins []*LoginResponse
+	var claims []*TokenClaims
+	for _, userAgent := range []string{"laptop", "phone"} {
+		login, err := f.auth.Login(WithRequestInfo(ctx, RequestInfo{UserAgent: userAgent}), LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+		if err != nil {
+			t.Fatalf("Login(%s): %v", userAgent, err)
+		}
+		c, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken)
+		if err != nil {
+			t.Fatalf("ValidateAccessToken(%s): %v", userAgent, err)
+		}
+		logins = append(logins, login)
+		claims = append(claims, c)
+	}
+	return logins, claims
+}
+
+func TestLogoutEndsOnlyItsLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addJane(t, domain.RoleAdministrator)
+	logins, claims := loginTwice(t, f)
+
+	if err := f.auth.Logout(ctx, claims[0], logins[0].RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := f.jwt.ValidateAccessToken(ctx, logins[0].AccessToken); err == nil {
+		t.Fatal("access token still valid after logout")
+	}
+	if _, err := f.auth.RefreshTokens(ctx, logins[0].RefreshToken); err == nil {
+		t.Fatal("refresh token still valid after logout")
+	}
+	if _, err := f.sessions.GetSession(ctx, claims[0].SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("GetSession after logout: got %v, want ErrSessionNotFound", err)
+	}
+
+	// The other login is untouched
+	if _, err := f.jwt.ValidateAccessToken(ctx, logins[1].AccessToken); err != nil {
+		t.Fatalf("other access token: %v", err)
+	}
+	if _, err := f.auth.RefreshTokens(ctx, logins[1].RefreshToken); err != nil {
+		t.Fatalf("other refresh token: %v", err)
+	}
+}
+
+func TestLogoutAllEndsEveryLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addJane(t, domain.RoleAdministrator)
+	logins, claims := loginTwice(t, f)
+
+	if err := f.auth.LogoutAll(ctx, claims[0]); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+
+	for i, login := range logins {
+		if _, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken); err == nil {
+			t.Errorf("access token %d still valid after logout-all", i)
+		}
+		if _, err := f.auth.RefreshTokens(ctx, login.RefreshToken); err == nil {
+			t.Errorf("refresh token %d still valid after logout-all", i)
+		}
+	}
+	sessions, err := f.sessions.ListUserSessions(ctx, claims[0].UserID)
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("sessions after logout-all = %+v, %v", sessions, err)
+	}
+
+	// Logging in again works at once
+	login, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("Login after logout-all: %v", err)
+	}
+	if _, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken); err != nil {
+		t.Fatalf("new access token: %v", err)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	jane := f.addJane(t, domain.RoleAdministrator)
+	logins, _ := loginTwice(t, f)
+
+	if err := f.auth.RevokeUserSessions(ctx, jane.ID); err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+
+	// Tokens from the current second fail the session check instead of the revocation marker
+	for i, login := range logins {
+		_, err := f.jwt.ValidateAccessToken(ctx, login.AccessToken)
+		if !errors.Is(err, ErrRevokedToken) && !errors.Is(err, ErrSessionExpired) {
+			t.Errorf("access token %d: got %v, want ErrRevokedToken or ErrSessionExpired", i, err)
+		}
+	}
+	for _, token := range f.refreshTokens.tokens {
+		if !token.IsRevoked() {
+			t.Fatalf("refresh token %s was not revoked", token.JTI)
+		}
+	}
+	sessions, err := f.sessions.ListUserSessions(ctx, jane.ID)
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("sessions after revocation = %+v, %v", sessions, err)
+	}
+}
+
+func TestRevokeUserTokensComparesWholeSeconds(t *testing.T) {
+	ctx := context.Background()
+	svc := NewSessionService(SessionConfig{Store: NewMemorySessionStore()})
+
+	now := time.Now()
+	if err := svc.RevokeUserTokens(ctx, 1, time.Minute); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+
+	// Tokens from earlier seconds are revoked
+	if revoked, err := svc.IsTokenRevoked(ctx, "", 1, now.Add(-time.Second)); err != nil || !revoked {
+		t.Errorf("token issued a second earlier: revoked %v, %v", revoked, err)
+	}
+
+	// Tokens issued in the same second stay valid, so a login right after the
+	// revocation works; the callers denylist the presenting token instead
+	if revoked, err := svc.IsTokenRevoked(ctx, "", 1, time.Now().Truncate(time.Second)); err != nil || revoked {
+		t.Errorf("token issued in the revocation's second: revoked %v, %v", revoked, err)
+	}
+	if revoked, err := svc.IsTokenRevoked(ctx, "", 2, now.Add(-time.Second)); err != nil || revoked {
+		t.Errorf("other user's token: revoked %v, %v", revoked, err)
+	}
+}
+
+func TestUnavailableSessionStore(t *testing.T) {
+	ctx := context.Background()
+
+	// The service starts while Redis is down
+	mr := miniredis.RunT(t)
+	store := NewRedisSessionStore(RedisConfig{Addr: mr.Addr()})
+	t.Cleanup(func() { store.Close() })
+	mr.Close()
+
+	failClosed := NewSessionService(SessionConfig{Store: store})
+	failOpen := NewSessionService(SessionConfig{Store: store, FailOpen: true})
+
+	if err := failClosed.Ping(ctx); !errors.Is(err, ErrSessionStoreUnavailable) {
+		t.Fatalf("Ping: got %v, want ErrSessionStoreUnavailable", err)
+	}
+
+	// Logins cannot start either way
+	for _, svc := range []*SessionService{failClosed, failOpen} {
+		f := newFixtureWith(t, fixtureConfig{Sessions: svc})
+		f.addJane(t, domain.RoleAdministrator)
+		_, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+		if !errors.Is(err, ErrSessionStoreUnavailable) {
+			t.Fatalf("Login: got %v, want ErrSessionStoreUnavailable", err)
+		}
+		if err := svc.DenylistToken(ctx, "jti", time.Now().Add(time.Minute)); !errors.Is(err, ErrSessionStoreUnavailable) {
+			t.Fatalf("DenylistToken: got %v, want ErrSessionStoreUnavailable", err)
+		}
+	}
+
+	// Using a login fails unless the service fails open
+	if _, err := failClosed.IsTokenRevoked(ctx, "jti", 1, time.Now()); !errors.Is(err, ErrSessionStoreUnavailable) {
+		t.Fatalf("IsTokenRevoked: got %v, want ErrSessionStoreUnavailable", err)
+	}
+	if err := failClosed.RefreshSession(ctx, "session"); !errors.Is(err, ErrSessionStoreUnavailable) {
+		t.Fatalf("RefreshSession: got %v, want ErrSessionStoreUnavailable", err)
+	}
+	if revoked, err := failOpen.IsTokenRevoked(ctx, "jti", 1, time.Now()); err != nil || revoked {
+		t.Fatalf("IsTokenRevoked when failing open = %v, %v", revoked, err)
+	}
+	if err := failOpen.RefreshSession(ctx, "session"); err != nil {
+		t.Fatalf("RefreshSession when failing open: %v", err)
+	}
+}
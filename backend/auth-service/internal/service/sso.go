@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// DefaultSSOTimeout is the default time a single sign-on login may take at the identity provider
+	DefaultSSOTimeout = 10 * time.Minute
+
+	// DefaultSSOLoginCodeDuration is the default lifetime of the one-time code
+	// a browser exchanges for tokens after a single sign-on login
+	DefaultSSOLoginCodeDuration = time.Minute
+
+	// DefaultSSOHTTPTimeout is the default timeout for requests to identity providers
+	DefaultSSOHTTPTimeout = 10 * time.Second
+
+	// SSOOIDCCallbackPath is the redirect URI registered with OpenID Connect providers
+	SSOOIDCCallbackPath = "/api/v1/auth/sso/oidc/callback"
+
+	// SSOSAMLACSPath is the assertion consumer service SAML responses are posted to
+	SSOSAMLACSPath = "/api/v1/auth/sso/saml/acs"
+
+	// SSOSAMLMetadataPath serves the service provider metadata of a customer; its
+	// URL is also the service provider entity ID
+	SSOSAMLMetadataPath = "/api/v1/auth/sso/saml/metadata"
+)
+
+var (
+	// ErrSSONotConfigured is returned when a customer does not exist or has no usable single sign-on configuration
+	ErrSSONotConfigured = errors.New("single sign-on is not configured for this customer")
+
+	// ErrInvalidSSOResponse is returned when an identity provider response is
+	// malformed, fails verification or does not belong to a pending login
+	ErrInvalidSSOResponse = errors.New("invalid single sign-on response")
+
+	// ErrInvalidSSOCode is returned when a single sign-on login code is unknown, expired or already used
+	ErrInvalidSSOCode = errors.New("invalid or expired single sign-on code")
+
+	// ErrSSORequired is returned when a login that did not go through a customer's
+	// identity provider is scoped to that customer while it enforces single sign-on
+	ErrSSORequired = errors.New("must sign in with single sign-on")
+
+	// ErrSSOAccountConflict is returned when the email address of an identity
+	// belongs to a user who is not a member of the customer
+	ErrSSOAccountConflict = errors.New("email address belongs to an account outside this customer")
+
+	// ErrSSODomainNotAllowed is returned when the identity provider signs in an email domain the customer does not allow
+	ErrSSODomainNotAllowed = errors.New("email domain is not allowed for this customer")
+)
+
+// SSOState is the server-side state of a single sign-on login at an identity provider
+type SSOState struct {
+	CustomerID   int64              `json:"customer_id"`
+	Protocol     domain.SSOProtocol `json:"protocol"`
+	Nonce        string             `json:"nonce,omitempty"`
+	CodeVerifier string             `json:"code_verifier,omitempty"`
+	RequestID    string             `json:"request_id,omitempty"`
+}
+
+// SSOLogin is a completed single sign-on login waiting to be exchanged for tokens
+type SSOLogin struct {
+	UserID     int64 `json:"user_id"`
+	CustomerID int64 `json:"customer_id"`
+}
+
+// SSOStore keeps pending single sign-on logins and their one-time login codes
+type SSOStore interface {
+	SaveSSOState(ctx context.Context, state string, data *SSOState, ttl time.Duration) error
+
+	// TakeSSOState returns and deletes the state of a login, so each identity
+	// provider response is accepted once. It returns ErrInvalidSSOResponse if there is none.
+	TakeSSOState(ctx context.Context, state string) (*SSOState, error)
+
+	SaveSSOLogin(ctx context.Context, code string, login *SSOLogin, ttl time.Duration) error
+
+	// TakeSSOLogin returns and deletes a completed login. It returns ErrInvalidSSOCode if there is none.
+	TakeSSOLogin(ctx context.Context, code string) (*SSOLogin, error)
+}
+
+// SSOLoginCompleter issues the tokens of a user authenticated by a customer's identity provider
+type SSOLoginCompleter interface {
+	CompleteSSOLogin(ctx context.Context, user *domain.User, customerID int64) (*LoginResponse, error)
+}
+
+// SSOService logs users in through their customer's OpenID Connect or SAML
+// identity provider. Users are provisioned at their first login and linked to
+// the identity provider subject, so later logins find them even if their email
+// address changes.
+type SSOService struct {
+	customerRepo      domain.CustomerRepository
+	userRepo          domain.UserRepository
+	membershipRepo    domain.MembershipRepository
+	identityRepo      domain.SSOIdentityRepository
+	store             SSOStore
+	logins            SSOLoginCompleter
+	httpClient        *http.Client
+	baseURL           string
+	timeout           time.Duration
+	loginCodeDuration time.Duration
+
+	providersMu sync.Mutex
+	providers   map[string]*oidc.Provider
+}
+
+// SSOConfig holds single sign-on service configuration
+type SSOConfig struct {
+	CustomerRepo   domain.CustomerRepository
+	UserRepo       domain.UserRepository
+	MembershipRepo domain.MembershipRepository
+	IdentityRepo   domain.SSOIdentityRepository
+	Store          SSOStore
+	Logins         SSOLoginCompleter
+
+	// HTTPClient talks to identity providers; defaults to a client with DefaultSSOHTTPTimeout
+	HTTPClient *http.Client
+
+	// BaseURL is the public URL of the auth service, which identity providers
+	// redirect and post back to
+	BaseURL string
+
+	Timeout           time.Duration
+	LoginCodeDuration time.Duration
+}
+
+// NewSSOService creates a new single sign-on service
+func NewSSOService(config SSOConfig) *SSOService {
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultSSOHTTPTimeout}
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultSSOTimeout
+	}
+
+	loginCodeDuration := config.LoginCodeDuration
+	if loginCodeDuration == 0 {
+		loginCodeDuration = DefaultSSOLoginCodeDuration
+	}
+
+	return &SSOService{
+		customerRepo:      config.CustomerRepo,
+		userRepo:          config.UserRepo,
+		membershipRepo:    config.MembershipRepo,
+		identityRepo:      config.IdentityRepo,
+		store:             config.Store,
+		logins:            config.Logins,
+		httpClient:        httpClient,
+		baseURL:           strings.TrimSuffix(config.BaseURL, "/"),
+		timeout:           timeout,
+		loginCodeDuration: loginCodeDuration,
+		providers:         make(map[string]*oidc.Provider),
+	}
+}
+
+// ssoIdentity is a user as asserted by an identity provider
+type ssoIdentity struct {
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// BeginLogin starts a single sign-on login for a customer and returns the URL of
+// its identity provider to redirect the browser to
+func (s *SSOService) BeginLogin(ctx context.Context, customerUUID string) (string, error) {
+	customer, err := s.customerRepo.GetByUUID(ctx, customerUUID)
+	if err != nil {
+		if errors.Is(err, domain.ErrCustomerNotFound) {
+			return "", ErrSSONotConfigured
+		}
+		return "", fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	settings, err := ssoSettingsOf(customer)
+	if err != nil {
+		return "", err
+	}
+
+	if !customer.IsActive() {
+		if customer.IsSuspended() {
+			return "", ErrCustomerSuspended
+		}
+		return "", ErrNoActiveCustomer
+	}
+
+	state, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	var redirectURL string
+	var data *SSOState
+	switch settings.Protocol {
+	case domain.SSOProtocolOIDC:
+		redirectURL, data, err = s.beginOIDC(ctx, settings.OIDC, state)
+	default:
+		redirectURL, data, err = s.beginSAML(ctx, customer, settings.SAML, state)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data.CustomerID = customer.ID
+	data.Protocol = settings.Protocol
+	if err := s.store.SaveSSOState(ctx, state, data, s.timeout); err != nil {
+		return "", err
+	}
+
+	return redirectURL, nil
+}
+
+// Exchange redeems the one-time code of a completed single sign-on login for tokens
+// scoped to the customer the user signed in through
+func (s *SSOService) Exchange(ctx context.Context, code string) (*LoginResponse, error) {
+	login, err := s.store.TakeSSOLogin(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, login.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, ErrInvalidSSOCode
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.logins.CompleteSSOLogin(ctx, user, login.CustomerID)
+}
+
+// takeState loads the pending login a response belongs to, with its customer and settings
+func (s *SSOService) takeState(ctx context.Context, state string, protocol domain.SSOProtocol) (*SSOState, *domain.Customer, *domain.SSOSettings, error) {
+	if state == "" {
+		return nil, nil, nil, ErrInvalidSSOResponse
+	}
+
+	data, err := s.store.TakeSSOState(ctx, state)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if data.Protocol != protocol {
+		return nil, nil, nil, ErrInvalidSSOResponse
+	}
+
+	customer, err := s.customerRepo.GetByID(ctx, data.CustomerID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	// The configuration may have changed while the user was at the identity provider
+	settings, err := ssoSettingsOf(customer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if settings.Protocol != protocol {
+		return nil, nil, nil, ErrInvalidSSOResponse
+	}
+
+	return data, customer, settings, nil
+}
+
+// signIn maps a verified identity onto a user and returns a one-time code for its login
+func (s *SSOService) signIn(ctx context.Context, customer *domain.Customer, settings *domain.SSOSettings, identity *ssoIdentity) (string, error) {
+	user, err := s.provision(ctx, customer, settings, identity)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.SaveSSOLogin(ctx, code, &SSOLogin{UserID: user.ID, CustomerID: customer.ID}, s.loginCodeDuration); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// provision returns the user linked to an identity. At the first login of a
+// subject, an existing member of the customer with the same email address is
+// linked, or a new user is created and added with the default role.
+func (s *SSOService) provision(ctx context.Context, customer *domain.Customer, settings *domain.SSOSettings, identity *ssoIdentity) (*domain.User, error) {
+	linked, err := s.identityRepo.Get(ctx, customer.ID, identity.Subject)
+	if err == nil {
+		user, err := s.userRepo.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+
+		// The identity provider decides who may sign in, so a user who was removed
+		// from the customer but can still sign in there rejoins it
+		if err := s.ensureMembership(ctx, customer, settings, user); err != nil {
+			return nil, err
+		}
+
+		if err := s.identityRepo.UpdateLastLogin(ctx, linked.ID); err != nil {
+			return nil, fmt.Errorf("failed to update sso identity: %w", err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, domain.ErrSSOIdentityNotFound) {
+		return nil, fmt.Errorf("failed to get sso identity: %w", err)
+	}
+
+	if !emailDomainAllowed(identity.Email, settings.AllowedDomains) {
+		return nil, ErrSSODomainNotAllowed
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// Only members are linked, or a customer's identity provider could take
+		// over the accounts of other customers' users and administrators
+		if _, err := s.membershipRepo.Get(ctx, customer.ID, user.ID); err != nil {
+			if errors.Is(err, domain.ErrMembershipNotFound) {
+				return nil, ErrSSOAccountConflict
+			}
+			return nil, fmt.Errorf("failed to get membership: %w", err)
+		}
+
+	case errors.Is(err, domain.ErrUserNotFound):
+		// The identity provider vouches for the address. The user has no password
+		// and logs in through single sign-on only.
+		now := time.Now()
+		user = &domain.User{
+			Email:           identity.Email,
+			EmailVerifiedAt: &now,
+			FirstName:       identity.FirstName,
+			LastName:        identity.LastName,
+			Role:            domain.RoleCustomer,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		if err := s.ensureMembership(ctx, customer, settings, user); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := s.identityRepo.Create(ctx, &domain.SSOIdentity{
+		CustomerID: customer.ID,
+		Subject:    identity.Subject,
+		UserID:     user.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create sso identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// ensureMembership adds a user to the customer with the default role unless they are a member
+func (s *SSOService) ensureMembership(ctx context.Context, customer *domain.Customer, settings *domain.SSOSettings, user *domain.User) error {
+	if _, err := s.membershipRepo.Get(ctx, customer.ID, user.ID); err == nil {
+		return nil
+	} else if !errors.Is(err, domain.ErrMembershipNotFound) {
+		return fmt.Errorf("failed to get membership: %w", err)
+	}
+
+	role := settings.DefaultRole
+	if role == "" {
+		role = domain.MembershipRoleReadOnly
+	}
+
+	err := s.membershipRepo.Create(ctx, &domain.CustomerMembership{
+		CustomerID: customer.ID,
+		UserID:     user.ID,
+		Role:       role,
+	})
+	if err != nil && !errors.Is(err, domain.ErrMembershipAlreadyExists) {
+		return fmt.Errorf("failed to create membership: %w", err)
+	}
+
+	return nil
+}
+
+// ssoSettingsOf returns a customer's single sign-on settings if they are complete
+func ssoSettingsOf(customer *domain.Customer) (*domain.SSOSettings, error) {
+	settings := customer.Settings.SSO
+	if settings == nil {
+		return nil, ErrSSONotConfigured
+	}
+
+	switch settings.Protocol {
+	case domain.SSOProtocolOIDC:
+		if settings.OIDC == nil || settings.OIDC.DiscoveryURL == "" || settings.OIDC.ClientID == "" {
+			return nil, ErrSSONotConfigured
+		}
+	case domain.SSOProtocolSAML:
+		if settings.SAML == nil || (settings.SAML.MetadataURL == "" && settings.SAML.MetadataXML == "") {
+			return nil, ErrSSONotConfigured
+		}
+	default:
+		return nil, ErrSSONotConfigured
+	}
+
+	if settings.DefaultRole != "" && !settings.DefaultRole.IsValid() {
+		return nil, ErrSSONotConfigured
+	}
+
+	return settings, nil
+}
+
+// validIdentityEmail checks that an identity provider sent a plain email address
+func validIdentityEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// emailDomainAllowed checks an email address against a customer's allowed domains
+func emailDomainAllowed(email string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domainPart := email[at+1:]
+	for _, d := range allowed {
+		if strings.EqualFold(domainPart, strings.TrimPrefix(d, "@")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/hosterizer/auth-service/internal/domain"
+	"golang.org/x/oauth2"
+)
+
+// oidcClaims are the ID token claims a user is provisioned from
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// beginOIDC builds the authorization request of an OpenID Connect login, bound to
+// the login by a nonce and a PKCE code verifier
+func (s *SSOService) beginOIDC(ctx context.Context, settings *domain.OIDCSettings, state string) (string, *SSOState, error) {
+	provider, err := s.oidcProvider(ctx, settings)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce, err := NewTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	redirectURL := s.oauth2Config(provider, settings).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return redirectURL, &SSOState{Nonce: nonce, CodeVerifier: verifier}, nil
+}
+
+// FinishOIDC completes an OpenID Connect login from the authorization code the
+// identity provider redirected back with. It returns a one-time code for Exchange.
+func (s *SSOService) FinishOIDC(ctx context.Context, state, code string) (string, error) {
+	data, customer, settings, err := s.takeState(ctx, state, domain.SSOProtocolOIDC)
+	if err != nil {
+		return "", err
+	}
+	if code == "" {
+		return "", ErrInvalidSSOResponse
+	}
+
+	provider, err := s.oidcProvider(ctx, settings.OIDC)
+	if err != nil {
+		return "", err
+	}
+
+	ctx = oidc.ClientContext(ctx, s.httpClient)
+	token, err := s.oauth2Config(provider, settings.OIDC).Exchange(ctx, code, oauth2.VerifierOption(data.CodeVerifier))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSSOResponse, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", fmt.Errorf("%w: no id_token in token response", ErrInvalidSSOResponse)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: settings.OIDC.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSSOResponse, err)
+	}
+	if idToken.Nonce != data.Nonce {
+		return "", fmt.Errorf("%w: nonce mismatch", ErrInvalidSSOResponse)
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSSOResponse, err)
+	}
+
+	// Providers that do not verify addresses must say so; an unverified address
+	// could claim another user's account
+	if !validIdentityEmail(claims.Email) || (claims.EmailVerified != nil && !*claims.EmailVerified) {
+		return "", fmt.Errorf("%w: no verified email address", ErrInvalidSSOResponse)
+	}
+
+	return s.signIn(ctx, customer, settings, &ssoIdentity{
+		Subject:   idToken.Subject,
+		Email:     claims.Email,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+	})
+}
+
+// oidcProvider returns the discovered configuration of an OpenID Connect provider.
+// Providers are cached, so their signing keys are not fetched for every login.
+func (s *SSOService) oidcProvider(ctx context.Context, settings *domain.OIDCSettings) (*oidc.Provider, error) {
+	issuer := strings.TrimSuffix(settings.DiscoveryURL, "/.well-known/openid-configuration")
+
+	s.providersMu.Lock()
+	provider, ok := s.providers[issuer]
+	s.providersMu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, s.httpClient), issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover identity provider: %w", err)
+	}
+
+	s.providersMu.Lock()
+	s.providers[issuer] = provider
+	s.providersMu.Unlock()
+	return provider, nil
+}
+
+func (s *SSOService) oauth2Config(provider *oidc.Provider, settings *domain.OIDCSettings) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     settings.ClientID,
+		ClientSecret: settings.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  s.baseURL + SSOOIDCCallbackPath,
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// beginSAML builds the authentication request of a SAML login for the HTTP-Redirect
+// binding. The state travels as RelayState; the request ID must come back as InResponseTo.
+func (s *SSOService) beginSAML(ctx context.Context, customer *domain.Customer, settings *domain.SAMLSettings, state string) (string, *SSOState, error) {
+	sp, err := s.serviceProvider(ctx, customer, settings)
+	if err != nil {
+		return "", nil, err
+	}
+
+	location := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		return "", nil, fmt.Errorf("%w: identity provider does not support the HTTP-Redirect binding", ErrSSONotConfigured)
+	}
+
+	req, err := sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create saml request: %w", err)
+	}
+
+	redirectURL, err := req.Redirect(url.QueryEscape(state), sp)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create saml request: %w", err)
+	}
+
+	return redirectURL.String(), &SSOState{RequestID: req.ID}, nil
+}
+
+// FinishSAML completes a SAML login from the response the identity provider posted
+// to the assertion consumer service. It returns a one-time code for Exchange.
+func (s *SSOService) FinishSAML(ctx context.Context, samlResponse, relayState string) (string, error) {
+	data, customer, settings, err := s.takeState(ctx, relayState, domain.SSOProtocolSAML)
+	if err != nil {
+		return "", err
+	}
+
+	sp, err := s.serviceProvider(ctx, customer, settings.SAML)
+	if err != nil {
+		return "", err
+	}
+
+	responseXML, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSSOResponse, err)
+	}
+
+	// Verifies the signature, issuer, audience, destination, validity and that
+	// the response answers the request of this login
+	assertion, err := sp.ParseXMLResponse(responseXML, []string{data.RequestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		return "", fmt.Errorf("%w: %v", ErrInvalidSSOResponse, err)
+	}
+
+	identity, err := samlIdentity(assertion)
+	if err != nil {
+		return "", err
+	}
+
+	return s.signIn(ctx, customer, settings, identity)
+}
+
+// ServiceProviderMetadata returns the SAML service provider metadata to register
+// with a customer's identity provider
+func (s *SSOService) ServiceProviderMetadata(ctx context.Context, customerUUID string) ([]byte, error) {
+	customer, err := s.customerRepo.GetByUUID(ctx, customerUUID)
+	if err != nil {
+		if errors.Is(err, domain.ErrCustomerNotFound) {
+			return nil, ErrSSONotConfigured
+		}
+		return nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	settings, err := ssoSettingsOf(customer)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Protocol != domain.SSOProtocolSAML {
+		return nil, ErrSSONotConfigured
+	}
+
+	metadata := s.serviceProviderOf(customer).Metadata()
+
+	// Responses are only accepted through the POST binding
+	for i := range metadata.SPSSODescriptors {
+		services := metadata.SPSSODescriptors[i].AssertionConsumerServices
+		metadata.SPSSODescriptors[i].AssertionConsumerServices = services[:1]
+	}
+
+	out, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal saml metadata: %w", err)
+	}
+	return out, nil
+}
+
+// serviceProvider returns the service provider of a customer, set up to trust its identity provider
+func (s *SSOService) serviceProvider(ctx context.Context, customer *domain.Customer, settings *domain.SAMLSettings) (*saml.ServiceProvider, error) {
+	var idp *saml.EntityDescriptor
+	var err error
+	if settings.MetadataXML != "" {
+		idp, err = samlsp.ParseMetadata([]byte(settings.MetadataXML))
+	} else {
+		var metadataURL *url.URL
+		if metadataURL, err = url.Parse(settings.MetadataURL); err == nil {
+			idp, err = samlsp.FetchMetadata(ctx, s.httpClient, *metadataURL)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity provider metadata: %w", err)
+	}
+
+	sp := s.serviceProviderOf(customer)
+	sp.IDPMetadata = idp
+	return sp, nil
+}
+
+// serviceProviderOf returns the service provider of a customer. Each customer has
+// its own entity ID, so an assertion for one customer is not accepted for another.
+func (s *SSOService) serviceProviderOf(customer *domain.Customer) *saml.ServiceProvider {
+	metadataURL, _ := url.Parse(s.baseURL + SSOSAMLMetadataPath + "?customer=" + url.QueryEscape(customer.UUID))
+	acsURL, _ := url.Parse(s.baseURL + SSOSAMLACSPath)
+
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+}
+
+// samlIdentity reads the subject, email address and name of a verified assertion
+func samlIdentity(assertion *saml.Assertion) (*ssoIdentity, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, fmt.Errorf("%w: assertion has no subject", ErrInvalidSSOResponse)
+	}
+
+	nameID := assertion.Subject.NameID
+	if nameID.Format == string(saml.TransientNameIDFormat) {
+		return nil, fmt.Errorf("%w: a transient name ID cannot identify a user", ErrInvalidSSOResponse)
+	}
+
+	identity := &ssoIdentity{Subject: nameID.Value}
+	if nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		identity.Email = nameID.Value
+	}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if len(attr.Values) == 0 {
+				continue
+			}
+			if field := samlAttributeField(identity, attr); field != nil {
+				*field = strings.TrimSpace(attr.Values[0].Value)
+			}
+		}
+	}
+
+	if !validIdentityEmail(identity.Email) {
+		return nil, fmt.Errorf("%w: no email address in assertion", ErrInvalidSSOResponse)
+	}
+
+	return identity, nil
+}
+
+// samlAttributeField returns the identity field an attribute maps to, or nil. It
+// knows the LDAP names and OIDs as well as the claim URIs of Microsoft identity providers.
+func samlAttributeField(identity *ssoIdentity, attr saml.Attribute) *string {
+	for _, name := range []string{attr.Name, attr.FriendlyName} {
+		name = strings.ToLower(name)
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+
+		switch name {
+		case "email", "mail", "emailaddress", "urn:oid:0.9.2342.19200300.100.1.3":
+			return &identity.Email
+		case "givenname", "urn:oid:2.5.4.42":
+			return &identity.FirstName
+		case "sn", "surname", "urn:oid:2.5.4.4":
+			return &identity.LastName
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// mockOIDCProvider is an OpenID Connect provider that signs in whoever the test asks it to
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockOIDCGrant
+}
+
+type mockOIDCGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+const (
+	testOIDCClientID     = "hosterizer"
+	testOIDCClientSecret = "s3cret"
+)
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockOIDCProvider{key: key, codes: make(map[string]mockOIDCGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize plays the user signing in at the provider and returns the state and
+// code the provider redirects back with
+func (p *mockOIDCProvider) authorize(t *testing.T, redirectURL string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", redirectURL)
+	}
+
+	claims["iss"] = p.server.URL
+	claims["aud"] = testOIDCClientID
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	if _, ok := claims["nonce"]; !ok {
+		claims["nonce"] = query.Get("nonce")
+	}
+
+	code, err := NewTokenID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.codes[code] = mockOIDCGrant{challenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+
+	return query.Get("state"), code
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if clientID, secret, ok := r.BasicAuth(); !ok || clientID != testOIDCClientID || secret != testOIDCClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func TestOIDCLoginProvisionsAndLinksUsers(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockOIDCProvider(t)
+	f := newFixture(t)
+	f.customer.Settings.SSO = &domain.SSOSettings{
+		Protocol:       domain.SSOProtocolOIDC,
+		DefaultRole:    domain.MembershipRoleDeveloper,
+		AllowedDomains: []string{"acme.example"},
+		OIDC: &domain.OIDCSettings{
+			DiscoveryURL: idp.server.URL + "/.well-known/openid-configuration",
+			ClientID:     testOIDCClientID,
+			ClientSecret: testOIDCClientSecret,
+		},
+	}
+
+	login := func(claims jwt.MapClaims) (string, error) {
+		t.Helper()
+		redirectURL, err := f.sso.BeginLogin(ctx, f.customer.UUID)
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		state, code := idp.authorize(t, redirectURL, claims)
+		return f.sso.FinishOIDC(ctx, state, code)
+	}
+
+	code, err := login(jwt.MapClaims{"sub": "idp-123", "email": "sam@acme.example", "email_verified": true, "given_name": "Sam"})
+	if err != nil {
+		t.Fatalf("FinishOIDC: %v", err)
+	}
+	user := f.exchange(t, code)
+	if user.Email != "sam@acme.example" || user.FirstName != "Sam" || user.Role != domain.RoleCustomer || !user.IsEmailVerified() || user.HasPassword() {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if membership, err := f.memberships.Get(ctx, testCustomerID, user.ID); err != nil || membership.Role != domain.MembershipRoleDeveloper {
+		t.Fatalf("membership: got %+v, %v", membership, err)
+	}
+	if _, err := f.sso.Exchange(ctx, code); !errors.Is(err, ErrInvalidSSOCode) {
+		t.Fatalf("second exchange: got %v, want ErrInvalidSSOCode", err)
+	}
+
+	// The subject identifies the user, even after their address changed at the provider
+	code, err = login(jwt.MapClaims{"sub": "idp-123", "email": "samuel@acme.example"})
+	if err != nil {
+		t.Fatalf("second FinishOIDC: %v", err)
+	}
+	if again := f.exchange(t, code); again.ID != user.ID {
+		t.Fatalf("second login signed in user %d, want %d", again.ID, user.ID)
+	}
+	if len(f.users.users) != 1 || f.identities.identities[0].LastLoginAt == nil {
+		t.Fatalf("users %v, identities %+v", f.users.users, f.identities.identities)
+	}
+
+	if _, err := login(jwt.MapClaims{"sub": "idp-456", "email": "eve@acme.example", "nonce": "replayed"}); !errors.Is(err, ErrInvalidSSOResponse) {
+		t.Fatalf("wrong nonce: got %v, want ErrInvalidSSOResponse", err)
+	}
+	if _, err := login(jwt.MapClaims{"sub": "idp-456", "email": "eve@acme.example", "email_verified": false}); !errors.Is(err, ErrInvalidSSOResponse) {
+		t.Fatalf("unverified email: got %v, want ErrInvalidSSOResponse", err)
+	}
+	if _, err := login(jwt.MapClaims{"sub": "idp-456", "email": "eve@elsewhere.example"}); !errors.Is(err, ErrSSODomainNotAllowed) {
+		t.Fatalf("other domain: got %v, want ErrSSODomainNotAllowed", err)
+	}
+
+	// Each state is answered once
+	redirectURL, err := f.sso.BeginLogin(ctx, f.customer.UUID)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	state, authCode := idp.authorize(t, redirectURL, jwt.MapClaims{"sub": "idp-123", "email": "sam@acme.example"})
+	if _, err := f.sso.FinishOIDC(ctx, state, authCode); err != nil {
+		t.Fatalf("FinishOIDC: %v", err)
+	}
+	if _, err := f.sso.FinishOIDC(ctx, state, authCode); !errors.Is(err, ErrInvalidSSOResponse) {
+		t.Fatalf("replayed state: got %v, want ErrInvalidSSOResponse", err)
+	}
+}
+
+func TestSSODoesNotTakeOverOtherAccounts(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockOIDCProvider(t)
+	f := newFixture(t)
+	f.customer.Settings.SSO = &domain.SSOSettings{
+		Protocol: domain.SSOProtocolOIDC,
+		OIDC: &domain.OIDCSettings{
+			DiscoveryURL: idp.server.URL,
+			ClientID:     testOIDCClientID,
+			ClientSecret: testOIDCClientSecret,
+		},
+	}
+	jane := f.register(t)
+
+	signIn := func() (string, error) {
+		redirectURL, err := f.sso.BeginLogin(ctx, f.customer.UUID)
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		state, code := idp.authorize(t, redirectURL, jwt.MapClaims{"sub": "jane", "email": "jane@example.com"})
+		return f.sso.FinishOIDC(ctx, state, code)
+	}
+
+	if _, err := signIn(); !errors.Is(err, ErrSSOAccountConflict) {
+		t.Fatalf("outside account: got %v, want ErrSSOAccountConflict", err)
+	}
+
+	// Existing members are linked to their identity
+	f.memberships.memberships = append(f.memberships.memberships, &domain.CustomerMembership{
+		CustomerID: testCustomerID, UserID: jane.ID, Role: domain.MembershipRoleOwner,
+	})
+	code, err := signIn()
+	if err != nil {
+		t.Fatalf("FinishOIDC: %v", err)
+	}
+	if user := f.exchange(t, code); user.ID != jane.ID {
+		t.Fatalf("signed in user %d, want %d", user.ID, jane.ID)
+	}
+
+	if _, err := f.sso.BeginLogin(ctx, "unknown"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Fatalf("unknown customer: got %v, want ErrSSONotConfigured", err)
+	}
+}
+
+// newMockSAMLProvider returns an identity provider with a self-signed certificate
+func newMockSAMLProvider(t *testing.T) *saml.IdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	return &saml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}
+}
+
+// samlServiceProviders serves the metadata of a single service provider to the mock identity provider
+type samlServiceProviders struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p *samlServiceProviders) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if serviceProviderID != p.metadata.EntityID {
+		return nil, errors.New("unknown service provider")
+	}
+	return p.metadata, nil
+}
+
+func TestSAMLLoginProvisionsUser(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockSAMLProvider(t)
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newFixture(t)
+	f.customer.Settings.SSO = &domain.SSOSettings{
+		Protocol: domain.SSOProtocolSAML,
+		SAML:     &domain.SAMLSettings{MetadataXML: string(idpMetadata)},
+	}
+
+	spMetadata, err := f.sso.ServiceProviderMetadata(ctx, f.customer.UUID)
+	if err != nil {
+		t.Fatalf("ServiceProviderMetadata: %v", err)
+	}
+	sp, err := samlsp.ParseMetadata(spMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.ServiceProviderProvider = &samlServiceProviders{metadata: sp}
+
+	// respond plays the user signing in at the identity provider and returns the form it posts back
+	respond := func(session *saml.Session) saml.IdpAuthnRequestForm {
+		t.Helper()
+		redirectURL, err := f.sso.BeginLogin(ctx, f.customer.UUID)
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		req, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, redirectURL, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Validate(); err != nil {
+			t.Fatalf("identity provider rejected the request: %v", err)
+		}
+		if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+			t.Fatal(err)
+		}
+		form, err := req.PostBinding()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if form.URL != "https://auth.example.com"+SSOSAMLACSPath {
+			t.Fatalf("posted to %s", form.URL)
+		}
+		return form
+	}
+
+	session := &saml.Session{
+		NameID:        "a1b2c3",
+		NameIDFormat:  string(saml.PersistentNameIDFormat),
+		UserGivenName: "Sam",
+		UserSurname:   "Smith",
+		CustomAttributes: []saml.Attribute{{
+			FriendlyName: "mail",
+			Name:         "urn:oid:0.9.2342.19200300.100.1.3",
+			Values:       []saml.AttributeValue{{Type: "xs:string", Value: "sam@acme.example"}},
+		}},
+	}
+	form := respond(session)
+	code, err := f.sso.FinishSAML(ctx, form.SAMLResponse, form.RelayState)
+	if err != nil {
+		t.Fatalf("FinishSAML: %v", err)
+	}
+	user := f.exchange(t, code)
+	if user.Email != "sam@acme.example" || user.FirstName != "Sam" || user.LastName != "Smith" || user.HasPassword() {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if membership, err := f.memberships.Get(ctx, testCustomerID, user.ID); err != nil || membership.Role != domain.MembershipRoleReadOnly {
+		t.Fatalf("membership: got %+v, %v", membership, err)
+	}
+
+	// A response is accepted once, and only for the login it answers
+	if _, err := f.sso.FinishSAML(ctx, form.SAMLResponse, form.RelayState); !errors.Is(err, ErrInvalidSSOResponse) {
+		t.Fatalf("replayed response: got %v, want ErrInvalidSSOResponse", err)
+	}
+	other := respond(session)
+	if _, err := f.sso.FinishSAML(ctx, form.SAMLResponse, other.RelayState); !errors.Is(err, ErrInvalidSSOResponse) {
+		t.Fatalf("response to another request: got %v, want ErrInvalidSSOResponse", err)
+	}
+
+	session.NameIDFormat = string(saml.TransientNameIDFormat)
+	form = respond(session)
+	if _, err := f.sso.FinishSAML(ctx, form.SAMLResponse, form.RelayState); !errors.Is(err, ErrInvalidSSOResponse) {
+		t.Fatalf("transient name ID: got %v, want ErrInvalidSSOResponse", err)
+	}
+}
+
+func TestEnforcedSSODisablesPasswordLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.customer.Settings.SSO = &domain.SSOSettings{Protocol: domain.SSOProtocolOIDC, Enforced: true}
+	f.addUser(t, &domain.User{ID: testOwner.UserID, Email: "jane@example.com", Role: domain.RoleCustomer}, "kT9#vLq2!mZx")
+
+	// A wrong password does not reveal that single sign-on is enforced
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "wrong"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"}); !errors.Is(err, ErrSSORequired) {
+		t.Fatalf("password login: got %v, want ErrSSORequired", err)
+	}
+}
+
+func TestEnforcedSSOAppliesPerCustomer(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.customer.Settings.SSO = &domain.SSOSettings{Protocol: domain.SSOProtocolOIDC, Enforced: true}
+	jane := f.addUser(t, &domain.User{ID: testOwner.UserID, Email: "jane@example.com", Role: domain.RoleCustomer}, "kT9#vLq2!mZx")
+
+	globex := &domain.Customer{ID: 8, Name: "Globex", Status: domain.CustomerStatusActive}
+	if err := f.memberships.Create(ctx, &domain.CustomerMembership{CustomerID: globex.ID, UserID: jane.ID, Role: domain.MembershipRoleDeveloper, Customer: globex}); err != nil {
+		t.Fatal(err)
+	}
+
+	switchTo := func(resp *LoginResponse, customerID int64) error {
+		t.Helper()
+		claims, err := f.jwt.ValidateAccessToken(ctx, resp.AccessToken)
+		if err != nil {
+			t.Fatalf("ValidateAccessToken: %v", err)
+		}
+		_, err = f.auth.SwitchTenant(ctx, claims, customerID, "")
+		return err
+	}
+
+	// A password login is scoped to the customer that does not enforce single sign-on
+	resp, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("password login: %v", err)
+	}
+	if resp.CustomerID == nil || *resp.CustomerID != globex.ID {
+		t.Fatalf("password login scoped to %v, want Globex", resp.CustomerID)
+	}
+	if err := switchTo(resp, testCustomerID); !errors.Is(err, ErrSSORequired) {
+		t.Fatalf("switch of a password login to Acme: got %v, want ErrSSORequired", err)
+	}
+
+	// A login through Acme's identity provider may move between both
+	resp, err = f.auth.CompleteSSOLogin(ctx, jane, testCustomerID)
+	if err != nil {
+		t.Fatalf("SSO login: %v", err)
+	}
+	if err := switchTo(resp, globex.ID); err != nil {
+		t.Fatalf("switch of an SSO login to Globex: %v", err)
+	}
+	if err := switchTo(resp, testCustomerID); err != nil {
+		t.Fatalf("switch of an SSO login back to Acme: %v", err)
+	}
+}
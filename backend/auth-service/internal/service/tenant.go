@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+var (
+	// ErrNoActiveCustomer is returned when a customer user has no active customer to scope tokens to
+	ErrNoActiveCustomer = errors.New("user has no active customer")
+
+	// ErrCustomerSuspended is returned when a customer user's customer is suspended
+	ErrCustomerSuspended = errors.New("customer is suspended")
+)
+
+// Tenant is the customer a user's tokens are scoped to and the user's role in it
+type Tenant struct {
+	CustomerID int64
+	Role       domain.MembershipRole
+}
+
+// TenantService resolves the customer tenant a user's tokens are scoped to
+type TenantService struct {
+	membershipRepo domain.MembershipRepository
+}
+
+// NewTenantService creates a new tenant service
+func NewTenantService(membershipRepo domain.MembershipRepository) *TenantService {
+	return &TenantService{
+		membershipRepo: membershipRepo,
+	}
+}
+
+// ResolveTenant returns the tenant to put in a user's tokens.
+// Administrators are not scoped to a customer and get nil. For customer users the
+// preferred customer is used if the user is a member of it, otherwise the oldest
+// active membership. Users without an active customer are rejected.
+func (s *TenantService) ResolveTenant(ctx context.Context, user *domain.User, preferred *int64) (*Tenant, error) {
+	return s.resolveTenant(ctx, user, preferred, func(*domain.CustomerMembership) bool { return true })
+}
+
+// ResolveLoginTenant returns the tenant to put in the tokens of a new login or of
+// a login switching tenants. A customer that enforces single sign-on is only
+// resolved for a login through its own identity provider, given as ssoCustomerID;
+// preferring it otherwise fails with ErrSSORequired. Without a preferred customer
+// such customers are passed over, and ErrSSORequired is returned if no other
+// customer is left.
+func (s *TenantService) ResolveLoginTenant(ctx context.Context, user *domain.User, preferred, ssoCustomerID *int64) (*Tenant, error) {
+	return s.resolveTenant(ctx, user, preferred, func(membership *domain.CustomerMembership) bool {
+		return !membership.Customer.SSOEnforced() || (ssoCustomerID != nil && *ssoCustomerID == membership.CustomerID)
+	})
+}
+
+// resolveTenant resolves a tenant among the memberships a login may be scoped to
+func (s *TenantService) resolveTenant(ctx context.Context, user *domain.User, preferred *int64, allowed func(*domain.CustomerMembership) bool) (*Tenant, error) {
+	if user.Role == domain.RoleAdministrator {
+		return nil, nil
+	}
+
+	memberships, err := s.membershipRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve customer: %w", err)
+	}
+
+	if preferred != nil {
+		for _, membership := range memberships {
+			if membership.CustomerID == *preferred {
+				if !allowed(membership) {
+					return nil, ErrSSORequired
+				}
+				return checkMembership(membership)
+			}
+		}
+		return nil, ErrNoActiveCustomer
+	}
+
+	suspended, ssoRequired := false, false
+	for _, membership := range memberships {
+		if membership.Customer.IsActive() {
+			if allowed(membership) {
+				return &Tenant{CustomerID: membership.CustomerID, Role: membership.Role}, nil
+			}
+			ssoRequired = true
+		}
+		if membership.Customer.IsSuspended() {
+			suspended = true
+		}
+	}
+
+	switch {
+	case ssoRequired:
+		return nil, ErrSSORequired
+	case suspended:
+		return nil, ErrCustomerSuspended
+	default:
+		return nil, ErrNoActiveCustomer
+	}
+}
+
+// RequiresSSO reports whether a user can only log in through single sign-on:
+// every active customer of the user enforces it. Users with another active
+// customer may still log in with a password or passkey, scoped to that customer.
+func (s *TenantService) RequiresSSO(ctx context.Context, user *domain.User) (bool, error) {
+	if user.Role == domain.RoleAdministrator {
+		return false, nil
+	}
+
+	memberships, err := s.membershipRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	enforced := false
+	for _, membership := range memberships {
+		if membership.Customer == nil || !membership.Customer.IsActive() {
+			continue
+		}
+		if !membership.Customer.SSOEnforced() {
+			return false, nil
+		}
+		enforced = true
+	}
+	return enforced, nil
+}
+
+func checkMembership(membership *domain.CustomerMembership) (*Tenant, error) {
+	switch {
+	case membership.Customer.IsActive():
+		return &Tenant{CustomerID: membership.CustomerID, Role: membership.Role}, nil
+	case membership.Customer.IsSuspended():
+		return nil, ErrCustomerSuspended
+	default:
+		return nil, ErrNoActiveCustomer
+	}
+}
+
+// customerIDOf returns the tenant's customer ID, or nil when there is no tenant
+func customerIDOf(tenant *Tenant) *int64 {
+	if tenant == nil {
+		return nil
+	}
+	customerID := tenant.CustomerID
+	return &customerID
+}
+
+// tenantRoleOf returns the user's role in the tenant, or empty when there is no tenant
+func tenantRoleOf(tenant *Tenant) domain.MembershipRole {
+	if tenant == nil {
+		return ""
+	}
+	return tenant.Role
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultThrottleWindow is how far back failed logins are counted
+	DefaultThrottleWindow = 15 * time.Minute
+
+	// DefaultEmailFreeFailures is the number of failed logins for an email
+	// address within the window before logins are delayed
+	DefaultEmailFreeFailures = 3
+
+	// DefaultIPFreeFailures is the number of failed logins from a client IP
+	// within the window before logins are delayed
+	DefaultIPFreeFailures = 10
+
+	// DefaultMaxIPFailures is the number of failed logins from a client IP within
+	// the window after which the IP is blocked until the window has passed
+	DefaultMaxIPFailures = 100
+
+	// DefaultMaxEmailIPFailures is the number of failed logins for an email address
+	// from one client IP within the window after which that pair is blocked until
+	// the window has passed. Blocking the pair instead of locking the account keeps
+	// others from locking out a user just by knowing their email address.
+	DefaultMaxEmailIPFailures = 10
+
+	// DefaultThrottleBaseDelay is the first delay; each further failure doubles it
+	DefaultThrottleBaseDelay = time.Second
+
+	// DefaultThrottleMaxDelay caps the delay between attempts
+	DefaultThrottleMaxDelay = 5 * time.Minute
+)
+
+// ErrLoginThrottled is returned when a login is attempted before its delay has passed
+var ErrLoginThrottled = errors.New("too many failed login attempts")
+
+// LoginThrottledError is returned by LoginThrottle.Begin with the time the client
+// has to wait. It matches ErrLoginThrottled with errors.Is.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%v, try again in %v", ErrLoginThrottled, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+// FailureWindow counts failures per key in a sliding time window
+type FailureWindow interface {
+	// AddFailure records a failure and forgets the ones older than the window. The
+	// failures that preceded it within the window are returned from the same
+	// atomic step, so concurrent callers each see the others.
+	AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (*RecordedEvent, error)
+
+	// RemoveFailure forgets a single failure
+	RemoveFailure(ctx context.Context, key, failureID string) error
+
+	// ClearFailures forgets every failure of a key
+	ClearFailures(ctx context.Context, key string) error
+}
+
+// LoginThrottle slows down password guessing with progressive delays, per email
+// address against targeted guessing and per client IP against password spraying
+// across many accounts, and blocks an email address for a client IP that keeps
+// guessing it. Every attempt is counted as a failure when it begins, so parallel
+// guesses cannot all slip through before the first of them is recorded.
+type LoginThrottle struct {
+	failures           FailureWindow
+	now                func() time.Time
+	window             time.Duration
+	emailFreeFailures  int
+	ipFreeFailures     int
+	maxIPFailures      int
+	maxEmailIPFailures int
+	baseDelay          time.Duration
+	maxDelay           time.Duration
+}
+
+// ThrottleConfig holds login throttle configuration
+type ThrottleConfig struct {
+	Failures           FailureWindow
+	Window             time.Duration
+	EmailFreeFailures  int
+	IPFreeFailures     int
+	MaxIPFailures      int
+	MaxEmailIPFailures int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+}
+
+// ThrottledAttempt is a login attempt admitted by LoginThrottle.Begin. It counts
+// as a failed login until it is passed to Succeed or Release.
+type ThrottledAttempt struct {
+	failures []throttledFailure
+}
+
+// throttledFailure is the failure an attempt was counted as under a key
+type throttledFailure struct {
+	limit throttleLimit
+	id    string
+}
+
+// NewLoginThrottle creates a new login throttle
+func NewLoginThrottle(config ThrottleConfig) *LoginThrottle {
+	window := config.Window
+	if window == 0 {
+		window = DefaultThrottleWindow
+	}
+
+	emailFree := config.EmailFreeFailures
+	if emailFree == 0 {
+		emailFree = DefaultEmailFreeFailures
+	}
+
+	ipFree := config.IPFreeFailures
+	if ipFree == 0 {
+		ipFree = DefaultIPFreeFailures
+	}
+
+	maxIPFailures := config.MaxIPFailures
+	if maxIPFailures == 0 {
+		maxIPFailures = DefaultMaxIPFailures
+	}
+
+	maxEmailIPFailures := config.MaxEmailIPFailures
+	if maxEmailIPFailures == 0 {
+		maxEmailIPFailures = DefaultMaxEmailIPFailures
+	}
+
+	baseDelay := config.BaseDelay
+	if baseDelay == 0 {
+		baseDelay = DefaultThrottleBaseDelay
+	}
+
+	maxDelay := config.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = DefaultThrottleMaxDelay
+	}
+
+	return &LoginThrottle{
+		failures:           config.Failures,
+		now:                time.Now,
+		window:             window,
+		emailFreeFailures:  emailFree,
+		ipFreeFailures:     ipFree,
+		maxIPFailures:      maxIPFailures,
+		maxEmailIPFailures: maxEmailIPFailures,
+		baseDelay:          baseDelay,
+		maxDelay:           maxDelay,
+	}
+}
+
+// Begin counts a login attempt for the email address from the client IP as a
+// failure, or returns a *LoginThrottledError if the attempt has to wait. Attempts
+// that have to wait are not counted. An empty email address or IP is not
+// throttled by it.
+func (t *LoginThrottle) Begin(ctx context.Context, email, ip string) (*ThrottledAttempt, error) {
+	now := t.now()
+	attempt := &ThrottledAttempt{}
+
+	var retryAfter time.Duration
+	for _, limit := range t.limits(email, ip) {
+		failure, err := t.failures.AddFailure(ctx, limit.key, now, t.window)
+		if err != nil {
+			// Taking back the keys counted so far is best effort; they expire anyway
+			t.Release(ctx, attempt)
+			return nil, fmt.Errorf("failed to record login attempt: %w", err)
+		}
+		attempt.failures = append(attempt.failures, throttledFailure{limit: limit, id: failure.ID})
+		retryAfter = max(retryAfter, t.retryAfter(failure, now, limit.free, limit.block))
+	}
+
+	if retryAfter > 0 {
+		if err := t.Release(ctx, attempt); err != nil {
+			return nil, err
+		}
+		return nil, &LoginThrottledError{RetryAfter: retryAfter}
+	}
+
+	return attempt, nil
+}
+
+// Succeed forgets the failed logins for the email address of a successful attempt.
+// Failures per IP are kept, so a sprayer cannot reset them by logging in to an
+// account of their own; only the attempt itself is taken back.
+func (t *LoginThrottle) Succeed(ctx context.Context, attempt *ThrottledAttempt) error {
+	for _, failure := range attempt.failures {
+		var err error
+		if failure.limit.perIP {
+			err = t.failures.RemoveFailure(ctx, failure.limit.key, failure.id)
+		} else {
+			err = t.failures.ClearFailures(ctx, failure.limit.key)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reset login failures: %w", err)
+		}
+	}
+	return nil
+}
+
+// Release takes back an attempt that failed for another reason than a wrong
+// guess, such as an unavailable database
+func (t *LoginThrottle) Release(ctx context.Context, attempt *ThrottledAttempt) error {
+	for _, failure := range attempt.failures {
+		if err := t.failures.RemoveFailure(ctx, failure.limit.key, failure.id); err != nil {
+			return fmt.Errorf("failed to release login attempt: %w", err)
+		}
+	}
+	return nil
+}
+
+// Reset forgets the failed logins for an email address, when an administrator
+// unlocks the account
+func (t *LoginThrottle) Reset(ctx context.Context, email string) error {
+	if err := t.failures.ClearFailures(ctx, emailThrottleKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// throttleLimit is what a throttle key allows: free failures before delays begin,
+// and a number of failures after which the key is blocked, if any. Failures per
+// IP alone outlive a successful login.
+type throttleLimit struct {
+	key   string
+	free  int
+	block int
+	perIP bool
+}
+
+// limits returns the keys an attempt is counted under
+func (t *LoginThrottle) limits(email, ip string) []throttleLimit {
+	var limits []throttleLimit
+	if email != "" {
+		limits = append(limits, throttleLimit{key: emailThrottleKey(email), free: t.emailFreeFailures})
+	}
+	if ip != "" {
+		limits = append(limits, throttleLimit{key: ipThrottleKey(ip), free: t.ipFreeFailures, block: t.maxIPFailures, perIP: true})
+	}
+	if email != "" && ip != "" {
+		limits = append(limits, throttleLimit{key: emailIPThrottleKey(email, ip), free: t.maxEmailIPFailures, block: t.maxEmailIPFailures})
+	}
+	return limits
+}
+
+// retryAfter returns how long an attempt has to wait given the failures before it.
+// Each failure beyond the free ones doubles the delay after the latest failure.
+// With a block limit, reaching it blocks the key until the window has passed.
+func (t *LoginThrottle) retryAfter(failure *RecordedEvent, now time.Time, free, block int) time.Duration {
+	count := failure.Before
+
+	var delay time.Duration
+	switch {
+	case block > 0 && count >= block:
+		delay = t.window
+	case count > free:
+		delay = t.baseDelay
+		for i := free + 1; i < count && delay < t.maxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, t.maxDelay)
+	default:
+		return 0
+	}
+
+	return max(failure.Latest.Add(delay).Sub(now), 0)
+}
+
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func emailIPThrottleKey(email, ip string) string {
+	return "email-ip:" + strings.ToLower(strings.TrimSpace(email)) + " " + ip
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+// retryAfter begins an attempt and takes it back, returning how long it had to wait
+func retryAfter(t *testing.T, throttle *LoginThrottle, email, ip string) time.Duration {
+	t.Helper()
+
+	ctx := context.Background()
+	attempt, err := throttle.Begin(ctx, email, ip)
+	if err == nil {
+		if err := throttle.Release(ctx, attempt); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		return 0
+	}
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("Begin: got %v, want a LoginThrottledError", err)
+	}
+	return throttled.RetryAfter
+}
+
+func TestLoginThrottleDelaysRepeatedFailures(t *testing.T) {
+	ctx := context.Background()
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:          NewSessionService(SessionConfig{}),
+		EmailFreeFailures: 2,
+		BaseDelay:         time.Minute,
+		MaxDelay:          3 * time.Minute,
+	})
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+
+	// The free failures are not delayed; every further one doubles the delay up to the cap
+	for i, want := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if _, err := throttle.Begin(ctx, "jane@example.com", ""); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if got := retryAfter(t, throttle, "Jane@Example.com", ""); got != want {
+			t.Fatalf("after %d failures: retry after %v, want %v", i+1, got, want)
+		}
+		now = now.Add(want)
+	}
+
+	// Refused attempts do not extend the delay
+	if got := retryAfter(t, throttle, "jane@example.com", ""); got != 0 {
+		t.Fatalf("after waiting: retry after %v, want 0", got)
+	}
+
+	if err := throttle.Reset(ctx, "JANE@example.com"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := throttle.Begin(ctx, "jane@example.com", ""); err != nil {
+			t.Fatalf("attempt after reset: %v", err)
+		}
+	}
+	if got := retryAfter(t, throttle, "jane@example.com", ""); got != 0 {
+		t.Fatalf("after reset: retry after %v, want 0", got)
+	}
+}
+
+func TestLoginThrottleCountsConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:          NewSessionService(SessionConfig{}),
+		EmailFreeFailures: 3,
+		BaseDelay:         time.Hour,
+	})
+
+	// Guesses fired at once cannot all pass before the first is counted
+	const guesses = 20
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		admitted int
+	)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := throttle.Begin(ctx, "jane@example.com", "203.0.113.7")
+			if err == nil {
+				mu.Lock()
+				admitted++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrLoginThrottled) {
+				t.Errorf("Begin: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if admitted != 4 {
+		t.Fatalf("admitted %d concurrent guesses, want the 3 free ones and 1 more", admitted)
+	}
+}
+
+func TestLoginThrottleBlocksSprayingIP(t *testing.T) {
+	ctx := context.Background()
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:       NewSessionService(SessionConfig{}),
+		Window:         time.Hour,
+		IPFreeFailures: 2,
+		MaxIPFailures:  4,
+		BaseDelay:      time.Millisecond,
+	})
+
+	// One guess each against many accounts
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+		if _, err := throttle.Begin(ctx, email, "203.0.113.7"); err != nil && !errors.Is(err, ErrLoginThrottled) {
+			t.Fatalf("Begin: %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if got := retryAfter(t, throttle, "e@example.com", "203.0.113.7"); got < 59*time.Minute {
+		t.Fatalf("spraying IP retry after %v, want the whole window", got)
+	}
+
+	// Logging in to another account does not clear the IP
+	attempt, err := throttle.Begin(ctx, "e@example.com", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("Begin from another IP: %v", err)
+	}
+	if err := throttle.Succeed(ctx, attempt); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	if got := retryAfter(t, throttle, "e@example.com", "203.0.113.7"); got == 0 {
+		t.Fatal("spraying IP was let through after a successful login elsewhere")
+	}
+}
+
+func TestLoginThrottleBlocksEmailForGuessingIP(t *testing.T) {
+	ctx := context.Background()
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:           NewSessionService(SessionConfig{}),
+		Window:             time.Hour,
+		EmailFreeFailures:  100,
+		MaxEmailIPFailures: 3,
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := throttle.Begin(ctx, "jane@example.com", "203.0.113.7"); err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+	}
+
+	if got := retryAfter(t, throttle, "jane@example.com", "203.0.113.7"); got < 59*time.Minute {
+		t.Fatalf("guessing IP retry after %v, want the whole window", got)
+	}
+
+	// The owner of the account logs in from elsewhere as usual
+	if got := retryAfter(t, throttle, "jane@example.com", "198.51.100.1"); got != 0 {
+		t.Fatalf("another IP retry after %v, want 0", got)
+	}
+	if got := retryAfter(t, throttle, "joe@example.com", "203.0.113.7"); got != 0 {
+		t.Fatalf("another address retry after %v, want 0", got)
+	}
+}
+
+func TestWrongPasswordsDoNotLockAccount(t *testing.T) {
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IPAddress: "203.0.113.7", UserAgent: "test"})
+
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:           NewSessionService(SessionConfig{}),
+		EmailFreeFailures:  100,
+		MaxEmailIPFailures: 3,
+	})
+	f := newFixtureWith(t, fixtureConfig{Lockout: LockoutConfig{MaxFailedAttempts: 2}, Throttle: throttle})
+	jane := f.addJane(t, domain.RoleAdministrator)
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "wrong"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+		}
+	}
+	if jane.IsLocked() || len(lockoutEvents(f.events)) != 0 {
+		t.Fatal("wrong passwords locked the account")
+	}
+
+	// The guessing IP is blocked, even with the right password
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"}); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("login from the guessing IP: got %v, want ErrLoginThrottled", err)
+	}
+
+	// Jane herself logs in from her own address
+	elsewhere := WithRequestInfo(context.Background(), RequestInfo{IPAddress: "198.51.100.1", UserAgent: "test"})
+	if _, err := f.auth.Login(elsewhere, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"}); err != nil {
+		t.Fatalf("login from another IP: %v", err)
+	}
+}
+
+func TestMFAChallengeIsThrottled(t *testing.T) {
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IPAddress: "203.0.113.7", UserAgent: "test"})
+
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:          NewSessionService(SessionConfig{}),
+		EmailFreeFailures: 1,
+		BaseDelay:         time.Hour,
+	})
+	f := newFixtureWith(t, fixtureConfig{Throttle: throttle})
+	jane := f.addJane(t, domain.RoleCustomer)
+	jane.MFAEnabled = true
+
+	resp, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil || !resp.RequiresMFA {
+		t.Fatalf("expected an MFA challenge: %+v, %v", resp, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: resp.MFAToken, MFACode: "000000"}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code: got %v, want ErrInvalidMFACode", err)
+		}
+	}
+	if _, err := f.auth.CompleteMFAChallenge(ctx, MFAChallengeRequest{MFAToken: resp.MFAToken, MFACode: "000000"}); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("code after failures: got %v, want ErrLoginThrottled", err)
+	}
+}
+
+func TestPasskeyLoginIsThrottled(t *testing.T) {
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IPAddress: "203.0.113.7", UserAgent: "test"})
+
+	throttle := NewLoginThrottle(ThrottleConfig{
+		Failures:       NewSessionService(SessionConfig{}),
+		IPFreeFailures: 1,
+		BaseDelay:      time.Hour,
+	})
+	f := newFixtureWith(t, fixtureConfig{Throttle: throttle})
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.auth.Login(ctx, LoginRequest{WebAuthn: []byte(`{}`)}); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("bad assertion: got %v, want ErrInvalidCredentials", err)
+		}
+	}
+	if _, err := f.auth.Login(ctx, LoginRequest{WebAuthn: []byte(`{}`)}); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("assertion after failures: got %v, want ErrLoginThrottled", err)
+	}
+}
+
+func TestLockoutRecordsEventsAndAdminUnlocks(t *testing.T) {
+	ctx := WithRequestInfo(context.Background(), RequestInfo{IPAddress: "203.0.113.7", UserAgent: "test"})
+
+	f := newFixtureWith(t, fixtureConfig{Lockout: LockoutConfig{MaxFailedAttempts: 2}})
+	jane := f.addJane(t, domain.RoleCustomer)
+	jane.MFAEnabled = true
+
+	// Guessing the password with a stolen access token locks the account
+	claims := &TokenClaims{UserID: jane.ID, FamilyID: "family-1"}
+	for i := 0; i < 2; i++ {
+		if _, err := f.account.ChangePassword(ctx, claims, "WrongPassw0rd!", "Rw4$pYn8@cJs"); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("wrong password: got %v, want ErrInvalidCredentials", err)
+		}
+	}
+
+	recorded := lockoutEvents(f.events)
+	if len(recorded) != 1 || recorded[0].Type != AuditEventAccountLocked || recorded[0].UserID != jane.ID || recorded[0].IPAddress != "203.0.113.7" {
+		t.Fatalf("unexpected events after lockout: %+v", recorded)
+	}
+
+	if _, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"}); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("login while locked: got %v, want ErrAccountLocked", err)
+	}
+
+	customer := &TokenClaims{UserID: 2, Role: domain.RoleCustomer}
+	if err := f.admin.UnlockAccount(ctx, customer, jane.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("unlock by customer: got %v, want ErrForbidden", err)
+	}
+
+	admin := &TokenClaims{UserID: 3, Role: domain.RoleAdministrator}
+	if err := f.admin.UnlockAccount(ctx, admin, 42); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("unlock unknown user: got %v, want ErrUserNotFound", err)
+	}
+	if err := f.admin.UnlockAccount(ctx, admin, jane.ID); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+
+	recorded = lockoutEvents(f.events)
+	if len(recorded) != 2 || recorded[1].Type != AuditEventAccountUnlocked || recorded[1].ActorID != 3 {
+		t.Fatalf("unexpected events after unlock: %+v", recorded)
+	}
+
+	resp, err := f.auth.Login(ctx, LoginRequest{Email: "jane@example.com", Password: "kT9#vLq2!mZx"})
+	if err != nil {
+		t.Fatalf("login after unlock: %v", err)
+	}
+	if !resp.RequiresMFA {
+		t.Fatal("expected an MFA challenge")
+	}
+}
+
+// lockoutEvents returns the account lock and unlock events, leaving out login
+// attempts
+func lockoutEvents(recorder *MemoryEventRecorder) []AuditEvent {
+	var events []AuditEvent
+	for _, event := range recorder.Events() {
+		if event.Type == AuditEventAccountLocked || event.Type == AuditEventAccountUnlocked {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,430 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	// DefaultWebAuthnTimeout is the default time a WebAuthn ceremony may take
+	DefaultWebAuthnTimeout = 5 * time.Minute
+
+	webAuthnCeremonyRegistration = "registration"
+	webAuthnCeremonyLogin        = "login"
+)
+
+var (
+	// ErrWebAuthnCeremonyNotFound is returned when a WebAuthn response does not belong
+	// to a pending ceremony, for example because it expired or was already completed
+	ErrWebAuthnCeremonyNotFound = errors.New("webauthn ceremony not found or expired")
+
+	// ErrWebAuthnVerificationFailed is returned when a WebAuthn response fails verification
+	ErrWebAuthnVerificationFailed = errors.New("webauthn verification failed")
+
+	// ErrNoWebAuthnCredentials is returned when a user has no registered WebAuthn credentials
+	ErrNoWebAuthnCredentials = errors.New("no webauthn credentials registered")
+)
+
+// WebAuthnCeremony is the server-side state of a registration or login ceremony
+type WebAuthnCeremony struct {
+	Type    string               `json:"type"`
+	UserID  int64                `json:"user_id,omitempty"` // 0 for passwordless (discoverable) login
+	Session webauthn.SessionData `json:"session"`
+}
+
+// WebAuthnCeremonyStore keeps pending WebAuthn ceremonies keyed by their challenge
+type WebAuthnCeremonyStore interface {
+	SaveWebAuthnCeremony(ctx context.Context, challenge string, ceremony *WebAuthnCeremony, ttl time.Duration) error
+
+	// TakeWebAuthnCeremony returns and deletes a ceremony, so each challenge can be answered once.
+	// It returns ErrWebAuthnCeremonyNotFound if there is none.
+	TakeWebAuthnCeremony(ctx context.Context, challenge string) (*WebAuthnCeremony, error)
+}
+
+// WebAuthnService handles WebAuthn (passkey and security key) registration and login ceremonies
+type WebAuthnService struct {
+	webauthn    *webauthn.WebAuthn
+	credentials domain.WebAuthnCredentialRepository
+	users       domain.UserRepository
+	ceremonies  WebAuthnCeremonyStore
+	timeout     time.Duration
+}
+
+// WebAuthnConfig holds WebAuthn service configuration
+type WebAuthnConfig struct {
+	// RPID is the relying party ID, the domain credentials are scoped to
+	RPID          string
+	RPDisplayName string
+
+	// RPOrigins are the origins ceremonies may be performed from
+	RPOrigins []string
+
+	Credentials domain.WebAuthnCredentialRepository
+	Users       domain.UserRepository
+	Ceremonies  WebAuthnCeremonyStore
+	Timeout     time.Duration
+}
+
+// NewWebAuthnService creates a new WebAuthn service
+func NewWebAuthnService(config WebAuthnConfig) (*WebAuthnService, error) {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultWebAuthnTimeout
+	}
+
+	ceremonyTimeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    timeout,
+		TimeoutUVD: timeout,
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          config.RPID,
+		RPDisplayName: config.RPDisplayName,
+		RPOrigins:     config.RPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        ceremonyTimeout,
+			Registration: ceremonyTimeout,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn configuration: %w", err)
+	}
+
+	return &WebAuthnService{
+		webauthn:    w,
+		credentials: config.Credentials,
+		users:       config.Users,
+		ceremonies:  config.Ceremonies,
+		timeout:     timeout,
+	}, nil
+}
+
+// BeginRegistration starts registering a new credential for a user and returns the
+// options to pass to navigator.credentials.create()
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID int64) (*protocol.CredentialCreation, error) {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep authenticators from registering the same credential twice
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin webauthn registration: %w", err)
+	}
+
+	if err := s.saveCeremony(ctx, webAuthnCeremonyRegistration, userID, session); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+// FinishRegistration verifies the response of navigator.credentials.create() and stores the new credential
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID int64, name string, response []byte) (*domain.WebAuthnCredential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	ceremony, err := s.takeCeremony(ctx, parsed.Response.CollectedClientData.Challenge, webAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != userID {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.CreateCredential(user, ceremony.Session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	stored := &domain.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+
+	if err := s.credentials.Create(ctx, stored); err != nil {
+		if errors.Is(err, domain.ErrWebAuthnCredentialAlreadyExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store webauthn credential: %w", err)
+	}
+
+	return stored, nil
+}
+
+// BeginLogin starts a login ceremony and returns the options to pass to
+// navigator.credentials.get(). With a user, the assertion is limited to that user's
+// credentials and serves as a second factor. Without one, any discoverable credential
+// (passkey) may answer and user verification is required, so the passkey is the only factor.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, user *domain.User) (*protocol.CredentialAssertion, error) {
+	if user == nil {
+		assertion, session, err := s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin webauthn login: %w", err)
+		}
+
+		if err := s.saveCeremony(ctx, webAuthnCeremonyLogin, 0, session); err != nil {
+			return nil, err
+		}
+
+		return assertion, nil
+	}
+
+	waUser, err := s.newWebAuthnUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(waUser.credentials) == 0 {
+		return nil, ErrNoWebAuthnCredentials
+	}
+
+	assertion, session, err := s.webauthn.BeginLogin(waUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin webauthn login: %w", err)
+	}
+
+	if err := s.saveCeremony(ctx, webAuthnCeremonyLogin, user.ID, session); err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishLogin verifies the response of navigator.credentials.get() and returns the
+// authenticated user. The user must match the one the ceremony was started for; pass
+// nil to finish a passwordless login started without a user.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, user *domain.User, response []byte) (*domain.User, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	ceremony, err := s.takeCeremony(ctx, parsed.Response.CollectedClientData.Challenge, webAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		waUser     *webAuthnUser
+		credential *webauthn.Credential
+	)
+
+	if user != nil {
+		if ceremony.UserID != user.ID {
+			return nil, ErrWebAuthnCeremonyNotFound
+		}
+
+		waUser, err = s.newWebAuthnUser(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		credential, err = s.webauthn.ValidateLogin(waUser, ceremony.Session, parsed)
+	} else {
+		if ceremony.UserID != 0 {
+			return nil, ErrWebAuthnCeremonyNotFound
+		}
+
+		credential, err = s.webauthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			found, err := s.users.GetByUUID(ctx, string(userHandle))
+			if err != nil {
+				return nil, err
+			}
+			waUser, err = s.newWebAuthnUser(ctx, found)
+			return waUser, err
+		}, ceremony.Session, parsed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerificationFailed, err)
+	}
+
+	// A signature counter that did not increase means the credential may have been cloned
+	if credential.Authenticator.CloneWarning {
+		return nil, fmt.Errorf("%w: signature counter did not increase", ErrWebAuthnVerificationFailed)
+	}
+
+	stored := waUser.credential(credential.ID)
+	if stored == nil {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+
+	if err := s.credentials.UpdateAfterLogin(ctx, stored.ID, credential.Authenticator.SignCount, credential.Flags.BackupState); err != nil {
+		return nil, fmt.Errorf("failed to update webauthn credential: %w", err)
+	}
+
+	return waUser.user, nil
+}
+
+// HasCredentials checks whether a user has registered any WebAuthn credentials
+func (s *WebAuthnService) HasCredentials(ctx context.Context, userID int64) (bool, error) {
+	credentials, err := s.ListCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+// ListCredentials returns the WebAuthn credentials of a user
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID int64) ([]*domain.WebAuthnCredential, error) {
+	credentials, err := s.credentials.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// DeleteCredential removes a WebAuthn credential of a user
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID, credentialID int64) error {
+	if err := s.credentials.Delete(ctx, userID, credentialID); err != nil {
+		if errors.Is(err, domain.ErrWebAuthnCredentialNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	return nil
+}
+
+func (s *WebAuthnService) saveCeremony(ctx context.Context, ceremonyType string, userID int64, session *webauthn.SessionData) error {
+	err := s.ceremonies.SaveWebAuthnCeremony(ctx, session.Challenge, &WebAuthnCeremony{
+		Type:    ceremonyType,
+		UserID:  userID,
+		Session: *session,
+	}, s.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to save webauthn ceremony: %w", err)
+	}
+	return nil
+}
+
+func (s *WebAuthnService) takeCeremony(ctx context.Context, challenge, ceremonyType string) (*WebAuthnCeremony, error) {
+	ceremony, err := s.ceremonies.TakeWebAuthnCeremony(ctx, challenge)
+	if err != nil {
+		if errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load webauthn ceremony: %w", err)
+	}
+
+	if ceremony.Type != ceremonyType {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+
+	return ceremony, nil
+}
+
+func (s *WebAuthnService) loadUser(ctx context.Context, userID int64) (*webAuthnUser, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return s.newWebAuthnUser(ctx, user)
+}
+
+func (s *WebAuthnService) newWebAuthnUser(ctx context.Context, user *domain.User) (*webAuthnUser, error) {
+	credentials, err := s.ListCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// webAuthnUser adapts a user and their credentials to webauthn.User.
+// The user handle is the user's UUID, so discoverable logins can look the user up.
+type webAuthnUser struct {
+	user        *domain.User
+	credentials []*domain.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.user.UUID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	name := strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+	if name == "" {
+		return u.user.Email
+	}
+	return name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, transport := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+func (u *webAuthnUser) credential(id []byte) *domain.WebAuthnCredential {
+	for _, c := range u.credentials {
+		if bytes.Equal(c.CredentialID, id) {
+			return c
+		}
+	}
+	return nil
+}
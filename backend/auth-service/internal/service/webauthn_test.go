@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/hosterizer/auth-service/internal/domain"
+)
+
+const (
+	testRPID   = "hosterizer.test"
+	testOrigin = "https://admin.hosterizer.test"
+)
+
+// softAuthenticator is a software WebAuthn authenticator holding one ES256 credential
+type softAuthenticator struct {
+	origin       string
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("failed to generate credential ID: %v", err)
+	}
+	return &softAuthenticator{origin: testOrigin, credentialID: credentialID, key: key}
+}
+
+// register answers navigator.credentials.create() with "none" attestation
+func (a *softAuthenticator) register(t *testing.T, creation *protocol.CredentialCreation) []byte {
+	t.Helper()
+
+	userID, ok := creation.Response.User.ID.(protocol.URLEncodedBase64)
+	if !ok {
+		t.Fatalf("unexpected user ID type %T", creation.Response.User.ID)
+	}
+	a.userHandle = userID
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: x,
+		-3: y,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+
+	authData := a.authenticatorData(0x45, 0) // UP, UV, AT
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode attestation object: %v", err)
+	}
+
+	return a.response(t, map[string]interface{}{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", creation.Response.Challenge.String()),
+		"attestationObject": attestationObject,
+	})
+}
+
+// assert answers navigator.credentials.get()
+func (a *softAuthenticator) assert(t *testing.T, assertion *protocol.CredentialAssertion, userVerified bool) []byte {
+	t.Helper()
+
+	flags := byte(0x01) // UP
+	if userVerified {
+		flags |= 0x04 // UV
+	}
+	a.signCount++
+	authData := a.authenticatorData(flags, a.signCount)
+
+	clientData := a.clientData(t, "webauthn.get", assertion.Response.Challenge.String())
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+
+	return a.response(t, map[string]interface{}{
+		"clientDataJSON":    clientData,
+		"authenticatorData": authData,
+		"signature":         signature,
+		"userHandle":        a.userHandle,
+	})
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode client data: %v", err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) response(t *testing.T, fields map[string]interface{}) []byte {
+	t.Helper()
+	encoded := make(map[string]string, len(fields))
+	for name, value := range fields {
+		encoded[name] = base64.RawURLEncoding.EncodeToString(value.([]byte))
+	}
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       id,
+		"rawId":    id,
+		"type":     "public-key",
+		"response": encoded,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode credential: %v", err)
+	}
+	return body
+}
+
+func TestWebAuthnSecondFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	authenticator := f.registerPasskey(t, alice)
+
+	assertion, err := f.webauthn.BeginLogin(ctx, alice)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+	if len(assertion.Response.AllowedCredentials) != 1 {
+		t.Fatalf("expected 1 allowed credential, got %d", len(assertion.Response.AllowedCredentials))
+	}
+
+	user, err := f.webauthn.FinishLogin(ctx, alice, authenticator.assert(t, assertion, false))
+	if err != nil {
+		t.Fatalf("FinishLogin returned error: %v", err)
+	}
+	if user.ID != alice.ID {
+		t.Errorf("FinishLogin returned user %d, want %d", user.ID, alice.ID)
+	}
+
+	stored := f.credentials.credentials[0]
+	if stored.SignCount != 1 || stored.LastUsedAt == nil {
+		t.Errorf("credential not updated after login: sign count %d, last used %v", stored.SignCount, stored.LastUsedAt)
+	}
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	bob := f.addUser(t, &domain.User{Email: "bob@example.com", Role: domain.RoleCustomer}, "")
+	f.registerPasskey(t, alice)
+	authenticator := f.registerPasskey(t, bob)
+
+	assertion, err := f.webauthn.BeginLogin(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+	if len(assertion.Response.AllowedCredentials) != 0 {
+		t.Fatalf("passwordless login must not restrict credentials")
+	}
+
+	user, err := f.webauthn.FinishLogin(ctx, nil, authenticator.assert(t, assertion, true))
+	if err != nil {
+		t.Fatalf("FinishLogin returned error: %v", err)
+	}
+	if user.ID != bob.ID {
+		t.Errorf("FinishLogin returned user %d, want %d", user.ID, bob.ID)
+	}
+}
+
+func TestWebAuthnPasswordlessLoginRequiresUserVerification(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	authenticator := f.registerPasskey(t, alice)
+
+	assertion, err := f.webauthn.BeginLogin(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+
+	_, err = f.webauthn.FinishLogin(ctx, nil, authenticator.assert(t, assertion, false))
+	if !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Fatalf("FinishLogin error = %v, want %v", err, ErrWebAuthnVerificationFailed)
+	}
+}
+
+func TestWebAuthnAssertionCannotBeReplayed(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	authenticator := f.registerPasskey(t, alice)
+
+	assertion, err := f.webauthn.BeginLogin(ctx, alice)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+
+	response := authenticator.assert(t, assertion, true)
+	if _, err := f.webauthn.FinishLogin(ctx, alice, response); err != nil {
+		t.Fatalf("FinishLogin returned error: %v", err)
+	}
+
+	_, err = f.webauthn.FinishLogin(ctx, alice, response)
+	if !errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+		t.Fatalf("replayed FinishLogin error = %v, want %v", err, ErrWebAuthnCeremonyNotFound)
+	}
+}
+
+func TestWebAuthnCeremonyIsBoundToUser(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	bob := f.addUser(t, &domain.User{Email: "bob@example.com", Role: domain.RoleCustomer}, "")
+	authenticator := f.registerPasskey(t, alice)
+
+	assertion, err := f.webauthn.BeginLogin(ctx, alice)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+
+	_, err = f.webauthn.FinishLogin(ctx, bob, authenticator.assert(t, assertion, true))
+	if !errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+		t.Fatalf("FinishLogin error = %v, want %v", err, ErrWebAuthnCeremonyNotFound)
+	}
+}
+
+func TestWebAuthnRejectsClonedAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	authenticator := f.registerPasskey(t, alice)
+
+	for i := 0; i < 2; i++ {
+		assertion, err := f.webauthn.BeginLogin(ctx, alice)
+		if err != nil {
+			t.Fatalf("BeginLogin returned error: %v", err)
+		}
+		if _, err := f.webauthn.FinishLogin(ctx, alice, authenticator.assert(t, assertion, true)); err != nil {
+			t.Fatalf("FinishLogin returned error: %v", err)
+		}
+	}
+
+	// A copy of the key that has not seen the last signature
+	authenticator.signCount = 0
+
+	assertion, err := f.webauthn.BeginLogin(ctx, alice)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+
+	_, err = f.webauthn.FinishLogin(ctx, alice, authenticator.assert(t, assertion, true))
+	if !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Fatalf("FinishLogin error = %v, want %v", err, ErrWebAuthnVerificationFailed)
+	}
+}
+
+func TestWebAuthnRejectsForeignOrigin(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	alice := f.addUser(t, &domain.User{Email: "alice@example.com", Role: domain.RoleAdministrator}, "")
+	authenticator := f.registerPasskey(t, alice)
+
+	assertion, err := f.webauthn.BeginLogin(ctx, alice)
+	if err != nil {
+		t.Fatalf("BeginLogin returned error: %v", err)
+	}
+
+	authenticator.origin = "https://phishing.example"
+	_, err = f.webauthn.FinishLogin(ctx, alice, authenticator.assert(t, assertion, true))
+	if !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Fatalf("FinishLogin error = %v, want %v", err, ErrWebAuthnVerificationFailed)
+	}
+}
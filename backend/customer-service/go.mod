@@ -2,6 +2,15 @@ module github.com/hosterizer/customer-service
 
 go 1.21
 
+require github.com/hosterizer/shared v0.0.0
+
 require (
-	github.com/lib/pq v1.10.9
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+	github.com/golang-migrate/migrate/v4 v4.17.0 // indirect
+	github.com/hashicorp/errwrap v1.1.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/lib/pq v1.10.9 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
 )
+
+replace github.com/hosterizer/shared => ../shared
@@ -1,18 +1,82 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hosterizer/shared/audit"
+	"github.com/hosterizer/shared/auth"
 )
 
 func main() {
 	log.Println("Policy Service starting...")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8005"
+	port := getEnv("PORT", "8005")
+	jwksURL := getEnv("AUTH_JWKS_URL", "http://localhost:8001/.well-known/jwks.json")
+	sessionURL := getEnv("AUTH_SESSION_URL", "http://localhost:8001/api/v1/auth/sessions/current")
+	introspectionURL := getEnv("AUTH_API_KEY_INTROSPECTION_URL", "http://localhost:8001/api/v1/auth/api-keys/introspect")
+
+	// Access tokens are checked against auth-service's keys and their login
+	// session; API keys are introspected by auth-service
+	validator := &auth.BearerValidator{
+		Tokens:  auth.NewSessionValidator(auth.NewJWKSValidator(jwksURL), sessionURL),
+		APIKeys: auth.NewAPIKeyValidator(introspectionURL),
+	}
+
+	// Resource handlers are registered on api together with the API key scopes
+	// they accept; every request to it needs a valid credential
+	api := http.NewServeMux()
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", auth.Authenticate(validator)(api))
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	server := &http.Server{
+		Addr:         ":" + port,
+		Handler:      audit.RequestID()(mux),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// Start server in a goroutine
+	go func() {
+		log.Printf("Policy Service listening on port %s", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down server...")
+
+	// Graceful shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
-	log.Printf("Policy Service will listen on port %s", port)
-	// Server initialization will be implemented in subsequent tasks
+	log.Println("Server stopped")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
 }
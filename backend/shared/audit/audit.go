@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hosterizer/shared/auth"
+)
+
+// Action is the kind of change recorded by an audit entry
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Execer executes statements; both *sql.Tx and *sql.DB satisfy it
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Entry is a change to a tenant resource. Before and After hold the whole
+// resource, typically the struct a service stores; Record keeps only the fields
+// that changed.
+type Entry struct {
+	// ActorID, APIKeyID and CustomerID default to the request claims
+	ActorID    *int64
+	APIKeyID   string
+	CustomerID *int64
+
+	ResourceType string
+	ResourceID   string
+	Action       Action
+
+	// Before is nil on create and After is nil on delete
+	Before interface{}
+	After  interface{}
+
+	// RequestID defaults to the ID stored by the RequestID middleware
+	RequestID  string
+	OccurredAt time.Time
+}
+
+// Record appends an entry to the audit log. Pass the transaction that makes the
+// change, such as the one of database.WithTenantContext or auth.TxFromContext,
+// so the entry is committed or rolled back with it; RLS only lets customers
+// record entries of their own tenant. Updates that change nothing are not
+// recorded.
+func Record(ctx context.Context, exec Execer, entry Entry) error {
+	if entry.ResourceType == "" || entry.ResourceID == "" {
+		return fmt.Errorf("audit entry requires a resource type and ID")
+	}
+
+	switch entry.Action {
+	case ActionCreate, ActionUpdate, ActionDelete:
+	default:
+		return fmt.Errorf("invalid audit action %q", entry.Action)
+	}
+
+	before, after, err := Diff(entry.Before, entry.After)
+	if err != nil {
+		return fmt.Errorf("failed to diff %s %s: %w", entry.ResourceType, entry.ResourceID, err)
+	}
+	if entry.Action == ActionUpdate && before == nil && after == nil {
+		return nil
+	}
+
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		if entry.ActorID == nil && claims.UserID > 0 {
+			userID := claims.UserID
+			entry.ActorID = &userID
+		}
+		if entry.APIKeyID == "" {
+			entry.APIKeyID = claims.APIKeyID
+		}
+		if entry.CustomerID == nil && !claims.IsAdministrator() {
+			entry.CustomerID = claims.CustomerID
+		}
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = RequestIDFromContext(ctx)
+	}
+	if entry.OccurredAt.IsZero() {
+		entry.OccurredAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_id, api_key_id, customer_id, resource_type, resource_id, action, before, after, request_id, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err = exec.ExecContext(
+		ctx,
+		query,
+		entry.ActorID,
+		entry.APIKeyID,
+		entry.CustomerID,
+		entry.ResourceType,
+		entry.ResourceID,
+		string(entry.Action),
+		nullJSON(before),
+		nullJSON(after),
+		entry.RequestID,
+		entry.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Diff encodes two versions of a resource as JSON objects and returns only the
+// top-level fields that differ, with their old and new values. A field missing
+// from one version appears only in the other. Either version may be nil, in
+// which case every field of the other one is returned. Both results are nil
+// when nothing changed.
+func Diff(before, after interface{}) (json.RawMessage, json.RawMessage, error) {
+	oldFields, err := fields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	newFields, err := fields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldChanged := map[string]json.RawMessage{}
+	newChanged := map[string]json.RawMessage{}
+	for name, value := range oldFields {
+		if newValue, ok := newFields[name]; !ok || !bytes.Equal(value, newValue) {
+			oldChanged[name] = value
+		}
+	}
+	for name, value := range newFields {
+		if oldValue, ok := oldFields[name]; !ok || !bytes.Equal(value, oldValue) {
+			newChanged[name] = value
+		}
+	}
+
+	oldJSON, err := encodeFields(oldChanged, before == nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	newJSON, err := encodeFields(newChanged, after == nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldJSON, newJSON, nil
+}
+
+// fields returns the top-level fields of a value encoded as a JSON object
+func fields(value interface{}) (map[string]json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resource: %w", err)
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(data, &result); err != nil || result == nil {
+		return nil, fmt.Errorf("resource must encode to a JSON object")
+	}
+	return result, nil
+}
+
+// encodeFields encodes changed fields, or returns nil for a missing version or
+// when nothing changed
+func encodeFields(changed map[string]json.RawMessage, missing bool) (json.RawMessage, error) {
+	if missing || len(changed) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(changed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode changes: %w", err)
+	}
+	return data, nil
+}
+
+// nullJSON passes nil JSON as SQL NULL rather than an empty byte slice
+func nullJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return []byte(data)
+}
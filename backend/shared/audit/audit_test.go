@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hosterizer/shared/auth"
+)
+
+// recordingExecer keeps the arguments of the statements it is given
+type recordingExecer struct {
+	args [][]interface{}
+}
+
+func (e *recordingExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.args = append(e.args, args)
+	return nil, nil
+}
+
+type site struct {
+	Domain string `json:"domain"`
+	Region string `json:"region"`
+	Secret string `json:"-"`
+}
+
+func decodeFields(t *testing.T, data json.RawMessage) map[string]string {
+	t.Helper()
+
+	if data == nil {
+		return nil
+	}
+	var result map[string]string
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return result
+}
+
+func TestDiff(t *testing.T) {
+	before, after, err := Diff(
+		&site{Domain: "acme.example", Region: "eu-west-1", Secret: "old"},
+		&site{Domain: "shop.acme.example", Region: "eu-west-1", Secret: "new"},
+	)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if got := decodeFields(t, before); len(got) != 1 || got["domain"] != "acme.example" {
+		t.Errorf("before = %s, want only the old domain", before)
+	}
+	if got := decodeFields(t, after); len(got) != 1 || got["domain"] != "shop.acme.example" {
+		t.Errorf("after = %s, want only the new domain", after)
+	}
+
+	// A create keeps the whole resource in after, a delete in before
+	before, after, err = Diff(nil, &site{Domain: "acme.example", Region: "eu-west-1"})
+	if err != nil || before != nil || len(decodeFields(t, after)) != 2 {
+		t.Errorf("create: before %s after %s err %v", before, after, err)
+	}
+	before, after, err = Diff(&site{Domain: "acme.example", Region: "eu-west-1"}, nil)
+	if err != nil || after != nil || len(decodeFields(t, before)) != 2 {
+		t.Errorf("delete: before %s after %s err %v", before, after, err)
+	}
+
+	// Fields that disappear are only in before, new fields only in after
+	before, after, err = Diff(map[string]string{"plan": "basic"}, map[string]string{"tier": "gold"})
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if got := decodeFields(t, before); len(got) != 1 || got["plan"] != "basic" {
+		t.Errorf("before = %s", before)
+	}
+	if got := decodeFields(t, after); len(got) != 1 || got["tier"] != "gold" {
+		t.Errorf("after = %s", after)
+	}
+
+	// Unchanged resources give no diff, and only objects can be diffed
+	before, after, err = Diff(&site{Domain: "acme.example"}, &site{Domain: "acme.example", Secret: "changed"})
+	if err != nil || before != nil || after != nil {
+		t.Errorf("unchanged: before %s after %s err %v", before, after, err)
+	}
+	if _, _, err := Diff("acme.example", nil); err == nil {
+		t.Error("a string was diffed")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	customerID := int64(7)
+	ctx := auth.WithClaims(context.Background(), &auth.Claims{
+		UserID:     42,
+		Role:       auth.RoleCustomer,
+		CustomerID: &customerID,
+		APIKeyID:   "key-1",
+	})
+	ctx = WithRequestID(ctx, "req-1")
+
+	exec := &recordingExecer{}
+	err := Record(ctx, exec, Entry{
+		ResourceType: "site",
+		ResourceID:   "12",
+		Action:       ActionUpdate,
+		Before:       &site{Domain: "acme.example"},
+		After:        &site{Domain: "shop.acme.example"},
+	})
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if len(exec.args) != 1 {
+		t.Fatalf("recorded %d entries, want 1", len(exec.args))
+	}
+
+	// The actor, key, tenant and request come from the context
+	args := exec.args[0]
+	if actor, ok := args[0].(*int64); !ok || actor == nil || *actor != 42 {
+		t.Errorf("actor_id = %v, want 42", args[0])
+	}
+	if args[1] != "key-1" {
+		t.Errorf("api_key_id = %v, want key-1", args[1])
+	}
+	if customer, ok := args[2].(*int64); !ok || customer == nil || *customer != 7 {
+		t.Errorf("customer_id = %v, want 7", args[2])
+	}
+	if args[5] != "update" || args[8] != "req-1" {
+		t.Errorf("action %v request_id %v", args[5], args[8])
+	}
+	if occurredAt, ok := args[9].(time.Time); !ok || occurredAt.IsZero() {
+		t.Errorf("occurred_at = %v", args[9])
+	}
+
+	// Updates that change nothing are not recorded
+	err = Record(ctx, exec, Entry{
+		ResourceType: "site",
+		ResourceID:   "12",
+		Action:       ActionUpdate,
+		Before:       &site{Domain: "acme.example"},
+		After:        &site{Domain: "acme.example"},
+	})
+	if err != nil || len(exec.args) != 1 {
+		t.Errorf("no-op update: %d entries, err %v", len(exec.args), err)
+	}
+
+	// A create stores no before value
+	err = Record(ctx, exec, Entry{ResourceType: "site", ResourceID: "13", Action: ActionCreate, After: &site{Domain: "new.example"}})
+	if err != nil {
+		t.Fatalf("Record create: %v", err)
+	}
+	if before := exec.args[1][6]; before != nil {
+		t.Errorf("create before = %v, want NULL", before)
+	}
+}
+
+func TestRecordLeavesAdministratorEntriesUnscoped(t *testing.T) {
+	customerID := int64(7)
+	ctx := auth.WithClaims(context.Background(), &auth.Claims{
+		UserID:     1,
+		Role:       auth.RoleAdministrator,
+		CustomerID: &customerID,
+	})
+
+	exec := &recordingExecer{}
+	if err := Record(ctx, exec, Entry{ResourceType: "policy", ResourceID: "3", Action: ActionDelete, Before: &site{}}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if customer := exec.args[0][2].(*int64); customer != nil {
+		t.Errorf("customer_id = %d, want none for an administrator", *customer)
+	}
+}
+
+func TestRecordRejectsInvalidEntries(t *testing.T) {
+	exec := &recordingExecer{}
+	entries := []Entry{
+		{ResourceID: "12", Action: ActionCreate, After: &site{}},
+		{ResourceType: "site", Action: ActionCreate, After: &site{}},
+		{ResourceType: "site", ResourceID: "12", Action: "rename", After: &site{}},
+		{ResourceType: "site", ResourceID: "12", Action: ActionCreate, After: []string{"not", "an", "object"}},
+	}
+	for _, entry := range entries {
+		if err := Record(context.Background(), exec, entry); err == nil {
+			t.Errorf("entry %+v was recorded", entry)
+		}
+	}
+	if len(exec.args) != 0 {
+		t.Errorf("%d invalid entries reached the database", len(exec.args))
+	}
+}
@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// requestIDOf runs a request with the given X-Request-ID header through the
+// middleware and returns the ID seen by the handler and the response header
+func requestIDOf(header string) (string, string) {
+	var seen string
+	handler := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		r.Header.Set(RequestIDHeader, header)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return seen, w.Header().Get(RequestIDHeader)
+}
+
+func TestRequestID(t *testing.T) {
+	// IDs set by a gateway or another service are kept
+	seen, echoed := requestIDOf("gw-1234")
+	if seen != "gw-1234" || echoed != "gw-1234" {
+		t.Fatalf("propagated ID: handler saw %q, response %q", seen, echoed)
+	}
+
+	// Otherwise a new ID is generated for every request
+	first, echoed := requestIDOf("")
+	if len(first) != 32 || echoed != first {
+		t.Fatalf("generated ID: handler saw %q, response %q", first, echoed)
+	}
+	if second, _ := requestIDOf(""); second == first {
+		t.Fatal("two requests got the same ID")
+	}
+}
+
+func TestRequestIDReplacesInvalidHeaders(t *testing.T) {
+	for _, header := range []string{"has space", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		seen, echoed := requestIDOf(header)
+		if seen == header || echoed != seen || len(seen) != 32 {
+			t.Errorf("%q: handler saw %q, response %q", header, seen, echoed)
+		}
+	}
+}
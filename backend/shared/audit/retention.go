@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// MinRetention is the shortest retention period. The purge_audit_log
+	// function refuses shorter ones, so entries are kept at least this long.
+	MinRetention = 90 * 24 * time.Hour
+
+	// DefaultRetention is how long audit entries are kept
+	DefaultRetention = MinRetention
+
+	// DefaultPurgeInterval is how often the retention job runs
+	DefaultPurgeInterval = time.Hour
+)
+
+// retentionLockID is the advisory lock held while purging, so that of the
+// services running the retention job only one purges at a time
+const retentionLockID int64 = 0x61756469746c6f67
+
+// RetentionConfig holds the configuration of the retention job
+type RetentionConfig struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// Purge deletes the audit entries older than the retention period and returns
+// how many were deleted. Entries are deleted by the purge_audit_log function,
+// since RLS lets no one delete them directly. When another service is purging
+// already, Purge returns without deleting anything.
+func Purge(ctx context.Context, db *sql.DB, retention time.Duration) (int64, error) {
+	if retention < MinRetention {
+		return 0, fmt.Errorf("audit retention must be at least %v", MinRetention)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, retentionLockID).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to lock audit log retention: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	var purged int64
+	err = tx.QueryRowContext(ctx, `SELECT purge_audit_log(make_interval(secs => $1))`, retention.Seconds()).Scan(&purged)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge audit log: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return purged, nil
+}
+
+// RunRetention purges entries older than the retention period every interval
+// until ctx is done. Failures are logged and retried at the next run. Every
+// replica of a service may run it; an advisory lock keeps their runs from
+// overlapping, and a run after another one finds nothing left to delete.
+func RunRetention(ctx context.Context, db *sql.DB, cfg RetentionConfig) {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	if cfg.Retention < MinRetention {
+		log.Printf("Audit retention of %v is below the minimum, keeping entries for %v", cfg.Retention, MinRetention)
+		cfg.Retention = MinRetention
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultPurgeInterval
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if purged, err := Purge(purgeCtx, db, cfg.Retention); err != nil {
+			log.Printf("Failed to purge audit log: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d audit log entries older than %v", purged, cfg.Retention)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAPIKeyCacheTTL is how long the result of an API key introspection is
+	// reused. A revoked key keeps working for at most this long.
+	DefaultAPIKeyCacheTTL = 30 * time.Second
+)
+
+// APIKeyValidator validates API keys by introspecting them at auth-service's
+// /api/v1/auth/api-keys/introspect endpoint. Results are cached briefly, so a key
+// used for a burst of requests is only looked up once.
+type APIKeyValidator struct {
+	url      string
+	client   *http.Client
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	claims  *Claims
+	expires time.Time
+}
+
+// NewAPIKeyValidator creates a new validator for the introspection endpoint at the given URL
+func NewAPIKeyValidator(url string) *APIKeyValidator {
+	return &APIKeyValidator{
+		url:      url,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		cacheTTL: DefaultAPIKeyCacheTTL,
+		cache:    make(map[string]cachedAPIKey),
+	}
+}
+
+// ValidateAccessToken validates an API key and returns the claims of the principal it acts as
+func (v *APIKeyValidator) ValidateAccessToken(ctx context.Context, key string) (*Claims, error) {
+	if !IsAPIKey(key) {
+		return nil, fmt.Errorf("%w: not an API key", ErrInvalidToken)
+	}
+
+	// The cache is keyed by a hash, so keys are not kept in memory
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	v.mu.Lock()
+	cached, ok := v.cache[cacheKey]
+	v.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.claims, nil
+	}
+
+	claims, err := v.introspect(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(v.cacheTTL)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(expires) {
+		expires = claims.ExpiresAt.Time
+	}
+
+	v.mu.Lock()
+	for k, c := range v.cache {
+		if !now.Before(c.expires) {
+			delete(v.cache, k)
+		}
+	}
+	v.cache[cacheKey] = cachedAPIKey{claims: claims, expires: expires}
+	v.mu.Unlock()
+
+	return claims, nil
+}
+
+// introspect asks auth-service for the claims of an API key
+func (v *APIKeyValidator) introspect(ctx context.Context, key string) (*Claims, error) {
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal introspection request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect API key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrInvalidToken
+	default:
+		return nil, fmt.Errorf("failed to introspect API key: unexpected status %d", resp.StatusCode)
+	}
+
+	var claims Claims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	if !claims.IsAPIKey() {
+		return nil, fmt.Errorf("%w: expected API key claims", ErrInvalidToken)
+	}
+
+	return &claims, nil
+}
+
+// BearerValidator accepts both kinds of bearer credentials: API keys, recognised
+// by their prefix, go to APIKeys and everything else to Tokens. Without an API key
+// validator, API keys are refused.
+type BearerValidator struct {
+	Tokens  Validator
+	APIKeys Validator
+}
+
+// ValidateAccessToken validates an access token or API key and returns its claims
+func (v *BearerValidator) ValidateAccessToken(ctx context.Context, tokenString string) (*Claims, error) {
+	if IsAPIKey(tokenString) {
+		if v.APIKeys == nil {
+			return nil, fmt.Errorf("%w: API keys are not accepted", ErrInvalidToken)
+		}
+		return v.APIKeys.ValidateAccessToken(ctx, tokenString)
+	}
+	return v.Tokens.ValidateAccessToken(ctx, tokenString)
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIntrospection answers introspection requests like auth-service
+type testIntrospection struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	claims   map[string]*Claims
+	status   int
+	requests int
+}
+
+func newTestIntrospection(t *testing.T) *testIntrospection {
+	t.Helper()
+
+	ti := &testIntrospection{claims: make(map[string]*Claims)}
+	ti.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		ti.requests++
+
+		var req struct {
+			Key string `json:"key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if ti.status != 0 {
+			w.WriteHeader(ti.status)
+			return
+		}
+		claims, ok := ti.claims[req.Key]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(claims)
+	}))
+	t.Cleanup(ti.server.Close)
+	return ti
+}
+
+func (ti *testIntrospection) add(key string, claims *Claims) {
+	ti.mu.Lock()
+	ti.claims[key] = claims
+	ti.mu.Unlock()
+}
+
+func (ti *testIntrospection) revoke(key string) {
+	ti.mu.Lock()
+	delete(ti.claims, key)
+	ti.mu.Unlock()
+}
+
+func (ti *testIntrospection) requestCount() int {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	return ti.requests
+}
+
+func serviceKeyClaims(scopes ...string) *Claims {
+	customerID := int64(7)
+	return &Claims{
+		Role:       RoleCustomer,
+		CustomerID: &customerID,
+		TokenType:  TokenTypeAPIKey,
+		APIKeyID:   "key-1",
+		Scopes:     scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestAPIKeyValidator(t *testing.T) {
+	ctx := context.Background()
+	ti := newTestIntrospection(t)
+	ti.add("hzk_good", serviceKeyClaims(ScopeSitesRead))
+	validator := NewAPIKeyValidator(ti.server.URL)
+
+	claims, err := validator.ValidateAccessToken(ctx, "hzk_good")
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if !claims.IsAPIKey() || claims.APIKeyID != "key-1" || !claims.HasScope(ScopeSitesRead) {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// Repeated use is served from the cache until it expires
+	ti.revoke("hzk_good")
+	if _, err := validator.ValidateAccessToken(ctx, "hzk_good"); err != nil {
+		t.Fatalf("cached key: %v", err)
+	}
+	if ti.requestCount() != 1 {
+		t.Fatalf("introspected %d times, want 1", ti.requestCount())
+	}
+
+	// Once the cache entry expires, the revocation is seen
+	validator.mu.Lock()
+	for key, cached := range validator.cache {
+		cached.expires = time.Now()
+		validator.cache[key] = cached
+	}
+	validator.mu.Unlock()
+	if _, err := validator.ValidateAccessToken(ctx, "hzk_good"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("revoked key after cache expiry: got %v, want ErrInvalidToken", err)
+	}
+
+	// JWTs are never sent to the introspection endpoint
+	requests := ti.requestCount()
+	if _, err := validator.ValidateAccessToken(ctx, "eyJhbGciOiJFZERTQSJ9.e30.sig"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("JWT: got %v, want ErrInvalidToken", err)
+	}
+	if ti.requestCount() != requests {
+		t.Fatal("a JWT was sent for introspection")
+	}
+}
+
+func TestAPIKeyValidatorRejectsUnexpectedAnswers(t *testing.T) {
+	ctx := context.Background()
+	ti := newTestIntrospection(t)
+	validator := NewAPIKeyValidator(ti.server.URL)
+
+	// Only API key claims are accepted from the endpoint
+	user := accessClaims(42)
+	ti.add("hzk_access", user)
+	if _, err := validator.ValidateAccessToken(ctx, "hzk_access"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("access claims: got %v, want ErrInvalidToken", err)
+	}
+
+	// An outage is an error but not an invalid key
+	ti.add("hzk_good", serviceKeyClaims(ScopeSitesRead))
+	ti.mu.Lock()
+	ti.status = http.StatusInternalServerError
+	ti.mu.Unlock()
+	_, err := validator.ValidateAccessToken(ctx, "hzk_good")
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("introspection outage: got %v, want a non-token error", err)
+	}
+}
+
+func TestBearerValidator(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	ti := newTestIntrospection(t)
+	ti.add("hzk_good", serviceKeyClaims(ScopeSitesRead))
+
+	validator := &BearerValidator{
+		Tokens:  NewJWKSValidator(issuer.server.URL),
+		APIKeys: NewAPIKeyValidator(ti.server.URL),
+	}
+
+	claims, err := validator.ValidateAccessToken(ctx, issuer.sign(issuer.anyKID(), accessClaims(42)))
+	if err != nil || claims.UserID != 42 {
+		t.Fatalf("access token: %+v, %v", claims, err)
+	}
+	claims, err = validator.ValidateAccessToken(ctx, "hzk_good")
+	if err != nil || !claims.IsAPIKey() {
+		t.Fatalf("API key: %+v, %v", claims, err)
+	}
+
+	tokensOnly := &BearerValidator{Tokens: NewJWKSValidator(issuer.server.URL)}
+	if _, err := tokensOnly.ValidateAccessToken(ctx, "hzk_good"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("API key without an API key validator: got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestAuthenticateAPIKeys(t *testing.T) {
+	validator := staticValidator{token: "hzk_good", claims: serviceKeyClaims(ScopeSitesWrite)}
+
+	request := func(middleware func(http.Handler) http.Handler, method string) int {
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("Authorization", "Bearer hzk_good")
+		w := httptest.NewRecorder()
+		middleware(http.HandlerFunc(noContent)).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Routes that declare no scope do not take API keys at all
+	if code := request(Authenticate(validator), http.MethodGet); code != http.StatusForbidden {
+		t.Errorf("route without scopes: status %d, want 403", code)
+	}
+
+	if code := request(Authenticate(validator, ScopeSitesRead), http.MethodGet); code != http.StatusNoContent {
+		t.Errorf("sites:read route: status %d", code)
+	}
+	if code := request(Authenticate(validator, ScopeDeploymentsRead), http.MethodGet); code != http.StatusForbidden {
+		t.Errorf("deployments:read route: status %d, want 403", code)
+	}
+
+	// Writes need the write scope on top of the route's read scope
+	routes := func(write string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return Authenticate(validator, ScopeSitesRead)(RequireWriteScope(write)(next))
+		}
+	}
+	if code := request(routes(ScopeSitesWrite), http.MethodPost); code != http.StatusNoContent {
+		t.Errorf("write with sites:write: status %d", code)
+	}
+	if code := request(routes(ScopeDeploymentsWrite), http.MethodPost); code != http.StatusForbidden {
+		t.Errorf("write without deployments:write: status %d, want 403", code)
+	}
+	if code := request(routes(ScopeDeploymentsWrite), http.MethodGet); code != http.StatusNoContent {
+		t.Errorf("read on a route with a write scope: status %d", code)
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// RoleAdministrator is the platform administrator role
+	RoleAdministrator = "administrator"
+
+	// RoleCustomer is the customer user role
+	RoleCustomer = "customer"
+
+	// TokenTypeAccess is the token_type claim of access tokens
+	TokenTypeAccess = "access"
+
+	// TokenTypeAPIKey is the token_type of claims resolved from an API key
+	TokenTypeAPIKey = "api_key"
+
+	// Issuer is the issuer of tokens minted by auth-service
+	Issuer = "hosterizer-auth"
+)
+
+const (
+	// TenantRoleOwner manages the tenant, its members and billing
+	TenantRoleOwner = "owner"
+
+	// TenantRoleDeveloper manages the tenant's sites and infrastructure
+	TenantRoleDeveloper = "developer"
+
+	// TenantRoleBilling manages the tenant's billing
+	TenantRoleBilling = "billing"
+
+	// TenantRoleReadOnly can only read the tenant's resources
+	TenantRoleReadOnly = "read_only"
+)
+
+// Claims represents the claims of an access token issued by auth-service
+type Claims struct {
+	UserID     int64    `json:"user_id"`
+	UUID       string   `json:"uuid"`
+	Email      string   `json:"email"`
+	Role       string   `json:"role"`
+	CustomerID *int64   `json:"customer_id,omitempty"`
+	TenantRole string   `json:"tenant_role,omitempty"`
+	FamilyID   string   `json:"fid,omitempty"`
+	SessionID  string   `json:"sid,omitempty"`
+	TokenType  string   `json:"token_type"`
+	APIKeyID   string   `json:"api_key_id,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IsAdministrator checks if the claims belong to an administrator
+func (c *Claims) IsAdministrator() bool {
+	return c.Role == RoleAdministrator
+}
+
+// HasRole checks if the claims carry one of the given platform roles
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTenantRole checks if the claims carry one of the given roles within their tenant
+func (c *Claims) HasTenantRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.TenantRole != "" && c.TenantRole == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey checks if the claims were resolved from an API key
+func (c *Claims) IsAPIKey() bool {
+	return c.TokenType == TokenTypeAPIKey
+}
+
+// HasScope checks if the claims allow the given scope. Access tokens of a
+// signed-in user are not limited by scopes; API keys only allow the scopes they
+// were granted.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsAPIKey() {
+		return true
+	}
+	for _, granted := range c.Scopes {
+		if scopeCovers(granted, scope) {
+			return true
+		}
+	}
+	return false
+}
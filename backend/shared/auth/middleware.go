@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hosterizer/shared/database"
+)
+
+type contextKey int
+
+const (
+	claimsContextKey contextKey = iota
+	txContextKey
+)
+
+// ErrorResponse represents an error response written by the middleware
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// WithClaims returns a copy of ctx carrying the given claims
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext returns the claims stored by Authenticate
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// TxFromContext returns the RLS-scoped transaction opened by TenantTransaction
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey).(*sql.Tx)
+	return tx, ok && tx != nil
+}
+
+// Authenticate validates the bearer credential of every request and stores its
+// claims in the request context. Requests without a valid credential get 401.
+// API keys are only accepted on routes that declare the scopes they need: without
+// scopes they get 403, as they do when they lack one of the scopes. Access tokens
+// of signed-in users are not limited by scopes.
+func Authenticate(validator Validator, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, ok := bearerToken(r)
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+
+			claims, err := validator.ValidateAccessToken(r.Context(), tokenString)
+			if err != nil {
+				sendError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			if claims.IsAPIKey() {
+				if len(scopes) == 0 {
+					sendError(w, http.StatusForbidden, "API keys are not accepted on this route")
+					return
+				}
+				if scope, ok := missingScope(claims, scopes); ok {
+					sendError(w, http.StatusForbidden, "insufficient scope: "+scope+" required")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireRole only lets requests through whose claims carry one of the given roles.
+// It must run after Authenticate.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			if !claims.HasRole(roles...) {
+				sendError(w, http.StatusForbidden, "insufficient role")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdministrator only lets administrators through. It must run after Authenticate.
+func RequireAdministrator() func(http.Handler) http.Handler {
+	return RequireRole(RoleAdministrator)
+}
+
+// RequireTenantRole only lets requests through whose claims carry one of the
+// given tenant roles, such as TenantRoleOwner. Administrators act across tenants
+// and pass; service keys have no tenant role and are refused. It must run after
+// Authenticate.
+func RequireTenantRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			if !claims.IsAdministrator() && !claims.HasTenantRole(roles...) {
+				sendError(w, http.StatusForbidden, "insufficient tenant role")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope only lets requests through whose claims allow all of the given
+// scopes. Access tokens of signed-in users pass; API keys need the scopes granted.
+// It narrows the scopes declared to Authenticate and must run after it.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			if scope, ok := missingScope(claims, scopes); ok {
+				sendError(w, http.StatusForbidden, "insufficient scope: "+scope+" required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireWriteScope works like RequireScope for requests that may change data,
+// i.e. all but GET, HEAD and OPTIONS, and lets the others through. Routes declare
+// their read scope to Authenticate and their write scope here.
+func RequireWriteScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		requireScope := RequireScope(scopes...)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+			default:
+				requireScope.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// missingScope returns the first of the scopes the claims do not allow
+func missingScope(claims *Claims, scopes []string) (string, bool) {
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// TenantTransaction runs each request inside a database.WithTenantContext transaction
+// built from the request claims, so handlers get RLS-scoped queries through TxFromContext.
+// The transaction is committed when the handler responds with a status below 400 and
+// rolled back otherwise. The response is buffered until then: if the commit fails,
+// the client gets 500 instead of the handler's response. Customer users without a
+// customer_id claim are refused. It must run after Authenticate.
+func TenantTransaction(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				sendError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			tc, err := TenantContextFromClaims(claims)
+			if err != nil {
+				sendError(w, http.StatusForbidden, err.Error())
+				return
+			}
+
+			buf := newBufferedResponse()
+			err = database.WithTenantContext(r.Context(), db, tc, func(tx *sql.Tx) error {
+				ctx := context.WithValue(r.Context(), txContextKey, tx)
+				next.ServeHTTP(buf, r.WithContext(ctx))
+				if buf.status >= http.StatusBadRequest {
+					return errHandlerFailed
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errHandlerFailed) {
+				sendError(w, http.StatusInternalServerError, "failed to process request")
+				return
+			}
+
+			buf.flush(w)
+		})
+	}
+}
+
+// errHandlerFailed rolls back the transaction of a handler that responded with an error
+var errHandlerFailed = errors.New("handler responded with an error status")
+
+// TenantContextFromClaims builds the RLS tenant context for a set of claims
+func TenantContextFromClaims(claims *Claims) (database.TenantContext, error) {
+	tc := database.TenantContext{
+		UserRole: claims.Role,
+	}
+
+	if claims.IsAdministrator() {
+		return tc, nil
+	}
+
+	if claims.CustomerID == nil {
+		return tc, fmt.Errorf("token is not scoped to a customer")
+	}
+
+	tc.CustomerID = *claims.CustomerID
+	return tc, nil
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" || tokenString == authHeader {
+		return "", false
+	}
+	return tokenString, true
+}
+
+// bufferedResponse holds a handler's response until its transaction is done
+type bufferedResponse struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+// flush writes the buffered response to w
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
+
+func sendError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(status),
+		Message: message,
+	})
+}
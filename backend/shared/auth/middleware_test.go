@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// staticValidator accepts a single token
+type staticValidator struct {
+	token  string
+	claims *Claims
+}
+
+func (v staticValidator) ValidateAccessToken(ctx context.Context, tokenString string) (*Claims, error) {
+	if tokenString != v.token {
+		return nil, ErrInvalidToken
+	}
+	return v.claims, nil
+}
+
+// serve runs a request with the given claims through a middleware
+func serve(middleware func(http.Handler) http.Handler, claims *Claims, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if claims != nil {
+		r = r.WithContext(WithClaims(r.Context(), claims))
+	}
+	w := httptest.NewRecorder()
+	middleware(handler).ServeHTTP(w, r)
+	return w
+}
+
+func noContent(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestAuthenticate(t *testing.T) {
+	claims := accessClaims(42)
+	middleware := Authenticate(staticValidator{token: "good", claims: claims})
+
+	var seen *Claims
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = ClaimsFromContext(r.Context())
+	}))
+
+	for _, header := range []string{"", "good", "Basic good", "Bearer bad"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", header, w.Code)
+		}
+	}
+	if seen != nil {
+		t.Fatal("handler ran for an unauthenticated request")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer good")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if seen != claims {
+		t.Fatal("claims were not stored in the request context")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	admin := &Claims{Role: RoleAdministrator}
+	customer := &Claims{Role: RoleCustomer}
+
+	if w := serve(RequireAdministrator(), admin, noContent); w.Code != http.StatusNoContent {
+		t.Errorf("administrator: status %d", w.Code)
+	}
+	if w := serve(RequireAdministrator(), customer, noContent); w.Code != http.StatusForbidden {
+		t.Errorf("customer: status %d, want 403", w.Code)
+	}
+	if w := serve(RequireRole(RoleAdministrator, RoleCustomer), customer, noContent); w.Code != http.StatusNoContent {
+		t.Errorf("customer with either role allowed: status %d", w.Code)
+	}
+	if w := serve(RequireRole(RoleCustomer), nil, noContent); w.Code != http.StatusUnauthorized {
+		t.Errorf("no claims: status %d, want 401", w.Code)
+	}
+}
+
+func TestRequireTenantRole(t *testing.T) {
+	customerID := int64(7)
+	member := func(role string) *Claims {
+		return &Claims{Role: RoleCustomer, CustomerID: &customerID, TenantRole: role}
+	}
+	ownersAndDevelopers := RequireTenantRole(TenantRoleOwner, TenantRoleDeveloper)
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   int
+	}{
+		{"owner", member(TenantRoleOwner), http.StatusNoContent},
+		{"developer", member(TenantRoleDeveloper), http.StatusNoContent},
+		{"billing", member(TenantRoleBilling), http.StatusForbidden},
+		{"read only", member(TenantRoleReadOnly), http.StatusForbidden},
+		{"service key", &Claims{Role: RoleCustomer, CustomerID: &customerID, TokenType: TokenTypeAPIKey}, http.StatusForbidden},
+		{"administrator", &Claims{Role: RoleAdministrator}, http.StatusNoContent},
+		{"no claims", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := serve(ownersAndDevelopers, tt.claims, noContent); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	apiKey := &Claims{Role: RoleCustomer, TokenType: TokenTypeAPIKey, Scopes: []string{ScopeSitesRead}}
+
+	if w := serve(RequireScope(ScopeSitesRead), apiKey, noContent); w.Code != http.StatusNoContent {
+		t.Errorf("granted scope: status %d", w.Code)
+	}
+	if w := serve(RequireScope(ScopeSitesRead, ScopeSitesWrite), apiKey, noContent); w.Code != http.StatusForbidden {
+		t.Errorf("missing scope: status %d, want 403", w.Code)
+	}
+	if w := serve(RequireScope(ScopeSitesWrite), accessClaims(42), noContent); w.Code != http.StatusNoContent {
+		t.Errorf("access token: status %d", w.Code)
+	}
+}
+
+// fakeDB is a database/sql connector whose transactions record what happened to
+// them, so TenantTransaction can be tested without PostgreSQL
+type fakeDB struct {
+	mu         sync.Mutex
+	commitErr  error
+	statements []string
+	commits    int
+	rollbacks  int
+}
+
+func (d *fakeDB) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{db: d}, nil }
+func (d *fakeDB) Driver() driver.Driver                            { return fakeDriver{d} }
+
+type fakeDriver struct{ db *fakeDB }
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{db: d.db}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return &fakeTx{db: c.db}, nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.statements = append(c.db.statements, query)
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if tx.db.commitErr != nil {
+		return tx.db.commitErr
+	}
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.rollbacks++
+	return nil
+}
+
+// insert writes through the request transaction and responds with status
+func insert(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tx, ok := TxFromContext(r.Context())
+		if !ok {
+			http.Error(w, "no transaction", http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.ExecContext(r.Context(), "INSERT INTO sites (name) VALUES ('blog')"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Handler", "sites")
+		w.WriteHeader(status)
+		w.Write([]byte("site created"))
+	}
+}
+
+func TestTenantTransaction(t *testing.T) {
+	customerID := int64(7)
+	customer := &Claims{Role: RoleCustomer, CustomerID: &customerID}
+
+	t.Run("commits and passes the response on", func(t *testing.T) {
+		fake := &fakeDB{}
+		w := serve(TenantTransaction(sql.OpenDB(fake)), customer, insert(http.StatusCreated))
+
+		if w.Code != http.StatusCreated || w.Body.String() != "site created" || w.Header().Get("X-Handler") != "sites" {
+			t.Fatalf("got %d %q %v, want the handler's response", w.Code, w.Body.String(), w.Header())
+		}
+		if fake.commits != 1 {
+			t.Fatalf("committed %d times, want 1", fake.commits)
+		}
+		if len(fake.statements) != 3 || !strings.Contains(fake.statements[0], "app.current_customer_id") {
+			t.Fatalf("unexpected statements %q", fake.statements)
+		}
+	})
+
+	t.Run("rolls back error responses", func(t *testing.T) {
+		fake := &fakeDB{}
+		w := serve(TenantTransaction(sql.OpenDB(fake)), customer, insert(http.StatusConflict))
+
+		if w.Code != http.StatusConflict || w.Body.String() != "site created" {
+			t.Fatalf("got %d %q, want the handler's response", w.Code, w.Body.String())
+		}
+		if fake.commits != 0 || fake.rollbacks != 1 {
+			t.Fatalf("commits %d rollbacks %d, want a rollback only", fake.commits, fake.rollbacks)
+		}
+	})
+
+	t.Run("reports failed commits", func(t *testing.T) {
+		fake := &fakeDB{commitErr: errors.New("serialization failure")}
+		w := serve(TenantTransaction(sql.OpenDB(fake)), customer, insert(http.StatusCreated))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status %d, want 500", w.Code)
+		}
+		if strings.Contains(w.Body.String(), "site created") || w.Header().Get("X-Handler") != "" {
+			t.Fatalf("the response of the rolled back handler leaked: %v %q", w.Header(), w.Body.String())
+		}
+	})
+
+	t.Run("refuses customers without a tenant", func(t *testing.T) {
+		fake := &fakeDB{}
+		w := serve(TenantTransaction(sql.OpenDB(fake)), &Claims{Role: RoleCustomer}, insert(http.StatusCreated))
+
+		if w.Code != http.StatusForbidden || len(fake.statements) != 0 {
+			t.Fatalf("status %d after %d statements, want 403 before any", w.Code, len(fake.statements))
+		}
+	})
+
+	t.Run("administrators see every tenant", func(t *testing.T) {
+		fake := &fakeDB{}
+		w := serve(TenantTransaction(sql.OpenDB(fake)), &Claims{Role: RoleAdministrator}, insert(http.StatusCreated))
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status %d", w.Code)
+		}
+		for _, statement := range fake.statements {
+			if strings.Contains(statement, "app.current_customer_id") {
+				t.Fatalf("administrator transaction was scoped to a customer: %q", fake.statements)
+			}
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package auth
+
+import "strings"
+
+const (
+	// ScopeSitesRead allows reading sites
+	ScopeSitesRead = "sites:read"
+
+	// ScopeSitesWrite allows creating, updating and deleting sites
+	ScopeSitesWrite = "sites:write"
+
+	// ScopeDeploymentsRead allows reading deployments
+	ScopeDeploymentsRead = "deployments:read"
+
+	// ScopeDeploymentsWrite allows starting and cancelling deployments
+	ScopeDeploymentsWrite = "deployments:write"
+
+	// ScopeInfrastructureRead allows reading infrastructure
+	ScopeInfrastructureRead = "infrastructure:read"
+
+	// ScopeInfrastructureWrite allows provisioning and changing infrastructure
+	ScopeInfrastructureWrite = "infrastructure:write"
+
+	// ScopePoliciesRead allows reading cloud policies
+	ScopePoliciesRead = "policies:read"
+
+	// ScopePoliciesWrite allows changing cloud policies
+	ScopePoliciesWrite = "policies:write"
+
+	// ScopeCostsRead allows reading cost records
+	ScopeCostsRead = "costs:read"
+
+	// APIKeyPrefix starts every API key, so keys can be told apart from JWTs
+	// and found by secret scanners
+	APIKeyPrefix = "hzk_"
+)
+
+// Scopes lists every scope an API key can be granted
+var Scopes = []string{
+	ScopeSitesRead,
+	ScopeSitesWrite,
+	ScopeDeploymentsRead,
+	ScopeDeploymentsWrite,
+	ScopeInfrastructureRead,
+	ScopeInfrastructureWrite,
+	ScopePoliciesRead,
+	ScopePoliciesWrite,
+	ScopeCostsRead,
+}
+
+// IsValidScope checks if a scope is known
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey checks if a bearer credential is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// scopeCovers checks if a granted scope covers a required one. A write scope
+// covers the read scope of the same resource.
+func scopeCovers(granted, required string) bool {
+	if granted == required {
+		return true
+	}
+	resource, action, ok := strings.Cut(required, ":")
+	return ok && action == "read" && granted == resource+":write"
+}
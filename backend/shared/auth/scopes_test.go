@@ -0,0 +1,50 @@
+package auth
+
+import "testing"
+
+func TestHasScope(t *testing.T) {
+	apiKey := &Claims{TokenType: TokenTypeAPIKey, Scopes: []string{ScopeSitesWrite, ScopeCostsRead}}
+
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{ScopeSitesWrite, true},
+		{ScopeSitesRead, true}, // covered by sites:write
+		{ScopeCostsRead, true},
+		{ScopeDeploymentsRead, false},
+		{ScopePoliciesWrite, false},
+		{"costs:write", false}, // a read scope never covers writes
+	}
+	for _, tt := range tests {
+		if got := apiKey.HasScope(tt.scope); got != tt.want {
+			t.Errorf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+
+	// Access tokens of signed-in users are not limited by scopes
+	user := &Claims{TokenType: TokenTypeAccess}
+	if !user.HasScope(ScopePoliciesWrite) {
+		t.Error("access token was limited by scopes")
+	}
+}
+
+func TestScopeNames(t *testing.T) {
+	for _, scope := range Scopes {
+		if !IsValidScope(scope) {
+			t.Errorf("IsValidScope(%q) = false", scope)
+		}
+	}
+	for _, scope := range []string{"", "sites", "sites:admin", "SITES:READ"} {
+		if IsValidScope(scope) {
+			t.Errorf("IsValidScope(%q) = true", scope)
+		}
+	}
+
+	if !IsAPIKey(APIKeyPrefix + "abc") {
+		t.Error("prefixed key was not recognised as an API key")
+	}
+	if IsAPIKey("eyJhbGciOiJFZERTQSJ9.e30.sig") {
+		t.Error("JWT was taken for an API key")
+	}
+}
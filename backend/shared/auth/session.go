@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSessionCheckInterval is how long a session confirmed by auth-service
+	// is trusted. A revoked or idled out session keeps working for at most this
+	// long, and sessions in use are slid forward at least this often.
+	DefaultSessionCheckInterval = 30 * time.Second
+)
+
+// ErrSessionExpired is returned when the login session of a token has idled out or was revoked
+var ErrSessionExpired = errors.New("session expired")
+
+// SessionValidator checks the login session of access tokens accepted by another
+// validator, typically a JWKSValidator. The session is looked up at auth-service's
+// /api/v1/auth/sessions/current endpoint, which also extends its idle timeout, so
+// activity in any service keeps a login alive. Confirmed sessions are cached
+// briefly; tokens without a sid claim are not checked.
+type SessionValidator struct {
+	tokens   Validator
+	url      string
+	client   *http.Client
+	interval time.Duration
+
+	mu      sync.Mutex
+	checked map[string]time.Time
+}
+
+// NewSessionValidator creates a validator that checks the sessions of the tokens
+// accepted by tokens at the given session endpoint URL
+func NewSessionValidator(tokens Validator, url string) *SessionValidator {
+	return &SessionValidator{
+		tokens:   tokens,
+		url:      url,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		interval: DefaultSessionCheckInterval,
+		checked:  make(map[string]time.Time),
+	}
+}
+
+// ValidateAccessToken validates an access token and checks that its login session is active
+func (v *SessionValidator) ValidateAccessToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := v.tokens.ValidateAccessToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.SessionID == "" {
+		return claims, nil
+	}
+
+	now := time.Now()
+	v.mu.Lock()
+	until, ok := v.checked[claims.SessionID]
+	v.mu.Unlock()
+	if ok && now.Before(until) {
+		return claims, nil
+	}
+
+	if err := v.checkSession(ctx, tokenString); err != nil {
+		v.mu.Lock()
+		delete(v.checked, claims.SessionID)
+		v.mu.Unlock()
+		return nil, err
+	}
+
+	v.mu.Lock()
+	for sid, until := range v.checked {
+		if !now.Before(until) {
+			delete(v.checked, sid)
+		}
+	}
+	v.checked[claims.SessionID] = now.Add(v.interval)
+	v.mu.Unlock()
+
+	return claims, nil
+}
+
+// checkSession asks auth-service whether the session of a token is active
+func (v *SessionValidator) checkSession(ctx context.Context, tokenString string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create session request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return ErrSessionExpired
+	default:
+		return fmt.Errorf("failed to check session: unexpected status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSessions answers session checks like auth-service, for the tokens of one issuer
+type testSessions struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	active   map[string]bool
+	down     bool
+	requests int
+}
+
+func newTestSessions(t *testing.T, issuer *testIssuer) *testSessions {
+	t.Helper()
+
+	tokens := NewJWKSValidator(issuer.server.URL)
+	ts := &testSessions{active: make(map[string]bool)}
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.requests++
+
+		if ts.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		claims, err := tokens.ValidateAccessToken(r.Context(), strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if err != nil || !ts.active[claims.SessionID] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(ts.server.Close)
+	return ts
+}
+
+func (ts *testSessions) set(sid string, active bool) {
+	ts.mu.Lock()
+	ts.active[sid] = active
+	ts.mu.Unlock()
+}
+
+func (ts *testSessions) requestCount() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.requests
+}
+
+func sessionClaims(sid string) *Claims {
+	claims := accessClaims(42)
+	claims.SessionID = sid
+	return claims
+}
+
+func TestSessionValidator(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	sessions := newTestSessions(t, issuer)
+	sessions.set("session-1", true)
+	validator := NewSessionValidator(NewJWKSValidator(issuer.server.URL), sessions.server.URL)
+
+	token := issuer.sign(issuer.anyKID(), sessionClaims("session-1"))
+	claims, err := validator.ValidateAccessToken(ctx, token)
+	if err != nil {
+		t.Fatalf("active session: %v", err)
+	}
+	if claims.SessionID != "session-1" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	// A confirmed session is trusted for the check interval
+	sessions.set("session-1", false)
+	if _, err := validator.ValidateAccessToken(ctx, token); err != nil {
+		t.Fatalf("cached session: %v", err)
+	}
+	if sessions.requestCount() != 1 {
+		t.Fatalf("checked the session %d times, want 1", sessions.requestCount())
+	}
+
+	// After that the ended session is noticed
+	validator.mu.Lock()
+	validator.checked = make(map[string]time.Time)
+	validator.mu.Unlock()
+	if _, err := validator.ValidateAccessToken(ctx, token); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("ended session: got %v, want ErrSessionExpired", err)
+	}
+}
+
+func TestSessionValidatorChecksEveryInterval(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	sessions := newTestSessions(t, issuer)
+	sessions.set("session-1", true)
+	validator := NewSessionValidator(NewJWKSValidator(issuer.server.URL), sessions.server.URL)
+	validator.interval = 0
+
+	// Each check slides the session at auth-service
+	token := issuer.sign(issuer.anyKID(), sessionClaims("session-1"))
+	for i := 0; i < 3; i++ {
+		if _, err := validator.ValidateAccessToken(ctx, token); err != nil {
+			t.Fatalf("ValidateAccessToken: %v", err)
+		}
+	}
+	if sessions.requestCount() != 3 {
+		t.Fatalf("checked the session %d times, want 3", sessions.requestCount())
+	}
+
+	// An unreachable auth-service fails closed
+	sessions.mu.Lock()
+	sessions.down = true
+	sessions.mu.Unlock()
+	if _, err := validator.ValidateAccessToken(ctx, token); err == nil {
+		t.Fatal("token accepted while its session could not be checked")
+	}
+}
+
+func TestSessionValidatorSkipsTokensWithoutSession(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	sessions := newTestSessions(t, issuer)
+	validator := NewSessionValidator(NewJWKSValidator(issuer.server.URL), sessions.server.URL)
+
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(issuer.anyKID(), accessClaims(42))); err != nil {
+		t.Fatalf("token without sid: %v", err)
+	}
+	if sessions.requestCount() != 0 {
+		t.Fatal("a token without sid was checked")
+	}
+
+	// Invalid tokens are refused before any session lookup
+	if _, err := validator.ValidateAccessToken(ctx, "not-a-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("invalid token: got %v, want ErrInvalidToken", err)
+	}
+	if sessions.requestCount() != 0 {
+		t.Fatal("an invalid token was checked")
+	}
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is the minimum time between JWKS fetches
+	// triggered by unknown key IDs
+	DefaultJWKSRefreshInterval = time.Minute
+)
+
+var (
+	// ErrInvalidToken is returned when a token is invalid
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrExpiredToken is returned when a token has expired
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Validator validates a bearer access token and returns its claims
+type Validator interface {
+	ValidateAccessToken(ctx context.Context, tokenString string) (*Claims, error)
+}
+
+// JWKSValidator validates access tokens against the public keys published by
+// auth-service at /.well-known/jwks.json. Keys are cached and the set is fetched
+// again when a token carries an unknown key ID, so signing keys can be rotated
+// without restarting services.
+type JWKSValidator struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]verificationKey
+	lastFetch time.Time
+}
+
+type verificationKey struct {
+	algorithm string
+	publicKey crypto.PublicKey
+}
+
+// NewJWKSValidator creates a new validator for the JWKS at the given URL
+func NewJWKSValidator(url string) *JWKSValidator {
+	return &JWKSValidator{
+		url:             url,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		refreshInterval: DefaultJWKSRefreshInterval,
+		keys:            make(map[string]verificationKey),
+	}
+}
+
+// ValidateAccessToken validates an access token and returns its claims
+func (v *JWKSValidator) ValidateAccessToken(ctx context.Context, tokenString string) (*Claims, error) {
+	return parseAccessToken(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("missing key id")
+		}
+
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// The algorithm must match the key to rule out algorithm confusion
+		if token.Method.Alg() != key.algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.publicKey, nil
+	})
+}
+
+// key returns the verification key for a key ID, fetching the JWKS again if the
+// key is unknown and the last fetch is older than the refresh interval
+func (v *JWKSValidator) key(ctx context.Context, kid string) (verificationKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.lastFetch) >= v.refreshInterval
+	v.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return verificationKey{}, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if err := v.Refresh(ctx); err != nil {
+		return verificationKey{}, err
+	}
+
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+
+	if !ok {
+		return verificationKey{}, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// Refresh fetches the JWKS and replaces the cached keys
+func (v *JWKSValidator) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			// Skip keys this validator cannot use
+			continue
+		}
+		algorithm, err := Algorithm(publicKey)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = verificationKey{algorithm: algorithm, publicKey: publicKey}
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.lastFetch = time.Now()
+	v.mu.Unlock()
+
+	return nil
+}
+
+// parseAccessToken parses a token with the given key function and checks the access token claims
+func parseAccessToken(tokenString string, keyFunc jwt.Keyfunc) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyFunc, jwt.WithIssuer(Issuer))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.TokenType != TokenTypeAccess {
+		return nil, fmt.Errorf("%w: expected access token", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
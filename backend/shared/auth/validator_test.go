@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer signs access tokens like auth-service and serves its JWKS
+type testIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]ed25519.PrivateKey
+	fetches int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	issuer := &testIssuer{t: t, keys: make(map[string]ed25519.PrivateKey)}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		issuer.fetches++
+
+		var set JWKSet
+		for kid, key := range issuer.keys {
+			jwk, err := NewJWK(kid, key.Public())
+			if err != nil {
+				t.Errorf("NewJWK: %v", err)
+			}
+			set.Keys = append(set.Keys, jwk)
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(issuer.server.Close)
+
+	issuer.rotate()
+	return issuer
+}
+
+// rotate adds a new signing key and returns its key ID
+func (i *testIssuer) rotate() string {
+	i.t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	kid, err := Thumbprint(key.Public())
+	if err != nil {
+		i.t.Fatal(err)
+	}
+
+	i.mu.Lock()
+	i.keys[kid] = key
+	i.mu.Unlock()
+	return kid
+}
+
+func (i *testIssuer) fetchCount() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.fetches
+}
+
+// sign signs claims with the key of the given key ID
+func (i *testIssuer) sign(kid string, claims *Claims) string {
+	i.t.Helper()
+
+	i.mu.Lock()
+	key := i.keys[kid]
+	i.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	return signed
+}
+
+// anyKID returns the ID of one of the signing keys
+func (i *testIssuer) anyKID() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for kid := range i.keys {
+		return kid
+	}
+	return ""
+}
+
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func accessClaims(userID int64) *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID:    userID,
+		Role:      RoleCustomer,
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+		},
+	}
+}
+
+func TestJWKSValidatorAcceptsAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	validator := NewJWKSValidator(issuer.server.URL)
+
+	customerID := int64(7)
+	claims := accessClaims(42)
+	claims.CustomerID = &customerID
+	claims.TenantRole = TenantRoleDeveloper
+
+	got, err := validator.ValidateAccessToken(ctx, issuer.sign(issuer.anyKID(), claims))
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if got.UserID != 42 || got.CustomerID == nil || *got.CustomerID != 7 || got.TenantRole != TenantRoleDeveloper {
+		t.Fatalf("unexpected claims %+v", got)
+	}
+}
+
+func TestJWKSValidatorRejectsInvalidTokens(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	kid := issuer.anyKID()
+	validator := NewJWKSValidator(issuer.server.URL)
+
+	expired := accessClaims(42)
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(kid, expired)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("expired token: got %v, want ErrExpiredToken", err)
+	}
+
+	foreign := accessClaims(42)
+	foreign.Issuer = "someone-else"
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(kid, foreign)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("foreign issuer: got %v, want ErrInvalidToken", err)
+	}
+
+	refresh := accessClaims(42)
+	refresh.TokenType = "refresh"
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(kid, refresh)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("refresh token: got %v, want ErrInvalidToken", err)
+	}
+
+	// A token signed with a key that is not published
+	_, stranger, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, accessClaims(42))
+	token.Header["kid"] = kid
+	forged, err := token.SignedString(stranger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validator.ValidateAccessToken(ctx, forged); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("forged signature: got %v, want ErrInvalidToken", err)
+	}
+
+	// The algorithm is taken from the key, not from the token header
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(42))
+	hmac.Header["kid"] = kid
+	confused, err := hmac.SignedString([]byte(kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validator.ValidateAccessToken(ctx, confused); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("algorithm confusion: got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWKSValidatorPicksUpRotatedKeys(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	validator := NewJWKSValidator(issuer.server.URL)
+	validator.refreshInterval = 0
+
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(issuer.anyKID(), accessClaims(42))); err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if issuer.fetchCount() != 1 {
+		t.Fatalf("fetched JWKS %d times, want 1", issuer.fetchCount())
+	}
+
+	// Known keys are served from the cache
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(issuer.anyKID(), accessClaims(42))); err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if issuer.fetchCount() != 1 {
+		t.Fatalf("fetched JWKS %d times for a cached key, want 1", issuer.fetchCount())
+	}
+
+	// A new key ID triggers a fetch
+	rotated := issuer.rotate()
+	if _, err := validator.ValidateAccessToken(ctx, issuer.sign(rotated, accessClaims(42))); err != nil {
+		t.Fatalf("token signed with rotated key: %v", err)
+	}
+	if issuer.fetchCount() != 2 {
+		t.Fatalf("fetched JWKS %d times after rotation, want 2", issuer.fetchCount())
+	}
+}
+
+func TestJWKSValidatorLimitsRefetches(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	validator := NewJWKSValidator(issuer.server.URL)
+
+	if err := validator.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Unknown key IDs do not hammer auth-service within the refresh interval
+	rotated := issuer.rotate()
+	for i := 0; i < 3; i++ {
+		if _, err := validator.ValidateAccessToken(ctx, issuer.sign(rotated, accessClaims(42))); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("unknown key before refresh interval: got %v, want ErrInvalidToken", err)
+		}
+	}
+	if issuer.fetchCount() != 1 {
+		t.Fatalf("fetched JWKS %d times, want 1", issuer.fetchCount())
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := testRSAKey(t)
+
+	for _, publicKey := range []crypto.PublicKey{edKey.Public(), rsaKey.Public()} {
+		jwk, err := NewJWK("kid", publicKey)
+		if err != nil {
+			t.Fatalf("NewJWK: %v", err)
+		}
+		decoded, err := jwk.PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey: %v", err)
+		}
+		if !decoded.(interface{ Equal(crypto.PublicKey) bool }).Equal(publicKey) {
+			t.Fatalf("%s key did not survive the round trip", jwk.Kty)
+		}
+
+		algorithm, err := Algorithm(decoded)
+		if err != nil || algorithm != jwk.Alg {
+			t.Fatalf("Algorithm = %q, %v; want %q", algorithm, err, jwk.Alg)
+		}
+
+		thumbprint, err := Thumbprint(publicKey)
+		if err != nil {
+			t.Fatalf("Thumbprint: %v", err)
+		}
+		again, _ := Thumbprint(decoded)
+		if thumbprint == "" || thumbprint != again {
+			t.Fatalf("thumbprints %q and %q of the same key differ", thumbprint, again)
+		}
+	}
+
+	if _, err := (JWK{Kty: "EC"}).PublicKey(); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("EC key: got %v, want ErrUnsupportedKey", err)
+	}
+	if _, err := (JWK{Kty: "OKP", Crv: "Ed25519", X: "dG9vLXNob3J0"}).PublicKey(); err == nil {
+		t.Fatal("short Ed25519 key was accepted")
+	}
+}
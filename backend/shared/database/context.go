@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 )
 
 // TenantContext holds tenant-specific information for RLS
@@ -22,7 +23,7 @@ func SetTenantContext(ctx context.Context, db *sql.DB, tc TenantContext) error {
 
 	// Set customer ID
 	if tc.CustomerID > 0 {
-		_, err = conn.ExecContext(ctx, "SET LOCAL app.current_customer_id = $1", tc.CustomerID)
+		_, err = conn.ExecContext(ctx, "SELECT set_config('app.current_customer_id', $1, true)", strconv.FormatInt(tc.CustomerID, 10))
 		if err != nil {
 			return fmt.Errorf("failed to set customer_id: %w", err)
 		}
@@ -30,7 +31,7 @@ func SetTenantContext(ctx context.Context, db *sql.DB, tc TenantContext) error {
 
 	// Set user role
 	if tc.UserRole != "" {
-		_, err = conn.ExecContext(ctx, "SET LOCAL app.current_user_role = $1", tc.UserRole)
+		_, err = conn.ExecContext(ctx, "SELECT set_config('app.current_user_role', $1, true)", tc.UserRole)
 		if err != nil {
 			return fmt.Errorf("failed to set user_role: %w", err)
 		}
@@ -47,9 +48,10 @@ func WithTenantContext(ctx context.Context, db *sql.DB, tc TenantContext, fn fun
 	}
 	defer tx.Rollback()
 
-	// Set customer ID
+	// Set customer ID. SET does not accept bind parameters, so use set_config
+	// with is_local = true, which is equivalent to SET LOCAL.
 	if tc.CustomerID > 0 {
-		_, err = tx.ExecContext(ctx, "SET LOCAL app.current_customer_id = $1", tc.CustomerID)
+		_, err = tx.ExecContext(ctx, "SELECT set_config('app.current_customer_id', $1, true)", strconv.FormatInt(tc.CustomerID, 10))
 		if err != nil {
 			return fmt.Errorf("failed to set customer_id: %w", err)
 		}
@@ -57,7 +59,7 @@ func WithTenantContext(ctx context.Context, db *sql.DB, tc TenantContext, fn fun
 
 	// Set user role
 	if tc.UserRole != "" {
-		_, err = tx.ExecContext(ctx, "SET LOCAL app.current_user_role = $1", tc.UserRole)
+		_, err = tx.ExecContext(ctx, "SELECT set_config('app.current_user_role', $1, true)", tc.UserRole)
 		if err != nil {
 			return fmt.Errorf("failed to set user_role: %w", err)
 		}
@@ -3,6 +3,7 @@ module github.com/hosterizer/shared
 go 1.21
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/golang-migrate/migrate/v4 v4.17.0
 	github.com/lib/pq v1.10.9
 )
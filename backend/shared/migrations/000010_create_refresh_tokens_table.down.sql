@@ -0,0 +1,5 @@
+-- Drop refresh_tokens table and related objects
+DROP INDEX IF EXISTS idx_refresh_tokens_expires;
+DROP INDEX IF EXISTS idx_refresh_tokens_user;
+DROP INDEX IF EXISTS idx_refresh_tokens_family;
+DROP TABLE IF EXISTS refresh_tokens;
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- Create refresh_tokens table
+CREATE TABLE refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    jti UUID NOT NULL UNIQUE,
+    family_id UUID NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for refresh_tokens table
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_expires ON refresh_tokens(expires_at);
+-- Add comments to table
+COMMENT ON TABLE refresh_tokens IS 'Issued refresh tokens used for single-use rotation and reuse detection';
+COMMENT ON COLUMN refresh_tokens.jti IS 'JWT ID of the refresh token';
+COMMENT ON COLUMN refresh_tokens.family_id IS 'Token family shared by all tokens rotated from the same login';
+COMMENT ON COLUMN refresh_tokens.used_at IS 'Timestamp at which the token was exchanged for a new one';
+COMMENT ON COLUMN refresh_tokens.revoked_at IS 'Timestamp at which the token was revoked';
\ No newline at end of file
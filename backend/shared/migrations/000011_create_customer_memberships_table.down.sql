@@ -0,0 +1,9 @@
+-- Drop customer_memberships table and related objects
+DROP TRIGGER IF EXISTS customers_owner_membership ON customers;
+DROP FUNCTION IF EXISTS add_customer_owner_membership();
+DROP POLICY IF EXISTS admin_memberships_policy ON customer_memberships;
+DROP POLICY IF EXISTS customer_memberships_policy ON customer_memberships;
+DROP TRIGGER IF EXISTS customer_memberships_updated_at ON customer_memberships;
+DROP INDEX IF EXISTS idx_customer_memberships_customer_role;
+DROP INDEX IF EXISTS idx_customer_memberships_user;
+DROP TABLE IF EXISTS customer_memberships;
\ No newline at end of file
@@ -0,0 +1,45 @@
+-- Create customer_memberships table
+CREATE TABLE customer_memberships (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'developer', 'billing', 'read_only')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(customer_id, user_id)
+);
+-- Create indexes for customer_memberships table
+CREATE INDEX idx_customer_memberships_user ON customer_memberships(user_id);
+CREATE INDEX idx_customer_memberships_customer_role ON customer_memberships(customer_id, role);
+-- Create trigger to automatically update updated_at
+CREATE TRIGGER customer_memberships_updated_at BEFORE
+UPDATE ON customer_memberships FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+-- Backfill owner memberships for existing customers
+INSERT INTO customer_memberships (customer_id, user_id, role)
+SELECT id,
+    owner_user_id,
+    'owner'
+FROM customers ON CONFLICT (customer_id, user_id) DO NOTHING;
+-- Keep owner memberships in sync for newly created customers
+CREATE OR REPLACE FUNCTION add_customer_owner_membership() RETURNS TRIGGER AS $$ BEGIN
+INSERT INTO customer_memberships (customer_id, user_id, role)
+VALUES (NEW.id, NEW.owner_user_id, 'owner') ON CONFLICT (customer_id, user_id) DO NOTHING;
+RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER customers_owner_membership
+AFTER
+INSERT ON customers FOR EACH ROW EXECUTE FUNCTION add_customer_owner_membership();
+-- Enable RLS on customer_memberships table
+ALTER TABLE customer_memberships ENABLE ROW LEVEL SECURITY;
+CREATE POLICY customer_memberships_policy ON customer_memberships FOR ALL TO app_user USING (
+    customer_id = current_setting('app.current_customer_id', true)::BIGINT
+);
+CREATE POLICY admin_memberships_policy ON customer_memberships FOR ALL TO app_user USING (
+    current_setting('app.current_user_role', true) = 'administrator'
+);
+-- Add comments to table
+COMMENT ON TABLE customer_memberships IS 'Users that belong to a customer tenant and their per-tenant role';
+COMMENT ON COLUMN customer_memberships.role IS 'Tenant role: owner, developer, billing, or read_only';
+COMMENT ON POLICY customer_memberships_policy ON customer_memberships IS 'Customers can only access their own memberships';
+COMMENT ON POLICY admin_memberships_policy ON customer_memberships IS 'Administrators can access all memberships';
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- Remove TOTP replay protection column
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_last_used_step;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Track the last accepted TOTP time step to prevent code replay
+ALTER TABLE users
+ADD COLUMN mfa_last_used_step BIGINT;
+COMMENT ON COLUMN users.mfa_last_used_step IS 'Last accepted TOTP time step; codes for this or earlier steps are rejected';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Drop mfa_recovery_codes table and related objects
+DROP INDEX IF EXISTS idx_mfa_recovery_codes_user;
+DROP TABLE IF EXISTS mfa_recovery_codes;
\ No newline at end of file
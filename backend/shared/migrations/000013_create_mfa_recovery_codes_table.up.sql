@@ -0,0 +1,15 @@
+-- Create mfa_recovery_codes table
+CREATE TABLE mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(user_id, code_hash)
+);
+-- Create indexes for mfa_recovery_codes table
+CREATE INDEX idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+-- Add comments to table
+COMMENT ON TABLE mfa_recovery_codes IS 'Single-use MFA recovery codes, stored only as hashes';
+COMMENT ON COLUMN mfa_recovery_codes.code_hash IS 'Hex-encoded SHA-256 hash of the normalized recovery code';
+COMMENT ON COLUMN mfa_recovery_codes.used_at IS 'Timestamp at which the code was redeemed';
\ No newline at end of file
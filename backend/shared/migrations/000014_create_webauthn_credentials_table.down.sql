@@ -0,0 +1,3 @@
+-- Drop webauthn_credentials table and related objects
+DROP INDEX IF EXISTS idx_webauthn_credentials_user;
+DROP TABLE IF EXISTS webauthn_credentials;
\ No newline at end of file
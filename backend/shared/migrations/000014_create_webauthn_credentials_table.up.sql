@@ -0,0 +1,25 @@
+-- Create webauthn_credentials table
+CREATE TABLE webauthn_credentials (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+    aaguid BYTEA,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    backup_eligible BOOLEAN NOT NULL DEFAULT false,
+    backup_state BOOLEAN NOT NULL DEFAULT false,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for webauthn_credentials table
+CREATE INDEX idx_webauthn_credentials_user ON webauthn_credentials(user_id);
+-- Add comments to table
+COMMENT ON TABLE webauthn_credentials IS 'WebAuthn credentials (passkeys and security keys) registered by users';
+COMMENT ON COLUMN webauthn_credentials.credential_id IS 'Credential ID chosen by the authenticator';
+COMMENT ON COLUMN webauthn_credentials.public_key IS 'COSE-encoded credential public key';
+COMMENT ON COLUMN webauthn_credentials.sign_count IS 'Last signature counter reported by the authenticator, used to detect cloned authenticators';
+COMMENT ON COLUMN webauthn_credentials.backup_eligible IS 'Whether the credential may be synced between devices (passkey)';
+COMMENT ON COLUMN webauthn_credentials.name IS 'User-chosen label for the credential';
\ No newline at end of file
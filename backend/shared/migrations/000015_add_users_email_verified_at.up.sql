@@ -0,0 +1,4 @@
+-- Record when a user confirmed their email address
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMPTZ;
+COMMENT ON COLUMN users.email_verified_at IS 'Timestamp at which the user confirmed their email address; NULL while unverified';
\ No newline at end of file
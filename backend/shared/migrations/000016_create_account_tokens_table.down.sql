@@ -0,0 +1,4 @@
+-- Drop account_tokens table and related objects
+DROP INDEX IF EXISTS idx_account_tokens_expires_at;
+DROP INDEX IF EXISTS idx_account_tokens_user_purpose;
+DROP TABLE IF EXISTS account_tokens;
\ No newline at end of file
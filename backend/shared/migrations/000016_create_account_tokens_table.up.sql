@@ -0,0 +1,18 @@
+-- Create account_tokens table
+CREATE TABLE account_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for account_tokens table
+CREATE INDEX idx_account_tokens_user_purpose ON account_tokens(user_id, purpose);
+CREATE INDEX idx_account_tokens_expires_at ON account_tokens(expires_at);
+-- Add comments to table
+COMMENT ON TABLE account_tokens IS 'Single-use emailed tokens for password resets and email verification, stored only as hashes';
+COMMENT ON COLUMN account_tokens.purpose IS 'What the token may be used for: password_reset or email_verification';
+COMMENT ON COLUMN account_tokens.token_hash IS 'Hex-encoded SHA-256 hash of the token sent by email';
+COMMENT ON COLUMN account_tokens.used_at IS 'Timestamp at which the token was redeemed';
\ No newline at end of file
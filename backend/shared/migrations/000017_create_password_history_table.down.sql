@@ -0,0 +1,3 @@
+-- Drop password_history table and related objects
+DROP INDEX IF EXISTS idx_password_history_user_created;
+DROP TABLE IF EXISTS password_history;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Create password_history table
+CREATE TABLE password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for password_history table
+CREATE INDEX idx_password_history_user_created ON password_history(user_id, created_at DESC);
+-- Add comments to table
+COMMENT ON TABLE password_history IS 'Hashes of passwords users replaced, used to prevent password reuse';
+COMMENT ON COLUMN password_history.password_hash IS 'Hash of the replaced password';
+COMMENT ON COLUMN password_history.created_at IS 'Timestamp at which the password was replaced';
\ No newline at end of file
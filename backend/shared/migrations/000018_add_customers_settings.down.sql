@@ -0,0 +1,2 @@
+-- Remove customer settings column
+ALTER TABLE customers DROP COLUMN IF EXISTS settings;
\ No newline at end of file
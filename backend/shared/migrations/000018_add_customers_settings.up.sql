@@ -0,0 +1,4 @@
+-- Add customer settings, e.g. password policy overrides
+ALTER TABLE customers
+ADD COLUMN settings JSONB NOT NULL DEFAULT '{}'::jsonb;
+COMMENT ON COLUMN customers.settings IS 'Customer-specific settings, e.g. password_policy overrides (min_length, min_score, reject_breached, reject_similar)';
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Drop invitations table and related objects
+DROP INDEX IF EXISTS idx_invitations_open_email;
+DROP INDEX IF EXISTS idx_invitations_customer;
+DROP TABLE IF EXISTS invitations;
\ No newline at end of file
@@ -0,0 +1,27 @@
+-- Create invitations table
+CREATE TABLE invitations (
+    id BIGSERIAL PRIMARY KEY,
+    uuid UUID DEFAULT gen_random_uuid() UNIQUE NOT NULL,
+    customer_id BIGINT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'developer', 'billing', 'read_only')),
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    accepted_user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for invitations table
+CREATE INDEX idx_invitations_customer ON invitations(customer_id, created_at);
+-- At most one open invitation per customer and address
+CREATE UNIQUE INDEX idx_invitations_open_email ON invitations(customer_id, LOWER(email))
+WHERE accepted_at IS NULL
+    AND revoked_at IS NULL;
+-- Add comments to table
+COMMENT ON TABLE invitations IS 'Invitations for new users to join a customer tenant, accepted through a signed, expiring link';
+COMMENT ON COLUMN invitations.uuid IS 'Public invitation ID, carried as the jti of the signed invitation link';
+COMMENT ON COLUMN invitations.role IS 'Membership role the invited user receives: owner, developer, billing or read_only';
+COMMENT ON COLUMN invitations.invited_by IS 'User who sent the invitation';
+COMMENT ON COLUMN invitations.accepted_user_id IS 'User created when the invitation was accepted';
+COMMENT ON COLUMN invitations.revoked_at IS 'Timestamp at which the invitation was revoked';
\ No newline at end of file
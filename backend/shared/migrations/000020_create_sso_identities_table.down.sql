@@ -0,0 +1,4 @@
+-- Drop sso_identities table and related objects
+COMMENT ON COLUMN customers.settings IS 'Customer-specific settings, e.g. password_policy overrides (min_length, min_score, reject_breached, reject_similar)';
+DROP INDEX IF EXISTS idx_sso_identities_user;
+DROP TABLE IF EXISTS sso_identities;
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- Create sso_identities table
+CREATE TABLE sso_identities (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE(customer_id, subject)
+);
+-- Create indexes for sso_identities table
+CREATE INDEX idx_sso_identities_user ON sso_identities(user_id);
+-- Add comments to table
+COMMENT ON TABLE sso_identities IS 'Links subjects at customer identity providers to users';
+COMMENT ON COLUMN sso_identities.subject IS 'Stable user identifier at the identity provider: the OIDC sub claim or the SAML NameID';
+COMMENT ON COLUMN customers.settings IS 'Customer-specific settings, e.g. password_policy overrides (min_length, min_score, reject_breached, reject_similar) and sso (protocol, enforced, default_role, allowed_domains, oidc, saml)';
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Drop api_keys table and related objects
+DROP INDEX IF EXISTS idx_api_keys_customer;
+DROP INDEX IF EXISTS idx_api_keys_user;
+DROP TABLE IF EXISTS api_keys;
\ No newline at end of file
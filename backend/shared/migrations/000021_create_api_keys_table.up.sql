@@ -0,0 +1,32 @@
+-- Create api_keys table
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    uuid UUID DEFAULT gen_random_uuid() UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    customer_id BIGINT REFERENCES customers(id) ON DELETE CASCADE,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (user_id IS NOT NULL OR customer_id IS NOT NULL)
+);
+-- Create indexes for api_keys table
+CREATE INDEX idx_api_keys_user ON api_keys(user_id, created_at)
+WHERE user_id IS NOT NULL;
+CREATE INDEX idx_api_keys_customer ON api_keys(customer_id, created_at)
+WHERE customer_id IS NOT NULL;
+-- Add comments to table
+COMMENT ON TABLE api_keys IS 'Long-lived, scoped API keys: personal access tokens of a user and service keys of a customer';
+COMMENT ON COLUMN api_keys.key_prefix IS 'First characters of the key, shown to tell keys apart; the key itself is shown once';
+COMMENT ON COLUMN api_keys.key_hash IS 'SHA-256 hash of the key';
+COMMENT ON COLUMN api_keys.user_id IS 'User a personal access token acts as; NULL for service keys';
+COMMENT ON COLUMN api_keys.customer_id IS 'Customer the key is scoped to; NULL for personal access tokens of administrators';
+COMMENT ON COLUMN api_keys.created_by IS 'User who created the key';
+COMMENT ON COLUMN api_keys.scopes IS 'Scopes the key is limited to, e.g. sites:read or deployments:write';
+COMMENT ON COLUMN api_keys.last_used_at IS 'Timestamp at which the key was last accepted, updated at most once a minute';
+COMMENT ON COLUMN api_keys.revoked_at IS 'Timestamp at which the key was revoked';
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- Drop session store tables and related objects
+DROP INDEX IF EXISTS idx_session_events_expires_at;
+DROP INDEX IF EXISTS idx_session_events_key;
+DROP INDEX IF EXISTS idx_session_values_expires_at;
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_user;
+DROP TABLE IF EXISTS session_events;
+DROP TABLE IF EXISTS session_values;
+DROP TABLE IF EXISTS sessions;
\ No newline at end of file
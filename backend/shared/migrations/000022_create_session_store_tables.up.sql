@@ -0,0 +1,32 @@
+-- Create session store tables, used by the auth service when it keeps sessions
+-- in PostgreSQL instead of Redis. Rows past expires_at are ignored and purged.
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    data JSONB NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE session_values (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE session_events (
+    id BIGSERIAL PRIMARY KEY,
+    key TEXT NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+-- Create indexes for session store tables
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
+CREATE INDEX idx_session_values_expires_at ON session_values(expires_at);
+CREATE INDEX idx_session_events_key ON session_events(key, occurred_at);
+CREATE INDEX idx_session_events_expires_at ON session_events(expires_at);
+-- Add comments to tables
+COMMENT ON TABLE sessions IS 'Login sessions of the auth service, one per refresh token family';
+COMMENT ON COLUMN sessions.data IS 'Session data: user, active customer, client and last access';
+COMMENT ON COLUMN sessions.expires_at IS 'Timestamp at which the session idles out unless it is used again';
+COMMENT ON TABLE session_values IS 'Short-lived auth service state: token denylist, pending WebAuthn and SSO logins, MFA attempt counters';
+COMMENT ON COLUMN session_values.key IS 'Namespaced key, e.g. denylist:<token id>';
+COMMENT ON TABLE session_events IS 'Timestamps of recent events in sliding windows, e.g. failed logins per email and IP address';
\ No newline at end of file
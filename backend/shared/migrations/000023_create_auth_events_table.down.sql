@@ -0,0 +1,8 @@
+-- Drop auth_events table and related objects
+DROP TRIGGER IF EXISTS auth_events_append_only ON auth_events;
+DROP FUNCTION IF EXISTS prevent_auth_event_changes();
+DROP INDEX IF EXISTS idx_auth_events_occurred_at;
+DROP INDEX IF EXISTS idx_auth_events_type;
+DROP INDEX IF EXISTS idx_auth_events_customer;
+DROP INDEX IF EXISTS idx_auth_events_user;
+DROP TABLE IF EXISTS auth_events;
\ No newline at end of file
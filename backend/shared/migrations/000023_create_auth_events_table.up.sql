@@ -0,0 +1,38 @@
+-- Create auth_events table
+CREATE TABLE auth_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+    user_id BIGINT,
+    actor_id BIGINT,
+    customer_id BIGINT,
+    email TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for auth_events table
+CREATE INDEX idx_auth_events_user ON auth_events(user_id, id)
+WHERE user_id IS NOT NULL;
+CREATE INDEX idx_auth_events_customer ON auth_events(customer_id, id)
+WHERE customer_id IS NOT NULL;
+CREATE INDEX idx_auth_events_type ON auth_events(event_type, id);
+CREATE INDEX idx_auth_events_occurred_at ON auth_events(occurred_at);
+-- Keep auth_events append-only
+CREATE OR REPLACE FUNCTION prevent_auth_event_changes() RETURNS TRIGGER AS $$ BEGIN
+RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER auth_events_append_only BEFORE
+UPDATE
+    OR DELETE ON auth_events FOR EACH ROW EXECUTE FUNCTION prevent_auth_event_changes();
+-- Add comments to table
+COMMENT ON TABLE auth_events IS 'Append-only log of authentication events: logins, failed attempts, lockouts, MFA changes and token refreshes';
+COMMENT ON COLUMN auth_events.event_type IS 'Kind of event, e.g. login, token_refresh or account_locked';
+COMMENT ON COLUMN auth_events.outcome IS 'Whether the attempt succeeded: success or failure';
+COMMENT ON COLUMN auth_events.user_id IS 'User the event is about; NULL when no user matched. Not a foreign key, so events outlive deleted users';
+COMMENT ON COLUMN auth_events.actor_id IS 'User who caused the event when it was not the user themselves, e.g. an administrator';
+COMMENT ON COLUMN auth_events.customer_id IS 'Customer tenant the event happened in; NULL before a tenant is known';
+COMMENT ON COLUMN auth_events.email IS 'Email address given or of the user, kept for attempts against unknown addresses';
+COMMENT ON COLUMN auth_events.reason IS 'Why an attempt failed, or details of the event';
\ No newline at end of file
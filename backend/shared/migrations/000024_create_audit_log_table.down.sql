@@ -0,0 +1,12 @@
+-- Drop audit_log table and related objects
+DROP POLICY IF EXISTS admin_audit_log_policy ON audit_log;
+DROP POLICY IF EXISTS audit_log_insert_policy ON audit_log;
+DROP POLICY IF EXISTS audit_log_select_policy ON audit_log;
+DROP TRIGGER IF EXISTS audit_log_immutable ON audit_log;
+DROP FUNCTION IF EXISTS prevent_audit_log_updates();
+DROP INDEX IF EXISTS idx_audit_log_occurred_at;
+DROP INDEX IF EXISTS idx_audit_log_request;
+DROP INDEX IF EXISTS idx_audit_log_actor;
+DROP INDEX IF EXISTS idx_audit_log_resource;
+DROP INDEX IF EXISTS idx_audit_log_customer;
+DROP TABLE IF EXISTS audit_log;
\ No newline at end of file
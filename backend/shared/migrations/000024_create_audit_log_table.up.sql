@@ -0,0 +1,58 @@
+-- Create audit_log table
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT,
+    api_key_id TEXT NOT NULL DEFAULT '',
+    customer_id BIGINT,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    before JSONB,
+    after JSONB,
+    request_id TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Create indexes for audit_log table
+CREATE INDEX idx_audit_log_customer ON audit_log(customer_id, id)
+WHERE customer_id IS NOT NULL;
+CREATE INDEX idx_audit_log_resource ON audit_log(resource_type, resource_id, id);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_id, id)
+WHERE actor_id IS NOT NULL;
+CREATE INDEX idx_audit_log_request ON audit_log(request_id)
+WHERE request_id <> '';
+CREATE INDEX idx_audit_log_occurred_at ON audit_log(occurred_at);
+-- Entries are never changed; only the retention job deletes them
+CREATE OR REPLACE FUNCTION prevent_audit_log_updates() RETURNS TRIGGER AS $$ BEGIN
+RAISE EXCEPTION 'audit_log entries cannot be changed';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_log_immutable BEFORE
+UPDATE ON audit_log FOR EACH ROW EXECUTE FUNCTION prevent_audit_log_updates();
+-- Enable RLS on audit_log table. Customers may read and append their own
+-- entries but not delete them, so there is no FOR ALL policy for them.
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+CREATE POLICY audit_log_select_policy ON audit_log FOR
+SELECT TO app_user USING (
+        customer_id = current_setting('app.current_customer_id', true)::BIGINT
+    );
+CREATE POLICY audit_log_insert_policy ON audit_log FOR
+INSERT TO app_user WITH CHECK (
+        customer_id = current_setting('app.current_customer_id', true)::BIGINT
+    );
+CREATE POLICY admin_audit_log_policy ON audit_log FOR ALL TO app_user USING (
+    current_setting('app.current_user_role', true) = 'administrator'
+);
+-- Add comments to table
+COMMENT ON TABLE audit_log IS 'Trail of tenant-mutating operations across all services, kept for the audit retention period (90 days by default)';
+COMMENT ON COLUMN audit_log.actor_id IS 'User who made the change; NULL for service keys and background jobs. Not a foreign key, so entries outlive deleted users';
+COMMENT ON COLUMN audit_log.api_key_id IS 'API key the change was made with, if any';
+COMMENT ON COLUMN audit_log.customer_id IS 'Customer tenant the resource belongs to; NULL for platform-wide resources';
+COMMENT ON COLUMN audit_log.resource_type IS 'Kind of resource changed, e.g. site, deployment or policy';
+COMMENT ON COLUMN audit_log.resource_id IS 'Identifier of the resource changed';
+COMMENT ON COLUMN audit_log.action IS 'Change made: create, update, or delete';
+COMMENT ON COLUMN audit_log.before IS 'Fields that changed, with their values before the change; NULL on create';
+COMMENT ON COLUMN audit_log.after IS 'Fields that changed, with their values after the change; NULL on delete';
+COMMENT ON COLUMN audit_log.request_id IS 'ID of the request that made the change, to correlate entries and logs';
+COMMENT ON POLICY audit_log_select_policy ON audit_log IS 'Customers can only read their own audit entries';
+COMMENT ON POLICY audit_log_insert_policy ON audit_log IS 'Customers can only append audit entries for their own tenant';
+COMMENT ON POLICY admin_audit_log_policy ON audit_log IS 'Administrators can access and purge all audit entries';
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Move OIDC client secrets back into customers.settings
+UPDATE customers c
+SET settings = jsonb_set(
+        c.settings,
+        '{sso,oidc,client_secret}',
+        to_jsonb(s.oidc_client_secret)
+    )
+FROM customer_sso_secrets s
+WHERE s.customer_id = c.id
+    AND c.settings->'sso'->'oidc' IS NOT NULL;
+-- Drop customer_sso_secrets table and related objects
+DROP POLICY IF EXISTS admin_sso_secrets_policy ON customer_sso_secrets;
+DROP TABLE IF EXISTS customer_sso_secrets;
\ No newline at end of file
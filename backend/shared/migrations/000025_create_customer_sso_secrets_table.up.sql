@@ -0,0 +1,26 @@
+-- Create customer_sso_secrets table
+CREATE TABLE customer_sso_secrets (
+    customer_id BIGINT PRIMARY KEY REFERENCES customers(id) ON DELETE CASCADE,
+    oidc_client_secret TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Move OIDC client secrets out of the settings customers can read
+INSERT INTO customer_sso_secrets (customer_id, oidc_client_secret)
+SELECT id,
+    settings->'sso'->'oidc'->>'client_secret'
+FROM customers
+WHERE settings->'sso'->'oidc'->>'client_secret' IS NOT NULL;
+UPDATE customers
+SET settings = settings #- '{sso,oidc,client_secret}'
+WHERE settings->'sso'->'oidc' ? 'client_secret';
+-- Enable RLS on customer_sso_secrets table. There is no customer policy, so only
+-- administrators and roles that bypass RLS, like the auth service's, can read secrets.
+ALTER TABLE customer_sso_secrets ENABLE ROW LEVEL SECURITY;
+CREATE POLICY admin_sso_secrets_policy ON customer_sso_secrets FOR ALL TO app_user USING (
+    current_setting('app.current_user_role', true) = 'administrator'
+);
+-- Add comments to table
+COMMENT ON TABLE customer_sso_secrets IS 'Credentials of customer identity providers, kept apart from customers.settings so that customers cannot read them';
+COMMENT ON COLUMN customer_sso_secrets.oidc_client_secret IS 'Client secret registered with the customer''s OpenID Connect provider';
+COMMENT ON POLICY admin_sso_secrets_policy ON customer_sso_secrets IS 'Only administrators can access identity provider secrets';
\ No newline at end of file
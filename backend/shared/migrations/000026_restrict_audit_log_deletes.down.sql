@@ -0,0 +1,8 @@
+-- Drop the purge function and restore the administrator policy
+DROP FUNCTION IF EXISTS purge_audit_log(INTERVAL);
+DROP POLICY IF EXISTS admin_audit_log_insert_policy ON audit_log;
+DROP POLICY IF EXISTS admin_audit_log_select_policy ON audit_log;
+CREATE POLICY admin_audit_log_policy ON audit_log FOR ALL TO app_user USING (
+    current_setting('app.current_user_role', true) = 'administrator'
+);
+COMMENT ON POLICY admin_audit_log_policy ON audit_log IS 'Administrators can access and purge all audit entries';
\ No newline at end of file
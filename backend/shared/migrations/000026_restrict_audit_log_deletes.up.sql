@@ -0,0 +1,33 @@
+-- Administrators may read and append audit entries but no longer delete them.
+-- Expired entries are deleted by purge_audit_log only.
+DROP POLICY admin_audit_log_policy ON audit_log;
+CREATE POLICY admin_audit_log_select_policy ON audit_log FOR
+SELECT TO app_user USING (
+        current_setting('app.current_user_role', true) = 'administrator'
+    );
+CREATE POLICY admin_audit_log_insert_policy ON audit_log FOR
+INSERT TO app_user WITH CHECK (
+        current_setting('app.current_user_role', true) = 'administrator'
+    );
+-- Purge entries older than the retention period. The function runs as the table
+-- owner, which RLS does not apply to, and refuses periods shorter than 90 days,
+-- so callers can only delete entries that have expired.
+CREATE OR REPLACE FUNCTION purge_audit_log(retention INTERVAL) RETURNS BIGINT AS $$
+DECLARE purged BIGINT;
+BEGIN IF retention < INTERVAL '90 days' THEN RAISE EXCEPTION 'audit retention must be at least 90 days';
+END IF;
+DELETE FROM audit_log
+WHERE occurred_at < NOW() - retention;
+GET DIAGNOSTICS purged = ROW_COUNT;
+RETURN purged;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER
+SET search_path = pg_catalog,
+    public;
+REVOKE ALL ON FUNCTION purge_audit_log(INTERVAL)
+FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION purge_audit_log(INTERVAL) TO app_user;
+-- Add comments
+COMMENT ON FUNCTION purge_audit_log(INTERVAL) IS 'Deletes audit entries older than the retention period, which must be at least 90 days';
+COMMENT ON POLICY admin_audit_log_select_policy ON audit_log IS 'Administrators can read all audit entries';
+COMMENT ON POLICY admin_audit_log_insert_policy ON audit_log IS 'Administrators can append audit entries for any tenant';
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Disable RLS on auth_events table
+DROP POLICY IF EXISTS admin_auth_events_policy ON auth_events;
+DROP POLICY IF EXISTS customer_auth_events_policy ON auth_events;
+ALTER TABLE auth_events DISABLE ROW LEVEL SECURITY;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- Enable RLS on auth_events table. Events are recorded by the auth service,
+-- whose role bypasses RLS, so customers and administrators may only read them.
+ALTER TABLE auth_events ENABLE ROW LEVEL SECURITY;
+-- Customers see the events in their tenant and the events of their members
+-- outside any tenant, such as failed logins
+CREATE POLICY customer_auth_events_policy ON auth_events FOR
+SELECT TO app_user USING (
+        customer_id = current_setting('app.current_customer_id', true)::BIGINT
+        OR (
+            customer_id IS NULL
+            AND user_id IN (
+                SELECT user_id
+                FROM customer_memberships
+                WHERE customer_id = current_setting('app.current_customer_id', true)::BIGINT
+            )
+        )
+    );
+CREATE POLICY admin_auth_events_policy ON auth_events FOR
+SELECT TO app_user USING (
+        current_setting('app.current_user_role', true) = 'administrator'
+    );
+-- Add comments to policies
+COMMENT ON POLICY customer_auth_events_policy ON auth_events IS 'Customers can only read the events of their tenant and of their members outside any tenant';
+COMMENT ON POLICY admin_auth_events_policy ON auth_events IS 'Administrators can read all authentication events';
\ No newline at end of file